@@ -0,0 +1,191 @@
+package mhttp
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Accept is the parsed representation of an HTTP [Accept] header.
+//
+// [Accept]: https://httpwg.org/specs/rfc9110.html#field.accept
+type Accept struct {
+	ranges []MediaRange // nil if not present
+}
+
+// A MediaRange is a single element of an Accept header.
+type MediaRange struct {
+	// Type is the media range, for example "text/html", "text/*", or "*/*".
+	// The type and subtype are normalized to lower case.
+	Type string
+
+	// Params are the media type parameters of the range, not including the
+	// weight. Parameter names are normalized to lower case.
+	Params map[string]string
+
+	// Quality is the weight assigned to the range, between 0 and 1.
+	// If the range does not specify a weight, the default is 1.
+	Quality float64
+}
+
+// specificity reports the precedence of r when more than one range matches
+// a media type. More specific ranges have higher values.
+func (r MediaRange) specificity() int {
+	switch {
+	case r.Type == "*/*":
+		return 0
+	case strings.HasSuffix(r.Type, "/*"):
+		return 1
+	default:
+		return 2 + len(r.Params)
+	}
+}
+
+// matches reports whether r matches the given media type and parameters.
+func (r MediaRange) matches(mtype string, params map[string]string) bool {
+	if r.Type != "*/*" {
+		if pfx, ok := strings.CutSuffix(r.Type, "*"); ok {
+			if !strings.HasPrefix(mtype, pfx) {
+				return false
+			}
+		} else if mtype != r.Type {
+			return false
+		}
+	}
+	for name, val := range r.Params {
+		if !strings.EqualFold(params[name], val) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAcceptHeader parses the contents of an HTTP Accept header and returns
+// an [Accept]. If the header is empty it returns an Accept that accepts all
+// media types. Use [Accept.IsPresent] to check for this case. An error is
+// only reported if the header is present but invalid.
+func ParseAcceptHeader(s string) (Accept, error) {
+	if strings.TrimSpace(s) == "" {
+		return Accept{}, nil // not present
+	}
+	out := []MediaRange{}
+	for _, elt := range splitList(s) {
+		mtype, params, err := parseMediaType(elt)
+		if err != nil {
+			return Accept{}, fmt.Errorf("invalid media range %q: %w", elt, err)
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			q, err = parseQValue(qs)
+			if err != nil {
+				return Accept{}, fmt.Errorf("invalid weight in %q: %w", elt, err)
+			}
+			delete(params, "q")
+		}
+		if len(params) == 0 {
+			params = nil
+		}
+		out = append(out, MediaRange{Type: mtype, Params: params, Quality: q})
+	}
+	return Accept{ranges: out}, nil
+}
+
+// IsPresent reports whether an Accept header was present at the time of
+// parsing.
+func (a Accept) IsPresent() bool { return a.ranges != nil }
+
+// Ranges returns the media ranges of a in the order they were specified.
+// The caller should not modify the contents of the slice.
+func (a Accept) Ranges() []MediaRange { return a.ranges }
+
+// Quality reports the weight a assigns to the specified media type, which may
+// include parameters (for example "text/html; charset=utf-8"). The weight is
+// taken from the most specific media range that matches the type. If no range
+// matches, the weight is 0. If a is not present, the weight is always 1.
+func (a Accept) Quality(mediaType string) float64 {
+	q, _ := a.quality(mediaType)
+	return q
+}
+
+// quality reports the weight of mediaType, and the specificity of the range
+// from which the weight was taken. It reports -1 if mediaType is invalid.
+func (a Accept) quality(mediaType string) (float64, int) {
+	mtype, params, err := parseMediaType(mediaType)
+	if err != nil || strings.Contains(mtype, "*") {
+		return 0, -1
+	} else if !a.IsPresent() {
+		return 1, 0
+	}
+	q, spec := 0.0, -1
+	for _, r := range a.ranges {
+		if s := r.specificity(); s > spec && r.matches(mtype, params) {
+			q, spec = r.Quality, s
+		}
+	}
+	return q, spec
+}
+
+// Negotiate selects the offered media type most preferred by a, following
+// the rules of [RFC 9110 Section 12.5.1]. Offers may include parameters, for
+// example "text/html; charset=utf-8". Offers that are not valid media types
+// are never selected.
+//
+// Each offer is weighted by the most specific media range that matches it.
+// The offer with the highest non-zero weight is selected. If multiple offers
+// have the same weight, the one matched by the most specific range wins; and
+// among those, the offer listed earliest wins, so offers should be given in
+// order of server preference. If a is not present, the first valid offer is
+// selected.
+//
+// If no offer is acceptable, Negotiate returns "", false. The caller should
+// typically respond with status 406 (Not Acceptable) in this case, or else
+// disregard the header and send a default representation.
+//
+// [RFC 9110 Section 12.5.1]: https://httpwg.org/specs/rfc9110.html#field.accept
+func (a Accept) Negotiate(offers ...string) (string, bool) {
+	var best string
+	bestQ, bestSpec := 0.0, -1
+	for _, offer := range offers {
+		q, spec := a.quality(offer)
+		if spec < 0 || q == 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && spec > bestSpec) {
+			best, bestQ, bestSpec = offer, q, spec
+		}
+	}
+	return best, bestQ > 0
+}
+
+// parseMediaType parses s as a media type or media range with optional
+// parameters, as [mime.ParseMediaType], but additionally requires that the
+// type have the form "type/subtype".
+func parseMediaType(s string) (string, map[string]string, error) {
+	mtype, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return "", nil, err
+	}
+	typ, sub, ok := strings.Cut(mtype, "/")
+	if !ok || typ == "" || sub == "" || (typ == "*" && sub != "*") {
+		return "", nil, errors.New("missing or invalid subtype")
+	}
+	return mtype, params, nil
+}
+
+// parseQValue parses a weight value as defined by RFC 9110 Section 12.4.2.
+// A weight is a decimal value between 0 and 1 with at most three digits
+// after the decimal point.
+func parseQValue(s string) (float64, error) {
+	ipart, frac, hasDot := strings.Cut(s, ".")
+	if (ipart != "0" && ipart != "1") || len(frac) > 3 || strings.TrimLeft(frac, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid weight %q", s)
+	} else if ipart == "1" && strings.Trim(frac, "0") != "" {
+		return 0, fmt.Errorf("weight %q out of range", s)
+	}
+	if !hasDot || frac == "" {
+		return float64(ipart[0] - '0'), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
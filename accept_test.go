@@ -0,0 +1,118 @@
+package mhttp_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAcceptHeader(t *testing.T) {
+	a, err := mhttp.ParseAcceptHeader(`text/html, application/xhtml+xml;q=0.9, TEXT/Plain; Format=flowed; q=0.5, */*;q=0.1, text/x-q; note="a, b"`)
+	if err != nil {
+		t.Fatalf("ParseAcceptHeader: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(a.Ranges(), []mhttp.MediaRange{
+		{Type: "text/html", Quality: 1},
+		{Type: "application/xhtml+xml", Quality: 0.9},
+		{Type: "text/plain", Params: map[string]string{"format": "flowed"}, Quality: 0.5},
+		{Type: "*/*", Quality: 0.1},
+		{Type: "text/x-q", Params: map[string]string{"note": "a, b"}, Quality: 1},
+	}); diff != "" {
+		t.Errorf("Ranges (-got, +want):\n%s", diff)
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		a, err := mhttp.ParseAcceptHeader("")
+		if err != nil {
+			t.Fatalf("ParseAcceptHeader: unexpected error: %v", err)
+		}
+		if a.IsPresent() {
+			t.Error("IsPresent: got true, want false")
+		}
+		if got := a.Quality("image/png"); got != 1 {
+			t.Errorf("Quality: got %v, want 1", got)
+		}
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{"text", "invalid media range"},
+			{"*/html", "invalid media range"},
+			{"text/html;q=2", "invalid weight"},
+			{"text/html;q=1.5", "out of range"},
+			{"text/html;q=0.1234", "invalid weight"},
+			{"text/html;q=-1", "invalid weight"},
+			{"text/html;q=", "invalid"},
+			{"text/html; level", "invalid media range"},
+		}
+		for _, tc := range tests {
+			a, err := mhttp.ParseAcceptHeader(tc.input)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ParseAcceptHeader(%q): got (%+v, %v), want error %q", tc.input, a, err, tc.want)
+			}
+		}
+	})
+}
+
+func TestAcceptQuality(t *testing.T) {
+	// This example is from RFC 9110 Section 12.5.1.
+	a, err := mhttp.ParseAcceptHeader("text/*;q=0.3, text/plain;q=0.7, text/plain;format=flowed, text/plain;format=fixed;q=0.4, */*;q=0.5")
+	if err != nil {
+		t.Fatalf("ParseAcceptHeader: unexpected error: %v", err)
+	}
+	tests := []struct {
+		mtype string
+		want  float64
+	}{
+		{"text/plain;format=flowed", 1},
+		{"text/plain", 0.7},
+		{"text/html", 0.3},
+		{"image/jpeg", 0.5},
+		{"text/plain;format=fixed", 0.4},
+		{"text/html;level=3", 0.3},
+		{"bogus", 0},
+	}
+	for _, tc := range tests {
+		if got := a.Quality(tc.mtype); got != tc.want {
+			t.Errorf("Quality(%q): got %v, want %v", tc.mtype, got, tc.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "application/cbor", "text/html; charset=utf-8"}
+	tests := []struct {
+		header string
+		offers []string
+		want   string // "" means not acceptable
+	}{
+		{"", offers, "application/json"},
+		{"*/*", offers, "application/json"},
+		{"text/html", offers, "text/html; charset=utf-8"},
+		{"application/cbor, application/json;q=0.9", offers, "application/cbor"},
+		{"application/*;q=0.5, text/html;q=0.5", offers, "text/html; charset=utf-8"},
+		{"application/*", offers, "application/json"},
+		{"*/*;q=0.1, application/cbor;q=0.1", offers, "application/cbor"},
+		{"text/html;charset=UTF-8", offers, "text/html; charset=utf-8"},
+		{"text/html;charset=latin1", offers, ""},
+		{"image/png", offers, ""},
+		{"*/*;q=0", offers, ""},
+		{"application/json;q=0, */*", offers, "application/cbor"},
+		{"text/*", []string{"bogus", "text/plain"}, "text/plain"},
+		{"*/*", nil, ""},
+	}
+	for _, tc := range tests {
+		a, err := mhttp.ParseAcceptHeader(tc.header)
+		if err != nil {
+			t.Fatalf("ParseAcceptHeader(%q): unexpected error: %v", tc.header, err)
+		}
+		got, ok := a.Negotiate(tc.offers...)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("Negotiate(%q, %q): got (%q, %v), want %q", tc.header, tc.offers, got, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package mhttp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Challenge is an authentication challenge from a WWW-Authenticate or
+// Proxy-Authenticate header (RFC 9110 Section 11.3).
+type Challenge struct {
+	// Scheme is the authentication scheme, for example "Basic". Schemes are
+	// case-insensitive.
+	Scheme string
+
+	// Token68 is the token68 form of the challenge data, if any.
+	// A challenge has either a Token68 or Params, not both.
+	Token68 string
+
+	// Params are the auth-params of the challenge, keyed by lower-case name.
+	Params map[string]string
+}
+
+// String renders c as a challenge for a WWW-Authenticate header. Parameters
+// are written in order by name, and their values are quoted, except for the
+// Digest parameters algorithm and stale, which are written as tokens.
+func (c Challenge) String() string {
+	return formatAuth(c.Scheme, c.Token68, c.Params, challengeTokenParams)
+}
+
+// FormatChallenges renders the contents of a WWW-Authenticate header for the
+// given challenges.
+func FormatChallenges(cs ...Challenge) string {
+	ss := make([]string, len(cs))
+	for i, c := range cs {
+		ss[i] = c.String()
+	}
+	return strings.Join(ss, ", ")
+}
+
+// Credentials are the authentication credentials from an Authorization or
+// Proxy-Authorization header (RFC 9110 Section 11.4).
+type Credentials struct {
+	// Scheme is the authentication scheme, for example "Basic". Schemes are
+	// case-insensitive.
+	Scheme string
+
+	// Token68 is the token68 form of the credentials, if any.
+	// Credentials have either a Token68 or Params, not both.
+	Token68 string
+
+	// Params are the auth-params of the credentials, keyed by lower-case name.
+	Params map[string]string
+}
+
+// String renders c as the contents of an Authorization header. Parameters
+// are written in order by name, and their values are quoted, except for the
+// Digest parameters algorithm, nc, qop, and userhash, which are written as
+// tokens.
+func (c Credentials) String() string {
+	return formatAuth(c.Scheme, c.Token68, c.Params, credentialTokenParams)
+}
+
+// These parameters are written as tokens rather than quoted strings, as RFC
+// 7616 requires.
+var (
+	challengeTokenParams  = []string{"algorithm", "stale", "userhash"}
+	credentialTokenParams = []string{"algorithm", "nc", "qop", "userhash"}
+)
+
+func formatAuth(scheme, token68 string, params map[string]string, tokens []string) string {
+	if token68 != "" {
+		return scheme + " " + token68
+	}
+	ps := make([]string, 0, len(params))
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		v := params[name]
+		if slices.Contains(tokens, name) && isToken(v) {
+			ps = append(ps, name+"="+v)
+		} else {
+			ps = append(ps, name+"="+quoteString(v))
+		}
+	}
+	if len(ps) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(ps, ", ")
+}
+
+// ParseWWWAuthenticateHeader parses the contents of a WWW-Authenticate or
+// Proxy-Authenticate header, which may contain multiple challenges. If a
+// response has multiple header lines, the caller should join them with commas
+// before parsing. An empty header yields no challenges without error.
+func ParseWWWAuthenticateHeader(s string) ([]Challenge, error) {
+	var out []Challenge
+	for _, elt := range splitList(s) {
+		word, rest, _ := strings.Cut(elt, " ")
+		rest = strings.TrimSpace(rest)
+
+		// An element is an auth-param of the current challenge if it has the
+		// form name=value, allowing whitespace around the "=". Otherwise, it
+		// begins a new challenge.
+		if strings.Contains(word, "=") || strings.HasPrefix(rest, "=") {
+			if len(out) == 0 {
+				return nil, fmt.Errorf("parameter %q without a challenge", elt)
+			}
+			cur := &out[len(out)-1]
+			if cur.Token68 != "" {
+				return nil, fmt.Errorf("parameter %q after token68", elt)
+			}
+			if err := addAuthParam(&cur.Params, elt); err != nil {
+				return nil, fmt.Errorf("challenge %d: %w", len(out), err)
+			}
+			continue
+		}
+		if !isToken(word) {
+			return nil, fmt.Errorf("invalid auth scheme %q", word)
+		}
+		c := Challenge{Scheme: word}
+		if isToken68(rest) {
+			c.Token68 = rest
+		} else if rest != "" {
+			if err := addAuthParam(&c.Params, rest); err != nil {
+				return nil, fmt.Errorf("challenge %d: %w", len(out)+1, err)
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// ParseAuthorizationHeader parses the contents of an Authorization or
+// Proxy-Authorization header.
+func ParseAuthorizationHeader(s string) (Credentials, error) {
+	s = strings.TrimSpace(s)
+	scheme, rest, _ := strings.Cut(s, " ")
+	if !isToken(scheme) {
+		return Credentials{}, fmt.Errorf("invalid auth scheme %q", scheme)
+	}
+	out := Credentials{Scheme: scheme}
+	if rest = strings.TrimSpace(rest); isToken68(rest) {
+		out.Token68 = rest
+		return out, nil
+	}
+	for _, elt := range splitList(rest) {
+		if err := addAuthParam(&out.Params, elt); err != nil {
+			return Credentials{}, err
+		}
+	}
+	return out, nil
+}
+
+// addAuthParam parses s as an auth-param and adds it to *params, which is
+// allocated if necessary. Per RFC 9110, a parameter name may occur only once.
+func addAuthParam(params *map[string]string, s string) error {
+	name, value, hasValue, err := parseParam(s)
+	if err != nil {
+		return err
+	} else if !hasValue {
+		return fmt.Errorf("missing value for %q", name)
+	}
+	if *params == nil {
+		*params = make(map[string]string)
+	} else if _, ok := (*params)[name]; ok {
+		return fmt.Errorf("duplicate parameter %q", name)
+	}
+	(*params)[name] = value
+	return nil
+}
+
+// isToken68 reports whether s is a token68 as defined by RFC 9110:
+// one or more of ALPHA, DIGIT, "-", ".", "_", "~", "+", "/", followed by
+// zero or more "=".
+func isToken68(s string) bool {
+	body := strings.TrimRight(s, "=")
+	if body == "" {
+		return false
+	}
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("-._~+/", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// BasicChallenge returns a challenge for the Basic scheme (RFC 7617) with the
+// given realm, indicating that credentials are encoded in UTF-8.
+func BasicChallenge(realm string) Challenge {
+	return Challenge{Scheme: "Basic", Params: map[string]string{"realm": realm, "charset": "UTF-8"}}
+}
+
+// BasicCredentials returns credentials for the Basic scheme (RFC 7617).
+func BasicCredentials(username, password string) Credentials {
+	return Credentials{
+		Scheme:  "Basic",
+		Token68: base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+}
+
+// Basic returns the username and password from c, and reports whether c
+// holds valid credentials for the Basic scheme.
+func (c Credentials) Basic() (username, password string, ok bool) {
+	if !strings.EqualFold(c.Scheme, "Basic") {
+		return "", "", false
+	}
+	dec, err := base64.StdEncoding.DecodeString(c.Token68)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(dec), ":")
+}
+
+// BearerCredentials returns credentials for the Bearer scheme (RFC 6750).
+func BearerCredentials(token string) Credentials {
+	return Credentials{Scheme: "Bearer", Token68: token}
+}
+
+// Bearer returns the token from c, and reports whether c holds credentials
+// for the Bearer scheme.
+func (c Credentials) Bearer() (token string, ok bool) {
+	if !strings.EqualFold(c.Scheme, "Bearer") || c.Token68 == "" {
+		return "", false
+	}
+	return c.Token68, true
+}
+
+// Error codes for a [BearerChallenge], defined by RFC 6750 Section 3.1.
+const (
+	BearerInvalidRequest    = "invalid_request"
+	BearerInvalidToken      = "invalid_token"
+	BearerInsufficientScope = "insufficient_scope"
+)
+
+// A BearerChallenge is a challenge for the Bearer scheme (RFC 6750 Section 3).
+// All the fields are optional.
+type BearerChallenge struct {
+	Realm            string
+	Scope            string // a space-separated list of scope values
+	Error            string // e.g., BearerInvalidToken
+	ErrorDescription string
+	ErrorURI         string
+}
+
+// Challenge returns the generic form of b.
+func (b BearerChallenge) Challenge() Challenge {
+	out := Challenge{Scheme: "Bearer"}
+	for name, v := range map[string]string{
+		"realm":             b.Realm,
+		"scope":             b.Scope,
+		"error":             b.Error,
+		"error_description": b.ErrorDescription,
+		"error_uri":         b.ErrorURI,
+	} {
+		if v != "" {
+			if out.Params == nil {
+				out.Params = make(map[string]string)
+			}
+			out.Params[name] = v
+		}
+	}
+	return out
+}
+
+// Bearer returns the contents of c as a Bearer challenge, and reports whether
+// c is a challenge for the Bearer scheme.
+func (c Challenge) Bearer() (BearerChallenge, bool) {
+	if !strings.EqualFold(c.Scheme, "Bearer") || c.Token68 != "" {
+		return BearerChallenge{}, false
+	}
+	return BearerChallenge{
+		Realm:            c.Params["realm"],
+		Scope:            c.Params["scope"],
+		Error:            c.Params["error"],
+		ErrorDescription: c.Params["error_description"],
+		ErrorURI:         c.Params["error_uri"],
+	}, true
+}
+
+// A DigestChallenge is a challenge for the Digest scheme (RFC 7616).
+type DigestChallenge struct {
+	Realm  string
+	Domain []string // URIs defining the protection space
+	Nonce  string
+	Opaque string
+	Stale  bool
+
+	// Algorithm is the hash algorithm, one of "MD5", "SHA-256", or
+	// "SHA-512-256", optionally with the suffix "-sess". When parsing, an
+	// absent algorithm is reported as "MD5".
+	Algorithm string
+
+	// QOP are the quality-of-protection values supported by the server, such
+	// as "auth" and "auth-int".
+	QOP []string
+
+	Charset  string // if set, "UTF-8"
+	UserHash bool   // whether the server supports username hashing
+}
+
+// Challenge returns the generic form of d.
+func (d DigestChallenge) Challenge() Challenge {
+	ps := map[string]string{"realm": d.Realm, "nonce": d.Nonce}
+	if len(d.Domain) != 0 {
+		ps["domain"] = strings.Join(d.Domain, " ")
+	}
+	if d.Opaque != "" {
+		ps["opaque"] = d.Opaque
+	}
+	if d.Stale {
+		ps["stale"] = "true"
+	}
+	if d.Algorithm != "" {
+		ps["algorithm"] = d.Algorithm
+	}
+	if len(d.QOP) != 0 {
+		ps["qop"] = strings.Join(d.QOP, ", ")
+	}
+	if d.Charset != "" {
+		ps["charset"] = d.Charset
+	}
+	if d.UserHash {
+		ps["userhash"] = "true"
+	}
+	return Challenge{Scheme: "Digest", Params: ps}
+}
+
+// Digest returns the contents of c as a Digest challenge, and reports whether
+// c is a challenge for the Digest scheme.
+func (c Challenge) Digest() (DigestChallenge, bool) {
+	if !strings.EqualFold(c.Scheme, "Digest") || c.Token68 != "" {
+		return DigestChallenge{}, false
+	}
+	out := DigestChallenge{
+		Realm:     c.Params["realm"],
+		Domain:    strings.Fields(c.Params["domain"]),
+		Nonce:     c.Params["nonce"],
+		Opaque:    c.Params["opaque"],
+		Stale:     strings.EqualFold(c.Params["stale"], "true"),
+		Algorithm: c.Params["algorithm"],
+		QOP:       splitList(c.Params["qop"]),
+		Charset:   c.Params["charset"],
+		UserHash:  strings.EqualFold(c.Params["userhash"], "true"),
+	}
+	if out.Algorithm == "" {
+		out.Algorithm = "MD5"
+	}
+	return out, true
+}
+
+// Respond returns a response to d for a request with the given method and
+// request-target URI, authenticated by the specified username and password.
+// It chooses the "auth" quality of protection, with a random client nonce
+// and a nonce count of 1. If the server supports it, the username is hashed.
+//
+// Respond reports an error if the algorithm is not supported, or if the
+// server offers quality-of-protection values but not "auth".
+func (d DigestChallenge) Respond(method, uri, username, password string) (DigestResponse, error) {
+	if _, _, ok := digestHash(d.Algorithm); !ok {
+		return DigestResponse{}, fmt.Errorf("unsupported digest algorithm %q", d.Algorithm)
+	}
+	out := DigestResponse{
+		Username:  username,
+		Realm:     d.Realm,
+		URI:       uri,
+		Algorithm: d.Algorithm,
+		Nonce:     d.Nonce,
+		Opaque:    d.Opaque,
+		UserHash:  d.UserHash,
+	}
+	if len(d.QOP) != 0 {
+		if !slices.ContainsFunc(d.QOP, func(q string) bool { return strings.EqualFold(q, "auth") }) {
+			return DigestResponse{}, fmt.Errorf("unsupported qop %q", d.QOP)
+		}
+		out.QOP, out.NC, out.CNonce = "auth", 1, rand.Text()
+	}
+	if d.UserHash {
+		out.Username = out.hashUsername(username)
+	}
+	out.Response = out.compute(method, username, password)
+	return out, nil
+}
+
+// A DigestResponse is the content of an Authorization header for the Digest
+// scheme (RFC 7616 Section 3.4).
+type DigestResponse struct {
+	// Username is the name of the user, or its hash if UserHash is true.
+	Username string
+
+	Realm     string
+	URI       string
+	Algorithm string
+	Nonce     string
+	Opaque    string
+	QOP       string // the chosen quality of protection, or "" if none
+	NC        int    // the nonce count
+	CNonce    string // the client nonce
+	Response  string // the response hash, in hexadecimal
+	UserHash  bool
+}
+
+// Credentials returns the generic form of r. A username that is not ASCII is
+// encoded in a username* parameter.
+func (r DigestResponse) Credentials() Credentials {
+	ps := map[string]string{
+		"realm":    r.Realm,
+		"uri":      r.URI,
+		"nonce":    r.Nonce,
+		"response": r.Response,
+	}
+	if isASCII(r.Username) {
+		ps["username"] = r.Username
+	} else {
+		ps["username*"] = encodeExtValue(r.Username, "")
+	}
+	if r.Algorithm != "" {
+		ps["algorithm"] = r.Algorithm
+	}
+	if r.Opaque != "" {
+		ps["opaque"] = r.Opaque
+	}
+	if r.QOP != "" {
+		ps["qop"] = r.QOP
+		ps["nc"] = fmt.Sprintf("%08x", r.NC)
+		ps["cnonce"] = r.CNonce
+	}
+	if r.UserHash {
+		ps["userhash"] = "true"
+	}
+	return Credentials{Scheme: "Digest", Params: ps}
+}
+
+// Digest returns the contents of c as a Digest response, and reports an
+// error if c is not a valid response for the Digest scheme.
+func (c Credentials) Digest() (DigestResponse, error) {
+	if !strings.EqualFold(c.Scheme, "Digest") || c.Token68 != "" {
+		return DigestResponse{}, errors.New("not digest credentials")
+	}
+	out := DigestResponse{
+		Username:  c.Params["username"],
+		Realm:     c.Params["realm"],
+		URI:       c.Params["uri"],
+		Algorithm: c.Params["algorithm"],
+		Nonce:     c.Params["nonce"],
+		Opaque:    c.Params["opaque"],
+		QOP:       c.Params["qop"],
+		CNonce:    c.Params["cnonce"],
+		Response:  c.Params["response"],
+		UserHash:  strings.EqualFold(c.Params["userhash"], "true"),
+	}
+	if ext, ok := c.Params["username*"]; ok {
+		if out.Username != "" {
+			return DigestResponse{}, errors.New("both username and username* are present")
+		}
+		name, _, err := decodeExtValue(ext)
+		if err != nil {
+			return DigestResponse{}, fmt.Errorf("invalid username*: %w", err)
+		}
+		out.Username = name
+	}
+	if out.Algorithm == "" {
+		out.Algorithm = "MD5"
+	}
+	if out.QOP != "" {
+		nc, err := strconv.ParseUint(c.Params["nc"], 16, 32)
+		if err != nil {
+			return DigestResponse{}, fmt.Errorf("invalid nonce count: %w", err)
+		}
+		out.NC = int(nc)
+	}
+	if out.Username == "" || out.Nonce == "" || out.Response == "" {
+		return DigestResponse{}, errors.New("missing required parameters")
+	}
+	return out, nil
+}
+
+// Verify reports whether r is a valid response by the specified user and
+// password to a challenge, for a request with the given method. The caller
+// is responsible for checking that the nonce, nonce count, realm, and URI
+// are acceptable. Only the "auth" quality of protection is supported.
+func (r DigestResponse) Verify(method, username, password string) bool {
+	if _, _, ok := digestHash(r.Algorithm); !ok || (r.QOP != "" && r.QOP != "auth") {
+		return false
+	}
+	name := username
+	if r.UserHash {
+		name = r.hashUsername(username)
+	}
+	want := r.compute(method, username, password)
+	return subtle.ConstantTimeCompare([]byte(name), []byte(r.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(want), []byte(strings.ToLower(r.Response))) == 1
+}
+
+// compute returns the response hash for r, per RFC 7616 Section 3.4.1.
+func (r DigestResponse) compute(method, username, password string) string {
+	newHash, sess, _ := digestHash(r.Algorithm)
+	h := func(parts ...string) string {
+		d := newHash()
+		d.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	ha1 := h(username, r.Realm, password)
+	if sess {
+		ha1 = h(ha1, r.Nonce, r.CNonce)
+	}
+	ha2 := h(method, r.URI)
+	if r.QOP == "" {
+		return h(ha1, r.Nonce, ha2) // RFC 2069 compatibility
+	}
+	return h(ha1, r.Nonce, fmt.Sprintf("%08x", r.NC), r.CNonce, r.QOP, ha2)
+}
+
+// hashUsername returns the hashed form of username, per RFC 7616 Section 3.4.4.
+func (r DigestResponse) hashUsername(username string) string {
+	newHash, _, _ := digestHash(r.Algorithm)
+	d := newHash()
+	d.Write([]byte(username + ":" + r.Realm))
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// digestHash returns a constructor for the hash of the specified Digest
+// algorithm, and reports whether it is a session variant. An empty algorithm
+// is treated as "MD5".
+func digestHash(alg string) (_ func() hash.Hash, sess, ok bool) {
+	base, sess := strings.CutSuffix(strings.ToUpper(alg), "-SESS")
+	switch base {
+	case "", "MD5":
+		return md5.New, sess, true
+	case "SHA-256":
+		return sha256.New, sess, true
+	case "SHA-512-256":
+		return sha512.New512_256, sess, true
+	}
+	return nil, false, false
+}
@@ -0,0 +1,282 @@
+package mhttp_test
+
+import (
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseWWWAuthenticateHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []mhttp.Challenge
+	}{
+		{"", nil},
+		{"Negotiate", []mhttp.Challenge{{Scheme: "Negotiate"}}},
+		{"Negotiate a87421000492aa874209af8bc028==", []mhttp.Challenge{
+			{Scheme: "Negotiate", Token68: "a87421000492aa874209af8bc028=="},
+		}},
+		{`Basic realm="simple", charset="UTF-8"`, []mhttp.Challenge{
+			{Scheme: "Basic", Params: map[string]string{"realm": "simple", "charset": "UTF-8"}},
+		}},
+
+		// Two challenges in one header, from RFC 9110 Section 11.6.1.
+		{`Basic realm="simple", Newauth realm="apps", type=1, title="Login to \"apps\""`, []mhttp.Challenge{
+			{Scheme: "Basic", Params: map[string]string{"realm": "simple"}},
+			{Scheme: "Newauth", Params: map[string]string{"realm": "apps", "type": "1", "title": `Login to "apps"`}},
+		}},
+
+		// Commas inside quoted strings, whitespace around "=", and case.
+		{`Digest realm = "a, b", QOP="auth,auth-int", nonce=xyz,Bearer error="invalid_token", Basic`, []mhttp.Challenge{
+			{Scheme: "Digest", Params: map[string]string{"realm": "a, b", "qop": "auth,auth-int", "nonce": "xyz"}},
+			{Scheme: "Bearer", Params: map[string]string{"error": "invalid_token"}},
+			{Scheme: "Basic"},
+		}},
+		{"Basic, , Bearer", []mhttp.Challenge{{Scheme: "Basic"}, {Scheme: "Bearer"}}},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseWWWAuthenticateHeader(tc.input)
+		if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("Parse %q (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+
+	for _, bad := range []string{
+		`realm="x"`,                  // parameter before scheme
+		`Basic realm="x", realm="y"`, // duplicate parameter
+		`Negotiate abc==, realm="x"`, // parameter after token68
+		`Basic realm="x`,             // unterminated quote
+		`Basic realm x`,              // not a token68 or parameter
+		`B@sic realm="x"`,            // invalid scheme
+		`Basic realm=a b`,            // invalid value
+	} {
+		if got, err := mhttp.ParseWWWAuthenticateHeader(bad); err == nil {
+			t.Errorf("Parse %q: got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestParseAuthorizationHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  mhttp.Credentials
+	}{
+		{"Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==", mhttp.Credentials{Scheme: "Basic", Token68: "QWxhZGRpbjpvcGVuIHNlc2FtZQ=="}},
+		{"Bearer mF_9.B5f-4.1JqM", mhttp.Credentials{Scheme: "Bearer", Token68: "mF_9.B5f-4.1JqM"}},
+		{"Custom", mhttp.Credentials{Scheme: "Custom"}},
+		{`Digest username="Mufasa", nc=00000001, qop=auth`, mhttp.Credentials{
+			Scheme: "Digest", Params: map[string]string{"username": "Mufasa", "nc": "00000001", "qop": "auth"},
+		}},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseAuthorizationHeader(tc.input)
+		if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("Parse %q (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+	for _, bad := range []string{"", "Basic a b", `Digest a="1", a="2"`, "Digest a b"} {
+		if got, err := mhttp.ParseAuthorizationHeader(bad); err == nil {
+			t.Errorf("Parse %q: got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestFormatChallenges(t *testing.T) {
+	got := mhttp.FormatChallenges(
+		mhttp.BasicChallenge("my realm"),
+		mhttp.BearerChallenge{
+			Realm:            "example",
+			Error:            mhttp.BearerInvalidToken,
+			ErrorDescription: `The token "expired"`,
+		}.Challenge(),
+		mhttp.Challenge{Scheme: "Negotiate"},
+		mhttp.DigestChallenge{
+			Realm: "r", Nonce: "n", Algorithm: "SHA-256", QOP: []string{"auth"}, Stale: true,
+		}.Challenge(),
+	)
+	const want = `Basic charset="UTF-8", realm="my realm", ` +
+		`Bearer error="invalid_token", error_description="The token \"expired\"", realm="example", ` +
+		`Negotiate, ` +
+		`Digest algorithm=SHA-256, nonce="n", qop="auth", realm="r", stale=true`
+	if got != want {
+		t.Errorf("FormatChallenges:\ngot  %s\nwant %s", got, want)
+	}
+
+	cs, err := mhttp.ParseWWWAuthenticateHeader(got)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if len(cs) != 4 {
+		t.Fatalf("Parse: got %d challenges, want 4", len(cs))
+	}
+	if b, ok := cs[1].Bearer(); !ok || b.Error != mhttp.BearerInvalidToken || b.Realm != "example" {
+		t.Errorf("Bearer: got %+v, %v", b, ok)
+	}
+	if d, ok := cs[3].Digest(); !ok || d.Algorithm != "SHA-256" || !d.Stale || d.Nonce != "n" {
+		t.Errorf("Digest: got %+v, %v", d, ok)
+	}
+	if _, ok := cs[0].Bearer(); ok {
+		t.Error("Bearer: unexpectedly succeeded for Basic")
+	}
+}
+
+func TestBasicBearer(t *testing.T) {
+	c := mhttp.BasicCredentials("Aladdin", "open sesame")
+	if got, want := c.String(), "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="; got != want {
+		t.Errorf("Basic: got %q, want %q", got, want)
+	}
+	pc, err := mhttp.ParseAuthorizationHeader("basic " + c.Token68)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if user, pass, ok := pc.Basic(); !ok || user != "Aladdin" || pass != "open sesame" {
+		t.Errorf("Basic: got (%q, %q, %v), want (Aladdin, open sesame, true)", user, pass, ok)
+	}
+	if _, ok := pc.Bearer(); ok {
+		t.Error("Bearer: unexpectedly succeeded for Basic")
+	}
+	if _, _, ok := (mhttp.Credentials{Scheme: "Basic", Token68: "bm9jb2xvbg=="}).Basic(); ok {
+		t.Error("Basic: unexpectedly succeeded without a colon")
+	}
+
+	b := mhttp.BearerCredentials("mF_9.B5f-4.1JqM")
+	if tok, ok := b.Bearer(); !ok || tok != "mF_9.B5f-4.1JqM" {
+		t.Errorf("Bearer: got (%q, %v)", tok, ok)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	// Test vectors from RFC 2617 Section 3.5 and RFC 7616 Section 3.9.1.
+	tests := []struct {
+		name     string
+		resp     mhttp.DigestResponse
+		password string
+		want     string
+	}{
+		{"RFC2617", mhttp.DigestResponse{
+			Username: "Mufasa", Realm: "testrealm@host.com", URI: "/dir/index.html",
+			Nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", QOP: "auth", NC: 1, CNonce: "0a4f113b",
+		}, "Circle Of Life", "6629fae49393a05397450978507c4ef1"},
+		{"RFC7616-MD5", mhttp.DigestResponse{
+			Username: "Mufasa", Realm: "http-auth@example.org", URI: "/dir/index.html", Algorithm: "MD5",
+			Nonce: "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", QOP: "auth", NC: 1,
+			CNonce: "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+		}, "Circle of Life", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"RFC7616-SHA256", mhttp.DigestResponse{
+			Username: "Mufasa", Realm: "http-auth@example.org", URI: "/dir/index.html", Algorithm: "SHA-256",
+			Nonce: "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", QOP: "auth", NC: 1,
+			CNonce: "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+		}, "Circle of Life", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := tc.resp
+			r.Response = tc.want
+			if !r.Verify("GET", r.Username, tc.password) {
+				t.Errorf("Verify: got false, want true")
+			}
+			if r.Verify("GET", r.Username, "wrong") {
+				t.Errorf("Verify with wrong password: got true, want false")
+			}
+			if r.Verify("POST", r.Username, tc.password) {
+				t.Errorf("Verify with wrong method: got true, want false")
+			}
+
+			// The response survives formatting and parsing.
+			c, err := mhttp.ParseAuthorizationHeader(r.Credentials().String())
+			if err != nil {
+				t.Fatalf("Parse: unexpected error: %v", err)
+			}
+			back, err := c.Digest()
+			if err != nil {
+				t.Fatalf("Digest: unexpected error: %v", err)
+			}
+			if back.Algorithm != "" && r.Algorithm == "" {
+				r.Algorithm = back.Algorithm
+			}
+			if diff := cmp.Diff(back, r); diff != "" {
+				t.Errorf("Round trip (-got, +want):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("Format", func(t *testing.T) {
+		r := mhttp.DigestResponse{
+			Username: "Mufasa", Realm: "r", URI: "/", Algorithm: "SHA-256",
+			Nonce: "n", QOP: "auth", NC: 10, CNonce: "c", Response: "abc", Opaque: "o",
+		}
+		const want = `Digest algorithm=SHA-256, cnonce="c", nc=0000000a, nonce="n", opaque="o", ` +
+			`qop=auth, realm="r", response="abc", uri="/", username="Mufasa"`
+		if got := r.Credentials().String(); got != want {
+			t.Errorf("String:\ngot  %s\nwant %s", got, want)
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		ch   mhttp.DigestChallenge
+	}{
+		{"MD5", mhttp.DigestChallenge{Realm: "r", Nonce: "n", Algorithm: "MD5", QOP: []string{"auth-int", "auth"}}},
+		{"SHA512Sess", mhttp.DigestChallenge{Realm: "r", Nonce: "n", Algorithm: "SHA-512-256-sess", QOP: []string{"auth"}}},
+		{"Legacy", mhttp.DigestChallenge{Realm: "r", Nonce: "n"}},
+		{"UserHash", mhttp.DigestChallenge{Realm: "r", Nonce: "n", Algorithm: "SHA-256", QOP: []string{"auth"}, UserHash: true}},
+		{"NonASCII", mhttp.DigestChallenge{Realm: "r", Nonce: "n", Algorithm: "SHA-256", QOP: []string{"auth"}, Charset: "UTF-8"}},
+	} {
+		t.Run("Respond/"+tc.name, func(t *testing.T) {
+			user := "alice"
+			if tc.name == "NonASCII" {
+				user = "Jäsøn Doe"
+			}
+			// Round-trip the challenge through the header syntax.
+			cs, err := mhttp.ParseWWWAuthenticateHeader(tc.ch.Challenge().String())
+			if err != nil || len(cs) != 1 {
+				t.Fatalf("Parse challenge: got %v, %v", cs, err)
+			}
+			ch, ok := cs[0].Digest()
+			if !ok {
+				t.Fatal("Digest: not a digest challenge")
+			}
+			r, err := ch.Respond("GET", "/a?b=c", user, "secret")
+			if err != nil {
+				t.Fatalf("Respond: unexpected error: %v", err)
+			}
+			if tc.ch.UserHash && r.Username == user {
+				t.Error("Respond: username was not hashed")
+			}
+			c, err := mhttp.ParseAuthorizationHeader(r.Credentials().String())
+			if err != nil {
+				t.Fatalf("Parse: unexpected error: %v", err)
+			}
+			got, err := c.Digest()
+			if err != nil {
+				t.Fatalf("Digest: unexpected error: %v", err)
+			}
+			if !got.Verify("GET", user, "secret") {
+				t.Errorf("Verify %+v: got false, want true", got)
+			}
+			if got.Verify("GET", "bob", "secret") {
+				t.Errorf("Verify with wrong user: got true, want false")
+			}
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		for _, ch := range []mhttp.DigestChallenge{
+			{Realm: "r", Nonce: "n", Algorithm: "SHA-1"},
+			{Realm: "r", Nonce: "n", QOP: []string{"auth-int"}},
+		} {
+			if r, err := ch.Respond("GET", "/", "u", "p"); err == nil {
+				t.Errorf("Respond %+v: got %+v, want error", ch, r)
+			}
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package mhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Delta is an optional non-negative duration in whole seconds, as used by
+// the arguments of Cache-Control directives. The zero value is absent.
+type Delta struct {
+	secs    int64
+	present bool
+}
+
+// maxDelta is the largest delta-seconds value a recipient is required to
+// represent, per RFC 9111 Section 1.2.2. Larger values are clamped to it.
+const maxDelta = 1 << 31
+
+// DeltaOf returns a present Delta for d, truncated to whole seconds.
+// Negative durations are treated as zero.
+func DeltaOf(d time.Duration) Delta {
+	return Delta{secs: min(max(int64(d/time.Second), 0), maxDelta), present: true}
+}
+
+// IsPresent reports whether d is present.
+func (d Delta) IsPresent() bool { return d.present }
+
+// Seconds returns the value of d in seconds, or 0 if d is not present.
+func (d Delta) Seconds() int64 { return d.secs }
+
+// Duration returns the value of d as a [time.Duration], or 0 if d is not
+// present.
+func (d Delta) Duration() time.Duration { return time.Duration(d.secs) * time.Second }
+
+// parseDelta parses s as a delta-seconds value.
+func parseDelta(s string) (Delta, error) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return Delta{}, fmt.Errorf("invalid delta-seconds %q", s)
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v > maxDelta {
+		v = maxDelta // the only possible error here is overflow
+	}
+	return Delta{secs: v, present: true}, nil
+}
+
+// CacheControl is the parsed representation of an HTTP [Cache-Control]
+// header. It covers the directives defined for requests and responses by
+// RFC 9111, as well as the immutable (RFC 8246), stale-while-revalidate, and
+// stale-if-error (RFC 5861) extensions. Other directives are preserved as
+// extensions.
+//
+// A CacheControl can also be used to construct a header value; see
+// [CacheControl.String].
+//
+// [Cache-Control]: https://httpwg.org/specs/rfc9111.html#field.cache-control
+type CacheControl struct {
+	// Directives with a delta-seconds argument.
+
+	MaxAge               Delta // max-age (request, response)
+	SMaxAge              Delta // s-maxage (response)
+	MaxStale             Delta // max-stale (request); see also MaxStaleAny
+	MinFresh             Delta // min-fresh (request)
+	StaleWhileRevalidate Delta // stale-while-revalidate (response)
+	StaleIfError         Delta // stale-if-error (request, response)
+
+	// MaxStaleAny is true if max-stale was given without an argument,
+	// indicating that the client will accept a stale response of any age.
+	MaxStaleAny bool
+
+	// NoCache is true if no-cache was given. If the directive lists field
+	// names, NoCacheFields holds them and the restriction applies only to
+	// those fields.
+	NoCache       bool
+	NoCacheFields []string
+
+	// Private is true if private was given. If the directive lists field
+	// names, PrivateFields holds them and the restriction applies only to
+	// those fields.
+	Private       bool
+	PrivateFields []string
+
+	NoStore         bool // no-store (request, response)
+	NoTransform     bool // no-transform (request, response)
+	OnlyIfCached    bool // only-if-cached (request)
+	MustRevalidate  bool // must-revalidate (response)
+	ProxyRevalidate bool // proxy-revalidate (response)
+	MustUnderstand  bool // must-understand (response)
+	Public          bool // public (response)
+	Immutable       bool // immutable (response)
+
+	// Extensions are directives not otherwise recognized, in the order they
+	// were given.
+	Extensions []Directive
+}
+
+// A Directive is a Cache-Control directive with an optional argument.
+type Directive struct {
+	Name  string // normalized to lower case
+	Value string // unquoted; empty if there was no argument
+}
+
+// String renders d as it appears in a header.
+func (d Directive) String() string {
+	if d.Value == "" {
+		return d.Name
+	}
+	return d.Name + "=" + tokenOrQuoted(d.Value)
+}
+
+// ParseCacheControlHeader parses the contents of an HTTP Cache-Control
+// header. If a request or response has multiple Cache-Control header lines,
+// the caller should join them with commas before parsing.
+//
+// Directive names are not case-sensitive, and arguments may be given either
+// as tokens or as quoted strings. If a directive appears more than once, the
+// first occurrence is used. Delta-seconds values larger than 2^31 are clamped
+// to that value, per RFC 9111.
+//
+// An error is reported if the header is syntactically invalid, or if the
+// argument of a recognized directive is missing or invalid.
+func ParseCacheControlHeader(s string) (CacheControl, error) {
+	var cc CacheControl
+	seen := make(map[string]bool)
+	for _, elt := range splitList(s) {
+		name, value, hasValue, err := parseParam(elt)
+		if err != nil {
+			return CacheControl{}, fmt.Errorf("invalid directive %q: %w", elt, err)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		// Handle directives with required delta-seconds arguments.
+		if p := cc.deltaField(name); p != nil {
+			d, err := parseDelta(value)
+			if err != nil {
+				return CacheControl{}, fmt.Errorf("directive %q: %w", name, err)
+			}
+			*p = d
+			continue
+		}
+
+		// Handle directives with optional arguments.
+		switch name {
+		case "max-stale":
+			if !hasValue {
+				cc.MaxStaleAny = true
+			} else if cc.MaxStale, err = parseDelta(value); err != nil {
+				return CacheControl{}, fmt.Errorf("directive %q: %w", name, err)
+			}
+			continue
+		case "no-cache":
+			cc.NoCache = true
+			cc.NoCacheFields = splitFieldNames(value)
+			continue
+		case "private":
+			cc.Private = true
+			cc.PrivateFields = splitFieldNames(value)
+			continue
+		}
+
+		// Handle directives without arguments.
+		if p := cc.flagField(name); p != nil {
+			if hasValue {
+				return CacheControl{}, fmt.Errorf("directive %q does not take an argument", name)
+			}
+			*p = true
+			continue
+		}
+		cc.Extensions = append(cc.Extensions, Directive{Name: name, Value: value})
+	}
+	return cc, nil
+}
+
+func (cc *CacheControl) deltaField(name string) *Delta {
+	switch name {
+	case "max-age":
+		return &cc.MaxAge
+	case "s-maxage":
+		return &cc.SMaxAge
+	case "min-fresh":
+		return &cc.MinFresh
+	case "stale-while-revalidate":
+		return &cc.StaleWhileRevalidate
+	case "stale-if-error":
+		return &cc.StaleIfError
+	}
+	return nil
+}
+
+func (cc *CacheControl) flagField(name string) *bool {
+	switch name {
+	case "no-store":
+		return &cc.NoStore
+	case "no-transform":
+		return &cc.NoTransform
+	case "only-if-cached":
+		return &cc.OnlyIfCached
+	case "must-revalidate":
+		return &cc.MustRevalidate
+	case "proxy-revalidate":
+		return &cc.ProxyRevalidate
+	case "must-understand":
+		return &cc.MustUnderstand
+	case "public":
+		return &cc.Public
+	case "immutable":
+		return &cc.Immutable
+	}
+	return nil
+}
+
+// String renders cc as the value of a Cache-Control header. Directives are
+// written in a fixed order, followed by extensions in their given order.
+// Field name lists are always written as quoted strings, as RFC 9111
+// recommends. If cc has no directives, String returns "".
+func (cc CacheControl) String() string {
+	var out []string
+	flag := func(ok bool, name string) {
+		if ok {
+			out = append(out, name)
+		}
+	}
+	delta := func(d Delta, name string) {
+		if d.IsPresent() {
+			out = append(out, name+"="+strconv.FormatInt(d.secs, 10))
+		}
+	}
+	fields := func(ok bool, name string, names []string) {
+		if len(names) != 0 {
+			out = append(out, name+"="+quoteString(strings.Join(names, ", ")))
+		} else if ok {
+			out = append(out, name)
+		}
+	}
+
+	flag(cc.Public, "public")
+	fields(cc.Private, "private", cc.PrivateFields)
+	fields(cc.NoCache, "no-cache", cc.NoCacheFields)
+	flag(cc.NoStore, "no-store")
+	delta(cc.MaxAge, "max-age")
+	delta(cc.SMaxAge, "s-maxage")
+	if cc.MaxStaleAny && !cc.MaxStale.IsPresent() {
+		out = append(out, "max-stale")
+	}
+	delta(cc.MaxStale, "max-stale")
+	delta(cc.MinFresh, "min-fresh")
+	flag(cc.MustRevalidate, "must-revalidate")
+	flag(cc.ProxyRevalidate, "proxy-revalidate")
+	flag(cc.MustUnderstand, "must-understand")
+	flag(cc.NoTransform, "no-transform")
+	flag(cc.OnlyIfCached, "only-if-cached")
+	flag(cc.Immutable, "immutable")
+	delta(cc.StaleWhileRevalidate, "stale-while-revalidate")
+	delta(cc.StaleIfError, "stale-if-error")
+	for _, d := range cc.Extensions {
+		out = append(out, d.String())
+	}
+	return strings.Join(out, ", ")
+}
+
+// splitFieldNames splits a comma-separated list of field names, and
+// normalizes them to canonical form. It returns nil if s is empty.
+func splitFieldNames(s string) []string {
+	var out []string
+	for _, name := range splitList(s) {
+		out = append(out, http.CanonicalHeaderKey(name))
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package mhttp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+var deltaCmp = cmp.Comparer(func(a, b mhttp.Delta) bool {
+	return a.IsPresent() == b.IsPresent() && a.Seconds() == b.Seconds()
+})
+
+func secs(n int64) mhttp.Delta { return mhttp.DeltaOf(time.Duration(n) * time.Second) }
+
+func TestParseCacheControlHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  mhttp.CacheControl
+	}{
+		{"", mhttp.CacheControl{}},
+		{"no-store", mhttp.CacheControl{NoStore: true}},
+		{"public, max-age=3600, immutable", mhttp.CacheControl{
+			Public: true, MaxAge: secs(3600), Immutable: true,
+		}},
+		{"Max-Age=0, Must-Revalidate", mhttp.CacheControl{MaxAge: secs(0), MustRevalidate: true}},
+		{`max-age="60", s-maxage=120`, mhttp.CacheControl{MaxAge: secs(60), SMaxAge: secs(120)}},
+		{"max-age=99999999999999999999", mhttp.CacheControl{MaxAge: secs(1 << 31)}},
+		{"max-age=10, max-age=20", mhttp.CacheControl{MaxAge: secs(10)}},
+		{`private="set-cookie, x-user", no-cache="Authorization"`, mhttp.CacheControl{
+			Private: true, PrivateFields: []string{"Set-Cookie", "X-User"},
+			NoCache: true, NoCacheFields: []string{"Authorization"},
+		}},
+		{"no-cache, private", mhttp.CacheControl{NoCache: true, Private: true}},
+		{"max-stale", mhttp.CacheControl{MaxStaleAny: true}},
+		{"max-stale=30, min-fresh=5, only-if-cached, no-transform", mhttp.CacheControl{
+			MaxStale: secs(30), MinFresh: secs(5), OnlyIfCached: true, NoTransform: true,
+		}},
+		{"max-age=600, stale-while-revalidate=30, stale-if-error=86400", mhttp.CacheControl{
+			MaxAge: secs(600), StaleWhileRevalidate: secs(30), StaleIfError: secs(86400),
+		}},
+		{"proxy-revalidate, must-understand", mhttp.CacheControl{ProxyRevalidate: true, MustUnderstand: true}},
+		{`community="UCI", x-flag, ext="a \"b\", c"`, mhttp.CacheControl{
+			Extensions: []mhttp.Directive{
+				{Name: "community", Value: "UCI"},
+				{Name: "x-flag"},
+				{Name: "ext", Value: `a "b", c`},
+			},
+		}},
+		{" , no-store ,, ", mhttp.CacheControl{NoStore: true}},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseCacheControlHeader(tc.input)
+		if err != nil {
+			t.Errorf("ParseCacheControlHeader(%q): unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want, deltaCmp); diff != "" {
+			t.Errorf("ParseCacheControlHeader(%q) (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+
+	t.Run("Fail", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{"max-age", "invalid delta-seconds"},
+			{"max-age=-1", "invalid delta-seconds"},
+			{"max-age=1.5", "invalid delta-seconds"},
+			{"s-maxage=soon", "invalid delta-seconds"},
+			{"max-stale=x", "invalid delta-seconds"},
+			{"public=yes", "does not take an argument"},
+			{`max-age="60`, "invalid quoted value"},
+			{"max age=5", "invalid parameter name"},
+			{"x=a b", "invalid value"},
+		}
+		for _, tc := range tests {
+			got, err := mhttp.ParseCacheControlHeader(tc.input)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ParseCacheControlHeader(%q): got (%+v, %v), want error %q", tc.input, got, err, tc.want)
+			}
+		}
+	})
+}
+
+func TestCacheControlString(t *testing.T) {
+	tests := []struct {
+		input mhttp.CacheControl
+		want  string
+	}{
+		{mhttp.CacheControl{}, ""},
+		{mhttp.CacheControl{NoStore: true}, "no-store"},
+		{mhttp.CacheControl{Public: true, MaxAge: mhttp.DeltaOf(time.Hour), Immutable: true},
+			"public, max-age=3600, immutable"},
+		{mhttp.CacheControl{MaxAge: mhttp.DeltaOf(0)}, "max-age=0"},
+		{mhttp.CacheControl{MaxAge: mhttp.DeltaOf(1500 * time.Millisecond)}, "max-age=1"},
+		{mhttp.CacheControl{Private: true, PrivateFields: []string{"Set-Cookie", "X-User"}},
+			`private="Set-Cookie, X-User"`},
+		{mhttp.CacheControl{NoCacheFields: []string{"Authorization"}}, `no-cache="Authorization"`},
+		{mhttp.CacheControl{MaxStaleAny: true, MinFresh: mhttp.DeltaOf(5 * time.Second)}, "max-stale, min-fresh=5"},
+		{mhttp.CacheControl{
+			MaxAge:               mhttp.DeltaOf(10 * time.Minute),
+			StaleWhileRevalidate: mhttp.DeltaOf(30 * time.Second),
+			StaleIfError:         mhttp.DeltaOf(24 * time.Hour),
+		}, "max-age=600, stale-while-revalidate=30, stale-if-error=86400"},
+		{mhttp.CacheControl{
+			NoCache:    true,
+			Extensions: []mhttp.Directive{{Name: "x-flag"}, {Name: "ext", Value: `a "b", c`}},
+		}, `no-cache, x-flag, ext="a \"b\", c"`},
+	}
+	for _, tc := range tests {
+		got := tc.input.String()
+		if got != tc.want {
+			t.Errorf("String: got %q, want %q", got, tc.want)
+		}
+
+		// Verify that the rendered value round-trips.
+		cc, err := mhttp.ParseCacheControlHeader(got)
+		if err != nil {
+			t.Errorf("ParseCacheControlHeader(%q): unexpected error: %v", got, err)
+		} else if again := cc.String(); again != got {
+			t.Errorf("Round trip: got %q, want %q", again, got)
+		}
+	}
+}
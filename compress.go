@@ -0,0 +1,457 @@
+package mhttp
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// An Encoder defines a content coding that a [Compressor] can apply.
+type Encoder struct {
+	// Coding is the name of the content coding, for example "gzip" or "br".
+	Coding string
+
+	// NewWriter returns a writer that encodes the data written to it and
+	// writes the result to w. The Compressor closes the writer at the end of
+	// the response. If the writer has a method
+	//
+	//	Flush() error
+	//
+	// it is called whenever the underlying handler flushes the response.
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+var (
+	// GzipEncoder is an [Encoder] for the "gzip" content coding.
+	GzipEncoder = Encoder{
+		Coding:    "gzip",
+		NewWriter: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	}
+
+	// DeflateEncoder is an [Encoder] for the "deflate" content coding.  Per
+	// RFC 9110, this coding is the zlib format, not a raw deflate stream.
+	DeflateEncoder = Encoder{
+		Coding:    "deflate",
+		NewWriter: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+	}
+)
+
+// DefaultMinCompressSize is the default minimum size in bytes of a response
+// body that a [Compressor] will compress.
+const DefaultMinCompressSize = 1024
+
+// A Compressor is an [http.Handler] that compresses the responses of an
+// underlying handler, using a content coding negotiated from the request's
+// Accept-Encoding header.
+//
+// Response bodies are compressed as they are written, once they reach a
+// minimum size. A Compressor does not compress a response that:
+//
+//   - has a status other than 2xx, 4xx, or 5xx, or is a 204 or 206,
+//   - already has a Content-Encoding or Content-Range header,
+//   - has a Cache-Control header with the no-transform directive, or
+//   - has a content type that is not compressible (see Compressible).
+//
+// If the client does not accept any of the Encoders, the response is sent
+// without compression. All responses get "Accept-Encoding" in their Vary
+// header.
+//
+// The response to a HEAD request gets the same header fields as the
+// response to the corresponding GET request, so a HEAD response whose body
+// would be compressed is reported with the Content-Encoding and ETag of the
+// compressed representation. Its size is taken from the Content-Length set
+// by the handler, if the handler does not write the body.
+//
+// When a response is compressed, a strong ETag is replaced by a variant
+// specific to the content coding ("abc" becomes "abc-gzip"), since the
+// compressed representation is not byte-for-byte identical to the original.
+// A weak ETag is left unchanged. Conversely, the coding suffix is removed
+// from the strong entity tags of the If-Match and If-None-Match headers
+// before the request is passed to the underlying handler, so that the
+// handler can compare them with its own tags. A request whose If-Range
+// header holds a coding-specific tag is passed on without its Range and
+// If-Range headers, so that the client gets the whole representation rather
+// than a range of the uncompressed one.
+type Compressor struct {
+	// Handler is the underlying handler whose responses are compressed.
+	Handler http.Handler
+
+	// Encoders are the content codings the Compressor may use, in order of
+	// preference. If empty, GzipEncoder and DeflateEncoder are used.
+	Encoders []Encoder
+
+	// MinSize is the minimum size in bytes of a response body that will be
+	// compressed. If zero, DefaultMinCompressSize is used. If negative, any
+	// non-empty body may be compressed.
+	//
+	// If the handler flushes the response after writing some data but before
+	// MinSize bytes have been written, the body is treated as a stream and
+	// compressed regardless of its size, unless the handler set a
+	// Content-Length less than MinSize.
+	MinSize int
+
+	// Compressible reports whether a response with the specified content
+	// type should be compressed. If nil, all types are compressed except
+	// those whose content is usually compressed already, such as images
+	// (other than SVG), audio, video, fonts, and archives.
+	Compressible func(contentType string) bool
+}
+
+var defaultEncoders = []Encoder{GzipEncoder, DeflateEncoder}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (c *Compressor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cw := &compressWriter{ResponseWriter: w, c: c, head: r.Method == http.MethodHead}
+
+	ae, err := ParseAcceptEncodingHeader(strings.Join(r.Header.Values("Accept-Encoding"), ","))
+	if err == nil {
+		cw.enc = c.negotiate(ae)
+	}
+	if cw.enc != nil {
+		r, cw.stripped = stripValidators(r, cw.enc.Coding)
+	}
+	defer cw.finish()
+	c.Handler.ServeHTTP(cw, r)
+}
+
+// negotiate returns the encoder selected by ae, or nil if no encoder is
+// acceptable.
+func (c *Compressor) negotiate(ae AcceptEncoding) *Encoder {
+	encs := c.Encoders
+	if len(encs) == 0 {
+		encs = defaultEncoders
+	}
+	var offers []string
+	for _, e := range encs {
+		offers = append(offers, e.Coding)
+	}
+	coding, ok := ae.Negotiate(offers...)
+	if !ok {
+		return nil
+	}
+	for i, e := range encs {
+		if e.Coding == coding {
+			return &encs[i]
+		}
+	}
+	return nil // identity
+}
+
+func (c *Compressor) minSize() int {
+	if c.MinSize == 0 {
+		return DefaultMinCompressSize
+	}
+	return max(c.MinSize, 1)
+}
+
+func (c *Compressor) compressible(ctype string) bool {
+	if c.Compressible != nil {
+		return c.Compressible(ctype)
+	}
+	return isCompressible(ctype)
+}
+
+// compressWriter is an [http.ResponseWriter] that buffers the start of a
+// response body until it can decide whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+
+	c        *Compressor
+	enc      *Encoder // nil if compression is not possible
+	stripped bool     // request validators were rewritten
+	head     bool     // the request is a HEAD; the body is not sent
+
+	code    int            // status code, or 0 if not yet written
+	buf     []byte         // buffered body, before committing
+	decided bool           // whether the header has been sent
+	zw      io.WriteCloser // non-nil if compressing
+}
+
+// Unwrap supports [http.ResponseController].
+func (cw *compressWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
+
+// WriteHeader implements part of [http.ResponseWriter].
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || code < 200 {
+		cw.ResponseWriter.WriteHeader(code) // informational or superfluous
+		return
+	}
+	if cw.code == 0 {
+		cw.code = code
+	}
+	if cw.enc == nil || !compressibleStatus(code) {
+		cw.commit(false)
+	}
+}
+
+// Write implements part of [http.ResponseWriter].
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.decided && cw.code == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.zw != nil {
+			return cw.zw.Write(data)
+		}
+		return cw.ResponseWriter.Write(data)
+	}
+	cw.buf = append(cw.buf, data...)
+	if n := cw.declaredSize(); n >= 0 || len(cw.buf) >= cw.c.minSize() {
+		// Either the handler told us the length of the body, so that we need
+		// not wait to decide, or we have enough data to compress.
+		if err := cw.commit(n < 0 || n >= cw.c.minSize()); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush implements the [http.Flusher] interface.
+func (cw *compressWriter) Flush() { cw.FlushError() }
+
+// FlushError flushes buffered data to the client, and supports
+// [http.ResponseController].
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		n := cw.declaredSize()
+		if err := cw.commit(n < 0 || n >= cw.c.minSize()); err != nil {
+			return err
+		}
+	}
+	if f, ok := cw.zw.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// declaredSize reports the Content-Length set by the handler, or -1 if the
+// handler did not set a valid length.
+func (cw *compressWriter) declaredSize() int {
+	n, err := strconv.Atoi(cw.Header().Get("Content-Length"))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// commit sends the response header and any buffered body data. If compress
+// is true and the response is eligible, it begins compressing the body.
+func (cw *compressWriter) commit(compress bool) error {
+	cw.decided = true
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	h := cw.Header()
+	addVary(h, "Accept-Encoding")
+	if len(cw.buf) != 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	hasBody := len(buf) != 0 || (cw.head && cw.declaredSize() > 0)
+	if compress && hasBody && cw.eligible(h) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.enc.Coding)
+		if etag := h.Get("Etag"); etag != "" {
+			h.Set("Etag", variantETag(etag, cw.enc.Coding))
+		}
+		cw.ResponseWriter.WriteHeader(cw.code)
+		if cw.head {
+			cw.zw = discardCloser{}
+			return nil
+		}
+		cw.zw = cw.enc.NewWriter(cw.ResponseWriter)
+		_, err := cw.zw.Write(buf)
+		return err
+	}
+
+	// A 304 response describes the representation the client already has. If
+	// the client presented a coding-specific tag, report the same variant.
+	if cw.code == http.StatusNotModified && cw.stripped {
+		if etag := h.Get("Etag"); etag != "" {
+			h.Set("Etag", variantETag(etag, cw.enc.Coding))
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+	if len(buf) != 0 {
+		_, err := cw.ResponseWriter.Write(buf)
+		return err
+	}
+	return nil
+}
+
+// eligible reports whether the response described by h can be compressed.
+func (cw *compressWriter) eligible(h http.Header) bool {
+	return cw.enc != nil &&
+		compressibleStatus(cw.code) &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		!hasDirective(h.Values("Cache-Control"), "no-transform") &&
+		cw.c.compressible(h.Get("Content-Type"))
+}
+
+// finish completes the response after the underlying handler returns.
+func (cw *compressWriter) finish() {
+	if !cw.decided {
+		size := len(cw.buf)
+		if cw.head && size == 0 {
+			size = cw.declaredSize()
+		}
+		cw.commit(size >= cw.c.minSize())
+	}
+	if cw.zw != nil {
+		cw.zw.Close()
+	}
+}
+
+// discardCloser is an [io.WriteCloser] that discards the body of a
+// compressed response to a HEAD request.
+type discardCloser struct{}
+
+func (discardCloser) Write(data []byte) (int, error) { return len(data), nil }
+func (discardCloser) Close() error                   { return nil }
+
+// compressibleStatus reports whether a response with the given status code
+// may have its body compressed.
+func compressibleStatus(code int) bool {
+	switch {
+	case code == http.StatusNoContent, code == http.StatusPartialContent:
+		return false
+	case code >= 200 && code < 300, code >= 400:
+		return true
+	default:
+		return false // 1xx, 3xx
+	}
+}
+
+// isCompressible is the default rule for deciding whether a content type is
+// worth compressing.
+func isCompressible(ctype string) bool {
+	mt, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(ctype))
+	}
+	if mt == "image/svg+xml" {
+		return true
+	}
+	for _, pfx := range []string{"image/", "audio/", "video/", "font/woff"} {
+		if strings.HasPrefix(mt, pfx) {
+			return false
+		}
+	}
+	switch mt {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+		"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+		"application/vnd.rar", "application/x-rar-compressed", "application/x-brotli":
+		return false
+	}
+	return true
+}
+
+// variantETag returns the coding-specific variant of a strong entity tag.
+// Weak and malformed tags are returned unchanged.
+func variantETag(etag, coding string) string {
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + coding + `"`
+}
+
+// stripValidators returns a copy of r in which the coding-specific suffix
+// added by variantETag is removed from the strong entity tags in the
+// If-Match and If-None-Match headers of r. If no changes are needed, it
+// returns r unmodified. It reports whether any changes were made.
+//
+// If-Range is not rewritten: A range of the identity representation cannot
+// be appended to a prefix of the compressed one. Instead, if If-Range holds a
+// coding-specific tag, the Range and If-Range headers are both removed, so
+// that the handler sends the whole representation.
+func stripValidators(r *http.Request, coding string) (*http.Request, bool) {
+	var h http.Header
+	if _, ok := stripCoding(r.Header.Get("If-Range"), coding); ok {
+		h = r.Header.Clone()
+		h.Del("Range")
+		h.Del("If-Range")
+	}
+	for _, name := range []string{"If-Match", "If-None-Match"} {
+		vs := r.Header.Values(name)
+		var out []string
+		changed := false
+		for _, v := range vs {
+			s, ok := stripCoding(v, coding)
+			out = append(out, s)
+			changed = changed || ok
+		}
+		if changed {
+			if h == nil {
+				h = r.Header.Clone()
+			}
+			h[name] = out
+		}
+	}
+	if h == nil {
+		return r, false
+	}
+	r = r.Clone(r.Context())
+	r.Header = h
+	return r, true
+}
+
+// stripCoding removes the suffix added by variantETag for coding from each
+// strong entity tag in s. It reports whether any changes were made.
+func stripCoding(s, coding string) (string, bool) {
+	suffix := "-" + coding + `"`
+	var sb strings.Builder
+	changed := false
+	for {
+		i := strings.Index(s, suffix)
+		if i < 0 {
+			break
+		}
+		// The last quotation mark before the suffix opens the tag.
+		open := strings.LastIndexByte(s[:i], '"')
+		if open < 0 || strings.HasSuffix(s[:open], "W/") {
+			sb.WriteString(s[:i+len(suffix)]) // weak or malformed; keep
+		} else {
+			sb.WriteString(s[:i])
+			sb.WriteByte('"')
+			changed = true
+		}
+		s = s[i+len(suffix):]
+	}
+	sb.WriteString(s)
+	return sb.String(), changed
+}
+
+// addVary adds name to the Vary header of h, if it is not already listed.
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, elt := range splitList(v) {
+			if elt == "*" || strings.EqualFold(elt, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+// hasDirective reports whether any of the specified comma-separated header
+// values contains the given directive name, with or without an argument.
+func hasDirective(vs []string, name string) bool {
+	for _, v := range vs {
+		for _, elt := range splitList(v) {
+			dir, _, _ := strings.Cut(elt, "=")
+			if strings.EqualFold(strings.TrimSpace(dir), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
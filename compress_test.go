@@ -0,0 +1,340 @@
+package mhttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+)
+
+var bigText = strings.Repeat("All work and no play makes Jack a dull boy.\n", 100)
+
+func serveText(status int, body string, headers ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	})
+}
+
+func doRequest(h http.Handler, method string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Add(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody(t *testing.T, coding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	var err error
+	switch coding {
+	case "":
+		return string(body)
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	case "rev":
+		return reverse(string(body))
+	default:
+		t.Fatalf("Unknown coding %q", coding)
+	}
+	if err != nil {
+		t.Fatalf("Open %s reader: %v", coding, err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read %s body: %v", coding, err)
+	}
+	return string(data)
+}
+
+func TestCompressor(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		method   string
+		headers  []string // request headers
+		coding   string   // expected Content-Encoding
+		etag     string   // expected ETag, if non-empty
+		wantBody string
+	}{
+		{"NoAcceptEncoding", serveText(200, bigText), "GET", nil, "", "", bigText},
+		{"Small", serveText(200, "hello"), "GET", []string{"Accept-Encoding", "gzip"}, "", "", "hello"},
+		{"Gzip", serveText(200, bigText), "GET", []string{"Accept-Encoding", "gzip"}, "gzip", "", bigText},
+		{"Deflate", serveText(200, bigText), "GET", []string{"Accept-Encoding", "deflate, gzip;q=0.5"}, "deflate", "", bigText},
+		{"IdentityPreferred", serveText(200, bigText), "GET",
+			[]string{"Accept-Encoding", "gzip;q=0.5, identity"}, "", "", bigText},
+		{"Unsupported", serveText(200, bigText), "GET", []string{"Accept-Encoding", "br"}, "", "", bigText},
+		{"NotFound", serveText(404, bigText), "GET", []string{"Accept-Encoding", "gzip"}, "gzip", "", bigText},
+		{"HEAD", serveText(200, ""), "HEAD", []string{"Accept-Encoding", "gzip"}, "", "", ""},
+		{"Partial", serveText(206, bigText, "Content-Range", "bytes 0-2199/5000"), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "", "", bigText},
+		{"Image", serveText(200, bigText, "Content-Type", "image/png"), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "", "", bigText},
+		{"SVG", serveText(200, bigText, "Content-Type", "image/svg+xml"), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "gzip", "", bigText},
+		{"AlreadyEncoded", serveText(200, bigText, "Content-Encoding", "identity"), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "identity", "", bigText},
+		{"NoTransform", serveText(200, bigText, "Cache-Control", "public, no-transform"), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "", "", bigText},
+		{"SmallDeclared", serveText(200, bigText[:500], "Content-Length", "500"), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "", "", bigText[:500]},
+		{"StrongETag", serveText(200, bigText, "ETag", `"v1"`), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "gzip", `"v1-gzip"`, bigText},
+		{"WeakETag", serveText(200, bigText, "ETag", `W/"v1"`), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "gzip", `W/"v1"`, bigText},
+		{"UncompressedETag", serveText(200, "small", "ETag", `"v1"`), "GET",
+			[]string{"Accept-Encoding", "gzip"}, "", `"v1"`, "small"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &mhttp.Compressor{Handler: tc.handler}
+			rec := doRequest(c, tc.method, tc.headers...)
+			rsp := rec.Result()
+
+			if got := rsp.Header.Get("Content-Encoding"); got != tc.coding {
+				t.Errorf("Content-Encoding: got %q, want %q", got, tc.coding)
+			}
+			if got := rsp.Header.Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary: got %q, want Accept-Encoding", got)
+			}
+			if tc.etag != "" {
+				if got := rsp.Header.Get("Etag"); got != tc.etag {
+					t.Errorf("ETag: got %q, want %q", got, tc.etag)
+				}
+			}
+			coding := tc.coding
+			if coding == "identity" {
+				coding = ""
+			}
+			if got := decodeBody(t, coding, rec.Body.Bytes()); got != tc.wantBody {
+				t.Errorf("Body: got %d bytes, want %d", len(got), len(tc.wantBody))
+			}
+			if coding != "" && rsp.Header.Get("Content-Length") != "" {
+				t.Errorf("Content-Length: got %q, want none", rsp.Header.Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestCompressorConditional(t *testing.T) {
+	var gotINM string
+	c := &mhttp.Compressor{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotINM = r.Header.Get("If-None-Match")
+		w.Header().Set("ETag", `"v1"`)
+		m, err := mhttp.ParseMatchHeader(gotINM)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if m.IsPresent() && m.MatchesWeak(`"v1"`) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, bigText)
+	})}
+
+	// Fetch the compressed representation and capture its tag.
+	rec := doRequest(c, "GET", "Accept-Encoding", "gzip")
+	etag := rec.Result().Header.Get("Etag")
+	if etag != `"v1-gzip"` {
+		t.Fatalf("ETag: got %q, want %q", etag, `"v1-gzip"`)
+	}
+
+	// Revalidate with the compressed tag: The handler should see its own tag,
+	// and the client should get back the compressed variant.
+	rec = doRequest(c, "GET", "Accept-Encoding", "gzip", "If-None-Match", etag+`, W/"x-gzip"`)
+	if got, want := gotINM, `"v1", W/"x-gzip"`; got != want {
+		t.Errorf("Handler If-None-Match: got %q, want %q", got, want)
+	}
+	rsp := rec.Result()
+	if rsp.StatusCode != http.StatusNotModified {
+		t.Errorf("Status: got %d, want %d", rsp.StatusCode, http.StatusNotModified)
+	}
+	if got := rsp.Header.Get("Etag"); got != etag {
+		t.Errorf("ETag: got %q, want %q", got, etag)
+	}
+
+	// Revalidate without compression: The tag should not be rewritten.
+	rec = doRequest(c, "GET", "If-None-Match", etag)
+	if gotINM != etag {
+		t.Errorf("Handler If-None-Match: got %q, want %q", gotINM, etag)
+	}
+	if got := rec.Result().StatusCode; got != http.StatusOK {
+		t.Errorf("Status: got %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestCompressorResume(t *testing.T) {
+	var gotRange string
+	c := &mhttp.Compressor{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(bigText))
+	})}
+
+	// Fetch the compressed representation and capture its tag.
+	rec := doRequest(c, "GET", "Accept-Encoding", "gzip")
+	etag := rec.Result().Header.Get("Etag")
+	if etag != `"abc-gzip"` {
+		t.Fatalf("ETag: got %q, want %q", etag, `"abc-gzip"`)
+	}
+
+	// Resume with the compressed tag: The client must get the whole
+	// compressed representation, not a range of the identity one.
+	rec = doRequest(c, "GET", "Accept-Encoding", "gzip", "Range", "bytes=100-", "If-Range", etag)
+	if gotRange != "" {
+		t.Errorf("Handler Range: got %q, want none", gotRange)
+	}
+	rsp := rec.Result()
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("Status: got %d, want %d", rsp.StatusCode, http.StatusOK)
+	}
+	if got := rsp.Header.Get("Content-Range"); got != "" {
+		t.Errorf("Content-Range: got %q, want none", got)
+	}
+	if got := rsp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding: got %q, want gzip", got)
+	}
+	if got := decodeBody(t, "gzip", rec.Body.Bytes()); got != bigText {
+		t.Errorf("Body: got %d bytes, want the whole %d-byte text", len(got), len(bigText))
+	}
+
+	// Resume with the identity tag: The range is served uncompressed.
+	rec = doRequest(c, "GET", "Accept-Encoding", "gzip", "Range", "bytes=100-", "If-Range", `"abc"`)
+	rsp = rec.Result()
+	if rsp.StatusCode != http.StatusPartialContent {
+		t.Errorf("Status: got %d, want %d", rsp.StatusCode, http.StatusPartialContent)
+	}
+	if got := rsp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding: got %q, want none", got)
+	}
+	if got := rec.Body.String(); got != bigText[100:] {
+		t.Errorf("Body: got %d bytes, want %d", len(got), len(bigText)-100)
+	}
+}
+
+func TestCompressorHead(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{"Content", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Content-Type", "text/plain")
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(bigText))
+		})},
+		{"Body", serveText(200, bigText, "ETag", `"abc"`)},
+		{"Small", serveText(200, "hello", "ETag", `"abc"`)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &mhttp.Compressor{Handler: tc.handler}
+			get := doRequest(c, "GET", "Accept-Encoding", "gzip").Result()
+			head := doRequest(c, "HEAD", "Accept-Encoding", "gzip")
+			for _, name := range []string{"Content-Encoding", "Content-Length", "Content-Type", "Etag", "Vary"} {
+				if got, want := head.Result().Header.Get(name), get.Header.Get(name); got != want {
+					t.Errorf("HEAD %s: got %q, want %q", name, got, want)
+				}
+			}
+			// An uncompressed body is passed through, for the server to discard.
+			if get.Header.Get("Content-Encoding") != "" && head.Body.Len() != 0 {
+				t.Errorf("HEAD body: got %d bytes, want none", head.Body.Len())
+			}
+		})
+	}
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// revWriter is a toy encoder that reverses the entire body.
+type revWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (r *revWriter) Write(data []byte) (int, error) {
+	r.buf = append(r.buf, data...)
+	return len(data), nil
+}
+
+func (r *revWriter) Close() error {
+	_, err := io.WriteString(r.w, reverse(string(r.buf)))
+	return err
+}
+
+func TestCompressorCustom(t *testing.T) {
+	c := &mhttp.Compressor{
+		Handler: serveText(200, "abcdef", "Content-Type", "application/octet-stream"),
+		Encoders: []mhttp.Encoder{{
+			Coding:    "rev",
+			NewWriter: func(w io.Writer) io.WriteCloser { return &revWriter{w: w} },
+		}, mhttp.GzipEncoder},
+		MinSize:      -1,
+		Compressible: func(ctype string) bool { return ctype == "application/octet-stream" },
+	}
+	rec := doRequest(c, "GET", "Accept-Encoding", "gzip, rev")
+	if got := rec.Result().Header.Get("Content-Encoding"); got != "rev" {
+		t.Errorf("Content-Encoding: got %q, want rev", got)
+	}
+	if got := rec.Body.String(); got != "fedcba" {
+		t.Errorf("Body: got %q, want %q", got, "fedcba")
+	}
+}
+
+func TestCompressorStream(t *testing.T) {
+	c := &mhttp.Compressor{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		for i := range 3 {
+			fmt.Fprintf(w, "chunk %d\n", i)
+			if err := rc.Flush(); err != nil {
+				t.Errorf("Flush: unexpected error: %v", err)
+			}
+		}
+	})}
+	hs := httptest.NewServer(c)
+	defer hs.Close()
+
+	req, err := http.NewRequest("GET", hs.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("Read body: %v", err)
+	}
+	if got := rsp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding: got %q, want gzip", got)
+	}
+	if got, want := decodeBody(t, "gzip", body), "chunk 0\nchunk 1\nchunk 2\n"; got != want {
+		t.Errorf("Body: got %q, want %q", got, want)
+	}
+}
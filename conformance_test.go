@@ -0,0 +1,185 @@
+package mhttp_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+// This file defines a conformance corpus for the header parsers, in two
+// parts.
+//
+// The tables of TestRangeConformance and TestMatchConformance are
+// hand-written. Each case imitates the shape of header value that the kind
+// of client named in its source column is known to send (browsers,
+// command-line tools, download managers, and CDN origin fetches), or a
+// non-conforming variant that motivates the Lenient parsing mode, and
+// records the expected outcome under both Strict and Lenient parsing, so
+// that any change in what is accepted shows up here.
+//
+// TestCapturedConformance checks header values captured verbatim from real
+// traffic, which are kept in testdata/captured with a note of where each
+// came from. See testdata/captured/README.md for the format.
+
+func TestRangeConformance(t *testing.T) {
+	const size = 10000
+	const reject = "reject"
+	tests := []struct {
+		source, input string
+		strict        any // []mhttp.Range or reject
+		lenient       any // []mhttp.Range or reject
+	}{
+		// Conforming values.
+		{"browser media probe", "bytes=0-", tr(0, size), tr(0, size)},
+		{"browser media probe", "bytes=0-1", tr(0, 2), tr(0, 2)},
+		{"browser resume", "bytes=4096-", tr(4096, size), tr(4096, size)},
+		{"download manager", "bytes=100-199", tr(100, 200), tr(100, 200)},
+		{"curl -r", "bytes=0-99,200-299", tr(0, 100, 200, 300), tr(0, 100, 200, 300)},
+		{"CDN origin fetch", "bytes=0-1048575", tr(0, size), tr(0, size)},
+		{"CDN suffix", "bytes=-500", tr(9500, size), tr(9500, size)},
+		{"list with OWS", "bytes=0-5, 10-15", tr(0, 6, 10, 16), tr(0, 6, 10, 16)},
+		{"list with tabs", "bytes=0-5,\t10-15", tr(0, 6, 10, 16), tr(0, 6, 10, 16)},
+
+		// Deviations tolerated only by Lenient.
+		{"capitalized unit", "Bytes=0-5", reject, tr(0, 6)},
+		{"upper-case unit", "BYTES=0-5", reject, tr(0, 6)},
+		{"space around equals", "bytes = 0-5", reject, tr(0, 6)},
+		{"space around dash", "bytes=0 - 5", reject, tr(0, 6)},
+		{"space around suffix", "bytes= -500", tr(9500, size), tr(9500, size)},
+		{"empty element", "bytes=0-5,,10-15", reject, tr(0, 6, 10, 16)},
+		{"trailing comma", "bytes=0-5,", reject, tr(0, 6)},
+		{"surrounding space", " bytes=0-5 ", reject, tr(0, 6)},
+
+		// Values rejected in all modes.
+		{"end before start", "bytes=5-0", reject, reject},
+		{"other unit", "items=0-5", reject, reject},
+		{"missing unit", "0-5", reject, reject},
+		{"only commas", "bytes=,,", reject, reject},
+		{"signed start", "bytes=+5-10", reject, reject},
+		{"hex offsets", "bytes=0x10-0x20", reject, reject},
+		{"start past end", "bytes=20000-", reject, reject},
+	}
+	for _, tc := range tests {
+		for _, mode := range []struct {
+			name string
+			mode mhttp.Mode
+			want any
+		}{{"Strict", mhttp.Strict, tc.strict}, {"Lenient", mhttp.Lenient, tc.lenient}} {
+			got, err := mode.mode.ParseRangeHeader(size, tc.input)
+			if mode.want == reject {
+				if err == nil {
+					t.Errorf("%s %s %q: got %v, want error", mode.name, tc.source, tc.input, got)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s %q: unexpected error: %v", mode.name, tc.source, tc.input, err)
+			} else if diff := cmp.Diff(got, mode.want); diff != "" {
+				t.Errorf("%s %s %q: ranges (-got, +want):\n%s", mode.name, tc.source, tc.input, diff)
+			}
+		}
+	}
+}
+
+func TestMatchConformance(t *testing.T) {
+	const reject = "reject"
+	tests := []struct {
+		source, input string
+		etag          string // the tag to check for a weak match
+		strict        any    // bool or reject
+		lenient       any    // bool or reject
+	}{
+		// Conforming values.
+		{"browser revalidation", `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+			"33a64df551425fcc55e4d42a148795d9f25f89d4", true, true},
+		{"browser weak", `W/"0815"`, `"0815"`, true, true},
+		{"nginx tag", `"5f8a1c2b-264"`, `"5f8a1c2b-264"`, true, true},
+		{"apache tag", `"2d-432a5e4a73a80"`, `"2d-432a5e4a73a80"`, true, true},
+		{"CDN list", `"v1", "v2", W/"v3"`, "v3", true, true},
+		{"create only", "*", "anything", true, true},
+		{"list no spaces", `"a","b"`, "b", true, true},
+
+		// Deviations tolerated only by Lenient.
+		{"unquoted tag", "33a64df5", "33a64df5", reject, true},
+		{"unquoted list", "plum, cherry", "cherry", reject, true},
+		{"mixed quoting", `"plum", cherry`, "cherry", reject, true},
+		{"lower-case weak", `w/"0815"`, "0815", reject, true},
+		{"empty element", `"a",,"b"`, "b", reject, true},
+		{"trailing comma", `"a", `, "a", reject, true},
+		{"leading comma", `, "a"`, "a", reject, true},
+
+		// Values rejected in all modes.
+		{"unterminated", `"abc`, "abc", reject, reject},
+		{"junk after tag", `"a" b`, "a", reject, reject},
+		{"embedded quote", `ab"c"`, "abc", reject, reject},
+	}
+	for _, tc := range tests {
+		for _, mode := range []struct {
+			name string
+			mode mhttp.Mode
+			want any
+		}{{"Strict", mhttp.Strict, tc.strict}, {"Lenient", mhttp.Lenient, tc.lenient}} {
+			m, err := mode.mode.ParseMatchHeader(tc.input)
+			if mode.want == reject {
+				if err == nil {
+					t.Errorf("%s %s %q: got %v, want error", mode.name, tc.source, tc.input, m)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s %q: unexpected error: %v", mode.name, tc.source, tc.input, err)
+			} else if got := m.MatchesWeak(tc.etag); got != mode.want {
+				t.Errorf("%s %s %q: match %q: got %v, want %v", mode.name, tc.source, tc.input, tc.etag, got, mode.want)
+			}
+		}
+	}
+}
+
+func TestCapturedConformance(t *testing.T) {
+	files, err := filepath.Glob("testdata/captured/*.txt")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	} else if len(files) == 0 {
+		t.Skip("No captured header values in testdata/captured")
+	}
+	for _, path := range files {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Read captures: %v", err)
+			}
+			lines := strings.Split(string(data), "\n")
+			if !strings.HasPrefix(lines[0], "#") {
+				t.Fatal("Captures do not begin with a note of their source")
+			}
+			for i, line := range lines {
+				line = strings.TrimSuffix(line, "\r")
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				name, value, ok := strings.Cut(line, ":")
+				value = strings.TrimLeft(value, " \t")
+				switch {
+				case !ok:
+					t.Errorf("Line %d: invalid header %q", i+1, line)
+				case strings.EqualFold(name, "Range"):
+					// Check the syntax only, with a size no range can exceed.
+					if _, err := mhttp.Lenient.ParseRangeHeader(math.MaxInt64, value); err != nil {
+						t.Errorf("Line %d: Range %q: %v", i+1, value, err)
+					}
+				case strings.EqualFold(name, "If-Match"), strings.EqualFold(name, "If-None-Match"):
+					if _, err := mhttp.Lenient.ParseMatchHeader(value); err != nil {
+						t.Errorf("Line %d: %s %q: %v", i+1, name, value, err)
+					}
+				default:
+					t.Errorf("Line %d: unexpected header %q", i+1, name)
+				}
+			}
+		})
+	}
+}
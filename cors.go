@@ -0,0 +1,209 @@
+package mhttp
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSMethods are the methods a [CORSHandler] allows if its
+// AllowMethods field is empty.
+var DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// DefaultCORSExposeHeaders are the response headers a [CORSHandler] exposes
+// if its ExposeHeaders field is nil. They are the headers used by range and
+// conditional requests that are not safelisted for scripts by default.
+var DefaultCORSExposeHeaders = []string{"ETag", "Content-Range", "Accept-Ranges"}
+
+// A CORSHandler is an [http.Handler] that implements [Cross-Origin Resource
+// Sharing] for an underlying handler.
+//
+// A preflight request, that is, an OPTIONS request with an
+// Access-Control-Request-Method header, is answered by the CORSHandler
+// itself: with status 204 (No Content) if the origin, method, headers, and
+// private network access it requests are allowed, or 403 (Forbidden)
+// otherwise. Other requests are delegated to the underlying handler, with
+// CORS headers added to the response if their origin is allowed.
+//
+// Because the response depends on the Origin header, every response gets
+// "Origin" in its Vary header, whether or not the request had an origin.
+//
+// [Cross-Origin Resource Sharing]: https://fetch.spec.whatwg.org/#http-cors-protocol
+type CORSHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+
+	// AllowOrigins are the origins allowed to make requests. Each is one of:
+	//
+	//   - "*", which allows any origin, unless AllowCredentials is set.
+	//   - An exact origin, such as "https://example.com".
+	//   - An origin with a wildcard subdomain, such as "https://*.example.com",
+	//     which allows any subdomain of example.com, but not example.com.
+	AllowOrigins []string
+
+	// AllowOrigin, if non-nil, reports whether an origin not matched by
+	// AllowOrigins is allowed.
+	AllowOrigin func(origin string) bool
+
+	// AllowMethods are the methods allowed in preflight requests, or "*" to
+	// allow any method. If empty, DefaultCORSMethods are allowed.
+	AllowMethods []string
+
+	// AllowHeaders are the request headers allowed in preflight requests, or
+	// "*" to allow any header.
+	AllowHeaders []string
+
+	// ExposeHeaders are the response headers exposed to scripts. If nil,
+	// DefaultCORSExposeHeaders are exposed; to expose none, set it to an
+	// empty non-nil slice.
+	ExposeHeaders []string
+
+	// AllowCredentials, if true, allows requests with credentials. Since that
+	// lets the allowed origins act with the user's cookies and other
+	// credentials, "*" in AllowOrigins then allows no origin. To allow
+	// credentialed requests from any origin anyway, say so explicitly with
+	// an AllowOrigin function; the origin it allows is reflected in the
+	// response, since browsers reject "*" for credentialed requests.
+	AllowCredentials bool
+
+	// MaxAge, if positive, is how long a preflight response may be cached.
+	MaxAge time.Duration
+
+	// AllowPrivateNetwork, if true, allows preflight requests for access to a
+	// private network, as indicated by Access-Control-Request-Private-Network.
+	AllowPrivateNetwork bool
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (c CORSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	addVary(h, "Origin")
+	origin := r.Header.Get("Origin")
+	isPreflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	if isPreflight {
+		addVary(h, "Access-Control-Request-Method")
+		addVary(h, "Access-Control-Request-Headers")
+		addVary(h, "Access-Control-Request-Private-Network")
+		c.preflight(w, r, origin)
+		return
+	}
+	if allow, ok := c.allowOrigin(origin); ok {
+		h.Set("Access-Control-Allow-Origin", allow)
+		if c.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		expose := c.ExposeHeaders
+		if expose == nil {
+			expose = DefaultCORSExposeHeaders
+		}
+		if len(expose) != 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(expose, ", "))
+		}
+	}
+	c.Handler.ServeHTTP(w, r)
+}
+
+// preflight answers a preflight request.
+func (c CORSHandler) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	allow, ok := c.allowOrigin(origin)
+	if !ok {
+		NewProblem(http.StatusForbidden, "origin not allowed").ServeHTTP(w, r)
+		return
+	}
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !c.allowMethod(method) {
+		NewProblem(http.StatusForbidden, "method "+method+" not allowed").ServeHTTP(w, r)
+		return
+	}
+	var headers []string
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range splitList(v) {
+			if !c.allowHeader(name) {
+				NewProblem(http.StatusForbidden, "header "+name+" not allowed").ServeHTTP(w, r)
+				return
+			}
+			headers = append(headers, strings.ToLower(name))
+		}
+	}
+	privateNet := strings.EqualFold(r.Header.Get("Access-Control-Request-Private-Network"), "true")
+	if privateNet && !c.AllowPrivateNetwork {
+		NewProblem(http.StatusForbidden, "private network access not allowed").ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", allow)
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	// Reflect the requested method and headers, since browsers do not
+	// honor "*" for credentialed requests, nor for Authorization at all.
+	h.Set("Access-Control-Allow-Methods", method)
+	if len(headers) != 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if c.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(c.MaxAge/time.Second), 10))
+	}
+	if privateNet {
+		h.Set("Access-Control-Allow-Private-Network", "true")
+	}
+	h.Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowOrigin reports whether origin is allowed, and if so, the value of the
+// Access-Control-Allow-Origin header for it.
+func (c CORSHandler) allowOrigin(origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+	for _, pat := range c.AllowOrigins {
+		if pat == "*" {
+			if !c.AllowCredentials {
+				return "*", true
+			}
+		} else if matchOrigin(pat, origin) {
+			return origin, true
+		}
+	}
+	if c.AllowOrigin != nil && c.AllowOrigin(origin) {
+		return origin, true
+	}
+	return "", false
+}
+
+// matchOrigin reports whether origin matches the pattern pat, which is
+// either an exact origin or one with a wildcard subdomain.
+func matchOrigin(pat, origin string) bool {
+	if strings.EqualFold(pat, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(pat, "://*.")
+	if !ok {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Scheme, scheme) || u.Path != "" || u.RawQuery != "" {
+		return false
+	}
+	sub, ok := strings.CutSuffix(strings.ToLower(u.Host), "."+strings.ToLower(host))
+	return ok && sub != "" && !strings.HasPrefix(sub, ".")
+}
+
+func (c CORSHandler) allowMethod(method string) bool {
+	methods := c.AllowMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	return slices.Contains(methods, "*") || slices.Contains(methods, method)
+}
+
+func (c CORSHandler) allowHeader(name string) bool {
+	return slices.ContainsFunc(c.AllowHeaders, func(s string) bool {
+		return s == "*" || strings.EqualFold(s, name)
+	})
+}
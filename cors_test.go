@@ -0,0 +1,296 @@
+package mhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCORSHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"x"`)
+		w.Write([]byte("ok"))
+	})
+	corsHeaders := []string{
+		"Access-Control-Allow-Origin",
+		"Access-Control-Allow-Credentials",
+		"Access-Control-Allow-Methods",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Allow-Private-Network",
+		"Access-Control-Expose-Headers",
+		"Access-Control-Max-Age",
+		"Vary",
+	}
+
+	tests := []struct {
+		name       string
+		handler    mhttp.CORSHandler
+		method     string
+		reqHeaders map[string]string
+		wantCode   int
+		want       map[string]string // CORS response headers; omitted headers must be empty
+	}{
+		{
+			name:     "NoOrigin",
+			handler:  mhttp.CORSHandler{AllowOrigins: []string{"*"}},
+			method:   "GET",
+			wantCode: http.StatusOK,
+			want:     map[string]string{"Vary": "Origin"},
+		},
+		{
+			name:       "AnyOrigin",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"*"}},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://a.example"},
+			wantCode:   http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":   "*",
+				"Access-Control-Expose-Headers": "ETag, Content-Range, Accept-Ranges",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:       "AnyOriginCredentials",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"*"}, AllowCredentials: true},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://a.example"},
+			wantCode:   http.StatusOK,
+			want:       map[string]string{"Vary": "Origin"},
+		},
+		{
+			name:       "AnyOriginCredentialsPreflight",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"*"}, AllowCredentials: true},
+			method:     "OPTIONS",
+			reqHeaders: map[string]string{"Origin": "https://a.example", "Access-Control-Request-Method": "GET"},
+			wantCode:   http.StatusForbidden,
+			want: map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network, Accept",
+			},
+		},
+		{
+			name: "FuncOriginCredentials",
+			handler: mhttp.CORSHandler{
+				AllowOrigin:      func(string) bool { return true },
+				AllowCredentials: true,
+				ExposeHeaders:    []string{},
+			},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://a.example"},
+			wantCode:   http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://a.example",
+				"Access-Control-Allow-Credentials": "true",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:       "ExactOrigin",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"https://a.example"}},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://a.example"},
+			wantCode:   http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":   "https://a.example",
+				"Access-Control-Expose-Headers": "ETag, Content-Range, Accept-Ranges",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:       "OriginNotAllowed",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"https://a.example"}},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://b.example"},
+			wantCode:   http.StatusOK,
+			want:       map[string]string{"Vary": "Origin"},
+		},
+		{
+			name:       "WildcardSubdomain",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"https://*.example.com"}, ExposeHeaders: []string{}},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://api.v2.example.com"},
+			wantCode:   http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin": "https://api.v2.example.com",
+				"Vary":                        "Origin",
+			},
+		},
+		{
+			name:       "WildcardSubdomainApex",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"https://*.example.com"}},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://example.com"},
+			wantCode:   http.StatusOK,
+			want:       map[string]string{"Vary": "Origin"},
+		},
+		{
+			name:       "WildcardSubdomainScheme",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"https://*.example.com"}},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "http://a.example.com"},
+			wantCode:   http.StatusOK,
+			want:       map[string]string{"Vary": "Origin"},
+		},
+		{
+			name:       "WildcardSubdomainSuffix",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"https://*.example.com"}},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "https://evilexample.com"},
+			wantCode:   http.StatusOK,
+			want:       map[string]string{"Vary": "Origin"},
+		},
+		{
+			name: "Predicate",
+			handler: mhttp.CORSHandler{
+				AllowOrigin:   func(o string) bool { return strings.HasSuffix(o, ":8080") },
+				ExposeHeaders: []string{"X-Total"},
+			},
+			method:     "GET",
+			reqHeaders: map[string]string{"Origin": "http://localhost:8080"},
+			wantCode:   http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":   "http://localhost:8080",
+				"Access-Control-Expose-Headers": "X-Total",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name: "Preflight",
+			handler: mhttp.CORSHandler{
+				AllowOrigins:     []string{"https://a.example"},
+				AllowMethods:     []string{"GET", "PUT"},
+				AllowHeaders:     []string{"Content-Type", "If-Match"},
+				AllowCredentials: true,
+				MaxAge:           10 * time.Minute,
+			},
+			method: "OPTIONS",
+			reqHeaders: map[string]string{
+				"Origin":                         "https://a.example",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "content-type, if-match",
+			},
+			wantCode: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://a.example",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "PUT",
+				"Access-Control-Allow-Headers":     "content-type, if-match",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network",
+			},
+		},
+		{
+			name:    "PreflightPrivateNetwork",
+			handler: mhttp.CORSHandler{AllowOrigins: []string{"*"}, AllowPrivateNetwork: true},
+			method:  "OPTIONS",
+			reqHeaders: map[string]string{
+				"Origin":                                 "https://a.example",
+				"Access-Control-Request-Method":          "GET",
+				"Access-Control-Request-Private-Network": "true",
+			},
+			wantCode: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":          "*",
+				"Access-Control-Allow-Methods":         "GET",
+				"Access-Control-Allow-Private-Network": "true",
+				"Vary":                                 "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network",
+			},
+		},
+		{
+			name:    "PreflightPrivateNetworkDenied",
+			handler: mhttp.CORSHandler{AllowOrigins: []string{"*"}},
+			method:  "OPTIONS",
+			reqHeaders: map[string]string{
+				"Origin":                                 "https://a.example",
+				"Access-Control-Request-Method":          "GET",
+				"Access-Control-Request-Private-Network": "true",
+			},
+			wantCode: http.StatusForbidden,
+			want: map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network, Accept",
+			},
+		},
+		{
+			name:    "PreflightMethodDenied",
+			handler: mhttp.CORSHandler{AllowOrigins: []string{"*"}},
+			method:  "OPTIONS",
+			reqHeaders: map[string]string{
+				"Origin":                        "https://a.example",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			wantCode: http.StatusForbidden,
+			want: map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network, Accept",
+			},
+		},
+		{
+			name:    "PreflightHeaderDenied",
+			handler: mhttp.CORSHandler{AllowOrigins: []string{"*"}, AllowHeaders: []string{"X-Ok"}},
+			method:  "OPTIONS",
+			reqHeaders: map[string]string{
+				"Origin":                         "https://a.example",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "x-ok,x-bad",
+			},
+			wantCode: http.StatusForbidden,
+			want: map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network, Accept",
+			},
+		},
+		{
+			name:    "PreflightAnyHeader",
+			handler: mhttp.CORSHandler{AllowOrigins: []string{"*"}, AllowMethods: []string{"*"}, AllowHeaders: []string{"*"}},
+			method:  "OPTIONS",
+			reqHeaders: map[string]string{
+				"Origin":                         "https://a.example",
+				"Access-Control-Request-Method":  "PATCH",
+				"Access-Control-Request-Headers": "Authorization",
+			},
+			wantCode: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "PATCH",
+				"Access-Control-Allow-Headers": "authorization",
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network",
+			},
+		},
+		{
+			name:       "PlainOptions",
+			handler:    mhttp.CORSHandler{AllowOrigins: []string{"*"}, ExposeHeaders: []string{}},
+			method:     "OPTIONS",
+			reqHeaders: map[string]string{"Origin": "https://a.example"},
+			wantCode:   http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Vary":                        "Origin",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.handler.Handler = ok
+			req := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.reqHeaders {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rec, req)
+			if rec.Code != tc.wantCode {
+				t.Errorf("Status: got %d, want %d", rec.Code, tc.wantCode)
+			}
+			got := make(map[string]string)
+			for _, name := range corsHeaders {
+				if v := strings.Join(rec.Header().Values(name), ", "); v != "" {
+					got[name] = v
+				}
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("Headers (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package mhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Layouts for the date formats defined by RFC 9110 Section 5.6.7.
+const (
+	imfFixdate = http.TimeFormat                  // Sun, 06 Nov 1994 08:49:37 GMT
+	rfc850Date = "Monday, 02-Jan-06 15:04:05 GMT" // Sunday, 06-Nov-94 08:49:37 GMT
+	asctime    = time.ANSIC                       // Sun Nov  6 08:49:37 1994
+)
+
+// ParseHTTPDate parses s as an [HTTP-date]. It accepts the preferred
+// IMF-fixdate format as well as the obsolete RFC 850 and ANSI C asctime
+// formats. The result is in UTC.
+//
+// For the RFC 850 format, which has a two-digit year, a year that would be
+// more than 50 years in the future is interpreted as the most recent year in
+// the past with the same last two digits.
+//
+// [HTTP-date]: https://httpwg.org/specs/rfc9110.html#http.date
+func ParseHTTPDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(imfFixdate, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(rfc850Date, s); err == nil {
+		// Adjust the century per RFC 9110 Section 5.6.7.
+		now := time.Now().UTC()
+		year := now.Year() - now.Year()%100 + t.Year()%100
+		if year > now.Year()+50 {
+			year -= 100
+		}
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), nil
+	}
+	if t, err := time.Parse(asctime, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid HTTP date %q", s)
+}
+
+// FormatHTTPDate formats t as an IMF-fixdate, the preferred format for an
+// HTTP-date. The result is truncated to whole seconds in UTC.
+func FormatHTTPDate(t time.Time) string { return t.UTC().Format(imfFixdate) }
+
+// Since is the parsed representation of an If-Modified-Since or
+// If-Unmodified-Since header.
+type Since struct {
+	t time.Time // zero if not present
+}
+
+// ParseSinceHeader parses the contents of an HTTP If-Modified-Since or
+// If-Unmodified-Since header and returns a [Since]. If the header is empty it
+// returns a Since that accepts all resources. Use [Since.IsPresent] to check
+// for this case. An error is only reported if the header is present but
+// invalid.
+//
+// Per RFC 9110, a recipient must ignore either header if its value is not a
+// valid HTTP-date, so callers should usually treat an error as equivalent to
+// an absent header.
+func ParseSinceHeader(s string) (Since, error) {
+	if strings.TrimSpace(s) == "" {
+		return Since{}, nil // not present
+	}
+	t, err := ParseHTTPDate(s)
+	if err != nil {
+		return Since{}, err
+	}
+	return Since{t: t}, nil
+}
+
+// IsPresent reports whether a date header was present at the time of parsing.
+func (s Since) IsPresent() bool { return !s.t.IsZero() }
+
+// Time returns the time specified by s, or the zero time if s is not present.
+func (s Since) Time() time.Time { return s.t }
+
+// ModifiedSince reports whether a representation last modified at the given
+// time satisfies an If-Modified-Since condition represented by s.  Because
+// HTTP dates have a resolution of one second, lastModified is truncated to
+// whole seconds before it is compared.
+//
+// If s is not present, or if lastModified is zero, the answer is always true.
+// Otherwise, it reports whether lastModified is strictly after s.
+func (s Since) ModifiedSince(lastModified time.Time) bool {
+	if !s.IsPresent() || lastModified.IsZero() {
+		return true
+	}
+	return lastModified.Truncate(time.Second).After(s.t)
+}
+
+// UnmodifiedSince reports whether a representation last modified at the
+// given time satisfies an If-Unmodified-Since condition represented by s.
+// Because HTTP dates have a resolution of one second, lastModified is
+// truncated to whole seconds before it is compared.
+//
+// If s is not present, or if lastModified is zero, the answer is always true.
+// Otherwise, it reports whether lastModified is not after s.
+func (s Since) UnmodifiedSince(lastModified time.Time) bool {
+	if !s.IsPresent() || lastModified.IsZero() {
+		return true
+	}
+	return !lastModified.Truncate(time.Second).After(s.t)
+}
+
+// IsStrongLastModified reports whether a Last-Modified time may be used as a
+// [strong validator], given the time at which the representation was
+// generated (for example, the value of its Date header).
+//
+// A Last-Modified time is implicitly weak, since the representation could
+// have changed more than once during the second it names. It is strong only
+// if the representation was generated at least one second after it was last
+// modified.
+//
+// [strong validator]: https://httpwg.org/specs/rfc9110.html#lastmod.comparison
+func IsStrongLastModified(lastModified, date time.Time) bool {
+	if lastModified.IsZero() || date.IsZero() {
+		return false
+	}
+	return !date.Truncate(time.Second).Before(lastModified.Truncate(time.Second).Add(time.Second))
+}
@@ -0,0 +1,116 @@
+package mhttp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+)
+
+func TestParseHTTPDate(t *testing.T) {
+	want := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+	tests := []struct {
+		name, input string
+		want        time.Time
+	}{
+		{"IMF", "Sun, 06 Nov 1994 08:49:37 GMT", want},
+		{"RFC850", "Sunday, 06-Nov-94 08:49:37 GMT", want},
+		{"Asctime", "Sun Nov  6 08:49:37 1994", want},
+		{"Spaces", "  Sun, 06 Nov 1994 08:49:37 GMT ", want},
+		{"RFC850Recent", "Friday, 01-Jan-21 00:00:00 GMT", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mhttp.ParseHTTPDate(tc.input)
+			if err != nil {
+				t.Fatalf("ParseHTTPDate(%q): unexpected error: %v", tc.input, err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("ParseHTTPDate(%q): got %v, want %v", tc.input, got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Fail", func(t *testing.T) {
+		for _, input := range []string{
+			"",
+			"yesterday",
+			"Sun, 06 Nov 1994 08:49:37 PST",
+			"1994-11-06T08:49:37Z",
+			"Sun, 06 Nov 1994",
+		} {
+			got, err := mhttp.ParseHTTPDate(input)
+			if err == nil || !strings.Contains(err.Error(), "invalid HTTP date") {
+				t.Errorf("ParseHTTPDate(%q): got (%v, %v), want error", input, got, err)
+			}
+		}
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		in := time.Date(1994, 11, 6, 3, 49, 37, 500, time.FixedZone("EST", -5*3600))
+		if got, want := mhttp.FormatHTTPDate(in), "Sun, 06 Nov 1994 08:49:37 GMT"; got != want {
+			t.Errorf("FormatHTTPDate(%v): got %q, want %q", in, got, want)
+		}
+	})
+}
+
+func TestSince(t *testing.T) {
+	const header = "Sun, 06 Nov 1994 08:49:37 GMT"
+	base := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+
+	tests := []struct {
+		header      string
+		lastMod     time.Time
+		mod, unmod  bool
+		description string
+	}{
+		{"", base, true, true, "absent header"},
+		{header, time.Time{}, true, true, "no modification time"},
+		{header, base, false, true, "equal"},
+		{header, base.Add(999 * time.Millisecond), false, true, "same second"},
+		{header, base.Add(time.Second), true, false, "one second later"},
+		{header, base.Add(-time.Second), false, true, "one second earlier"},
+	}
+	for _, tc := range tests {
+		s, err := mhttp.ParseSinceHeader(tc.header)
+		if err != nil {
+			t.Errorf("ParseSinceHeader(%q): unexpected error: %v", tc.header, err)
+			continue
+		}
+		if got, want := s.IsPresent(), tc.header != ""; got != want {
+			t.Errorf("%s: IsPresent: got %v, want %v", tc.description, got, want)
+		}
+		if got := s.ModifiedSince(tc.lastMod); got != tc.mod {
+			t.Errorf("%s: ModifiedSince(%v): got %v, want %v", tc.description, tc.lastMod, got, tc.mod)
+		}
+		if got := s.UnmodifiedSince(tc.lastMod); got != tc.unmod {
+			t.Errorf("%s: UnmodifiedSince(%v): got %v, want %v", tc.description, tc.lastMod, got, tc.unmod)
+		}
+	}
+
+	if s, err := mhttp.ParseSinceHeader("bogus"); err == nil {
+		t.Errorf("ParseSinceHeader(bogus): got %v, want error", s)
+	}
+}
+
+func TestIsStrongLastModified(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 250, time.UTC)
+	tests := []struct {
+		lastMod, date time.Time
+		want          bool
+	}{
+		{base, base, false},
+		{base, base.Add(500 * time.Millisecond), false},
+		{base, base.Add(time.Second), true},
+		{base, base.Add(time.Hour), true},
+		{base, base.Add(-time.Second), false},
+		{time.Time{}, base, false},
+		{base, time.Time{}, false},
+	}
+	for _, tc := range tests {
+		if got := mhttp.IsStrongLastModified(tc.lastMod, tc.date); got != tc.want {
+			t.Errorf("IsStrongLastModified(%v, %v): got %v, want %v", tc.lastMod, tc.date, got, tc.want)
+		}
+	}
+}
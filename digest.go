@@ -0,0 +1,365 @@
+package mhttp
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/creachadair/mhttp/sfv"
+)
+
+// A HashAlgorithm is a hash algorithm for the integrity fields of RFC 9530,
+// Content-Digest and Repr-Digest.
+type HashAlgorithm struct {
+	// Name is the registered name of the algorithm, for example "sha-256".
+	// It must be a valid structured field key, which is lower case.
+	Name string
+
+	// New returns a new hash for the algorithm.
+	New func() hash.Hash
+}
+
+var (
+	// HashSHA256 is the "sha-256" [HashAlgorithm].
+	HashSHA256 = HashAlgorithm{Name: "sha-256", New: sha256.New}
+
+	// HashSHA512 is the "sha-512" [HashAlgorithm].
+	HashSHA512 = HashAlgorithm{Name: "sha-512", New: sha512.New}
+)
+
+// hashAlgorithms are the algorithms supported for verification.
+var hashAlgorithms = []HashAlgorithm{HashSHA512, HashSHA256}
+
+// ErrDigestMismatch is reported when content does not match its digest.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// A DigestValue is a single digest from a Content-Digest or Repr-Digest
+// header.
+type DigestValue struct {
+	Algorithm string // e.g., "sha-256"
+	Value     []byte
+}
+
+// ParseIntegrityHeader parses the contents of a Content-Digest or Repr-Digest
+// header (RFC 9530 Section 2 and 3), which is a structured dictionary whose
+// values are byte sequences.
+func ParseIntegrityHeader(s string) ([]DigestValue, error) {
+	d, err := sfv.ParseDictionary(s)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DigestValue, 0, len(d))
+	for _, e := range d {
+		it, ok := e.Value.(sfv.Item)
+		if !ok {
+			return nil, fmt.Errorf("digest %q is not an item", e.Key)
+		}
+		v, ok := it.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("digest %q is not a byte sequence", e.Key)
+		}
+		out = append(out, DigestValue{Algorithm: e.Key, Value: v})
+	}
+	return out, nil
+}
+
+// FormatIntegrityHeader renders the contents of a Content-Digest or
+// Repr-Digest header for the given digests. It reports an error if an
+// algorithm name is not a valid structured field key.
+func FormatIntegrityHeader(ds ...DigestValue) (string, error) {
+	var d sfv.Dictionary
+	for _, dv := range ds {
+		d.Set(dv.Algorithm, sfv.Item{Value: dv.Value})
+	}
+	s, err := sfv.FormatDictionary(d)
+	if err != nil {
+		return "", fmt.Errorf("format digests: %w", err)
+	}
+	return s, nil
+}
+
+// A DigestWant is a single preference from a Want-Content-Digest or
+// Want-Repr-Digest header.
+type DigestWant struct {
+	Algorithm string // e.g., "sha-256"
+	Weight    int    // from 0 (not acceptable) to 10 (most preferred)
+}
+
+// ParseWantDigestHeader parses the contents of a Want-Content-Digest or
+// Want-Repr-Digest header (RFC 9530 Section 4), which is a structured
+// dictionary whose values are integers from 0 to 10.
+func ParseWantDigestHeader(s string) ([]DigestWant, error) {
+	d, err := sfv.ParseDictionary(s)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DigestWant, 0, len(d))
+	for _, e := range d {
+		it, ok := e.Value.(sfv.Item)
+		if !ok {
+			return nil, fmt.Errorf("preference %q is not an item", e.Key)
+		}
+		w, ok := it.Value.(int64)
+		if !ok || w < 0 || w > 10 {
+			return nil, fmt.Errorf("preference %q is not an integer from 0 to 10", e.Key)
+		}
+		out = append(out, DigestWant{Algorithm: e.Key, Weight: int(w)})
+	}
+	return out, nil
+}
+
+// selectHashes returns the algorithms from algs to use for a response, given
+// the value of a Want-*-Digest header. If the header is empty or invalid, all
+// of algs are used. Otherwise, the supported algorithm with the highest
+// positive weight is used; if no supported algorithm has a positive weight,
+// all of algs whose weight is not zero are used.
+func selectHashes(want string, algs []HashAlgorithm) []HashAlgorithm {
+	ws, err := ParseWantDigestHeader(want)
+	if err != nil || len(ws) == 0 {
+		return algs
+	}
+	var best *HashAlgorithm
+	bestWeight := 0
+	var rest []HashAlgorithm
+	for i, alg := range algs {
+		j := slices.IndexFunc(ws, func(w DigestWant) bool { return w.Algorithm == alg.Name })
+		if j < 0 {
+			rest = append(rest, alg)
+		} else if ws[j].Weight > bestWeight {
+			best, bestWeight = &algs[i], ws[j].Weight
+		}
+	}
+	if best != nil {
+		return []HashAlgorithm{*best}
+	}
+	return rest
+}
+
+// digestsOf returns the digests of data under each of algs.
+func digestsOf(data []byte, algs []HashAlgorithm) []DigestValue {
+	out := make([]DigestValue, len(algs))
+	for i, alg := range algs {
+		h := alg.New()
+		h.Write(data)
+		out[i] = DigestValue{Algorithm: alg.Name, Value: h.Sum(nil)}
+	}
+	return out
+}
+
+// A DigestHandler is an [http.Handler] that adds Content-Digest and
+// Repr-Digest headers (RFC 9530) to the responses of an underlying handler.
+//
+// The handler's response is buffered in memory so that its digests can be
+// sent in the header. The algorithms used for each field are chosen from
+// Algorithms according to the Want-Content-Digest and Want-Repr-Digest
+// headers of the request, if any. A digest header already set by the handler
+// is left unchanged. Responses to HEAD requests, and responses without
+// content (1xx, 204, and 304), are passed through unchanged.
+//
+// Content-Digest covers the content of the response as sent, and Repr-Digest
+// covers the complete selected representation. These differ for range
+// requests: to compute both, the DigestHandler gives the underlying handler
+// the request without its Range and If-Range headers, computes Repr-Digest
+// over the complete response, and then serves the requested ranges itself
+// using [http.ServeContent], including multipart/byteranges responses. The
+// handler's ETag and Last-Modified headers are used to evaluate If-Range.
+//
+// If an algorithm selected for a response has a name that is not a valid
+// structured field key, the response is replaced by status 500 (Internal
+// Server Error).
+type DigestHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+
+	// Algorithms are the hash algorithms that may be used, in order of
+	// preference. If empty, only HashSHA256 is used.
+	Algorithms []HashAlgorithm
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (d DigestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		d.Handler.ServeHTTP(w, r)
+		return
+	}
+	algs := d.Algorithms
+	if len(algs) == 0 {
+		algs = []HashAlgorithm{HashSHA256}
+	}
+
+	orig := r
+	isRange := r.Method == http.MethodGet && r.Header.Get("Range") != ""
+	if isRange {
+		r = r.Clone(r.Context())
+		r.Header.Del("Range")
+		r.Header.Del("If-Range")
+	}
+	full := newResponseBuffer()
+	d.Handler.ServeHTTP(full, r)
+	if !full.hasContent() {
+		full.copyTo(w)
+		return
+	}
+
+	h := full.Header()
+	if h.Get("Repr-Digest") == "" {
+		reprAlgs := selectHashes(strings.Join(orig.Header.Values("Want-Repr-Digest"), ","), algs)
+		if len(reprAlgs) != 0 {
+			s, err := FormatIntegrityHeader(digestsOf(full.body.Bytes(), reprAlgs)...)
+			if err != nil {
+				NewProblem(http.StatusInternalServerError, err.Error()).ServeHTTP(w, orig)
+				return
+			}
+			h.Set("Repr-Digest", s)
+		}
+	}
+
+	out := full
+	if isRange && full.code == http.StatusOK && h.Get("Content-Encoding") == "" {
+		// Serve the requested ranges from the complete representation.
+		out = newResponseBuffer()
+		for name, vs := range h {
+			out.header[name] = vs
+		}
+		out.header.Del("Content-Length")
+		out.header.Del("Content-Digest")
+		modTime, _ := ParseHTTPDate(h.Get("Last-Modified"))
+		http.ServeContent(out, orig, "", modTime, bytes.NewReader(full.body.Bytes()))
+	}
+	if out.hasContent() && out.Header().Get("Content-Digest") == "" {
+		contentAlgs := selectHashes(strings.Join(orig.Header.Values("Want-Content-Digest"), ","), algs)
+		if len(contentAlgs) != 0 {
+			s, err := FormatIntegrityHeader(digestsOf(out.body.Bytes(), contentAlgs)...)
+			if err != nil {
+				NewProblem(http.StatusInternalServerError, err.Error()).ServeHTTP(w, orig)
+				return
+			}
+			out.Header().Set("Content-Digest", s)
+		}
+	}
+	out.copyTo(w)
+}
+
+// responseBuffer is an [http.ResponseWriter] that records a response in
+// memory.
+type responseBuffer struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer { return &responseBuffer{header: make(http.Header)} }
+
+func (b *responseBuffer) Header() http.Header { return b.header }
+
+func (b *responseBuffer) WriteHeader(code int) {
+	if b.code == 0 && code >= 200 {
+		b.code = code
+	}
+}
+
+func (b *responseBuffer) Write(data []byte) (int, error) {
+	if b.code == 0 {
+		b.code = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+// hasContent reports whether the recorded response can have content.
+func (b *responseBuffer) hasContent() bool {
+	code := cmp.Or(b.code, http.StatusOK)
+	return code != http.StatusNoContent && code != http.StatusNotModified
+}
+
+// copyTo writes the recorded response to w.
+func (b *responseBuffer) copyTo(w http.ResponseWriter) {
+	h := w.Header()
+	for name, vs := range b.header {
+		h[name] = vs
+	}
+	w.WriteHeader(cmp.Or(b.code, http.StatusOK))
+	w.Write(b.body.Bytes())
+}
+
+// NewDigestReader returns a reader that reads from r and verifies that its
+// content matches the value of a Content-Digest or Repr-Digest header. Every
+// digest in the header whose algorithm is supported (sha-256 and sha-512) is
+// checked. When r is exhausted, the reader reports [ErrDigestMismatch]
+// instead of io.EOF if any digest does not match.
+//
+// NewDigestReader reports an error if the header is invalid or has no digest
+// with a supported algorithm.
+func NewDigestReader(r io.Reader, header string) (io.Reader, error) {
+	ds, err := ParseIntegrityHeader(header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest header: %w", err)
+	}
+	dr := &digestReader{r: r}
+	for _, d := range ds {
+		i := slices.IndexFunc(hashAlgorithms, func(a HashAlgorithm) bool { return a.Name == d.Algorithm })
+		if i >= 0 {
+			dr.hashes = append(dr.hashes, hashAlgorithms[i].New())
+			dr.want = append(dr.want, d.Value)
+		}
+	}
+	if len(dr.hashes) == 0 {
+		return nil, errors.New("no supported digest algorithm")
+	}
+	return dr, nil
+}
+
+// VerifyContentDigest arranges for the body of rsp to be verified against
+// its Content-Digest header as it is read, by replacing rsp.Body with a
+// reader that reports [ErrDigestMismatch] at the end of the body if the
+// content does not match. It reports an error without changing rsp if the
+// response has no valid Content-Digest with a supported algorithm.
+func VerifyContentDigest(rsp *http.Response) error {
+	dr, err := NewDigestReader(rsp.Body, rsp.Header.Get("Content-Digest"))
+	if err != nil {
+		return err
+	}
+	rsp.Body = struct {
+		io.Reader
+		io.Closer
+	}{dr, rsp.Body}
+	return nil
+}
+
+type digestReader struct {
+	r      io.Reader
+	hashes []hash.Hash
+	want   [][]byte
+	err    error // sticky result at end of input
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.r.Read(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF {
+		for i, h := range d.hashes {
+			if subtle.ConstantTimeCompare(h.Sum(nil), d.want[i]) != 1 {
+				err = ErrDigestMismatch
+				break
+			}
+		}
+		d.err = err
+		if err != io.EOF && n > 0 {
+			return n, nil // report the mismatch on the next call
+		}
+	}
+	return n, err
+}
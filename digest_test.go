@@ -0,0 +1,310 @@
+package mhttp_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func mustB64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Invalid base64 %q: %v", s, err)
+	}
+	return b
+}
+
+func TestIntegrityHeader(t *testing.T) {
+	// Example from RFC 9530 Section 2.
+	const input = `sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:, ` +
+		`sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:`
+	want := []mhttp.DigestValue{
+		{Algorithm: "sha-256", Value: mustB64(t, "X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=")},
+		{Algorithm: "sha-512", Value: mustB64(t, "WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==")},
+	}
+	got, err := mhttp.ParseIntegrityHeader(input)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Parse (-got, +want):\n%s", diff)
+	}
+	if got, err := mhttp.FormatIntegrityHeader(want...); err != nil {
+		t.Errorf("Format: unexpected error: %v", err)
+	} else if got != input {
+		t.Errorf("Format:\ngot  %s\nwant %s", got, input)
+	}
+	if got, err := mhttp.FormatIntegrityHeader(mhttp.DigestValue{Algorithm: "SHA-256"}); err == nil {
+		t.Errorf("Format invalid name: got %q, want error", got)
+	}
+
+	// The example digests are of this content.
+	r, err := mhttp.NewDigestReader(strings.NewReader(`{"hello": "world"}`), input)
+	if err != nil {
+		t.Fatalf("NewDigestReader: %v", err)
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Errorf("Read: unexpected error: %v", err)
+	}
+
+	for _, bad := range []string{"sha-256=abc", "sha-256=(:AA==:)", "SHA=:AA==:"} {
+		if got, err := mhttp.ParseIntegrityHeader(bad); err == nil {
+			t.Errorf("Parse %q: got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestParseWantDigestHeader(t *testing.T) {
+	got, err := mhttp.ParseWantDigestHeader("sha-512=3, sha-256=10, unixsum=0")
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	want := []mhttp.DigestWant{{"sha-512", 3}, {"sha-256", 10}, {"unixsum", 0}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Parse (-got, +want):\n%s", diff)
+	}
+	for _, bad := range []string{"sha-256=11", "sha-256=-1", "sha-256=1.5", "sha-256=a"} {
+		if got, err := mhttp.ParseWantDigestHeader(bad); err == nil {
+			t.Errorf("Parse %q: got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestDigestReader(t *testing.T) {
+	const header = `sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:`
+	r, err := mhttp.NewDigestReader(strings.NewReader(`{"hello": "World"}`), header)
+	if err != nil {
+		t.Fatalf("NewDigestReader: %v", err)
+	}
+	if data, err := io.ReadAll(r); !errors.Is(err, mhttp.ErrDigestMismatch) {
+		t.Errorf("Read: got %q, %v; want %v", data, err, mhttp.ErrDigestMismatch)
+	}
+
+	for _, bad := range []string{"", "md5=:AA==:", "sha-256=1"} {
+		if _, err := mhttp.NewDigestReader(strings.NewReader("x"), bad); err == nil {
+			t.Errorf("NewDigestReader(%q): got nil, want error", bad)
+		}
+	}
+}
+
+func TestDigestHandler(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	var sawRange bool
+	h := mhttp.DigestHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sawRange = r.Header.Get("Range") != ""
+			switch r.URL.Path {
+			case "/empty":
+				w.WriteHeader(http.StatusNoContent)
+				return
+			case "/preset":
+				w.Header().Set("Content-Digest", "sha-256=:AAAA:")
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Etag", `"v1"`)
+			if r.Method != http.MethodHead {
+				io.WriteString(w, content)
+			}
+		}),
+		Algorithms: []mhttp.HashAlgorithm{mhttp.HashSHA256, mhttp.HashSHA512},
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	get := func(t *testing.T, method, path string, header http.Header) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		rsp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		defer rsp.Body.Close()
+		body, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatalf("Read body: %v", err)
+		}
+		return rsp, body
+	}
+	digests := func(data string, algs ...mhttp.HashAlgorithm) string {
+		var ds []mhttp.DigestValue
+		for _, alg := range algs {
+			h := alg.New()
+			io.WriteString(h, data)
+			ds = append(ds, mhttp.DigestValue{Algorithm: alg.Name, Value: h.Sum(nil)})
+		}
+		s, err := mhttp.FormatIntegrityHeader(ds...)
+		if err != nil {
+			t.Fatalf("FormatIntegrityHeader: %v", err)
+		}
+		return s
+	}
+
+	t.Run("Full", func(t *testing.T) {
+		rsp, body := get(t, "GET", "/", nil)
+		want := digests(content, mhttp.HashSHA256, mhttp.HashSHA512)
+		if string(body) != content {
+			t.Errorf("Body: got %q, want %q", body, content)
+		}
+		if got := rsp.Header.Get("Content-Digest"); got != want {
+			t.Errorf("Content-Digest: got %q, want %q", got, want)
+		}
+		if got := rsp.Header.Get("Repr-Digest"); got != want {
+			t.Errorf("Repr-Digest: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Want", func(t *testing.T) {
+		rsp, _ := get(t, "GET", "/", http.Header{
+			"Want-Content-Digest": {"sha-512=3, sha-256=10"},
+			"Want-Repr-Digest":    {"sha-256=0, md5=5"},
+		})
+		if got, want := rsp.Header.Get("Content-Digest"), digests(content, mhttp.HashSHA256); got != want {
+			t.Errorf("Content-Digest: got %q, want %q", got, want)
+		}
+		if got, want := rsp.Header.Get("Repr-Digest"), digests(content, mhttp.HashSHA512); got != want {
+			t.Errorf("Repr-Digest: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("SingleRange", func(t *testing.T) {
+		rsp, body := get(t, "GET", "/", http.Header{
+			"Range":               {"bytes=10-15"},
+			"Want-Content-Digest": {"sha-256=1"},
+			"Want-Repr-Digest":    {"sha-256=1"},
+		})
+		if sawRange {
+			t.Error("Handler received a Range header")
+		}
+		if rsp.StatusCode != http.StatusPartialContent || string(body) != "abcdef" {
+			t.Errorf("Got %d %q, want 206 %q", rsp.StatusCode, body, "abcdef")
+		}
+		if got, want := rsp.Header.Get("Content-Digest"), digests("abcdef", mhttp.HashSHA256); got != want {
+			t.Errorf("Content-Digest: got %q, want %q", got, want)
+		}
+		if got, want := rsp.Header.Get("Repr-Digest"), digests(content, mhttp.HashSHA256); got != want {
+			t.Errorf("Repr-Digest: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("IfRange", func(t *testing.T) {
+		rsp, body := get(t, "GET", "/", http.Header{"Range": {"bytes=0-3"}, "If-Range": {`"v0"`}})
+		if rsp.StatusCode != http.StatusOK || string(body) != content {
+			t.Errorf("Got %d %q, want 200 with full content", rsp.StatusCode, body)
+		}
+		rsp, body = get(t, "GET", "/", http.Header{"Range": {"bytes=0-3"}, "If-Range": {`"v1"`}})
+		if rsp.StatusCode != http.StatusPartialContent || string(body) != "0123" {
+			t.Errorf("Got %d %q, want 206 %q", rsp.StatusCode, body, "0123")
+		}
+	})
+
+	t.Run("MultiRange", func(t *testing.T) {
+		rsp, body := get(t, "GET", "/", http.Header{"Range": {"bytes=0-9, 10-"}})
+		if rsp.StatusCode != http.StatusPartialContent {
+			t.Fatalf("Status: got %d, want 206", rsp.StatusCode)
+		}
+
+		// The content digest covers the multipart body as sent.
+		r, err := mhttp.NewDigestReader(bytes.NewReader(body), rsp.Header.Get("Content-Digest"))
+		if err != nil {
+			t.Fatalf("NewDigestReader: %v", err)
+		}
+		if _, err := io.ReadAll(r); err != nil {
+			t.Errorf("Verify content: %v", err)
+		}
+
+		// Reassembling the parts reproduces the representation digest.
+		_, params, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatalf("Content-Type: %v", err)
+		}
+		var parts []io.Reader
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("NextPart: %v", err)
+			}
+			data, _ := io.ReadAll(p)
+			parts = append(parts, bytes.NewReader(data))
+		}
+		r, err = mhttp.NewDigestReader(io.MultiReader(parts...), rsp.Header.Get("Repr-Digest"))
+		if err != nil {
+			t.Fatalf("NewDigestReader: %v", err)
+		}
+		if got, err := io.ReadAll(r); err != nil || string(got) != content {
+			t.Errorf("Verify representation: got %q, %v", got, err)
+		}
+	})
+
+	t.Run("Preset", func(t *testing.T) {
+		rsp, _ := get(t, "GET", "/preset", nil)
+		if got := rsp.Header.Get("Content-Digest"); got != "sha-256=:AAAA:" {
+			t.Errorf("Content-Digest: got %q, want the handler's value", got)
+		}
+	})
+
+	t.Run("NoContent", func(t *testing.T) {
+		for _, tc := range []struct{ method, path string }{{"GET", "/empty"}, {"HEAD", "/"}} {
+			rsp, _ := get(t, tc.method, tc.path, nil)
+			if got := rsp.Header.Get("Content-Digest") + rsp.Header.Get("Repr-Digest"); got != "" {
+				t.Errorf("%s %s: got digests %q, want none", tc.method, tc.path, got)
+			}
+		}
+	})
+
+	t.Run("InvalidName", func(t *testing.T) {
+		bad := mhttp.DigestHandler{
+			Handler:    h.Handler,
+			Algorithms: []mhttp.HashAlgorithm{{Name: "SHA-256", New: sha256.New}},
+		}
+		rec := httptest.NewRecorder()
+		bad.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Status: got %d, want %d", rec.Code, http.StatusInternalServerError)
+		}
+		if got := rec.Header().Get("Repr-Digest"); got != "" {
+			t.Errorf("Repr-Digest: got %q, want none", got)
+		}
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", srv.URL+"/", nil)
+		rsp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		defer rsp.Body.Close()
+		if err := mhttp.VerifyContentDigest(rsp); err != nil {
+			t.Fatalf("VerifyContentDigest: %v", err)
+		}
+		if body, err := io.ReadAll(rsp.Body); err != nil || string(body) != content {
+			t.Errorf("Read: got %q, %v", body, err)
+		}
+
+		rsp.Header.Set("Content-Digest", "sha-256=:AAAA:")
+		rsp.Body = io.NopCloser(strings.NewReader(content))
+		if err := mhttp.VerifyContentDigest(rsp); err != nil {
+			t.Fatalf("VerifyContentDigest: %v", err)
+		}
+		if _, err := io.ReadAll(rsp.Body); !errors.Is(err, mhttp.ErrDigestMismatch) {
+			t.Errorf("Read: got %v, want %v", err, mhttp.ErrDigestMismatch)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package mhttp
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ContentDisposition is the parsed value of a [Content-Disposition] header,
+// as used in HTTP responses (RFC 6266) and in the part headers of
+// multipart/form-data bodies (RFC 7578).
+//
+// To read the disposition of a multipart part, parse the value of its
+// Content-Disposition header with [ParseContentDispositionHeader]. To write
+// one, pass the [ContentDisposition.String] of the value to
+// [multipart.Writer.CreatePart] in the part header.
+//
+// [Content-Disposition]: https://www.rfc-editor.org/rfc/rfc6266
+type ContentDisposition struct {
+	// Type is the disposition type, for example "attachment", "inline", or
+	// "form-data". When parsing, it is normalized to lower case.
+	// When formatting, an empty Type is written as "attachment".
+	Type string
+
+	// Filename is the suggested file name for the content, if any.
+	//
+	// When parsing, it is taken from the filename* parameter if that can be
+	// decoded, otherwise from filename, and any directory components are
+	// removed (see [ParseContentDispositionHeader]).
+	//
+	// When formatting, a name that cannot be sent safely as plain ASCII is
+	// written both as a filename* parameter and as an ASCII filename
+	// fallback, except in form-data, where RFC 7578 forbids filename*.
+	Filename string
+
+	// Name is the field name of a form-data part.
+	Name string
+
+	// Params are any other parameters, keyed by lower-case name.
+	Params map[string]string
+}
+
+// ParseContentDispositionHeader parses the contents of a Content-Disposition
+// header. Parameter names are case-insensitive, and a parameter given more
+// than once is an error.
+//
+// As recommended by RFC 6266, a filename* parameter that cannot be decoded
+// (for example, due to an unsupported charset) is ignored in favor of the
+// plain filename parameter. Because the suggested name comes from the peer,
+// the Filename is reduced to its last path element, with "/" and "\"
+// treated as separators and control characters removed; a name that
+// reduces to "", ".", or ".." is discarded.
+func ParseContentDispositionHeader(s string) (ContentDisposition, error) {
+	elts := splitQuoted(s, ';')
+	if len(elts) == 0 {
+		return ContentDisposition{}, errors.New("empty content disposition")
+	}
+	dtype := strings.ToLower(elts[0])
+	if !isToken(dtype) {
+		return ContentDisposition{}, fmt.Errorf("invalid disposition type %q", elts[0])
+	}
+	out := ContentDisposition{Type: dtype}
+
+	var filename, filenameExt string
+	var hasExt bool
+	seen := make(map[string]bool)
+	for _, elt := range elts[1:] {
+		name, value, hasValue, err := parseParam(elt)
+		if err != nil {
+			return ContentDisposition{}, err
+		} else if !hasValue {
+			return ContentDisposition{}, fmt.Errorf("missing value for %q", name)
+		} else if seen[name] {
+			return ContentDisposition{}, fmt.Errorf("duplicate parameter %q", name)
+		}
+		seen[name] = true
+		switch name {
+		case "filename":
+			filename = value
+		case "filename*":
+			if text, _, err := decodeExtValue(value); err == nil {
+				filenameExt, hasExt = text, true
+			}
+		case "name":
+			out.Name = value
+		default:
+			if out.Params == nil {
+				out.Params = make(map[string]string)
+			}
+			out.Params[name] = value
+		}
+	}
+	if hasExt {
+		filename = filenameExt
+	}
+	out.Filename = cleanFilename(filename)
+	return out, nil
+}
+
+// String renders c as the contents of a Content-Disposition header.
+// Other parameters are written in order by name.
+func (c ContentDisposition) String() string {
+	var sb strings.Builder
+	if c.Type == "" {
+		sb.WriteString("attachment")
+	} else {
+		sb.WriteString(c.Type)
+	}
+	formData := strings.EqualFold(c.Type, "form-data")
+	if c.Name != "" {
+		sb.WriteString("; name=" + quoteString(stripControl(c.Name)))
+	}
+	if c.Filename != "" {
+		if formData {
+			sb.WriteString("; filename=" + quoteString(stripControl(c.Filename)))
+		} else {
+			fallback := asciiFilename(c.Filename)
+			sb.WriteString("; filename=" + quoteString(fallback))
+			if fallback != c.Filename {
+				sb.WriteString("; filename*=" + encodeExtValue(c.Filename, ""))
+			}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Params)) {
+		sb.WriteString("; " + name + "=" + tokenOrQuoted(stripControl(c.Params[name])))
+	}
+	return sb.String()
+}
+
+// asciiFilename returns a version of name that is safe to send as a plain
+// filename parameter. Following RFC 6266 Appendix D, characters that are not
+// printable ASCII, along with "%", "\", "/", and quotation marks, are
+// replaced by "_".
+func asciiFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || strings.ContainsRune(`%\/"`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// cleanFilename reduces a peer-supplied file name to a single path element
+// without control characters, or "" if nothing usable remains.
+func cleanFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSpace(stripControl(name))
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// stripControl returns s with ASCII control characters removed.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,149 @@
+package mhttp_test
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseContentDispositionHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  mhttp.ContentDisposition
+	}{
+		{"inline", mhttp.ContentDisposition{Type: "inline"}},
+		{"Attachment; FILENAME=example.html", mhttp.ContentDisposition{Type: "attachment", Filename: "example.html"}},
+
+		// RFC 6266 Section 5 examples.
+		{`Attachment; filename=example.html`, mhttp.ContentDisposition{Type: "attachment", Filename: "example.html"}},
+		{`INLINE; FILENAME= "an example.html"`, mhttp.ContentDisposition{Type: "inline", Filename: "an example.html"}},
+		{`attachment; filename*= UTF-8''%e2%82%ac%20rates`, mhttp.ContentDisposition{Type: "attachment", Filename: "€ rates"}},
+		{`attachment; filename="EURO rates"; filename*=utf-8''%e2%82%ac%20rates`,
+			mhttp.ContentDisposition{Type: "attachment", Filename: "€ rates"}},
+
+		// The ext-value wins regardless of order, unless it cannot be decoded.
+		{`attachment; filename*=iso-8859-1'en'%A3%20rates; filename="GBP rates"`,
+			mhttp.ContentDisposition{Type: "attachment", Filename: "£ rates"}},
+		{`attachment; filename="fallback.txt"; filename*=KOI8-R''%C6`,
+			mhttp.ContentDisposition{Type: "attachment", Filename: "fallback.txt"}},
+
+		// Path components and control characters are removed.
+		{`attachment; filename="../../etc/passwd"`, mhttp.ContentDisposition{Type: "attachment", Filename: "passwd"}},
+		{`attachment; filename="C:\\Windows\\evil.exe"`, mhttp.ContentDisposition{Type: "attachment", Filename: "evil.exe"}},
+		{`attachment; filename*=UTF-8''..%2F..%2Fx%0D%0A.txt`, mhttp.ContentDisposition{Type: "attachment", Filename: "x.txt"}},
+		{`attachment; filename=".."`, mhttp.ContentDisposition{Type: "attachment"}},
+		{`attachment; filename="dir/"`, mhttp.ContentDisposition{Type: "attachment"}},
+
+		// Multipart form-data, including raw UTF-8 in a quoted string.
+		{`form-data; name="upload"; filename="résumé.pdf"`,
+			mhttp.ContentDisposition{Type: "form-data", Name: "upload", Filename: "résumé.pdf"}},
+		{`form-data; name=field`, mhttp.ContentDisposition{Type: "form-data", Name: "field"}},
+
+		// Other parameters are preserved.
+		{`attachment; Creation-Date="Wed, 12 Feb 1997 16:29:51 -0500"; size=100`, mhttp.ContentDisposition{
+			Type: "attachment", Params: map[string]string{
+				"creation-date": "Wed, 12 Feb 1997 16:29:51 -0500",
+				"size":          "100",
+			},
+		}},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseContentDispositionHeader(tc.input)
+		if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("Parse %q (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"; filename=x",
+		"attach ment",
+		"attachment; filename",
+		`attachment; filename="unterminated`,
+		"attachment; filename=a b",
+		"attachment; filename=a; FileName=b",
+	} {
+		if got, err := mhttp.ParseContentDispositionHeader(bad); err == nil {
+			t.Errorf("Parse %q: got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestContentDispositionString(t *testing.T) {
+	tests := []struct {
+		input mhttp.ContentDisposition
+		want  string
+	}{
+		{mhttp.ContentDisposition{}, "attachment"},
+		{mhttp.ContentDisposition{Type: "inline"}, "inline"},
+		{mhttp.ContentDisposition{Filename: "report.pdf"}, `attachment; filename="report.pdf"`},
+		{mhttp.ContentDisposition{Filename: "€ rates.txt"},
+			`attachment; filename="_ rates.txt"; filename*=UTF-8''%E2%82%AC%20rates.txt`},
+		{mhttp.ContentDisposition{Type: "inline", Filename: `50% "off".txt`},
+			`inline; filename="50_ _off_.txt"; filename*=UTF-8''50%25%20%22off%22.txt`},
+		{mhttp.ContentDisposition{Filename: "a\r\nb"},
+			`attachment; filename="a__b"; filename*=UTF-8''a%0D%0Ab`},
+		{mhttp.ContentDisposition{Type: "form-data", Name: "file", Filename: `naïve "x".txt`},
+			`form-data; name="file"; filename="naïve \"x\".txt"`},
+		{mhttp.ContentDisposition{Type: "attachment", Params: map[string]string{"size": "10", "b": "x y"}},
+			`attachment; b="x y"; size=10`},
+	}
+	for _, tc := range tests {
+		got := tc.input.String()
+		if got != tc.want {
+			t.Errorf("String %+v:\ngot  %s\nwant %s", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestContentDispositionMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	files := []mhttp.ContentDisposition{
+		{Type: "form-data", Name: "doc", Filename: "Übersicht.txt"},
+		{Type: "form-data", Name: "plain", Filename: "plain.txt"},
+	}
+	for _, cd := range files {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{"Content-Disposition": {cd.String()}})
+		if err != nil {
+			t.Fatalf("CreatePart: %v", err)
+		}
+		io.WriteString(pw, cd.Name)
+	}
+	mw.Close()
+
+	mr := multipart.NewReader(&buf, mw.Boundary())
+	for i := 0; ; i++ {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			if i != len(files) {
+				t.Errorf("Got %d parts, want %d", i, len(files))
+			}
+			break
+		} else if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		got, err := mhttp.ParseContentDispositionHeader(p.Header.Get("Content-Disposition"))
+		if err != nil {
+			t.Fatalf("Parse part %d: %v", i, err)
+		}
+		if diff := cmp.Diff(got, files[i]); diff != "" {
+			t.Errorf("Part %d (-got, +want):\n%s", i, diff)
+		}
+
+		// The standard library agrees on the names.
+		if p.FormName() != files[i].Name || p.FileName() != files[i].Filename {
+			t.Errorf("Part %d: got name %q, filename %q; want %q, %q",
+				i, p.FormName(), p.FileName(), files[i].Name, files[i].Filename)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package mhttp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AcceptEncoding is the parsed representation of an HTTP [Accept-Encoding]
+// header.
+//
+// [Accept-Encoding]: https://httpwg.org/specs/rfc9110.html#field.accept-encoding
+type AcceptEncoding struct {
+	codings []Coding // nil if not present
+}
+
+// A Coding is a single element of an Accept-Encoding header.
+type Coding struct {
+	// Name is the name of the content coding, for example "gzip", "identity",
+	// or "*". Names are normalized to lower case.
+	Name string
+
+	// Quality is the weight assigned to the coding, between 0 and 1.
+	// If the coding does not specify a weight, the default is 1.
+	Quality float64
+}
+
+// ParseAcceptEncodingHeader parses the contents of an HTTP Accept-Encoding
+// header and returns an [AcceptEncoding]. If the header is empty it returns
+// an AcceptEncoding that is not present. Use [AcceptEncoding.IsPresent] to
+// check for this case. An error is only reported if the header is present but
+// invalid.
+//
+// Note that a request with an Accept-Encoding header whose value is empty
+// accepts only the identity coding, which differs from a request that has no
+// Accept-Encoding header at all. Callers that need to distinguish these cases
+// should check for the presence of the header separately.
+func ParseAcceptEncodingHeader(s string) (AcceptEncoding, error) {
+	if strings.TrimSpace(s) == "" {
+		return AcceptEncoding{}, nil // not present
+	}
+	out := []Coding{}
+	for _, elt := range splitList(s) {
+		name, wt, hasWeight := strings.Cut(elt, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "*" && !isToken(name) {
+			return AcceptEncoding{}, fmt.Errorf("invalid content coding %q", name)
+		}
+		q := 1.0
+		if hasWeight {
+			qs, ok := strings.CutPrefix(strings.TrimSpace(wt), "q=")
+			if !ok {
+				return AcceptEncoding{}, fmt.Errorf("invalid weight in %q", elt)
+			}
+			v, err := parseQValue(qs)
+			if err != nil {
+				return AcceptEncoding{}, fmt.Errorf("invalid weight in %q: %w", elt, err)
+			}
+			q = v
+		}
+		out = append(out, Coding{Name: name, Quality: q})
+	}
+	return AcceptEncoding{codings: out}, nil
+}
+
+// IsPresent reports whether an Accept-Encoding header was present at the time
+// of parsing.
+func (a AcceptEncoding) IsPresent() bool { return a.codings != nil }
+
+// Codings returns the content codings of a in the order they were specified.
+// The caller should not modify the contents of the slice.
+func (a AcceptEncoding) Codings() []Coding { return a.codings }
+
+// Quality reports the weight a assigns to the specified content coding,
+// following the rules of [RFC 9110 Section 12.5.3]:
+//
+//   - A coding listed explicitly has the weight given for it.
+//   - Otherwise, if "*" is listed, the coding has the weight given for "*".
+//   - Otherwise, "identity" has weight 1 and all other codings have weight 0.
+//
+// If a is not present, the weight is always 1.
+//
+// [RFC 9110 Section 12.5.3]: https://httpwg.org/specs/rfc9110.html#field.accept-encoding
+func (a AcceptEncoding) Quality(coding string) float64 {
+	if !a.IsPresent() {
+		return 1
+	}
+	coding = strings.ToLower(coding)
+	star := -1.0
+	for _, c := range a.codings {
+		if c.Name == coding {
+			return c.Quality
+		} else if c.Name == "*" {
+			star = c.Quality
+		}
+	}
+	if star >= 0 {
+		return star
+	} else if coding == "identity" {
+		return 1
+	}
+	return 0
+}
+
+// Negotiate selects the offered content coding most preferred by a. The
+// identity coding is implicitly offered, and need not be listed.
+//
+// The offer with the highest non-zero weight is selected. If multiple offers
+// have the same weight, the offer listed earliest wins, so offers should be
+// given in order of server preference. Identity is selected only if its weight
+// is greater than that of every other offer. If a is not present, Negotiate
+// selects identity, since a client that does not send the header may not
+// support any other coding.
+//
+// If no coding is acceptable, including identity, Negotiate returns "", false.
+// The caller may respond with status 406 (Not Acceptable) in this case, or
+// send an unencoded response anyway.
+func (a AcceptEncoding) Negotiate(offers ...string) (string, bool) {
+	if !a.IsPresent() {
+		return "identity", true
+	}
+	best, bestQ := "identity", a.Quality("identity")
+	for _, offer := range offers {
+		if q := a.Quality(offer); q > 0 && (q > bestQ || best == "identity" && q == bestQ) {
+			best, bestQ = offer, q
+		}
+	}
+	if bestQ == 0 {
+		return "", false
+	}
+	return best, true
+}
+
+// isToken reports whether s is a valid token as defined by RFC 9110.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar reports whether c is a valid tchar as defined by RFC 9110.
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+	}
+}
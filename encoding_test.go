@@ -0,0 +1,70 @@
+package mhttp_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAcceptEncodingHeader(t *testing.T) {
+	a, err := mhttp.ParseAcceptEncodingHeader("GZIP, deflate;q=0.5, br;q=1.0, identity; q=0, *;q=0.1")
+	if err != nil {
+		t.Fatalf("ParseAcceptEncodingHeader: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(a.Codings(), []mhttp.Coding{
+		{"gzip", 1}, {"deflate", 0.5}, {"br", 1}, {"identity", 0}, {"*", 0.1},
+	}); diff != "" {
+		t.Errorf("Codings (-got, +want):\n%s", diff)
+	}
+
+	t.Run("Fail", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{"g zip", "invalid content coding"},
+			{`"gzip"`, "invalid content coding"},
+			{"gzip;level=1", "invalid weight"},
+			{"gzip;q=2", "invalid weight"},
+		}
+		for _, tc := range tests {
+			a, err := mhttp.ParseAcceptEncodingHeader(tc.input)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ParseAcceptEncodingHeader(%q): got (%+v, %v), want error %q", tc.input, a, err, tc.want)
+			}
+		}
+	})
+}
+
+func TestAcceptEncodingNegotiate(t *testing.T) {
+	offers := []string{"br", "gzip", "deflate"}
+	tests := []struct {
+		header string
+		want   string // "" means not acceptable
+	}{
+		{"", "identity"},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip;q=1, br;q=0.8", "gzip"},
+		{"deflate;q=0.5, identity", "identity"},
+		{"deflate, identity", "deflate"},
+		{"*", "br"},
+		{"*;q=0.5, gzip;q=0", "br"},
+		{"compress", "identity"},
+		{"compress, identity;q=0", ""},
+		{"*;q=0", ""},
+		{"*;q=0, identity", "identity"},
+		{"br;q=0, gzip;q=0, deflate;q=0", "identity"},
+	}
+	for _, tc := range tests {
+		a, err := mhttp.ParseAcceptEncodingHeader(tc.header)
+		if err != nil {
+			t.Fatalf("ParseAcceptEncodingHeader(%q): unexpected error: %v", tc.header, err)
+		}
+		got, ok := a.Negotiate(offers...)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("Negotiate(%q): got (%q, %v), want %q", tc.header, got, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package mhttp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file implements the encoding of parameter values with non-ASCII
+// content defined by RFC 8187, as used in parameters such as title* and
+// filename*.
+//
+//	ext-value = charset "'" [ language ] "'" value-chars
+
+// decodeExtValue decodes an RFC 8187 ext-value, and returns the decoded text
+// and the language tag, if any. The UTF-8 and ISO-8859-1 charsets are
+// supported.
+func decodeExtValue(s string) (text, lang string, _ error) {
+	charset, rest, ok := strings.Cut(s, "'")
+	if !ok {
+		return "", "", errors.New("missing charset delimiter")
+	}
+	lang, enc, ok := strings.Cut(rest, "'")
+	if !ok {
+		return "", "", errors.New("missing language delimiter")
+	}
+	var buf []byte
+	for i := 0; i < len(enc); i++ {
+		switch c := enc[i]; {
+		case c == '%':
+			if i+2 >= len(enc) {
+				return "", "", errors.New("truncated percent escape")
+			}
+			hi, lo := unhexFold(enc[i+1]), unhexFold(enc[i+2])
+			if hi < 0 || lo < 0 {
+				return "", "", fmt.Errorf("invalid percent escape %q", enc[i:i+3])
+			}
+			buf = append(buf, byte(hi<<4|lo))
+			i += 2
+		case isAttrChar(c):
+			buf = append(buf, c)
+		default:
+			return "", "", fmt.Errorf("invalid character %q", c)
+		}
+	}
+	switch strings.ToLower(charset) {
+	case "utf-8":
+		if !utf8.Valid(buf) {
+			return "", "", errors.New("invalid UTF-8 text")
+		}
+		return string(buf), lang, nil
+	case "iso-8859-1":
+		rs := make([]rune, len(buf))
+		for i, b := range buf {
+			rs[i] = rune(b) // ISO-8859-1 is the first 256 code points
+		}
+		return string(rs), lang, nil
+	default:
+		return "", "", fmt.Errorf("unsupported charset %q", charset)
+	}
+}
+
+// encodeExtValue encodes text as an RFC 8187 ext-value in UTF-8, with the
+// given language tag (which may be empty).
+func encodeExtValue(text, lang string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	sb.WriteString("UTF-8'")
+	sb.WriteString(lang)
+	sb.WriteByte('\'')
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; isAttrChar(c) {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&0xf])
+		}
+	}
+	return sb.String()
+}
+
+// isASCII reports whether s consists entirely of printable ASCII.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// isAttrChar reports whether c is an attr-char as defined by RFC 8187.
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+	}
+}
+
+// unhexFold returns the value of a hexadecimal digit in either case, or -1.
+func unhexFold(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,452 @@
+package mhttp
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A ForwardedNode identifies a client or proxy in a [Forwarded] header (RFC
+// 7239 Section 6). A node is either an IP address or a name, which is either
+// "unknown" or an obfuscated identifier beginning with "_". The zero value
+// represents an absent node.
+//
+// [Forwarded]: https://www.rfc-editor.org/rfc/rfc7239
+type ForwardedNode struct {
+	Addr netip.Addr // the IP address of the node, if known
+	Name string     // if Addr is not valid, "unknown" or an obfuscated name
+	Port string     // a port number, an obfuscated port, or ""
+}
+
+// IsPresent reports whether n identifies a node.
+func (n ForwardedNode) IsPresent() bool { return n.Addr.IsValid() || n.Name != "" }
+
+// String renders n in the format of the for and by parameters of a Forwarded
+// header, without quotation. An IPv6 address is enclosed in brackets.
+func (n ForwardedNode) String() string {
+	host := n.Name
+	if n.Addr.IsValid() {
+		host = n.Addr.String()
+		if n.Addr.Is6() {
+			host = "[" + host + "]"
+		}
+	}
+	if n.Port != "" {
+		return host + ":" + n.Port
+	}
+	return host
+}
+
+// ParseForwardedNode parses a node identifier as it appears in the for and
+// by parameters of a Forwarded header, after removal of any quotation.
+func ParseForwardedNode(s string) (ForwardedNode, error) {
+	var name, port string
+	if rest, ok := strings.CutPrefix(s, "["); ok {
+		host, tail, ok := strings.Cut(rest, "]")
+		if !ok {
+			return ForwardedNode{}, fmt.Errorf("invalid node %q: missing ']'", s)
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil || !addr.Is6() || addr.Zone() != "" {
+			return ForwardedNode{}, fmt.Errorf("invalid node %q: bad IPv6 address", s)
+		}
+		if tail != "" {
+			p, ok := strings.CutPrefix(tail, ":")
+			if !ok || !isNodePort(p) {
+				return ForwardedNode{}, fmt.Errorf("invalid node %q: bad port", s)
+			}
+			port = p
+		}
+		return ForwardedNode{Addr: addr, Port: port}, nil
+	}
+
+	name, port, hasPort := strings.Cut(s, ":")
+	if hasPort && !isNodePort(port) {
+		return ForwardedNode{}, fmt.Errorf("invalid node %q: bad port", s)
+	}
+	if addr, err := netip.ParseAddr(name); err == nil && addr.Is4() {
+		return ForwardedNode{Addr: addr, Port: port}, nil
+	} else if strings.EqualFold(name, "unknown") {
+		return ForwardedNode{Name: "unknown", Port: port}, nil
+	} else if isObfuscated(name) {
+		return ForwardedNode{Name: name, Port: port}, nil
+	}
+	return ForwardedNode{}, fmt.Errorf("invalid node %q", s)
+}
+
+// isNodePort reports whether s is a valid node-port: a decimal port number
+// or an obfuscated port.
+func isNodePort(s string) bool {
+	if isObfuscated(s) {
+		return true
+	} else if s == "" || len(s) > 5 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	n, _ := strconv.Atoi(s)
+	return n <= 65535
+}
+
+// isObfuscated reports whether s is an obfuscated node or port identifier,
+// "_" followed by one or more of ALPHA, DIGIT, ".", "_", or "-".
+func isObfuscated(s string) bool {
+	rest, ok := strings.CutPrefix(s, "_")
+	if !ok || rest == "" {
+		return false
+	}
+	for i := 0; i < len(rest); i++ {
+		switch c := rest[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// A ForwardedElement is a single element of a Forwarded header, recording
+// the information seen by one proxy.
+type ForwardedElement struct {
+	For   ForwardedNode // the client that made the request to the proxy
+	By    ForwardedNode // the interface where the proxy received the request
+	Host  string        // the Host of the request received by the proxy
+	Proto string        // the scheme of the request received by the proxy
+
+	// Params are any extension parameters, keyed by lower-case name.
+	Params map[string]string
+}
+
+// String renders e as an element of a Forwarded header. Extension
+// parameters are written in order by name.
+func (e ForwardedElement) String() string {
+	var ps []string
+	if e.For.IsPresent() {
+		ps = append(ps, "for="+tokenOrQuoted(e.For.String()))
+	}
+	if e.By.IsPresent() {
+		ps = append(ps, "by="+tokenOrQuoted(e.By.String()))
+	}
+	if e.Host != "" {
+		ps = append(ps, "host="+tokenOrQuoted(e.Host))
+	}
+	if e.Proto != "" {
+		ps = append(ps, "proto="+tokenOrQuoted(e.Proto))
+	}
+	for _, name := range slices.Sorted(maps.Keys(e.Params)) {
+		ps = append(ps, name+"="+tokenOrQuoted(e.Params[name]))
+	}
+	return strings.Join(ps, ";")
+}
+
+// ParseForwardedHeader parses the contents of a Forwarded header, and returns
+// its elements in order, with the element added by the proxy nearest the
+// client first. If a request has multiple Forwarded header lines, the caller
+// should join them with commas before parsing.
+func ParseForwardedHeader(s string) ([]ForwardedElement, error) {
+	var out []ForwardedElement
+	for i, elt := range splitList(s) {
+		fe, err := parseForwardedElement(elt)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i+1, err)
+		}
+		out = append(out, fe)
+	}
+	return out, nil
+}
+
+func parseForwardedElement(s string) (ForwardedElement, error) {
+	var out ForwardedElement
+	seen := make(map[string]bool)
+	for _, pair := range splitQuoted(s, ';') {
+		name, value, hasValue, err := parseParam(pair)
+		if err != nil {
+			return ForwardedElement{}, err
+		} else if !hasValue {
+			return ForwardedElement{}, fmt.Errorf("missing value for %q", name)
+		} else if seen[name] {
+			return ForwardedElement{}, fmt.Errorf("duplicate parameter %q", name)
+		}
+		seen[name] = true
+		switch name {
+		case "for":
+			out.For, err = ParseForwardedNode(value)
+		case "by":
+			out.By, err = ParseForwardedNode(value)
+		case "host":
+			if !isValidHost(value) {
+				err = fmt.Errorf("invalid host %q", value)
+			}
+			out.Host = value
+		case "proto":
+			if !isScheme(value) {
+				err = fmt.Errorf("invalid proto %q", value)
+			}
+			out.Proto = strings.ToLower(value)
+		default:
+			if out.Params == nil {
+				out.Params = make(map[string]string)
+			}
+			out.Params[name] = value
+		}
+		if err != nil {
+			return ForwardedElement{}, err
+		}
+	}
+	if len(seen) == 0 {
+		return ForwardedElement{}, errors.New("empty element")
+	}
+	return out, nil
+}
+
+// isScheme reports whether s is a valid URI scheme (RFC 3986 Section 3.1).
+func isScheme(s string) bool {
+	if s == "" || !(s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z') {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '+', c == '-', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isValidHost reports whether s is plausible as the value of a Host header:
+// non-empty and consisting only of characters permitted in a URI authority
+// without userinfo.
+func isValidHost(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("-._~%!$&'()*+,;=:[]", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ForwardedOrigin describes the original request made by a client, as
+// determined by a [ForwardedResolver].
+type ForwardedOrigin struct {
+	// Client is the originating client. Its Addr is invalid if the client
+	// was reported as "unknown" or by an obfuscated identifier.
+	Client ForwardedNode
+
+	// Scheme is the URL scheme used by the client, for example "https".
+	Scheme string
+
+	// Host is the host requested by the client.
+	Host string
+}
+
+// A ForwardedSource selects the request headers from which a
+// [ForwardedResolver] determines the origin of a request.
+type ForwardedSource int
+
+const (
+	// SourceForwarded selects the Forwarded header (RFC 7239).
+	SourceForwarded ForwardedSource = iota
+
+	// SourceXForwarded selects the X-Forwarded-For, X-Forwarded-Proto, and
+	// X-Forwarded-Host headers.
+	SourceXForwarded
+)
+
+// A ForwardedResolver determines the origin of a request that may have
+// passed through proxies, from the headers selected by its Source.
+//
+// Because clients can send these headers too, they are believed only as far
+// as they were written by trusted proxies. The resolver starts from the
+// immediate peer of the request (its RemoteAddr) and walks the proxy chain
+// from right to left. While the current hop is a trusted proxy, the element
+// it appended is accepted, and the walk continues with the node that element
+// names as its client. The walk stops at the first node that is not a trusted
+// IP address, and that node is the client. The scheme and host are taken from
+// the leftmost accepted element that reports them.
+//
+// If the peer is not trusted, or the headers are absent, the origin is the
+// peer itself with the scheme and host of the request as received.
+//
+// The headers of the other source are always ignored. Set Source to match
+// the headers the trusted proxies actually write: a proxy that appends only
+// X-Forwarded-For passes along a Forwarded header sent by the client as-is,
+// and believing that header would let the client choose its own address.
+type ForwardedResolver struct {
+	// Trusted are the networks of proxies trusted to report the origin of a
+	// request. If empty, no proxies are trusted.
+	Trusted []netip.Prefix
+
+	// Source selects the headers written by the trusted proxies. The zero
+	// value is SourceForwarded.
+	Source ForwardedSource
+}
+
+// isTrusted reports whether addr is within a trusted network.
+func (f ForwardedResolver) isTrusted(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range f.Trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the origin of r.
+func (f ForwardedResolver) Resolve(r *http.Request) ForwardedOrigin {
+	out := ForwardedOrigin{Client: peerNode(r.RemoteAddr), Scheme: "http", Host: r.Host}
+	if r.TLS != nil {
+		out.Scheme = "https"
+	}
+	if !f.isTrusted(out.Client.Addr) {
+		return out
+	}
+
+	var elts []string
+	parse := parseForwardedElement
+	switch f.Source {
+	case SourceForwarded:
+		elts = splitList(strings.Join(r.Header.Values("Forwarded"), ","))
+	case SourceXForwarded:
+		elts, parse = xForwardedElements(r.Header), parseXForwardedElement
+	}
+	for i := len(elts) - 1; i >= 0; i-- {
+		e, err := parse(elts[i])
+		if err != nil || !e.For.IsPresent() {
+			break // the current client is the best we know
+		}
+		if e.Proto != "" {
+			out.Scheme = e.Proto
+		}
+		if e.Host != "" {
+			out.Host = e.Host
+		}
+		out.Client = e.For
+		if !f.isTrusted(e.For.Addr) {
+			break
+		}
+	}
+	return out
+}
+
+// peerNode returns a node for the address of the immediate peer of a request.
+func peerNode(remoteAddr string) ForwardedNode {
+	if ap, err := netip.ParseAddrPort(remoteAddr); err == nil {
+		return ForwardedNode{Addr: ap.Addr().Unmap(), Port: strconv.Itoa(int(ap.Port()))}
+	} else if addr, err := netip.ParseAddr(remoteAddr); err == nil {
+		return ForwardedNode{Addr: addr.Unmap()}
+	}
+	return ForwardedNode{}
+}
+
+// xForwardedElements synthesizes Forwarded elements from the X-Forwarded-For,
+// X-Forwarded-Proto, and X-Forwarded-Host headers of h. Each element has the
+// form of a Forwarded element, to be parsed by parseXForwardedElement.
+//
+// There is one element per address of X-Forwarded-For. The values of
+// X-Forwarded-Proto and X-Forwarded-Host are aligned with the addresses from
+// the right, since each proxy appends (or replaces) them in the same way.
+func xForwardedElements(h http.Header) []string {
+	fors := splitList(strings.Join(h.Values("X-Forwarded-For"), ","))
+	protos := splitList(strings.Join(h.Values("X-Forwarded-Proto"), ","))
+	hosts := splitList(strings.Join(h.Values("X-Forwarded-Host"), ","))
+	out := make([]string, len(fors))
+	for i, f := range fors {
+		ps := []string{"for=" + quoteString(f)}
+		if j := i - len(fors) + len(protos); j >= 0 {
+			ps = append(ps, "proto="+quoteString(protos[j]))
+		}
+		if j := i - len(fors) + len(hosts); j >= 0 {
+			ps = append(ps, "host="+quoteString(hosts[j]))
+		}
+		out[i] = strings.Join(ps, ";")
+	}
+	return out
+}
+
+// parseXForwardedElement parses an element synthesized by xForwardedElements.
+// It differs from parseForwardedElement in accepting the looser address
+// formats used by X-Forwarded-For, such as unbracketed IPv6 addresses.
+func parseXForwardedElement(s string) (ForwardedElement, error) {
+	var out ForwardedElement
+	for _, pair := range splitQuoted(s, ';') {
+		name, value, _, err := parseParam(pair)
+		if err != nil {
+			return ForwardedElement{}, err
+		}
+		switch name {
+		case "for":
+			if addr, err := netip.ParseAddr(value); err == nil && addr.Zone() == "" {
+				out.For = ForwardedNode{Addr: addr.Unmap()}
+			} else if ap, err := netip.ParseAddrPort(value); err == nil {
+				out.For = ForwardedNode{Addr: ap.Addr().Unmap(), Port: strconv.Itoa(int(ap.Port()))}
+			} else if out.For, err = ParseForwardedNode(value); err != nil {
+				return ForwardedElement{}, err
+			}
+		case "proto":
+			if !isScheme(value) {
+				return ForwardedElement{}, fmt.Errorf("invalid proto %q", value)
+			}
+			out.Proto = strings.ToLower(value)
+		case "host":
+			if !isValidHost(value) {
+				return ForwardedElement{}, fmt.Errorf("invalid host %q", value)
+			}
+			out.Host = value
+		}
+	}
+	return out, nil
+}
+
+// A ForwardedHandler is an [http.Handler] that rewrites requests to reflect
+// their origin as reported by trusted proxies, before passing them to an
+// underlying handler. See [ForwardedResolver] for how the origin is found.
+//
+// The request's RemoteAddr is set to the address and port of the client,
+// or to the address with port 0 if the port is not known. If the client's
+// address is not known, RemoteAddr is not changed. The request's URL.Scheme
+// and Host are set to the scheme and host of the origin.
+type ForwardedHandler struct {
+	// Handler is the underlying handler that receives rewritten requests.
+	Handler http.Handler
+
+	// Resolver determines the origin of each request.
+	Resolver ForwardedResolver
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (f ForwardedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o := f.Resolver.Resolve(r)
+	r = r.Clone(r.Context())
+	if o.Client.Addr.IsValid() {
+		port := o.Client.Port
+		if !isNodePort(port) || isObfuscated(port) {
+			port = "0"
+		}
+		r.RemoteAddr = net.JoinHostPort(o.Client.Addr.String(), port)
+	}
+	r.URL.Scheme = o.Scheme
+	r.Host = o.Host
+	f.Handler.ServeHTTP(w, r)
+}
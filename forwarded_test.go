@@ -0,0 +1,245 @@
+package mhttp_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+var addrCmp = cmp.Comparer(func(a, b netip.Addr) bool { return a == b })
+
+func node(addr, port string) mhttp.ForwardedNode {
+	return mhttp.ForwardedNode{Addr: netip.MustParseAddr(addr), Port: port}
+}
+
+func TestParseForwardedHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []mhttp.ForwardedElement
+	}{
+		{"", nil},
+
+		// RFC 7239 Section 4 and 7 examples.
+		{`for="_gazonk"`, []mhttp.ForwardedElement{{For: mhttp.ForwardedNode{Name: "_gazonk"}}}},
+		{`For="[2001:db8:cafe::17]:4711"`, []mhttp.ForwardedElement{{For: node("2001:db8:cafe::17", "4711")}}},
+		{`for=192.0.2.60;proto=http;by=203.0.113.43`, []mhttp.ForwardedElement{{
+			For: node("192.0.2.60", ""), By: node("203.0.113.43", ""), Proto: "http",
+		}}},
+		{`for=192.0.2.43, for=198.51.100.17`, []mhttp.ForwardedElement{
+			{For: node("192.0.2.43", "")}, {For: node("198.51.100.17", "")},
+		}},
+		{`for=192.0.2.43,for="[2001:db8:cafe::17]",for=unknown`, []mhttp.ForwardedElement{
+			{For: node("192.0.2.43", "")},
+			{For: node("2001:db8:cafe::17", "")},
+			{For: mhttp.ForwardedNode{Name: "unknown"}},
+		}},
+		{`for=unknown;by="_hidden:_port"`, []mhttp.ForwardedElement{{
+			For: mhttp.ForwardedNode{Name: "unknown"}, By: mhttp.ForwardedNode{Name: "_hidden", Port: "_port"},
+		}}},
+
+		// Host, proto, and extensions.
+		{`for="192.0.2.1:8080"; HOST="example.com:8443"; proto=HTTPS; secret=abc`, []mhttp.ForwardedElement{{
+			For: node("192.0.2.1", "8080"), Host: "example.com:8443", Proto: "https",
+			Params: map[string]string{"secret": "abc"},
+		}}},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseForwardedHeader(tc.input)
+		if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want, addrCmp); diff != "" {
+			t.Errorf("Parse %q (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+
+	for _, bad := range []string{
+		"for=2001:db8::1",             // unquoted and unbracketed IPv6
+		`for="2001:db8::1"`,           // unbracketed IPv6
+		`for="[192.0.2.1]"`,           // bracketed IPv4
+		`for="[2001:db8::1"`,          // unterminated bracket
+		`for="192.0.2.1:99999"`,       // bad port
+		`for="192.0.2.1:"`,            // empty port
+		"for=example.com",             // hostname
+		"for=_",                       // empty obfuscated name
+		"for=_a/b",                    // bad obfuscated name
+		"for=192.0.2.1;for=192.0.2.2", // duplicate parameter
+		"for",                         // missing value
+		`for=192.0.2.1;proto="h t"`,   // bad scheme
+		`host="a/b"`,                  // bad host
+		";",
+	} {
+		if got, err := mhttp.ParseForwardedHeader(bad); err == nil {
+			t.Errorf("Parse %q: got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestForwardedElementString(t *testing.T) {
+	e := mhttp.ForwardedElement{
+		For:    node("2001:db8::17", "4711"),
+		By:     mhttp.ForwardedNode{Name: "_proxy"},
+		Host:   "example.com",
+		Proto:  "https",
+		Params: map[string]string{"z": "1", "a": "x y"},
+	}
+	const want = `for="[2001:db8::17]:4711";by=_proxy;host=example.com;proto=https;a="x y";z=1`
+	if got := e.String(); got != want {
+		t.Errorf("String:\ngot  %s\nwant %s", got, want)
+	}
+	back, err := mhttp.ParseForwardedHeader(want)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(back, []mhttp.ForwardedElement{e}, addrCmp); diff != "" {
+		t.Errorf("Round trip (-got, +want):\n%s", diff)
+	}
+}
+
+func TestForwardedResolver(t *testing.T) {
+	res := mhttp.ForwardedResolver{Trusted: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}}
+	const (
+		fwd = mhttp.SourceForwarded
+		xff = mhttp.SourceXForwarded
+	)
+	tests := []struct {
+		name   string
+		source mhttp.ForwardedSource
+		remote string
+		header http.Header
+		want   mhttp.ForwardedOrigin
+	}{
+		{"NoHeaders", fwd, "10.1.1.1:5000", nil,
+			mhttp.ForwardedOrigin{Client: node("10.1.1.1", "5000"), Scheme: "http", Host: "svc.internal"}},
+		{"UntrustedPeer", fwd, "198.51.100.7:5000",
+			http.Header{"Forwarded": {"for=192.0.2.1;proto=https;host=evil.com"}},
+			mhttp.ForwardedOrigin{Client: node("198.51.100.7", "5000"), Scheme: "http", Host: "svc.internal"}},
+		{"OneHop", fwd, "10.1.1.1:5000",
+			http.Header{"Forwarded": {`for="192.0.2.1:1234";proto=https;host=example.com`}},
+			mhttp.ForwardedOrigin{Client: node("192.0.2.1", "1234"), Scheme: "https", Host: "example.com"}},
+		{"TwoHops", fwd, "10.1.1.1:5000",
+			http.Header{"Forwarded": {"for=192.0.2.1;proto=https;host=example.com", "for=10.2.2.2;proto=http"}},
+			mhttp.ForwardedOrigin{Client: node("192.0.2.1", ""), Scheme: "https", Host: "example.com"}},
+		{"Spoofed", fwd, "10.1.1.1:5000",
+			// The client sent its own Forwarded header; only the rightmost
+			// untrusted node is believed.
+			http.Header{"Forwarded": {"for=10.9.9.9;host=evil.com, for=203.0.113.5;host=example.com"}},
+			mhttp.ForwardedOrigin{Client: node("203.0.113.5", ""), Scheme: "http", Host: "example.com"}},
+		{"Garbage", fwd, "10.1.1.1:5000",
+			http.Header{"Forwarded": {"for=nonsense, for=10.2.2.2;proto=https"}},
+			mhttp.ForwardedOrigin{Client: node("10.2.2.2", ""), Scheme: "https", Host: "svc.internal"}},
+		{"Obfuscated", fwd, "[fd00::1]:443",
+			http.Header{"Forwarded": {`for=_client, for="[fd00::2]"`}},
+			mhttp.ForwardedOrigin{Client: mhttp.ForwardedNode{Name: "_client"}, Scheme: "http", Host: "svc.internal"}},
+		{"AllTrusted", fwd, "10.1.1.1:5000",
+			http.Header{"Forwarded": {"for=10.3.3.3, for=10.2.2.2"}},
+			mhttp.ForwardedOrigin{Client: node("10.3.3.3", ""), Scheme: "http", Host: "svc.internal"}},
+		{"IgnoreXFF", fwd, "10.1.1.1:5000",
+			http.Header{"X-Forwarded-For": {"192.0.2.99"}},
+			mhttp.ForwardedOrigin{Client: node("10.1.1.1", "5000"), Scheme: "http", Host: "svc.internal"}},
+
+		// X-Forwarded-* headers.
+		{"XFF", xff, "10.1.1.1:5000",
+			http.Header{
+				"X-Forwarded-For":   {"203.0.113.9, 2001:db8::5", "10.2.2.2"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"example.com"},
+			},
+			mhttp.ForwardedOrigin{Client: node("2001:db8::5", ""), Scheme: "https", Host: "example.com"}},
+		{"XFFAligned", xff, "10.1.1.1:5000",
+			http.Header{
+				"X-Forwarded-For":   {"192.0.2.1, 10.2.2.2"},
+				"X-Forwarded-Proto": {"https, http"},
+			},
+			mhttp.ForwardedOrigin{Client: node("192.0.2.1", ""), Scheme: "https", Host: "svc.internal"}},
+		{"XFFPort", xff, "10.1.1.1:5000",
+			http.Header{"X-Forwarded-For": {"[2001:db8::5]:4000"}},
+			mhttp.ForwardedOrigin{Client: node("2001:db8::5", "4000"), Scheme: "http", Host: "svc.internal"}},
+		{"XFFBadProto", xff, "10.1.1.1:5000",
+			http.Header{"X-Forwarded-For": {"192.0.2.1"}, "X-Forwarded-Proto": {"ht tp"}},
+			mhttp.ForwardedOrigin{Client: node("10.1.1.1", "5000"), Scheme: "http", Host: "svc.internal"}},
+		{"XFFSpoofedForwarded", xff, "10.1.1.1:5000",
+			// The trusted proxy appends only X-Forwarded-For, and passed on a
+			// Forwarded header sent by the client, which must be ignored.
+			http.Header{
+				"Forwarded":       {"for=1.2.3.4;proto=https;host=evil.com"},
+				"X-Forwarded-For": {"203.0.113.5"},
+			},
+			mhttp.ForwardedOrigin{Client: node("203.0.113.5", ""), Scheme: "http", Host: "svc.internal"}},
+		{"XFFOnlyForwarded", xff, "10.1.1.1:5000",
+			http.Header{"Forwarded": {"for=1.2.3.4"}},
+			mhttp.ForwardedOrigin{Client: node("10.1.1.1", "5000"), Scheme: "http", Host: "svc.internal"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remote
+			req.Host = "svc.internal"
+			req.Header = tc.header
+			if req.Header == nil {
+				req.Header = make(http.Header)
+			}
+			res := res
+			res.Source = tc.source
+			got := res.Resolve(req)
+			if diff := cmp.Diff(got, tc.want, addrCmp); diff != "" {
+				t.Errorf("Resolve (-got, +want):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("TLS", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.TLS = &tls.ConnectionState{}
+		req.RemoteAddr = "192.0.2.1:443"
+		if got := res.Resolve(req); got.Scheme != "https" {
+			t.Errorf("Resolve: got scheme %q, want https", got.Scheme)
+		}
+	})
+}
+
+func TestForwardedHandler(t *testing.T) {
+	var got *http.Request
+	h := mhttp.ForwardedHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r }),
+		Resolver: mhttp.ForwardedResolver{
+			Trusted: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+		},
+	}
+
+	tests := []struct {
+		forwarded            string
+		remote, scheme, host string
+	}{
+		{"", "127.0.0.1:9999", "http", "svc.internal"},
+		{`for="[2001:db8::1]:4711";proto=https;host=example.com`, "[2001:db8::1]:4711", "https", "example.com"},
+		{"for=192.0.2.1", "192.0.2.1:0", "http", "svc.internal"},
+		{`for="192.0.2.1:_obf"`, "192.0.2.1:0", "http", "svc.internal"},
+		{"for=unknown;proto=https", "127.0.0.1:9999", "https", "svc.internal"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/path", nil)
+		req.RemoteAddr = "127.0.0.1:9999"
+		req.Host = "svc.internal"
+		if tc.forwarded != "" {
+			req.Header.Set("Forwarded", tc.forwarded)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got.RemoteAddr != tc.remote || got.URL.Scheme != tc.scheme || got.Host != tc.host {
+			t.Errorf("Forwarded %q: got (%q, %q, %q), want (%q, %q, %q)", tc.forwarded,
+				got.RemoteAddr, got.URL.Scheme, got.Host, tc.remote, tc.scheme, tc.host)
+		}
+		if req.RemoteAddr != "127.0.0.1:9999" || req.Host != "svc.internal" {
+			t.Errorf("Forwarded %q: original request was modified", tc.forwarded)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// PreloadLink returns a link with relation type "preload" for the resource
+// at target, which the client should fetch as the given destination, for
+// example "style", "script", "font", or "image". Because fonts are always
+// fetched in CORS mode, a font link includes the crossorigin attribute.
+func PreloadLink(target, as string) Link {
+	l := Link{Target: target, Rel: []string{"preload"}, Params: []LinkParam{{Name: "as", Value: as}}}
+	if as == "font" {
+		l.Params = append(l.Params, LinkParam{Name: "crossorigin"})
+	}
+	return l
+}
+
+// PreconnectLink returns a link with relation type "preconnect" for the
+// given origin, for example "https://cdn.example.com".
+func PreconnectLink(origin string) Link {
+	return Link{Target: origin, Rel: []string{"preconnect"}}
+}
+
+// SendEarlyHints adds Link headers for the given links to the response
+// header of w, and sends them to the client in a 103 (Early Hints) response
+// (RFC 8297). It must be called before the final response header is written.
+//
+// Links already present in the response header are not added again. The
+// headers remain in place for the final response, so that clients that
+// ignore the hints still see the links. Because an HTTP/1.0 client does not
+// understand informational responses, the 103 response is not sent to one,
+// but the headers are still added.
+//
+// A handler may call SendEarlyHints more than once. Each 103 response
+// includes all the links added so far.
+func SendEarlyHints(w http.ResponseWriter, r *http.Request, links ...Link) {
+	h := w.Header()
+	added := false
+	for _, l := range links {
+		s := l.String()
+		if !slices.Contains(h.Values("Link"), s) {
+			h.Add("Link", s)
+			added = true
+		}
+	}
+	if added && r.ProtoAtLeast(1, 1) {
+		w.WriteHeader(http.StatusEarlyHints)
+	}
+}
+
+// An EarlyHintsHandler is an [http.Handler] that sends a 103 (Early Hints)
+// response with the links for a request before delegating to an underlying
+// handler, so that the client can fetch subresources or connect to other
+// origins while the final response is computed. See [SendEarlyHints].
+//
+// The underlying handler may also call [SendEarlyHints] to send links of
+// its own.
+type EarlyHintsHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+
+	// Hints returns the links to send for a request. If it is nil, or
+	// returns no links, no hints are sent. [HintManifest.Hints] is suitable.
+	Hints func(*http.Request) []Link
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (e EarlyHintsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if e.Hints != nil {
+		if links := e.Hints(r); len(links) != 0 {
+			SendEarlyHints(w, r, links...)
+		}
+	}
+	e.Handler.ServeHTTP(w, r)
+}
+
+// A HintManifest maps request paths to the links for an [EarlyHintsHandler]
+// to send for them. A path ending in "/" also matches every path below it,
+// and the longest matching path is used, as in [http.ServeMux].
+//
+// A HintManifest can be decoded from a JSON object whose values are arrays
+// of link-values in the syntax of a Link header, for example:
+//
+//	{"/": ["</app.css>; rel=preload; as=style"],
+//	 "/docs/": ["<https://cdn.example.com>; rel=preconnect"]}
+type HintManifest map[string][]Link
+
+// Hints returns the links for the path of r, or nil if there are none.
+func (m HintManifest) Hints(r *http.Request) []Link {
+	path := r.URL.Path
+	if links, ok := m[path]; ok {
+		return links
+	}
+	best := ""
+	for pat := range m {
+		if strings.HasSuffix(pat, "/") && strings.HasPrefix(path, pat) && len(pat) > len(best) {
+			best = pat
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return m[best]
+}
+
+// UnmarshalJSON decodes a JSON object into m. It implements the
+// [json.Unmarshaler] interface.
+func (m *HintManifest) UnmarshalJSON(data []byte) error {
+	var raw map[string][]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	out := make(HintManifest, len(raw))
+	for path, vals := range raw {
+		var links []Link
+		for _, v := range vals {
+			ls, err := ParseLinkHeader(v)
+			if err != nil {
+				return fmt.Errorf("path %q: %w", path, err)
+			}
+			links = append(links, ls...)
+		}
+		out[path] = links
+	}
+	*m = out
+	return nil
+}
@@ -0,0 +1,115 @@
+package mhttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEarlyHintsHandler(t *testing.T) {
+	var manifest mhttp.HintManifest
+	if err := json.Unmarshal([]byte(`{
+  "/": ["</app.css>; rel=preload; as=style"],
+  "/docs/": ["</docs.js>; rel=preload; as=script", "<https://cdn.example.com>; rel=preconnect"],
+  "/docs/index": []
+}`), &manifest); err != nil {
+		t.Fatalf("Unmarshal manifest: %v", err)
+	}
+	srv := httptest.NewServer(mhttp.EarlyHintsHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("font") != "" {
+				mhttp.SendEarlyHints(w, r, mhttp.PreloadLink("/f.woff2", "font"))
+			}
+			w.Write([]byte("ok"))
+		}),
+		Hints: manifest.Hints,
+	})
+	defer srv.Close()
+
+	tests := []struct {
+		path      string
+		wantHints [][]string // Link headers of each 103 response
+		wantFinal []string   // Link headers of the final response
+	}{
+		{"/docs/index", nil, nil},
+		{"/", [][]string{{`</app.css>; rel="preload"; as=style`}}, []string{`</app.css>; rel="preload"; as=style`}},
+		{"/docs/a/b", [][]string{{
+			`</docs.js>; rel="preload"; as=script`,
+			`<https://cdn.example.com>; rel="preconnect"`,
+		}}, []string{
+			`</docs.js>; rel="preload"; as=script`,
+			`<https://cdn.example.com>; rel="preconnect"`,
+		}},
+		{"/docs/index?font=1", [][]string{{
+			`</f.woff2>; rel="preload"; as=font; crossorigin`,
+		}}, []string{
+			`</f.woff2>; rel="preload"; as=font; crossorigin`,
+		}},
+		{"/x?font=1", [][]string{
+			{`</app.css>; rel="preload"; as=style`},
+			{`</app.css>; rel="preload"; as=style`, `</f.woff2>; rel="preload"; as=font; crossorigin`},
+		}, []string{
+			`</app.css>; rel="preload"; as=style`,
+			`</f.woff2>; rel="preload"; as=font; crossorigin`,
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			var hints [][]string
+			ctx := httptrace.WithClientTrace(t.Context(), &httptrace.ClientTrace{
+				Got1xxResponse: func(code int, h textproto.MIMEHeader) error {
+					if code == http.StatusEarlyHints {
+						hints = append(hints, h.Values("Link"))
+					}
+					return nil
+				},
+			})
+			req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+tc.path, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			rsp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			rsp.Body.Close()
+			if diff := cmp.Diff(hints, tc.wantHints); diff != "" {
+				t.Errorf("Early hints (-got, +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(rsp.Header.Values("Link"), tc.wantFinal); diff != "" {
+				t.Errorf("Final links (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+type codeRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (c *codeRecorder) WriteHeader(code int) {
+	c.codes = append(c.codes, code)
+	c.ResponseRecorder.WriteHeader(code)
+}
+
+func TestSendEarlyHintsHTTP10(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+	rec := &codeRecorder{ResponseRecorder: httptest.NewRecorder()}
+	mhttp.SendEarlyHints(rec, req, mhttp.PreconnectLink("https://cdn.example.com"))
+	rec.WriteHeader(http.StatusOK)
+
+	if diff := cmp.Diff(rec.codes, []int{http.StatusOK}); diff != "" {
+		t.Errorf("Status codes (-got, +want):\n%s", diff)
+	}
+	if got, want := rec.Header().Get("Link"), `<https://cdn.example.com>; rel="preconnect"`; got != want {
+		t.Errorf("Link: got %q, want %q", got, want)
+	}
+}
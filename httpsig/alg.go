@@ -0,0 +1,181 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package httpsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Algorithm names registered by RFC 9421 Section 6.2.
+const (
+	RSAPSSSHA512    = "rsa-pss-sha512"
+	ECDSAP256SHA256 = "ecdsa-p256-sha256"
+	Ed25519         = "ed25519"
+	HMACSHA256      = "hmac-sha256"
+)
+
+const (
+	pssSaltLength    = 64 // bytes, per RFC 9421 Section 3.3.1
+	p256ScalarLength = 32 // bytes, per RFC 9421 Section 3.3.4
+)
+
+// A Signer produces signatures over signature bases.
+type Signer interface {
+	// Algorithm returns the registered name of the signature algorithm.
+	Algorithm() string
+
+	// Sign returns the signature of base.
+	Sign(base []byte) ([]byte, error)
+}
+
+// A Verifier checks signatures over signature bases.
+type Verifier interface {
+	// Algorithm returns the registered name of the signature algorithm.
+	Algorithm() string
+
+	// Verify reports an error if sig is not a valid signature of base.
+	Verify(base, sig []byte) error
+}
+
+// errBadSignature is reported by verifiers when a signature does not match.
+var errBadSignature = errors.New("signature does not match")
+
+// Ed25519Signer returns a [Signer] for the ed25519 algorithm.
+func Ed25519Signer(key ed25519.PrivateKey) Signer { return ed25519Key{priv: key} }
+
+// Ed25519Verifier returns a [Verifier] for the ed25519 algorithm.
+func Ed25519Verifier(key ed25519.PublicKey) Verifier { return ed25519Key{pub: key} }
+
+type ed25519Key struct {
+	priv ed25519.PrivateKey
+	pub  ed25519.PublicKey
+}
+
+func (ed25519Key) Algorithm() string { return Ed25519 }
+
+func (k ed25519Key) Sign(base []byte) ([]byte, error) { return ed25519.Sign(k.priv, base), nil }
+
+func (k ed25519Key) Verify(base, sig []byte) error {
+	if !ed25519.Verify(k.pub, base, sig) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// ECDSAP256Signer returns a [Signer] for the ecdsa-p256-sha256 algorithm.
+// It reports an error if key is not on the P-256 curve.
+func ECDSAP256Signer(key *ecdsa.PrivateKey) (Signer, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("key is not on the P-256 curve")
+	}
+	return ecdsaKey{priv: key, pub: &key.PublicKey}, nil
+}
+
+// ECDSAP256Verifier returns a [Verifier] for the ecdsa-p256-sha256 algorithm.
+// It reports an error if key is not on the P-256 curve.
+func ECDSAP256Verifier(key *ecdsa.PublicKey) (Verifier, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("key is not on the P-256 curve")
+	}
+	return ecdsaKey{pub: key}, nil
+}
+
+type ecdsaKey struct {
+	priv *ecdsa.PrivateKey
+	pub  *ecdsa.PublicKey
+}
+
+func (ecdsaKey) Algorithm() string { return ECDSAP256SHA256 }
+
+// Sign returns the signature as the concatenation of r and s, each as a
+// 32-byte big-endian integer, per RFC 9421 Section 3.3.4.
+func (k ecdsaKey) Sign(base []byte) ([]byte, error) {
+	digest := sha256.Sum256(base)
+	r, s, err := ecdsa.Sign(rand.Reader, k.priv, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 2*p256ScalarLength)
+	r.FillBytes(sig[:p256ScalarLength])
+	s.FillBytes(sig[p256ScalarLength:])
+	return sig, nil
+}
+
+func (k ecdsaKey) Verify(base, sig []byte) error {
+	if len(sig) != 2*p256ScalarLength {
+		return fmt.Errorf("invalid signature length %d", len(sig))
+	}
+	digest := sha256.Sum256(base)
+	r := new(big.Int).SetBytes(sig[:p256ScalarLength])
+	s := new(big.Int).SetBytes(sig[p256ScalarLength:])
+	if !ecdsa.Verify(k.pub, digest[:], r, s) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// RSAPSSSigner returns a [Signer] for the rsa-pss-sha512 algorithm.
+func RSAPSSSigner(key *rsa.PrivateKey) Signer { return rsaPSSKey{priv: key, pub: &key.PublicKey} }
+
+// RSAPSSVerifier returns a [Verifier] for the rsa-pss-sha512 algorithm.
+func RSAPSSVerifier(key *rsa.PublicKey) Verifier { return rsaPSSKey{pub: key} }
+
+type rsaPSSKey struct {
+	priv *rsa.PrivateKey
+	pub  *rsa.PublicKey
+}
+
+func (rsaPSSKey) Algorithm() string { return RSAPSSSHA512 }
+
+var pssOptions = &rsa.PSSOptions{SaltLength: pssSaltLength, Hash: crypto.SHA512}
+
+func (k rsaPSSKey) Sign(base []byte) ([]byte, error) {
+	digest := sha512.Sum512(base)
+	return rsa.SignPSS(rand.Reader, k.priv, crypto.SHA512, digest[:], pssOptions)
+}
+
+func (k rsaPSSKey) Verify(base, sig []byte) error {
+	digest := sha512.Sum512(base)
+	if err := rsa.VerifyPSS(k.pub, crypto.SHA512, digest[:], sig, pssOptions); err != nil {
+		return errBadSignature
+	}
+	return nil
+}
+
+// HMACSHA256Key returns a [Signer] and [Verifier] for the hmac-sha256
+// algorithm with the given shared secret.
+func HMACSHA256Key(secret []byte) interface {
+	Signer
+	Verifier
+} {
+	return hmacKey(secret)
+}
+
+type hmacKey []byte
+
+func (hmacKey) Algorithm() string { return HMACSHA256 }
+
+func (k hmacKey) Sign(base []byte) ([]byte, error) {
+	m := hmac.New(sha256.New, k)
+	m.Write(base)
+	return m.Sum(nil), nil
+}
+
+func (k hmacKey) Verify(base, sig []byte) error {
+	want, _ := k.Sign(base)
+	if !hmac.Equal(want, sig) {
+		return errBadSignature
+	}
+	return nil
+}
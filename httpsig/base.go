@@ -0,0 +1,317 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package httpsig
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/mhttp/sfv"
+)
+
+// A Component identifies a component of an HTTP message covered by a
+// signature (RFC 9421 Section 2). Its name is either a derived component
+// name beginning with "@", or the lower-case name of a header field.
+type Component struct {
+	Name   string
+	Params sfv.Params // e.g., {Key: "req", Value: true}
+}
+
+// C returns a component with the given name and no parameters. Header field
+// names are converted to lower case.
+func C(name string) Component { return Component{Name: strings.ToLower(name)} }
+
+// String returns the serialized component identifier, for example
+// "@query-param";name="id".
+func (c Component) String() string {
+	s, err := sfv.FormatItem(c.item())
+	if err != nil {
+		return strconv.Quote(c.Name)
+	}
+	return s
+}
+
+func (c Component) item() sfv.Item { return sfv.Item{Value: c.Name, Params: c.Params} }
+
+func (c Component) hasFlag(key string) bool {
+	v, ok := c.Params.Get(key)
+	return ok && v == true
+}
+
+func (c Component) stringParam(key string) (string, bool) {
+	v, ok := c.Params.Get(key)
+	s, isString := v.(string)
+	return s, ok && isString
+}
+
+// message is the subject of a signature: a request, or a response and the
+// request that elicited it.
+type message struct {
+	req *http.Request
+	rsp *http.Response // nil for a request
+}
+
+// signatureBase constructs the signature base for the given components and
+// serialized signature parameters (RFC 9421 Section 2.5).
+func (m message) signatureBase(components []Component, sigParams string) ([]byte, error) {
+	var sb strings.Builder
+	seen := make(map[string]bool)
+	for _, c := range components {
+		id := c.String()
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate component %s", id)
+		}
+		seen[id] = true
+		vals, err := m.componentValues(c)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", id, err)
+		}
+		for _, v := range vals {
+			if strings.ContainsAny(v, "\r\n") {
+				return nil, fmt.Errorf("component %s: value contains a line break", id)
+			}
+			sb.WriteString(id + ": " + v + "\n")
+		}
+	}
+	sb.WriteString(`"@signature-params": ` + sigParams)
+	return []byte(sb.String()), nil
+}
+
+// componentValues returns the values of c in m. Most components have a single
+// value, but @query-param has one for each occurrence of the parameter.
+func (m message) componentValues(c Component) ([]string, error) {
+	target := m
+	if c.hasFlag("req") {
+		if m.rsp == nil {
+			return nil, errors.New("req parameter in a request signature")
+		} else if m.req == nil {
+			return nil, errors.New("no request available")
+		}
+		target = message{req: m.req}
+	}
+	if strings.HasPrefix(c.Name, "@") {
+		return target.derivedValues(c)
+	}
+	h := target.header()
+	if h == nil {
+		return nil, errors.New("no message available")
+	}
+	v, err := fieldValue(c, h.Values(c.Name))
+	if err != nil {
+		return nil, err
+	}
+	return []string{v}, nil
+}
+
+func (m message) header() http.Header {
+	if m.rsp != nil {
+		return m.rsp.Header
+	} else if m.req != nil {
+		return m.req.Header
+	}
+	return nil
+}
+
+// derivedValues returns the value of a derived component (Section 2.2).
+func (m message) derivedValues(c Component) ([]string, error) {
+	if c.Name == "@status" {
+		if m.rsp == nil {
+			return nil, errors.New("@status in a request")
+		}
+		return []string{fmt.Sprintf("%03d", m.rsp.StatusCode)}, nil
+	}
+	if m.rsp != nil && !c.hasFlag("req") {
+		return nil, errors.New("request component in a response without req")
+	}
+	if m.req == nil {
+		return nil, errors.New("no request available")
+	}
+	req := m.req
+	one := func(s string) ([]string, error) { return []string{s}, nil }
+	switch c.Name {
+	case "@method":
+		return one(req.Method)
+	case "@target-uri":
+		return one(scheme(req) + "://" + authority(req) + requestTarget(req))
+	case "@authority":
+		return one(authority(req))
+	case "@scheme":
+		return one(scheme(req))
+	case "@request-target":
+		return one(requestTarget(req))
+	case "@path":
+		if p := req.URL.EscapedPath(); p != "" {
+			return one(p)
+		}
+		return one("/")
+	case "@query":
+		return one("?" + req.URL.RawQuery)
+	case "@query-param":
+		name, ok := c.stringParam("name")
+		if !ok {
+			return nil, errors.New("missing name parameter")
+		}
+		return queryParam(req.URL.RawQuery, name)
+	default:
+		return nil, fmt.Errorf("unknown derived component %q", c.Name)
+	}
+}
+
+// scheme returns the lower-case scheme of req.
+func scheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return strings.ToLower(req.URL.Scheme)
+	} else if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// authority returns the normalized authority of req: lower case, without
+// the default port for the scheme (Section 2.2.3).
+func authority(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host = strings.ToLower(host)
+	switch scheme(req) {
+	case "http":
+		host = strings.TrimSuffix(host, ":80")
+	case "https":
+		host = strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// requestTarget returns the path and query of req, in origin form.
+func requestTarget(req *http.Request) string {
+	if req.Method == http.MethodConnect {
+		return authority(req)
+	} else if req.URL.Opaque == "*" {
+		return "*"
+	}
+	return req.URL.RequestURI()
+}
+
+// queryParam returns the re-encoded values of each occurrence of the named
+// parameter in a query string (Section 2.2.8). The name is given in its
+// encoded form.
+func queryParam(rawQuery, name string) ([]string, error) {
+	want, err := url.QueryUnescape(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter name %q", name)
+	}
+	var out []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		dk, err1 := url.QueryUnescape(k)
+		dv, err2 := url.QueryUnescape(v)
+		if err1 != nil || err2 != nil || dk != want {
+			continue
+		}
+		out = append(out, formEncode(dv))
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("query parameter %q not found", name)
+	}
+	return out, nil
+}
+
+// formEncode percent-encodes s with the application/x-www-form-urlencoded
+// percent-encode set, but encoding space as %20 (Section 2.2.8).
+func formEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '*', c == '-', c == '.', c == '_':
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&15])
+		}
+	}
+	return sb.String()
+}
+
+// structuredTypes maps the names of known structured header fields to their
+// types, for the sf and key component parameters.
+var structuredTypes = map[string]string{
+	"accept-signature":    "dictionary",
+	"cache-status":        "list",
+	"content-digest":      "dictionary",
+	"proxy-status":        "list",
+	"repr-digest":         "dictionary",
+	"signature":           "dictionary",
+	"signature-input":     "dictionary",
+	"want-content-digest": "dictionary",
+	"want-repr-digest":    "dictionary",
+}
+
+// fieldValue returns the value of a header field component with the given
+// field values (Section 2.1).
+func fieldValue(c Component, vals []string) (string, error) {
+	if len(vals) == 0 {
+		return "", errors.New("field not present")
+	}
+	if c.hasFlag("bs") {
+		// Section 2.1.3: each value is wrapped as a byte sequence.
+		ss := make([]string, len(vals))
+		for i, v := range vals {
+			ss[i] = ":" + base64.StdEncoding.EncodeToString([]byte(strings.Trim(v, " \t"))) + ":"
+		}
+		return strings.Join(ss, ", "), nil
+	}
+	ss := make([]string, len(vals))
+	for i, v := range vals {
+		ss[i] = strings.Trim(v, " \t")
+	}
+	joined := strings.Join(ss, ", ")
+
+	key, hasKey := c.stringParam("key")
+	if !hasKey && !c.hasFlag("sf") {
+		return joined, nil
+	}
+	kind, ok := structuredTypes[c.Name]
+	if hasKey {
+		kind, ok = "dictionary", true
+	}
+	if !ok {
+		return "", fmt.Errorf("unknown structured field type for %q", c.Name)
+	}
+	switch kind {
+	case "dictionary":
+		d, err := sfv.ParseDictionary(joined)
+		if err != nil {
+			return "", err
+		}
+		if !hasKey {
+			return sfv.FormatDictionary(d)
+		}
+		m, ok := d.Get(key)
+		if !ok {
+			return "", fmt.Errorf("dictionary key %q not found", key)
+		}
+		return sfv.FormatList(sfv.List{m})
+	case "list":
+		l, err := sfv.ParseList(joined)
+		if err != nil {
+			return "", err
+		}
+		return sfv.FormatList(l)
+	default:
+		it, err := sfv.ParseItem(joined)
+		if err != nil {
+			return "", err
+		}
+		return sfv.FormatItem(it)
+	}
+}
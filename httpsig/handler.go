@@ -0,0 +1,122 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package httpsig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultSkew is the default allowance for clock skew used by a [Handler].
+const DefaultSkew = time.Minute
+
+// Handler is an [http.Handler] that verifies the signatures of requests
+// before delegating them to an underlying handler. A request is accepted if
+// it has at least one signature that:
+//
+//   - has a keyid parameter for which Keys returns a verifier,
+//   - covers all the Required components,
+//   - was created no later than now (allowing for Skew), and, if MaxAge > 0,
+//     no earlier than MaxAge before now,
+//   - has not expired (allowing for Skew), and
+//   - verifies correctly.
+//
+// Otherwise, the handler responds with 401 Unauthorized and does not call
+// the underlying handler. The accepted signature is available to the
+// underlying handler via [FromContext].
+type Handler struct {
+	// Handler is the underlying handler for verified requests.
+	Handler http.Handler
+
+	// Keys returns the verifier for the given key ID. If it reports an
+	// error, the signature is rejected. It must not be nil.
+	Keys func(ctx context.Context, keyID string) (Verifier, error)
+
+	// Required are the components that an acceptable signature must cover.
+	Required []Component
+
+	// MaxAge, if positive, is the maximum age of an acceptable signature.
+	// If MaxAge > 0, signatures must have a created parameter.
+	MaxAge time.Duration
+
+	// Skew is the allowance for clock skew when checking the created and
+	// expires parameters. If zero, DefaultSkew is used.
+	Skew time.Duration
+
+	// Now, if set, returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sig, err := h.Verify(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	h.Handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sigKey{}, sig)))
+}
+
+// Verify reports the first acceptable signature of r, as described for
+// [Handler], or an error if r has none.
+func (h Handler) Verify(r *http.Request) (Signature, error) {
+	sigs, err := Parse(r.Header)
+	if err != nil {
+		return Signature{}, err
+	} else if len(sigs) == 0 {
+		return Signature{}, errors.New("request is not signed")
+	}
+	var errs []error
+	for _, sig := range sigs {
+		if err := h.check(r, sig); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return sig, nil
+	}
+	return Signature{}, errors.Join(errs...)
+}
+
+func (h Handler) check(r *http.Request, sig Signature) error {
+	if !sig.Covers(h.Required...) {
+		return fmt.Errorf("signature %q does not cover the required components", sig.Label)
+	}
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+	skew := h.Skew
+	if skew == 0 {
+		skew = DefaultSkew
+	}
+	created, expires := sig.Params.Created, sig.Params.Expires
+	switch {
+	case h.MaxAge > 0 && created.IsZero():
+		return fmt.Errorf("signature %q has no creation time", sig.Label)
+	case !created.IsZero() && created.After(now.Add(skew)):
+		return fmt.Errorf("signature %q was created in the future", sig.Label)
+	case h.MaxAge > 0 && created.Before(now.Add(-h.MaxAge-skew)):
+		return fmt.Errorf("signature %q is too old", sig.Label)
+	case !expires.IsZero() && expires.Before(now.Add(-skew)):
+		return fmt.Errorf("signature %q has expired", sig.Label)
+	case sig.Params.KeyID == "":
+		return fmt.Errorf("signature %q has no key ID", sig.Label)
+	}
+	v, err := h.Keys(r.Context(), sig.Params.KeyID)
+	if err != nil {
+		return fmt.Errorf("signature %q: key %q: %w", sig.Label, sig.Params.KeyID, err)
+	}
+	return VerifyRequest(r, sig, v)
+}
+
+type sigKey struct{}
+
+// FromContext returns the signature accepted by a [Handler] for the request
+// with the given context, and reports whether there was one.
+func FromContext(ctx context.Context) (Signature, bool) {
+	sig, ok := ctx.Value(sigKey{}).(Signature)
+	return sig, ok
+}
@@ -0,0 +1,289 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+// Package httpsig implements HTTP Message Signatures as defined by
+// [RFC 9421].
+//
+// A signature covers a selection of message components: derived components
+// such as the method, authority, and path of a request, and header fields.
+// To sign a request, choose the components and signature parameters and call
+// [SignRequest], which adds the Signature-Input and Signature header fields.
+// To verify, parse the signatures of a message with [Parse] and check each
+// one with [VerifyRequest] or [VerifyResponse]. A [Handler] verifies the
+// signatures of incoming requests for an underlying handler.
+//
+// The supported algorithms are rsa-pss-sha512, ecdsa-p256-sha256, ed25519,
+// and hmac-sha256 (see [Signer] and [Verifier]).
+//
+// [RFC 9421]: https://www.rfc-editor.org/rfc/rfc9421
+package httpsig
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/creachadair/mhttp/sfv"
+)
+
+// Params are the signature parameters of a signature (RFC 9421 Section 2.3).
+// Zero fields are omitted.
+type Params struct {
+	Created time.Time // creation time
+	Expires time.Time // expiration time
+	Nonce   string    // a random unique value
+	Alg     string    // the signature algorithm
+	KeyID   string    // the identifier of the key
+	Tag     string    // an application-specific tag
+}
+
+// sfParams returns p as structured field parameters, in the order used by
+// the examples of RFC 9421.
+func (p Params) sfParams() sfv.Params {
+	var out sfv.Params
+	if !p.Created.IsZero() {
+		out.Set("created", p.Created.Unix())
+	}
+	if !p.Expires.IsZero() {
+		out.Set("expires", p.Expires.Unix())
+	}
+	if p.Nonce != "" {
+		out.Set("nonce", p.Nonce)
+	}
+	if p.Alg != "" {
+		out.Set("alg", p.Alg)
+	}
+	if p.KeyID != "" {
+		out.Set("keyid", p.KeyID)
+	}
+	if p.Tag != "" {
+		out.Set("tag", p.Tag)
+	}
+	return out
+}
+
+// parseParams decodes signature parameters, ignoring unknown ones.
+func parseParams(ps sfv.Params) (Params, error) {
+	var out Params
+	for _, p := range ps {
+		var ok bool
+		switch p.Key {
+		case "created", "expires":
+			var n int64
+			if n, ok = p.Value.(int64); ok {
+				if p.Key == "created" {
+					out.Created = time.Unix(n, 0)
+				} else {
+					out.Expires = time.Unix(n, 0)
+				}
+			}
+		case "nonce":
+			out.Nonce, ok = p.Value.(string)
+		case "alg":
+			out.Alg, ok = p.Value.(string)
+		case "keyid":
+			out.KeyID, ok = p.Value.(string)
+		case "tag":
+			out.Tag, ok = p.Value.(string)
+		default:
+			ok = true
+		}
+		if !ok {
+			return Params{}, fmt.Errorf("invalid %s parameter", p.Key)
+		}
+	}
+	return out, nil
+}
+
+// A Signature is a signature of an HTTP message.
+type Signature struct {
+	Label      string      // the label of the signature in the message
+	Components []Component // the covered components, in order
+	Params     Params      // the signature parameters
+	Value      []byte      // the signature itself
+
+	// raw, if set, is the parameter list as received, so that the signature
+	// base is reconstructed exactly even if it has unknown parameters or
+	// they are in an unusual order.
+	raw sfv.Params
+}
+
+// input returns the value of the Signature-Input entry for s.
+func (s Signature) input() sfv.InnerList {
+	items := make([]sfv.Item, len(s.Components))
+	for i, c := range s.Components {
+		items[i] = c.item()
+	}
+	ps := s.raw
+	if ps == nil {
+		ps = s.Params.sfParams()
+	}
+	return sfv.InnerList{Items: items, Params: ps}
+}
+
+// signatureParams returns the serialized @signature-params value for s.
+func (s Signature) signatureParams() (string, error) {
+	return sfv.FormatList(sfv.List{s.input()})
+}
+
+// RequestBase returns the signature base of s for req (RFC 9421 Section
+// 2.5), which is the data that is signed.
+func (s Signature) RequestBase(req *http.Request) ([]byte, error) {
+	return s.base(message{req: req})
+}
+
+// ResponseBase returns the signature base of s for rsp. Components with the
+// req parameter refer to rsp.Request.
+func (s Signature) ResponseBase(rsp *http.Response) ([]byte, error) {
+	return s.base(message{req: rsp.Request, rsp: rsp})
+}
+
+func (s Signature) base(m message) ([]byte, error) {
+	sp, err := s.signatureParams()
+	if err != nil {
+		return nil, err
+	}
+	return m.signatureBase(s.Components, sp)
+}
+
+// SignRequest signs the specified components of req with the given label
+// and parameters, and adds the signature to the Signature-Input and
+// Signature header fields of req, replacing any existing signature with the
+// same label. The caller is responsible for choosing parameters such as
+// Created and KeyID.
+func SignRequest(req *http.Request, label string, s Signer, components []Component, p Params) error {
+	return sign(message{req: req}, req.Header, label, s, components, p)
+}
+
+// SignResponse signs the specified components of rsp as for [SignRequest].
+// Components with the req parameter refer to rsp.Request.
+func SignResponse(rsp *http.Response, label string, s Signer, components []Component, p Params) error {
+	return sign(message{req: rsp.Request, rsp: rsp}, rsp.Header, label, s, components, p)
+}
+
+func sign(m message, h http.Header, label string, s Signer, components []Component, p Params) error {
+	sig := Signature{Label: label, Components: components, Params: p}
+	base, err := sig.base(m)
+	if err != nil {
+		return err
+	}
+	sig.Value, err = s.Sign(base)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	return addSignature(h, sig)
+}
+
+// addSignature adds sig to the Signature-Input and Signature fields of h.
+func addSignature(h http.Header, sig Signature) error {
+	inputs, err := sfv.ParseDictionary(strings.Join(h.Values("Signature-Input"), ", "))
+	if err != nil {
+		return fmt.Errorf("existing Signature-Input: %w", err)
+	}
+	sigs, err := sfv.ParseDictionary(strings.Join(h.Values("Signature"), ", "))
+	if err != nil {
+		return fmt.Errorf("existing Signature: %w", err)
+	}
+	inputs.Set(sig.Label, sig.input())
+	sigs.Set(sig.Label, sfv.Item{Value: sig.Value})
+
+	si, err := sfv.FormatDictionary(inputs)
+	if err != nil {
+		return fmt.Errorf("format Signature-Input: %w", err)
+	}
+	sv, err := sfv.FormatDictionary(sigs)
+	if err != nil {
+		return fmt.Errorf("format Signature: %w", err)
+	}
+	h.Set("Signature-Input", si)
+	h.Set("Signature", sv)
+	return nil
+}
+
+// Parse returns the signatures in the Signature-Input and Signature fields
+// of h, in the order of Signature-Input. It reports an error if either field
+// is malformed, or if a signature input has no matching signature.
+func Parse(h http.Header) ([]Signature, error) {
+	inputs, err := sfv.ParseDictionary(strings.Join(h.Values("Signature-Input"), ", "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Signature-Input: %w", err)
+	}
+	sigs, err := sfv.ParseDictionary(strings.Join(h.Values("Signature"), ", "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Signature: %w", err)
+	}
+	var out []Signature
+	for _, e := range inputs {
+		il, ok := e.Value.(sfv.InnerList)
+		if !ok {
+			return nil, fmt.Errorf("signature input %q is not an inner list", e.Key)
+		}
+		sig := Signature{Label: e.Key, raw: il.Params}
+		for _, it := range il.Items {
+			name, ok := it.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("signature input %q has a non-string component", e.Key)
+			}
+			sig.Components = append(sig.Components, Component{Name: name, Params: it.Params})
+		}
+		sig.Params, err = parseParams(il.Params)
+		if err != nil {
+			return nil, fmt.Errorf("signature input %q: %w", e.Key, err)
+		}
+		m, ok := sigs.Get(e.Key)
+		if !ok {
+			return nil, fmt.Errorf("no signature for input %q", e.Key)
+		}
+		if it, ok := m.(sfv.Item); ok {
+			sig.Value, ok = it.Value.([]byte)
+		}
+		if sig.Value == nil {
+			return nil, fmt.Errorf("signature %q is not a byte sequence", e.Key)
+		}
+		out = append(out, sig)
+	}
+	return out, nil
+}
+
+// VerifyRequest reports whether sig is a valid signature of req by v. If the
+// signature has an alg parameter, it must match the algorithm of v. The
+// caller is responsible for checking that the signature covers the required
+// components and that its parameters are acceptable; see also [Handler].
+func VerifyRequest(req *http.Request, sig Signature, v Verifier) error {
+	return verify(message{req: req}, sig, v)
+}
+
+// VerifyResponse reports whether sig is a valid signature of rsp by v, as
+// for [VerifyRequest].
+func VerifyResponse(rsp *http.Response, sig Signature, v Verifier) error {
+	return verify(message{req: rsp.Request, rsp: rsp}, sig, v)
+}
+
+func verify(m message, sig Signature, v Verifier) error {
+	if sig.Params.Alg != "" && sig.Params.Alg != v.Algorithm() {
+		return fmt.Errorf("signature %q: algorithm %q does not match key algorithm %q",
+			sig.Label, sig.Params.Alg, v.Algorithm())
+	}
+	base, err := sig.base(m)
+	if err != nil {
+		return fmt.Errorf("signature %q: %w", sig.Label, err)
+	}
+	if err := v.Verify(base, sig.Value); err != nil {
+		return fmt.Errorf("signature %q: %w", sig.Label, err)
+	}
+	return nil
+}
+
+// Covers reports whether sig covers all the specified components.
+func (s Signature) Covers(components ...Component) bool {
+	have := make(map[string]bool)
+	for _, c := range s.Components {
+		have[c.String()] = true
+	}
+	for _, c := range components {
+		if !have[c.String()] {
+			return false
+		}
+	}
+	return true
+}
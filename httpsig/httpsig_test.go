@@ -0,0 +1,485 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package httpsig_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp/httpsig"
+	"github.com/creachadair/mhttp/sfv"
+)
+
+// The test request and response from RFC 9421 Appendix B.2.
+func testRequest(t *testing.T) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest("POST", "http://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	req.Header.Set("Content-Length", "18")
+	return req
+}
+
+func testResponse(t *testing.T) *http.Response {
+	t.Helper()
+	rsp := &http.Response{StatusCode: 200, Header: make(http.Header), Request: testRequest(t)}
+	rsp.Header.Set("Date", "Tue, 20 Apr 2021 02:07:56 GMT")
+	rsp.Header.Set("Content-Type", "application/json")
+	rsp.Header.Set("Content-Digest", "sha-512=:mEWXIS7MaLRuGgxOBdODa3xqM1XdEvxoYhvlCFJ41QJgJc4GTsPp29l5oGX69wWdXymyU0rjJuahq4l5aGgfLQ==:")
+	rsp.Header.Set("Content-Length", "23")
+	return rsp
+}
+
+// Keys from RFC 9421 Appendix B.1.
+const (
+	testKeyEd25519  = "MC4CAQAwBQYDK2VwBCIEIJ+DYvh6SEqVTm50DFtMDoQikTmiCqirVv9mWG9qfSnF"
+	testKeyECCP256  = "MHcCAQEEIFKbhfNZfpDsW43+0+JjUr9K+bTeuxopu653+hBaXGA7oAoGCCqGSM49AwEHoUQDQgAEqIVYZVLCrPZHGHjP17CTW0/+D9Lfw0EkjqF7xB4FivAxzic30tMM4GF+hR6Dxh71Z50VGGdldkkDXZCnTNnoXQ=="
+	testSharedKey   = "uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ=="
+	testCreatedUnix = 1618884473
+
+	// The public key of test-key-rsa-pss.
+	testKeyRSAPSS = "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAr4tmm3r20Wd/PbqvP1s2+QEtvpuRaV8Yq40gjUR8y2Rjxa6dpG2GXHbPfvMs8ct+Lh1GH45x28Rw3Ry53mm+oAXjyQ86OnDkZ5N8lYbggD4O3w6M6pAvLkhk95AndTrifbIFPNU8PPMO7OyrFAHqgDsznjPFmTOtCEcN2Z1FpWgchwuYLPL+Wokqltd11nqqzi+bJ9cvSKADYdUAAN5WUtzdpiy6LbTgSxP7ociU4Tn0g5I6aDZJ7A8Lzo0KSyZYoA485mqcO0GVAdVw9lq4aOT9v6d+nb4bnNkQVklLQ3fVAvJm+xdDOp9LCNCN48V2pnDOkFV6+U9nV5oyc6XI2wIDAQAB"
+)
+
+func mustBase64(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Decode base64: %v", err)
+	}
+	return data
+}
+
+func ed25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	k, err := x509.ParsePKCS8PrivateKey(mustBase64(t, testKeyEd25519))
+	if err != nil {
+		t.Fatalf("Parse Ed25519 key: %v", err)
+	}
+	return k.(ed25519.PrivateKey)
+}
+
+func components(names ...string) []httpsig.Component {
+	out := make([]httpsig.Component, len(names))
+	for i, name := range names {
+		out[i] = httpsig.C(name)
+	}
+	return out
+}
+
+func TestSignatureBase(t *testing.T) {
+	// RFC 9421 Appendix B.2.2.
+	req := testRequest(t)
+	req.Header.Set("Signature-Input", `sig-b22=("@authority" "content-digest" "@query-param";name="Pet");created=1618884473;keyid="test-key-rsa-pss";tag="header-example"`)
+	// The signature value is not checked here; only the base is.
+	req.Header.Set("Signature", `sig-b22=:AAAA:`)
+	sigs, err := httpsig.Parse(req.Header)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	} else if len(sigs) != 1 {
+		t.Fatalf("Parse: got %d signatures, want 1", len(sigs))
+	}
+	sig := sigs[0]
+	if sig.Label != "sig-b22" || sig.Params.KeyID != "test-key-rsa-pss" || sig.Params.Tag != "header-example" ||
+		sig.Params.Created.Unix() != testCreatedUnix {
+		t.Errorf("Parse: got %+v", sig)
+	}
+	base, err := sig.RequestBase(req)
+	if err != nil {
+		t.Fatalf("RequestBase: unexpected error: %v", err)
+	}
+	const want = `"@authority": example.com
+"content-digest": sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:
+"@query-param";name="Pet": dog
+"@signature-params": ("@authority" "content-digest" "@query-param";name="Pet");created=1618884473;keyid="test-key-rsa-pss";tag="header-example"`
+	if got := string(base); got != want {
+		t.Errorf("RequestBase:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDerivedComponents(t *testing.T) {
+	// Examples from RFC 9421 Section 2.2.
+	req := httptest.NewRequest("POST", "https://www.example.com/path?param=value&foo=bar&baz=bat%2Dman&qux=", nil)
+	req.Host = "www.example.com"
+	rsp := &http.Response{StatusCode: 200, Header: make(http.Header), Request: req}
+
+	tests := []struct {
+		comp httpsig.Component
+		want string
+	}{
+		{httpsig.C("@method"), "POST"},
+		{httpsig.C("@target-uri"), "https://www.example.com/path?param=value&foo=bar&baz=bat%2Dman&qux="},
+		{httpsig.C("@authority"), "www.example.com"},
+		{httpsig.C("@scheme"), "https"},
+		{httpsig.C("@request-target"), "/path?param=value&foo=bar&baz=bat%2Dman&qux="},
+		{httpsig.C("@path"), "/path"},
+		{httpsig.C("@query"), "?param=value&foo=bar&baz=bat%2Dman&qux="},
+		{queryParam("baz"), "bat-man"},
+		{queryParam("qux"), ""},
+		{queryParam("param"), "value"},
+	}
+	for _, tc := range tests {
+		sig := httpsig.Signature{Components: []httpsig.Component{tc.comp}}
+		base, err := sig.RequestBase(req)
+		if err != nil {
+			t.Errorf("RequestBase %s: unexpected error: %v", tc.comp, err)
+			continue
+		}
+		line, _, _ := strings.Cut(string(base), "\n")
+		if want := tc.comp.String() + ": " + tc.want; line != want {
+			t.Errorf("RequestBase %s: got %q, want %q", tc.comp, line, want)
+		}
+	}
+
+	// A request component in a response requires the req parameter.
+	sig := httpsig.Signature{Components: components("@method")}
+	if _, err := sig.ResponseBase(rsp); err == nil {
+		t.Error("ResponseBase @method: got nil, want error")
+	}
+	sig.Components[0].Params = sfv.Params{{Key: "req", Value: true}}
+	if base, err := sig.ResponseBase(rsp); err != nil {
+		t.Errorf("ResponseBase @method;req: unexpected error: %v", err)
+	} else if !strings.HasPrefix(string(base), `"@method";req: POST`+"\n") {
+		t.Errorf("ResponseBase @method;req: got %q", base)
+	}
+
+	// Errors.
+	for _, cs := range [][]string{
+		{"@status"},      // not in a request
+		{"@bogus"},       // unknown
+		{"x-missing"},    // absent field
+		{"date", "date"}, // duplicate
+		{"@query-param"}, // no name
+	} {
+		req := testRequest(t)
+		sig := httpsig.Signature{Components: components(cs...)}
+		if base, err := sig.RequestBase(req); err == nil {
+			t.Errorf("RequestBase %q: got %q, want error", cs, base)
+		}
+	}
+}
+
+func queryParam(name string) httpsig.Component {
+	return httpsig.Component{Name: "@query-param", Params: sfv.Params{{Key: "name", Value: name}}}
+}
+
+func TestFieldComponents(t *testing.T) {
+	// Examples from RFC 9421 Section 2.1.
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Add("X-OWS-Header", "   Leading and trailing whitespace.   ")
+	req.Header.Add("X-Obs-Fold-Header", "Obsolete line folding.")
+	req.Header.Add("Example-Dict", " a=1,    b=2;x=1;y=2,   c=(a   b   c)")
+	req.Header.Add("Example-Header", "value, with, lots")
+	req.Header.Add("Example-Header", "of, commas")
+
+	tests := []struct {
+		comp httpsig.Component
+		want string
+	}{
+		{httpsig.C("X-OWS-Header"), "Leading and trailing whitespace."},
+		{httpsig.C("example-header"), "value, with, lots, of, commas"},
+		{httpsig.C("example-dict"), "a=1,    b=2;x=1;y=2,   c=(a   b   c)"},
+		{withParams("example-dict", sfv.Param{Key: "key", Value: "a"}), "1"},
+		{withParams("example-dict", sfv.Param{Key: "key", Value: "b"}), "2;x=1;y=2"},
+		{withParams("example-dict", sfv.Param{Key: "key", Value: "c"}), "(a b c)"},
+		{withParams("example-header", sfv.Param{Key: "bs", Value: true}), ":dmFsdWUsIHdpdGgsIGxvdHM=:, :b2YsIGNvbW1hcw==:"},
+	}
+	for _, tc := range tests {
+		sig := httpsig.Signature{Components: []httpsig.Component{tc.comp}}
+		base, err := sig.RequestBase(req)
+		if err != nil {
+			t.Errorf("RequestBase %s: unexpected error: %v", tc.comp, err)
+			continue
+		}
+		line, _, _ := strings.Cut(string(base), "\n")
+		if want := tc.comp.String() + ": " + tc.want; line != want {
+			t.Errorf("RequestBase %s: got %q, want %q", tc.comp, line, want)
+		}
+	}
+}
+
+func withParams(name string, ps ...sfv.Param) httpsig.Component {
+	return httpsig.Component{Name: name, Params: ps}
+}
+
+func TestVectors(t *testing.T) {
+	t.Run("HMAC", func(t *testing.T) {
+		// RFC 9421 Appendix B.2.5.
+		req := testRequest(t)
+		req.Header.Set("Signature-Input", `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`)
+		req.Header.Set("Signature", `sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:`)
+		key := httpsig.HMACSHA256Key(mustBase64(t, testSharedKey))
+		verifyOne(t, req, key)
+
+		// HMAC signatures are deterministic, so signing must reproduce it.
+		req2 := testRequest(t)
+		if err := httpsig.SignRequest(req2, "sig-b25", key, components("date", "@authority", "content-type"), httpsig.Params{
+			Created: time.Unix(testCreatedUnix, 0),
+			KeyID:   "test-shared-secret",
+		}); err != nil {
+			t.Fatalf("SignRequest: unexpected error: %v", err)
+		}
+		for _, name := range []string{"Signature-Input", "Signature"} {
+			if got, want := req2.Header.Get(name), req.Header.Get(name); got != want {
+				t.Errorf("SignRequest %s: got %q, want %q", name, got, want)
+			}
+		}
+	})
+
+	t.Run("Ed25519", func(t *testing.T) {
+		// RFC 9421 Appendix B.2.6.
+		req := testRequest(t)
+		req.Header.Set("Signature-Input", `sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`)
+		req.Header.Set("Signature", `sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:`)
+		priv := ed25519Key(t)
+		verifyOne(t, req, httpsig.Ed25519Verifier(priv.Public().(ed25519.PublicKey)))
+
+		// Ed25519 signatures are deterministic, so signing must reproduce it.
+		req2 := testRequest(t)
+		if err := httpsig.SignRequest(req2, "sig-b26", httpsig.Ed25519Signer(priv),
+			components("date", "@method", "@path", "@authority", "content-type", "content-length"),
+			httpsig.Params{Created: time.Unix(testCreatedUnix, 0), KeyID: "test-key-ed25519"}); err != nil {
+			t.Fatalf("SignRequest: unexpected error: %v", err)
+		}
+		if got, want := req2.Header.Get("Signature"), req.Header.Get("Signature"); got != want {
+			t.Errorf("SignRequest: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("RSAPSS", func(t *testing.T) {
+		// RFC 9421 Appendix B.2.1 and B.2.2. RSA-PSS signatures are
+		// randomized, so these can only be verified.
+		k, err := x509.ParsePKIXPublicKey(mustBase64(t, testKeyRSAPSS))
+		if err != nil {
+			t.Fatalf("Parse RSA key: %v", err)
+		}
+		v := httpsig.RSAPSSVerifier(k.(*rsa.PublicKey))
+		tests := []struct {
+			input, sig string
+		}{
+			{`sig-b21=();created=1618884473;keyid="test-key-rsa-pss";nonce="b3k2pp5k7z-50gnwp.yemd"`,
+				`sig-b21=:d2pmTvmbncD3xQm8E9ZV2828BjQWGgiwAaw5bAkgibUopemLJcWDy/lkbbHAve4cRAtx31Iq786U7it++wgGxbtRxf8Udx7zFZsckzXaJMkA7ChG52eSkFxykJeNqsrWH5S+oxNFlD4dzVuwe8DhTSja8xxbR/Z2cOGdCbzR72rgFWhzx2VjBqJzsPLMIQKhO4DGezXehhWwE56YCE+O6c0mKZsfxVrogUvA4HELjVKWmAvtl6UnCh8jYzuVG5WSb/QEVPnP5TmcAnLH1g+s++v6d4s8m0gCw1fV5/SITLq9mhho8K3+7EPYTU8IU1bLhdxO5Nyt8C8ssinQ98Xw9Q==:`},
+			{`sig-b22=("@authority" "content-digest" "@query-param";name="Pet");created=1618884473;keyid="test-key-rsa-pss";tag="header-example"`,
+				`sig-b22=:LjbtqUbfmvjj5C5kr1Ugj4PmLYvx9wVjZvD9GsTT4F7GrcQEdJzgI9qHxICagShLRiLMlAJjtq6N4CDfKtjvuJyE5qH7KT8UCMkSowOB4+ECxCmT8rtAmj/0PIXxi0A0nxKyB09RNrCQibbUjsLS/2YyFYXEu4TRJQzRw1rLEuEfY17SARYhpTlaqwZVtR8NV7+4UKkjqpcAoFqWFQh62s7Cl+H2fjBSpqfZUJcsIk4N6wiKYd4je2U/lankenQ99PZfB4jY3I5rSV2DSBVkSFsURIjYErOs0tFTQosMTAoxk//0RoKUqiYY8Bh0aaUEb0rQl3/XaVe4bXTugEjHSw==:`},
+		}
+		for _, tc := range tests {
+			req := testRequest(t)
+			req.Header.Set("Signature-Input", tc.input)
+			req.Header.Set("Signature", tc.sig)
+			sigs, err := httpsig.Parse(req.Header)
+			if err != nil || len(sigs) != 1 {
+				t.Fatalf("Parse: got %d signatures, %v; want 1", len(sigs), err)
+			}
+			if err := httpsig.VerifyRequest(req, sigs[0], v); err != nil {
+				t.Errorf("VerifyRequest %s: unexpected error: %v", sigs[0].Label, err)
+			}
+
+			// The signature parameters are covered even if no components are.
+			req.Header.Set("Signature-Input", strings.Replace(tc.input, "created=1618884473", "created=1618884474", 1))
+			sigs, err = httpsig.Parse(req.Header)
+			if err != nil || len(sigs) != 1 {
+				t.Fatalf("Parse: got %d signatures, %v; want 1", len(sigs), err)
+			}
+			if err := httpsig.VerifyRequest(req, sigs[0], v); err == nil {
+				t.Errorf("VerifyRequest %s with modified parameters: got nil, want error", sigs[0].Label)
+			}
+		}
+	})
+
+	t.Run("ECDSA", func(t *testing.T) {
+		// RFC 9421 Appendix B.2.4.
+		k, err := x509.ParseECPrivateKey(mustBase64(t, testKeyECCP256))
+		if err != nil {
+			t.Fatalf("Parse ECDSA key: %v", err)
+		}
+		v, err := httpsig.ECDSAP256Verifier(&k.PublicKey)
+		if err != nil {
+			t.Fatalf("ECDSAP256Verifier: %v", err)
+		}
+		rsp := testResponse(t)
+		rsp.Header.Set("Signature-Input", `sig-b24=("@status" "content-type" "content-digest" "content-length");created=1618884473;keyid="test-key-ecc-p256"`)
+		rsp.Header.Set("Signature", `sig-b24=:wNmSUAhwb5LxtOtOpNa6W5xj067m5hFrj0XQ4fvpaCLx0NKocgPquLgyahnzDnDAUy5eCdlYUEkLIj+32oiasw==:`)
+		sigs, err := httpsig.Parse(rsp.Header)
+		if err != nil || len(sigs) != 1 {
+			t.Fatalf("Parse: got %d signatures, %v; want 1", len(sigs), err)
+		}
+		if err := httpsig.VerifyResponse(rsp, sigs[0], v); err != nil {
+			t.Errorf("VerifyResponse: unexpected error: %v", err)
+		}
+		rsp.StatusCode = 201
+		if err := httpsig.VerifyResponse(rsp, sigs[0], v); err == nil {
+			t.Error("VerifyResponse with modified status: got nil, want error")
+		}
+	})
+}
+
+// verifyOne checks that req has one signature, that it verifies with v, and
+// that it fails to verify when the request is modified.
+func verifyOne(t *testing.T, req *http.Request, v httpsig.Verifier) {
+	t.Helper()
+	sigs, err := httpsig.Parse(req.Header)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	} else if len(sigs) != 1 {
+		t.Fatalf("Parse: got %d signatures, want 1", len(sigs))
+	}
+	if err := httpsig.VerifyRequest(req, sigs[0], v); err != nil {
+		t.Errorf("VerifyRequest: unexpected error: %v", err)
+	}
+	req.Host = "example.org"
+	if err := httpsig.VerifyRequest(req, sigs[0], v); err == nil {
+		t.Error("VerifyRequest with modified authority: got nil, want error")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// RSA-PSS and ECDSA signatures are randomized, so these check that each
+	// algorithm verifies its own signatures and rejects others.
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generate ECDSA key: %v", err)
+	}
+	ecSigner, err := httpsig.ECDSAP256Signer(ecKey)
+	if err != nil {
+		t.Fatalf("ECDSAP256Signer: %v", err)
+	}
+	ecVerifier, err := httpsig.ECDSAP256Verifier(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatalf("ECDSAP256Verifier: %v", err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Generate Ed25519 key: %v", err)
+	}
+	hmacKey := httpsig.HMACSHA256Key([]byte("secret"))
+
+	tests := []struct {
+		s httpsig.Signer
+		v httpsig.Verifier
+	}{
+		{httpsig.RSAPSSSigner(rsaKey), httpsig.RSAPSSVerifier(&rsaKey.PublicKey)},
+		{ecSigner, ecVerifier},
+		{httpsig.Ed25519Signer(edPriv), httpsig.Ed25519Verifier(edPub)},
+		{hmacKey, hmacKey},
+	}
+	comps := components("@method", "@target-uri", "content-digest")
+	for i, tc := range tests {
+		t.Run(tc.s.Algorithm(), func(t *testing.T) {
+			req := testRequest(t)
+			req.Header.Set("Signature-Input", `other=("@method");keyid="x"`)
+			req.Header.Set("Signature", `other=:AAAA:`)
+			if err := httpsig.SignRequest(req, "sig1", tc.s, comps, httpsig.Params{
+				Created: time.Unix(testCreatedUnix, 0),
+				Alg:     tc.s.Algorithm(),
+				KeyID:   "k",
+			}); err != nil {
+				t.Fatalf("SignRequest: unexpected error: %v", err)
+			}
+			sigs, err := httpsig.Parse(req.Header)
+			if err != nil {
+				t.Fatalf("Parse: unexpected error: %v", err)
+			} else if len(sigs) != 2 || sigs[1].Label != "sig1" {
+				t.Fatalf("Parse: got %+v, want other and sig1", sigs)
+			}
+			if err := httpsig.VerifyRequest(req, sigs[1], tc.v); err != nil {
+				t.Errorf("VerifyRequest: unexpected error: %v", err)
+			}
+			other := tests[(i+1)%len(tests)].v
+			if err := httpsig.VerifyRequest(req, sigs[1], other); err == nil {
+				t.Errorf("VerifyRequest with %s: got nil, want error", other.Algorithm())
+			}
+			req.Header.Set("Content-Digest", "sha-256=:AAAA:")
+			if err := httpsig.VerifyRequest(req, sigs[1], tc.v); err == nil {
+				t.Error("VerifyRequest with modified field: got nil, want error")
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	key := httpsig.HMACSHA256Key([]byte("test secret"))
+	now := time.Unix(testCreatedUnix, 0)
+	h := httpsig.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sig, ok := httpsig.FromContext(r.Context())
+			if !ok {
+				t.Error("FromContext: no signature")
+			}
+			io.WriteString(w, sig.Params.KeyID)
+		}),
+		Keys: func(_ context.Context, id string) (httpsig.Verifier, error) {
+			if id == "good" {
+				return key, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+		Required: components("@method", "@authority"),
+		MaxAge:   5 * time.Minute,
+		Now:      func() time.Time { return now },
+	}
+
+	sign := func(comps []string, p httpsig.Params) *http.Request {
+		req := testRequest(t)
+		if err := httpsig.SignRequest(req, "sig", key, components(comps...), p); err != nil {
+			t.Fatalf("SignRequest: %v", err)
+		}
+		return req
+	}
+	all := []string{"@method", "@authority", "@path"}
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"OK", sign(all, httpsig.Params{Created: now.Add(-time.Minute), KeyID: "good"}), http.StatusOK},
+		{"Unsigned", testRequest(t), http.StatusUnauthorized},
+		{"UnknownKey", sign(all, httpsig.Params{Created: now, KeyID: "bad"}), http.StatusUnauthorized},
+		{"NoKeyID", sign(all, httpsig.Params{Created: now}), http.StatusUnauthorized},
+		{"Uncovered", sign([]string{"@method"}, httpsig.Params{Created: now, KeyID: "good"}), http.StatusUnauthorized},
+		{"NoCreated", sign(all, httpsig.Params{KeyID: "good"}), http.StatusUnauthorized},
+		{"TooOld", sign(all, httpsig.Params{Created: now.Add(-time.Hour), KeyID: "good"}), http.StatusUnauthorized},
+		{"Future", sign(all, httpsig.Params{Created: now.Add(time.Hour), KeyID: "good"}), http.StatusUnauthorized},
+		{"SkewOK", sign(all, httpsig.Params{Created: now.Add(30 * time.Second), KeyID: "good"}), http.StatusOK},
+		{"Expired", sign(all, httpsig.Params{Created: now, Expires: now.Add(-time.Hour), KeyID: "good"}), http.StatusUnauthorized},
+		{"WrongAlg", sign(all, httpsig.Params{Created: now, Alg: httpsig.Ed25519, KeyID: "good"}), http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, tc.req)
+			if rec.Code != tc.want {
+				t.Errorf("Status: got %d, want %d (%s)", rec.Code, tc.want, rec.Body.String())
+			} else if tc.want == http.StatusOK && rec.Body.String() != "good" {
+				t.Errorf("Body: got %q, want %q", rec.Body.String(), "good")
+			}
+		})
+	}
+
+	t.Run("Tampered", func(t *testing.T) {
+		req := sign(all, httpsig.Params{Created: now, KeyID: "good"})
+		req.URL.Path = "/bar"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Status: got %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+}
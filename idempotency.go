@@ -0,0 +1,361 @@
+package mhttp
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/mhttp/sfv"
+)
+
+// IdempotentReplayedHeader is the response header with which an
+// [IdempotencyHandler] marks a response replayed from its store.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyPoll is the interval at which an IdempotencyHandler checks
+// whether a concurrent request with the same key has finished.
+const idempotencyPoll = 25 * time.Millisecond
+
+// A StoredResponse is a response recorded by an [IdempotencyHandler].
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// An IdempotencyRecord is the state of an idempotency key in an
+// [IdempotencyStore].
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request that first used the key.
+	Fingerprint string
+
+	// Response is the response to the request, or nil if the request is
+	// still in progress.
+	Response *StoredResponse
+}
+
+// An IdempotencyStore records the requests made with idempotency keys, and
+// their responses. Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Reserve atomically creates a record for key with the given fingerprint
+	// and no response, if there is no record for key, and returns a new
+	// non-empty token that identifies the reservation. Otherwise it returns
+	// the existing record and an empty token.
+	//
+	// A record without a response must not be discarded while its
+	// reservation may still be completed, or the request could run twice.
+	Reserve(ctx context.Context, key, fingerprint string) (_ IdempotencyRecord, token string, _ error)
+
+	// Complete records the response for a key reserved by Reserve with the
+	// given token. It reports an error without changing the record if the
+	// record for key does not hold that reservation.
+	Complete(ctx context.Context, key, token string, rsp StoredResponse) error
+
+	// Release discards the record for a key reserved by Reserve with the
+	// given token, so that the request can be retried. It reports an error
+	// without changing the record if the record for key does not hold that
+	// reservation.
+	Release(ctx context.Context, key, token string) error
+}
+
+// An IdempotencyHandler is an [http.Handler] that implements the
+// [Idempotency-Key] header for an underlying handler, so that clients can
+// safely retry requests whose methods are not idempotent.
+//
+// The first request with a given key is delegated to the underlying handler,
+// and its response is recorded in the store and then sent. A later request
+// with the same key gets the recorded response, with an
+// [IdempotentReplayedHeader] of "?1", without calling the handler. A request
+// with a key whose first request is still in progress waits for it to finish
+// for up to WaitTimeout, and then gets status 409 (Conflict). A request
+// that reuses a key with a different method, path, or content gets status
+// 422 (Unprocessable Content).
+//
+// Responses with a 5xx status are not recorded, so that the client may retry
+// the request with the same key.
+//
+// The whole response is buffered before it is sent, so the handler is not
+// suitable for streaming responses.
+//
+// [Idempotency-Key]: https://datatracker.ietf.org/doc/draft-ietf-httpapi-idempotency-key-header/
+type IdempotencyHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+
+	// Store records keys and responses. It must not be nil.
+	Store IdempotencyStore
+
+	// Methods are the request methods to which keys apply. Requests with
+	// other methods are delegated without checking for a key. If empty,
+	// POST and PATCH are used.
+	Methods []string
+
+	// Required, if true, rejects requests without a key with status 400
+	// (Bad Request). Otherwise they are delegated without checking.
+	Required bool
+
+	// Scope, if non-nil, returns a scope for the key of a request, so that
+	// the keys of different clients do not collide. Key functions for a
+	// [RateLimitHandler], such as [RateLimitByAuth], are suitable.
+	Scope func(*http.Request) string
+
+	// MaxBodySize, if positive, is the maximum size of a request body. A
+	// request with a key and a larger body gets status 413 (Content Too
+	// Large).
+	MaxBodySize int64
+
+	// WaitTimeout is how long a request waits for a concurrent request with
+	// the same key to finish. If zero, it does not wait.
+	WaitTimeout time.Duration
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h IdempotencyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	methods := h.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if !slices.Contains(methods, r.Method) {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+	hdr := r.Header.Get("Idempotency-Key")
+	if hdr == "" {
+		if h.Required {
+			NewProblem(http.StatusBadRequest, "an Idempotency-Key header is required").ServeHTTP(w, r)
+			return
+		}
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+	key, err := ParseIdempotencyKey(hdr)
+	if err != nil {
+		NewProblem(http.StatusBadRequest, err.Error()).ServeHTTP(w, r)
+		return
+	}
+	if h.Scope != nil {
+		key = h.Scope(r) + "\x00" + key
+	}
+
+	// Read the body to fingerprint the request, then restore it.
+	var body []byte
+	if r.Body != nil {
+		rc := r.Body
+		if h.MaxBodySize > 0 {
+			rc = http.MaxBytesReader(w, rc, h.MaxBodySize)
+		}
+		body, err = io.ReadAll(rc)
+		if mbe := (*http.MaxBytesError)(nil); errors.As(err, &mbe) {
+			NewProblem(http.StatusRequestEntityTooLarge, "request body is too large").ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			NewProblem(http.StatusBadRequest, "reading request body: "+err.Error()).ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	fp := requestFingerprint(r, body)
+
+	ctx := r.Context()
+	var deadline time.Time
+	if h.WaitTimeout > 0 {
+		deadline = time.Now().Add(h.WaitTimeout)
+	}
+	var token string
+	for {
+		rec, tok, err := h.Store.Reserve(ctx, key, fp)
+		if err != nil {
+			NewProblem(http.StatusInternalServerError, err.Error()).ServeHTTP(w, r)
+			return
+		} else if tok != "" {
+			token = tok
+			break // we hold the key
+		}
+		if rec.Fingerprint != fp {
+			NewProblem(http.StatusUnprocessableEntity,
+				"the idempotency key was used for a different request").ServeHTTP(w, r)
+			return
+		}
+		if rec.Response != nil {
+			replay(w, rec.Response)
+			return
+		}
+		if !time.Now().Before(deadline) {
+			p := NewProblem(http.StatusConflict, "a request with this idempotency key is in progress")
+			p.Header = http.Header{"Retry-After": {"1"}}
+			p.ServeHTTP(w, r)
+			return
+		}
+		tm := time.NewTimer(idempotencyPoll)
+		select {
+		case <-ctx.Done():
+			tm.Stop()
+			return
+		case <-tm.C:
+		}
+	}
+
+	// Release the key unless the response is recorded, including if the
+	// handler panics, so that the request can be retried.
+	recorded := false
+	defer func() {
+		if !recorded {
+			h.Store.Release(context.WithoutCancel(ctx), key, token)
+		}
+	}()
+	buf := newResponseBuffer()
+	h.Handler.ServeHTTP(buf, r)
+	if code := cmp.Or(buf.code, http.StatusOK); code < 500 {
+		err := h.Store.Complete(context.WithoutCancel(ctx), key, token, StoredResponse{
+			Status: code,
+			Header: buf.header.Clone(),
+			Body:   bytes.Clone(buf.body.Bytes()),
+		})
+		recorded = err == nil
+	}
+	buf.copyTo(w)
+}
+
+// replay writes a stored response to w.
+func replay(w http.ResponseWriter, rsp *StoredResponse) {
+	h := w.Header()
+	for name, vs := range rsp.Header {
+		h[name] = slices.Clone(vs)
+	}
+	h.Set(IdempotentReplayedHeader, "?1")
+	w.WriteHeader(rsp.Status)
+	w.Write(rsp.Body)
+}
+
+// requestFingerprint returns a fingerprint of the method, target, and body
+// of r.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ParseIdempotencyKey parses the contents of an Idempotency-Key header,
+// which is a structured string. For compatibility with clients that do not
+// quote the key, a value that is not a structured item is used as-is if it
+// is a non-empty sequence of visible ASCII characters other than quotation
+// marks.
+func ParseIdempotencyKey(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if it, err := sfv.ParseItem(s); err == nil {
+		if key, ok := it.Value.(string); ok && key != "" {
+			return key, nil
+		} else if tok, ok := it.Value.(sfv.Token); ok {
+			return string(tok), nil
+		}
+	}
+	if s == "" || strings.ContainsFunc(s, func(r rune) bool { return r <= ' ' || r > '~' || r == '"' }) {
+		return "", fmt.Errorf("invalid Idempotency-Key %q", s)
+	}
+	return s, nil
+}
+
+// A MemoryIdempotencyStore is an [IdempotencyStore] that keeps records in
+// memory, and discards completed records after a fixed time. A reservation
+// is kept until it is completed or released.
+type MemoryIdempotencyStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	records map[string]*memoryRecord
+	sweep   int // sweep expired records when the map reaches this size
+}
+
+type memoryRecord struct {
+	rec     IdempotencyRecord
+	token   string    // the reservation token
+	expires time.Time // zero if the record has no response
+}
+
+// expired reports whether mr has a response that expired before now.
+func (mr *memoryRecord) expired(now time.Time) bool {
+	return !mr.expires.IsZero() && !now.Before(mr.expires)
+}
+
+// NewMemoryIdempotencyStore returns a new empty [MemoryIdempotencyStore] that
+// discards records ttl after they are completed. It panics if ttl ≤ 0.
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	if ttl <= 0 {
+		panic("ttl must be positive")
+	}
+	return &MemoryIdempotencyStore{ttl: ttl, records: make(map[string]*memoryRecord), sweep: 64}
+}
+
+// Reserve implements part of the [IdempotencyStore] interface.
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key, fingerprint string) (IdempotencyRecord, string, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mr, ok := s.records[key]; ok && !mr.expired(now) {
+		return mr.rec, "", nil
+	}
+	s.sweepExpired(now)
+	mr := &memoryRecord{rec: IdempotencyRecord{Fingerprint: fingerprint}, token: rand.Text()}
+	s.records[key] = mr
+	return mr.rec, mr.token, nil
+}
+
+// Complete implements part of the [IdempotencyStore] interface.
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key, token string, rsp StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mr, err := s.reserved(key, token)
+	if err != nil {
+		return err
+	}
+	mr.rec.Response = &rsp
+	mr.expires = time.Now().Add(s.ttl)
+	return nil
+}
+
+// Release implements part of the [IdempotencyStore] interface.
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.reserved(key, token); err != nil {
+		return err
+	}
+	delete(s.records, key)
+	return nil
+}
+
+// reserved returns the record for key if it holds the reservation with the
+// given token and has no response. The caller must hold s.mu.
+func (s *MemoryIdempotencyStore) reserved(key, token string) (*memoryRecord, error) {
+	mr, ok := s.records[key]
+	if !ok || mr.token != token || mr.rec.Response != nil {
+		return nil, fmt.Errorf("idempotency key %q is not reserved", key)
+	}
+	return mr, nil
+}
+
+// sweepExpired discards expired records, so that the map does not grow
+// without bound. The caller must hold s.mu.
+func (s *MemoryIdempotencyStore) sweepExpired(now time.Time) {
+	if len(s.records) < s.sweep {
+		return
+	}
+	for key, mr := range s.records {
+		if mr.expired(now) {
+			delete(s.records, key)
+		}
+	}
+	s.sweep = max(2*len(s.records), 64)
+}
@@ -0,0 +1,300 @@
+package mhttp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+)
+
+func TestIdempotencyHandler(t *testing.T) {
+	var calls atomic.Int32
+	h := mhttp.IdempotencyHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := calls.Add(1)
+			body, _ := io.ReadAll(r.Body)
+			if string(body) == "fail" {
+				http.Error(w, "oops", http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("X-Call", string(rune('0'+n)))
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}),
+		Store: mhttp.NewMemoryIdempotencyStore(time.Minute),
+	}
+	do := func(t *testing.T, method, key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/things", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Replay", func(t *testing.T) {
+		calls.Store(0)
+		first := do(t, "POST", `"k1"`, "hello")
+		if first.Code != http.StatusCreated || first.Body.String() != "hello" {
+			t.Fatalf("First: got %d %q, want 201 hello", first.Code, first.Body)
+		}
+		if got := first.Header().Get(mhttp.IdempotentReplayedHeader); got != "" {
+			t.Errorf("First: got replayed header %q, want none", got)
+		}
+		second := do(t, "POST", "k1", "hello") // unquoted, same key
+		if second.Code != http.StatusCreated || second.Body.String() != "hello" {
+			t.Errorf("Second: got %d %q, want 201 hello", second.Code, second.Body)
+		}
+		if got := second.Header().Get(mhttp.IdempotentReplayedHeader); got != "?1" {
+			t.Errorf("Second: got replayed header %q, want ?1", got)
+		}
+		if got := second.Header().Get("X-Call"); got != "1" {
+			t.Errorf("Second: got X-Call %q, want 1", got)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("Handler calls: got %d, want 1", n)
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		do(t, "POST", `"k2"`, "one")
+		if rec := do(t, "POST", `"k2"`, "two"); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Different body: got %d, want 422", rec.Code)
+		}
+		if rec := do(t, "PATCH", `"k2"`, "one"); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Different method: got %d, want 422", rec.Code)
+		}
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		calls.Store(0)
+		for range 2 {
+			if rec := do(t, "POST", `"k3"`, "fail"); rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("Failing request: got %d, want 503", rec.Code)
+			}
+		}
+		if n := calls.Load(); n != 2 {
+			t.Errorf("Handler calls: got %d, want 2", n)
+		}
+	})
+
+	t.Run("NoKey", func(t *testing.T) {
+		calls.Store(0)
+		do(t, "POST", "", "x")
+		do(t, "POST", "", "x")
+		do(t, "GET", `"k4"`, "")
+		do(t, "GET", `"k4"`, "")
+		if n := calls.Load(); n != 4 {
+			t.Errorf("Handler calls: got %d, want 4", n)
+		}
+
+		strict := h
+		strict.Required = true
+		rec := httptest.NewRecorder()
+		strict.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("x")))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Required key: got %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		if rec := do(t, "POST", `"unterminated`, "x"); rec.Code != http.StatusBadRequest {
+			t.Errorf("Invalid key: got %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		small := h
+		small.MaxBodySize = 4
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/", strings.NewReader("too large"))
+		req.Header.Set("Idempotency-Key", `"k5"`)
+		small.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Large body: got %d, want 413", rec.Code)
+		}
+	})
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := mhttp.IdempotencyHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte("done"))
+		}),
+		Store: mhttp.NewMemoryIdempotencyStore(time.Minute),
+	}
+	newReq := func() *http.Request {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("x"))
+		req.Header.Set("Idempotency-Key", `"k"`)
+		return req
+	}
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() { defer close(done); h.ServeHTTP(first, newReq()) }()
+	<-started
+
+	// Without a wait, a duplicate is rejected while the first is in progress.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newReq())
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Concurrent: got %d, want 409", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got == "" {
+		t.Error("Concurrent: missing Retry-After")
+	}
+
+	// With a wait, a duplicate gets the response once the first is done.
+	h.WaitTimeout = 5 * time.Second
+	rec = httptest.NewRecorder()
+	go func() { time.Sleep(50 * time.Millisecond); close(release) }()
+	h.ServeHTTP(rec, newReq())
+	<-done
+	if rec.Code != http.StatusOK || rec.Body.String() != "done" {
+		t.Errorf("Waiting: got %d %q, want 200 done", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(mhttp.IdempotentReplayedHeader); got != "?1" {
+		t.Errorf("Waiting: got replayed header %q, want ?1", got)
+	}
+}
+
+func TestIdempotencySlowHandler(t *testing.T) {
+	// A handler that runs longer than the TTL of the store must not run
+	// again for a duplicate request.
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := mhttp.IdempotencyHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				close(started)
+			}
+			<-release
+			w.Write([]byte("done"))
+		}),
+		Store: mhttp.NewMemoryIdempotencyStore(10 * time.Millisecond),
+	}
+	newReq := func() *http.Request {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("x"))
+		req.Header.Set("Idempotency-Key", `"slow"`)
+		return req
+	}
+	done := make(chan struct{})
+	go func() { defer close(done); h.ServeHTTP(httptest.NewRecorder(), newReq()) }()
+	<-started
+	time.Sleep(30 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newReq())
+	close(release)
+	<-done
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Duplicate after ttl: got %d, want 409", rec.Code)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Handler calls: got %d, want 1", n)
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	s := mhttp.NewMemoryIdempotencyStore(ttl)
+	ctx := t.Context()
+	rsp := mhttp.StoredResponse{Status: http.StatusOK}
+
+	tok1, err := reserve(t, s, "k", "a")
+	if err != nil || tok1 == "" {
+		t.Fatalf("Reserve: got %q, %v; want a token", tok1, err)
+	}
+	if rec, tok, err := s.Reserve(ctx, "k", "b"); err != nil || tok != "" || rec.Fingerprint != "a" {
+		t.Fatalf("Reserve again: got %+v, %q, %v; want a, no token", rec, tok, err)
+	}
+
+	// A reservation does not expire while its request is in progress.
+	time.Sleep(2 * ttl)
+	if _, tok, _ := s.Reserve(ctx, "k", "a"); tok != "" {
+		t.Fatalf("Reserve after ttl: got token %q, want none", tok)
+	}
+
+	// Only the holder of the reservation can complete or release it.
+	if err := s.Complete(ctx, "k", "bogus", rsp); err == nil {
+		t.Error("Complete with wrong token: got nil, want error")
+	}
+	if err := s.Release(ctx, "k", "bogus"); err == nil {
+		t.Error("Release with wrong token: got nil, want error")
+	}
+	if err := s.Complete(ctx, "k", tok1, rsp); err != nil {
+		t.Fatalf("Complete: unexpected error: %v", err)
+	}
+	if err := s.Release(ctx, "k", tok1); err == nil {
+		t.Error("Release after Complete: got nil, want error")
+	}
+	if rec, tok, _ := s.Reserve(ctx, "k", "a"); tok != "" || rec.Response == nil {
+		t.Errorf("Reserve completed: got %+v, %q; want the response, no token", rec, tok)
+	}
+
+	// A completed record expires ttl after it is completed.
+	time.Sleep(2 * ttl)
+	tok2, err := reserve(t, s, "k", "b")
+	if err != nil || tok2 == "" || tok2 == tok1 {
+		t.Fatalf("Reserve after expiry: got %q, %v; want a new token", tok2, err)
+	}
+
+	// A stale holder cannot disturb a later reservation.
+	if err := s.Release(ctx, "k", tok1); err == nil {
+		t.Error("Release with stale token: got nil, want error")
+	}
+	if err := s.Release(ctx, "k", tok2); err != nil {
+		t.Errorf("Release: unexpected error: %v", err)
+	}
+}
+
+func reserve(t *testing.T, s *mhttp.MemoryIdempotencyStore, key, fp string) (string, error) {
+	t.Helper()
+	_, tok, err := s.Reserve(t.Context(), key, fp)
+	return tok, err
+}
+
+func TestParseIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		input, want string // want == "" for error
+	}{
+		{`"8e03978e-40d5-43e8-bc93-6894a57f9324"`, "8e03978e-40d5-43e8-bc93-6894a57f9324"},
+		{`  "abc"  `, "abc"},
+		{"abc", "abc"},
+		{"8e03978e-40d5", "8e03978e-40d5"},
+		{"a+b/c=", "a+b/c="},
+
+		{"", ""},
+		{`""`, ""},
+		{`"abc`, ""},
+		{"a b", ""},
+		{"café", ""},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseIdempotencyKey(tc.input)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("Parse %q: got %q, want error", tc.input, got)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Parse %q: got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
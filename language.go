@@ -0,0 +1,259 @@
+package mhttp
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AcceptLanguage is the parsed representation of an HTTP [Accept-Language]
+// header.
+//
+// [Accept-Language]: https://httpwg.org/specs/rfc9110.html#field.accept-language
+type AcceptLanguage struct {
+	ranges []LanguageRange // nil if not present
+}
+
+// A LanguageRange is a single element of an Accept-Language header.
+type LanguageRange struct {
+	// Tag is the basic language range, for example "en-US", "zh", or "*".
+	Tag string
+
+	// Quality is the weight assigned to the range, between 0 and 1.
+	// If the range does not specify a weight, the default is 1.
+	Quality float64
+}
+
+// matches reports whether r matches tag under the RFC 4647 basic filtering
+// scheme: The range "*" matches every tag, and any other range matches a tag
+// that is equal to it, or that begins with it followed by "-".
+func (r LanguageRange) matches(tag string) bool {
+	if r.Tag == "*" {
+		return true
+	}
+	pfx, ok := cutPrefixFold(tag, r.Tag)
+	return ok && (pfx == "" || pfx[0] == '-')
+}
+
+// ParseAcceptLanguageHeader parses the contents of an HTTP Accept-Language
+// header and returns an [AcceptLanguage]. If the header is empty it returns
+// an AcceptLanguage that accepts all languages. Use [AcceptLanguage.IsPresent]
+// to check for this case. An error is only reported if the header is present
+// but invalid.
+func ParseAcceptLanguageHeader(s string) (AcceptLanguage, error) {
+	if strings.TrimSpace(s) == "" {
+		return AcceptLanguage{}, nil // not present
+	}
+	out := []LanguageRange{}
+	for _, elt := range splitList(s) {
+		tag, wt, hasWeight := strings.Cut(elt, ";")
+		tag = strings.TrimSpace(tag)
+		if !isLanguageRange(tag) {
+			return AcceptLanguage{}, fmt.Errorf("invalid language range %q", tag)
+		}
+		q := 1.0
+		if hasWeight {
+			qs, ok := strings.CutPrefix(strings.TrimSpace(wt), "q=")
+			if !ok {
+				return AcceptLanguage{}, fmt.Errorf("invalid weight in %q", elt)
+			}
+			v, err := parseQValue(qs)
+			if err != nil {
+				return AcceptLanguage{}, fmt.Errorf("invalid weight in %q: %w", elt, err)
+			}
+			q = v
+		}
+		out = append(out, LanguageRange{Tag: tag, Quality: q})
+	}
+	return AcceptLanguage{ranges: out}, nil
+}
+
+// IsPresent reports whether an Accept-Language header was present at the
+// time of parsing.
+func (a AcceptLanguage) IsPresent() bool { return a.ranges != nil }
+
+// Ranges returns the language ranges of a in the order they were specified.
+// The caller should not modify the contents of the slice.
+func (a AcceptLanguage) Ranges() []LanguageRange { return a.ranges }
+
+// preferred returns the ranges of a with non-zero weight, in descending order
+// of weight. Ranges with equal weight retain their original order.
+func (a AcceptLanguage) preferred() []LanguageRange {
+	out := slices.DeleteFunc(slices.Clone(a.ranges), func(r LanguageRange) bool {
+		return r.Quality == 0
+	})
+	slices.SortStableFunc(out, func(a, b LanguageRange) int {
+		return cmp.Compare(b.Quality, a.Quality)
+	})
+	return out
+}
+
+// Quality reports the weight a assigns to the specified language tag. The
+// weight is taken from the longest range that matches the tag, with "*"
+// matching only if no other range does. If no range matches, the weight is
+// 0. If a is not present, the weight is always 1.
+func (a AcceptLanguage) Quality(tag string) float64 {
+	q, _ := a.quality(tag)
+	return q
+}
+
+// quality reports the weight of tag, and the index of the range that
+// determined it. It reports -1 for the index if no range matches.
+func (a AcceptLanguage) quality(tag string) (float64, int) {
+	if !a.IsPresent() {
+		return 1, 0
+	}
+	q, pos, best := 0.0, -1, -1
+	for i, r := range a.ranges {
+		n := len(r.Tag)
+		if r.Tag == "*" {
+			n = 0
+		}
+		if n > best && r.matches(tag) {
+			q, pos, best = r.Quality, i, n
+		}
+	}
+	return q, pos
+}
+
+// Filter implements the [basic filtering] scheme of RFC 4647. It returns
+// those supported tags that are acceptable to a, in order of preference.
+//
+// A supported tag is acceptable if the longest range that matches it has a
+// non-zero weight, so that for example "en, en-GB;q=0" accepts "en-US" but not
+// "en-GB". Acceptable tags are ordered by decreasing weight, then by the order
+// of their matching ranges in the header, then by their order in supported.
+// If a is not present, all the supported tags are returned in order.
+//
+// [basic filtering]: https://www.rfc-editor.org/rfc/rfc4647#section-3.3.1
+func (a AcceptLanguage) Filter(supported ...string) []string {
+	type match struct {
+		tag string
+		q   float64
+		pos int
+	}
+	var ms []match
+	for _, tag := range supported {
+		if q, pos := a.quality(tag); q > 0 {
+			ms = append(ms, match{tag, q, pos})
+		}
+	}
+	slices.SortStableFunc(ms, func(a, b match) int {
+		if c := cmp.Compare(b.q, a.q); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.pos, b.pos)
+	})
+	var out []string
+	for _, m := range ms {
+		out = append(out, m.tag)
+	}
+	return out
+}
+
+// A LanguageMatch is the result of a successful language lookup.
+type LanguageMatch struct {
+	// Tag is the selected tag, as it was given in the supported list.
+	Tag string
+
+	// Range is the language range from the header that selected Tag.
+	Range string
+
+	// Fallback is the lookup fallback chain for Range, from most to least
+	// specific, for example [zh-Hant-TW zh-Hant zh]. Tag is equal (without
+	// regard to case) to one of the elements of Fallback.
+	//
+	// Applications that assemble localized resources from partial bundles
+	// can use the chain to select the order in which bundles are consulted.
+	Fallback []string
+}
+
+// Lookup implements the [lookup] scheme of RFC 4647. It returns the single
+// supported tag that best matches a.
+//
+// Ranges are considered in order of decreasing weight. For each range, the
+// fallback chain (see [LanguageFallback]) is searched from most to least
+// specific for a tag that is equal to one of the supported tags, without
+// regard to case. The first match is returned. Ranges with zero weight and
+// the range "*" are not considered.
+//
+// If no supported tag matches, or a is not present, Lookup reports false; the
+// caller should then use its default language.
+//
+// [lookup]: https://www.rfc-editor.org/rfc/rfc4647#section-3.4
+func (a AcceptLanguage) Lookup(supported ...string) (LanguageMatch, bool) {
+	for _, r := range a.preferred() {
+		if r.Tag == "*" {
+			continue
+		}
+		chain := LanguageFallback(r.Tag)
+		for _, cand := range chain {
+			i := slices.IndexFunc(supported, func(s string) bool {
+				return strings.EqualFold(s, cand)
+			})
+			if i >= 0 {
+				return LanguageMatch{Tag: supported[i], Range: r.Tag, Fallback: chain}, true
+			}
+		}
+	}
+	return LanguageMatch{}, false
+}
+
+// LanguageFallback returns the lookup fallback chain for a language tag, from
+// most to least specific, as defined by [RFC 4647 Section 3.4]. Each element
+// after the first is formed by removing the last subtag of the previous one,
+// along with any single-character subtag (such as "x") left at the end.
+//
+// For example, the fallback chain for "zh-Hant-CN-x-private" is:
+//
+//	zh-Hant-CN-x-private
+//	zh-Hant-CN
+//	zh-Hant
+//	zh
+//
+// [RFC 4647 Section 3.4]: https://www.rfc-editor.org/rfc/rfc4647#section-3.4
+func LanguageFallback(tag string) []string {
+	var out []string
+	for tag != "" {
+		out = append(out, tag)
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+		if j := strings.LastIndexByte(tag, '-'); j >= 0 && j == len(tag)-2 {
+			tag = tag[:j]
+		}
+	}
+	return out
+}
+
+// isLanguageRange reports whether s is a valid basic language range.
+//
+//	language-range = (1*8ALPHA *("-" 1*8alphanum)) / "*"
+func isLanguageRange(s string) bool {
+	if s == "*" {
+		return true
+	}
+	for i, sub := range strings.Split(s, "-") {
+		if len(sub) == 0 || len(sub) > 8 {
+			return false
+		}
+		for _, c := range sub {
+			isAlpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+			if !isAlpha && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cutPrefixFold is as [strings.CutPrefix], but compares without regard to case.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
@@ -0,0 +1,127 @@
+package mhttp_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAcceptLanguageHeader(t *testing.T) {
+	a, err := mhttp.ParseAcceptLanguageHeader("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5")
+	if err != nil {
+		t.Fatalf("ParseAcceptLanguageHeader: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(a.Ranges(), []mhttp.LanguageRange{
+		{"fr-CH", 1}, {"fr", 0.9}, {"en", 0.8}, {"de", 0.7}, {"*", 0.5},
+	}); diff != "" {
+		t.Errorf("Ranges (-got, +want):\n%s", diff)
+	}
+
+	t.Run("Fail", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{"en_US", "invalid language range"},
+			{"toolonglang", "invalid language range"},
+			{"1en", "invalid language range"},
+			{"en-", "invalid language range"},
+			{"en;level=1", "invalid weight"},
+			{"en;q=high", "invalid weight"},
+		}
+		for _, tc := range tests {
+			a, err := mhttp.ParseAcceptLanguageHeader(tc.input)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ParseAcceptLanguageHeader(%q): got (%+v, %v), want error %q", tc.input, a, err, tc.want)
+			}
+		}
+	})
+}
+
+func TestLanguageFilter(t *testing.T) {
+	supported := []string{"en", "en-US", "en-GB", "de-DE", "fr", "zh-Hant-TW", "zh-Hans"}
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", supported},
+		{"en", []string{"en", "en-US", "en-GB"}},
+		{"EN-us", []string{"en-US"}},
+		{"de, en;q=0.5", []string{"de-DE", "en", "en-US", "en-GB"}},
+		{"en, en-GB;q=0", []string{"en", "en-US"}},
+		{"zh-Hant, *;q=0.1", []string{"zh-Hant-TW", "en", "en-US", "en-GB", "de-DE", "fr", "zh-Hans"}},
+		{"fr, *;q=0", []string{"fr"}},
+		{"e", nil},
+		{"ja", nil},
+	}
+	for _, tc := range tests {
+		a, err := mhttp.ParseAcceptLanguageHeader(tc.header)
+		if err != nil {
+			t.Fatalf("ParseAcceptLanguageHeader(%q): unexpected error: %v", tc.header, err)
+		}
+		if diff := cmp.Diff(a.Filter(supported...), tc.want); diff != "" {
+			t.Errorf("Filter %q (-got, +want):\n%s", tc.header, diff)
+		}
+	}
+}
+
+func TestLanguageLookup(t *testing.T) {
+	supported := []string{"en", "en-GB", "de", "zh-Hant", "zh"}
+	tests := []struct {
+		header string
+		want   *mhttp.LanguageMatch
+	}{
+		{"", nil},
+		{"ja", nil},
+		{"*", nil},
+		{"en-GB", &mhttp.LanguageMatch{Tag: "en-GB", Range: "en-GB", Fallback: []string{"en-GB", "en"}}},
+		{"en-US", &mhttp.LanguageMatch{Tag: "en", Range: "en-US", Fallback: []string{"en-US", "en"}}},
+		{"zh-Hant-TW", &mhttp.LanguageMatch{
+			Tag: "zh-Hant", Range: "zh-Hant-TW", Fallback: []string{"zh-Hant-TW", "zh-Hant", "zh"},
+		}},
+		{"ZH-HANS-CN", &mhttp.LanguageMatch{
+			Tag: "zh", Range: "ZH-HANS-CN", Fallback: []string{"ZH-HANS-CN", "ZH-HANS", "ZH"},
+		}},
+		{"ja;q=0.9, de-AT;q=0.95, en;q=0.1", &mhttp.LanguageMatch{
+			Tag: "de", Range: "de-AT", Fallback: []string{"de-AT", "de"},
+		}},
+		{"de;q=0, fr", nil},
+	}
+	for _, tc := range tests {
+		a, err := mhttp.ParseAcceptLanguageHeader(tc.header)
+		if err != nil {
+			t.Fatalf("ParseAcceptLanguageHeader(%q): unexpected error: %v", tc.header, err)
+		}
+		got, ok := a.Lookup(supported...)
+		if tc.want == nil {
+			if ok {
+				t.Errorf("Lookup %q: got %+v, want no match", tc.header, got)
+			}
+		} else if !ok {
+			t.Errorf("Lookup %q: got no match, want %+v", tc.header, tc.want)
+		} else if diff := cmp.Diff(got, *tc.want); diff != "" {
+			t.Errorf("Lookup %q (-got, +want):\n%s", tc.header, diff)
+		}
+	}
+}
+
+func TestLanguageFallback(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"en", []string{"en"}},
+		{"zh-Hant-TW", []string{"zh-Hant-TW", "zh-Hant", "zh"}},
+		{"zh-Hant-CN-x-private1-private2", []string{
+			"zh-Hant-CN-x-private1-private2", "zh-Hant-CN-x-private1", "zh-Hant-CN", "zh-Hant", "zh",
+		}},
+		{"de-DE-u-co-phonebk", []string{"de-DE-u-co-phonebk", "de-DE-u-co", "de-DE", "de"}},
+	}
+	for _, tc := range tests {
+		if diff := cmp.Diff(mhttp.LanguageFallback(tc.input), tc.want); diff != "" {
+			t.Errorf("LanguageFallback(%q) (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package mhttp
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Link is a single link-value from an HTTP [Link] header (RFC 8288).
+//
+// [Link]: https://www.rfc-editor.org/rfc/rfc8288#section-3
+type Link struct {
+	// Target is the target URI reference, as given. It may be relative.
+	Target string
+
+	// Rel are the relation types of the link, for example "next".
+	Rel []string
+
+	// Anchor, if non-empty, overrides the context of the link.
+	Anchor string
+
+	// Type is a hint of the media type of the target.
+	Type string
+
+	// Title is a human-readable label for the link. When parsing, it is
+	// taken from the title* parameter if present, otherwise from title.
+	// When formatting, a title containing non-ASCII characters is written as
+	// a title* parameter.
+	Title string
+
+	// TitleLang is the language of Title, if it was given by a title*
+	// parameter. When formatting, it is used only for a title* parameter.
+	TitleLang string
+
+	// Params are the other parameters of the link, in the order given.
+	Params []LinkParam
+}
+
+// A LinkParam is a target attribute of a [Link].
+type LinkParam struct {
+	Name  string // normalized to lower case
+	Value string // unquoted; empty if there was no value
+}
+
+// HasRel reports whether l has the specified relation type. Relation types
+// are compared without regard to case.
+func (l Link) HasRel(rel string) bool {
+	return slices.ContainsFunc(l.Rel, func(r string) bool { return strings.EqualFold(r, rel) })
+}
+
+// String renders l as a link-value for a Link header.
+func (l Link) String() string {
+	var sb strings.Builder
+	sb.WriteString("<" + l.Target + ">")
+	if len(l.Rel) != 0 {
+		sb.WriteString("; rel=" + quoteString(strings.Join(l.Rel, " ")))
+	}
+	if l.Anchor != "" {
+		sb.WriteString("; anchor=" + quoteString(l.Anchor))
+	}
+	if l.Type != "" {
+		sb.WriteString("; type=" + quoteString(l.Type))
+	}
+	if l.Title != "" {
+		if isASCII(l.Title) {
+			sb.WriteString("; title=" + quoteString(l.Title))
+		} else {
+			sb.WriteString("; title*=" + encodeExtValue(l.Title, l.TitleLang))
+		}
+	}
+	for _, p := range l.Params {
+		sb.WriteString("; " + p.Name)
+		if p.Value != "" {
+			sb.WriteString("=" + tokenOrQuoted(p.Value))
+		}
+	}
+	return sb.String()
+}
+
+// FormatLinks renders the contents of a Link header for the given links.
+func FormatLinks(links ...Link) string {
+	ss := make([]string, len(links))
+	for i, l := range links {
+		ss[i] = l.String()
+	}
+	return strings.Join(ss, ", ")
+}
+
+// ParseLinkHeader parses the contents of an HTTP Link header. If a response
+// has multiple Link header lines, the caller should join them with commas
+// before parsing. An empty header yields no links without error.
+//
+// Per RFC 8288, only the first occurrence of the rel, anchor, type, title,
+// and title* parameters is used. The title* parameter is decoded per RFC 8187,
+// and takes precedence over title. Other parameters are retained in Params.
+func ParseLinkHeader(s string) ([]Link, error) {
+	var out []Link
+	rest := s
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			return out, nil
+		} else if rest[0] != '<' {
+			return nil, fmt.Errorf("link %d: missing '<'", len(out)+1)
+		}
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return nil, fmt.Errorf("link %d: missing '>'", len(out)+1)
+		}
+		link := Link{Target: strings.TrimSpace(rest[1:end])}
+		rest = rest[end+1:]
+
+		var hasTitleStar bool
+		seen := make(map[string]bool)
+		for {
+			rest = strings.TrimLeft(rest, " \t")
+			if rest == "" || rest[0] == ',' {
+				break
+			} else if rest[0] != ';' {
+				return nil, fmt.Errorf("link %d: unexpected %q after target", len(out)+1, rest[0])
+			}
+			i := paramEnd(rest[1:]) + 1
+			elt := strings.TrimSpace(rest[1:i])
+			rest = rest[i:]
+			if elt == "" {
+				continue // tolerate empty parameters
+			}
+			name, value, _, err := parseParam(elt)
+			if err != nil {
+				return nil, fmt.Errorf("link %d: %w", len(out)+1, err)
+			}
+			first := !seen[name]
+			seen[name] = true
+			switch name {
+			case "rel":
+				if first {
+					link.Rel = strings.Fields(value)
+				}
+			case "anchor":
+				if first {
+					link.Anchor = value
+				}
+			case "type":
+				if first {
+					link.Type = value
+				}
+			case "title":
+				if first && !hasTitleStar {
+					link.Title = value
+				}
+			case "title*":
+				if first {
+					text, lang, err := decodeExtValue(value)
+					if err != nil {
+						return nil, fmt.Errorf("link %d: invalid title*: %w", len(out)+1, err)
+					}
+					link.Title, link.TitleLang, hasTitleStar = text, lang, true
+				}
+			default:
+				link.Params = append(link.Params, LinkParam{Name: name, Value: value})
+			}
+		}
+		out = append(out, link)
+	}
+}
+
+// paramEnd returns the offset of the first ';' or ',' in s that is not
+// inside a quoted string, or len(s) if there is none.
+func paramEnd(s string) int {
+	var inQuote, escaped bool
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case inQuote && c == '\\':
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case (c == ';' || c == ',') && !inQuote:
+			return i
+		}
+	}
+	return len(s)
+}
+
+// PageLinks returns links for navigating a paginated collection served at u,
+// in which the current page starts at the given zero-based offset and holds
+// at most limit items. The links carry "offset" and "limit" query parameters,
+// replacing any already present in u; other query parameters are preserved.
+// Use [FormatLinks] to render the links into a Link header.
+//
+// The result includes links with relation types "first" and, if applicable,
+// "prev", "next", and "last". If total < 0, the size of the collection is
+// taken to be unknown: "last" is omitted and "next" is always included.
+// If limit ≤ 0, PageLinks returns nil.
+func PageLinks(u *url.URL, offset, limit, total int) []Link {
+	if limit <= 0 {
+		return nil
+	}
+	page := func(rel string, off int) Link {
+		v := *u
+		q := v.Query()
+		q.Set("offset", strconv.Itoa(off))
+		q.Set("limit", strconv.Itoa(limit))
+		v.RawQuery = q.Encode()
+		return Link{Target: v.String(), Rel: []string{rel}}
+	}
+	out := []Link{page("first", 0)}
+	if offset > 0 {
+		out = append(out, page("prev", max(offset-limit, 0)))
+	}
+	if total < 0 || offset+limit < total {
+		out = append(out, page("next", offset+limit))
+	}
+	if total >= 0 {
+		out = append(out, page("last", max(total-1, 0)/limit*limit))
+	}
+	return out
+}
+
+// Pages returns an iterator over the pages of a paginated resource, starting
+// with req. After each successful response, it follows the link with relation
+// type "next" from the response's Link header, if there is one, using a GET
+// request with the same context and headers as req. If a next link refers to
+// a different host than req, credentials (Authorization and Cookie headers)
+// are not sent to it. If cli == nil, [http.DefaultClient] is used.
+//
+// Each response is yielded with a nil error, and its body is closed when the
+// loop body returns, so the caller must not retain it. If a request fails,
+// the response has a non-2xx status, the Link header is invalid, or the next
+// link refers to a page already visited, the iterator yields a nil response
+// with an error and stops.
+func Pages(cli *http.Client, req *http.Request) iter.Seq2[*http.Response, error] {
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	return func(yield func(*http.Response, error) bool) {
+		seen := make(map[string]bool)
+		for cur := req; cur != nil; {
+			seen[cur.URL.String()] = true
+			rsp, err := cli.Do(cur)
+			if err != nil {
+				yield(nil, err)
+				return
+			} else if rsp.StatusCode/100 != 2 {
+				rsp.Body.Close()
+				yield(nil, fmt.Errorf("get %s: %s", cur.URL, rsp.Status))
+				return
+			}
+			next, err := nextPage(rsp)
+			if err != nil {
+				rsp.Body.Close()
+				yield(nil, err)
+				return
+			}
+			ok := yield(rsp, nil)
+			rsp.Body.Close()
+			if !ok || next == nil {
+				return
+			} else if seen[next.String()] {
+				yield(nil, fmt.Errorf("pagination loop at %s", next))
+				return
+			}
+
+			cur, err = http.NewRequestWithContext(req.Context(), http.MethodGet, next.String(), nil)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			cur.Header = req.Header.Clone()
+			if cur.URL.Host != req.URL.Host {
+				for _, name := range []string{"Authorization", "Cookie", "Cookie2"} {
+					cur.Header.Del(name)
+				}
+			}
+		}
+	}
+}
+
+// nextPage returns the resolved URL of the "next" link of rsp, or nil if
+// there is none.
+func nextPage(rsp *http.Response) (*url.URL, error) {
+	links, err := ParseLinkHeader(strings.Join(rsp.Header.Values("Link"), ","))
+	if err != nil {
+		return nil, fmt.Errorf("invalid link header: %w", err)
+	}
+	for _, l := range links {
+		if !l.HasRel("next") || l.Anchor != "" {
+			continue
+		}
+		ref, err := url.Parse(l.Target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next link: %w", err)
+		}
+		base := rsp.Request.URL
+		if base == nil {
+			return nil, errors.New("response has no request URL")
+		}
+		return base.ResolveReference(ref), nil
+	}
+	return nil, nil
+}
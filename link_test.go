@@ -0,0 +1,264 @@
+package mhttp_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []mhttp.Link
+	}{
+		{"", nil},
+		{" , ", nil},
+		{`<http://example.com/TheBook/chapter2>; rel="previous"; title="previous chapter"`, []mhttp.Link{{
+			Target: "http://example.com/TheBook/chapter2", Rel: []string{"previous"}, Title: "previous chapter",
+		}}},
+		{`</>; rel="http://example.net/foo"`, []mhttp.Link{{
+			Target: "/", Rel: []string{"http://example.net/foo"},
+		}}},
+		{`</terms>; rel="copyright"; anchor="#foo"`, []mhttp.Link{{
+			Target: "/terms", Rel: []string{"copyright"}, Anchor: "#foo",
+		}}},
+
+		// RFC 8288 Section 3.5 examples with title*.
+		{`</TheBook/chapter2>; rel="previous"; title*=UTF-8'de'letztes%20Kapitel, ` +
+			`</TheBook/chapter4>; rel="next"; title*=UTF-8'de'n%c3%a4chstes%20Kapitel`,
+			[]mhttp.Link{
+				{Target: "/TheBook/chapter2", Rel: []string{"previous"}, Title: "letztes Kapitel", TitleLang: "de"},
+				{Target: "/TheBook/chapter4", Rel: []string{"next"}, Title: "nächstes Kapitel", TitleLang: "de"},
+			}},
+		{`<http://example.org/>; rel="start http://example.net/relation/other"`, []mhttp.Link{{
+			Target: "http://example.org/", Rel: []string{"start", "http://example.net/relation/other"},
+		}}},
+
+		// Commas and semicolons inside the target and quoted strings.
+		{`<http://x/a,b;c>; rel=next; title="a, b; c", <http://x/d>; REL=last`, []mhttp.Link{
+			{Target: "http://x/a,b;c", Rel: []string{"next"}, Title: "a, b; c"},
+			{Target: "http://x/d", Rel: []string{"last"}},
+		}},
+
+		// Only the first rel is used; title* wins over title in either order.
+		{`<a>; rel=one; rel=two; title*=UTF-8''x; title=y`, []mhttp.Link{
+			{Target: "a", Rel: []string{"one"}, Title: "x"},
+		}},
+		{`<a>; title=y; title*=iso-8859-1'en'%A3`, []mhttp.Link{
+			{Target: "a", Title: "£", TitleLang: "en"},
+		}},
+
+		// Extension parameters are preserved in order, including repeats.
+		{`<a>; hreflang=en; hreflang=de; crossorigin; media="screen"`, []mhttp.Link{{
+			Target: "a", Params: []mhttp.LinkParam{
+				{Name: "hreflang", Value: "en"},
+				{Name: "hreflang", Value: "de"},
+				{Name: "crossorigin"},
+				{Name: "media", Value: "screen"},
+			},
+		}}},
+		{`<a>;; rel=x ;`, []mhttp.Link{{Target: "a", Rel: []string{"x"}}}},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseLinkHeader(tc.input)
+		if err != nil {
+			t.Errorf("ParseLinkHeader(%q): unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("ParseLinkHeader(%q) (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+
+	for _, bad := range []string{
+		"http://x/",             // missing brackets
+		"<http://x/",            // unterminated target
+		"<a> rel=x",             // missing semicolon
+		`<a>; rel="x`,           // unterminated quote
+		"<a>; =x",               // missing name
+		"<a>; title*=x",         // bad ext-value
+		"<a>; title*=UTF-8''%",  // truncated escape
+		"<a>; title*=KOI8-R''x", // unsupported charset
+	} {
+		if got, err := mhttp.ParseLinkHeader(bad); err == nil {
+			t.Errorf("ParseLinkHeader(%q): got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestFormatLinks(t *testing.T) {
+	links := []mhttp.Link{
+		{Target: "/p?page=2", Rel: []string{"next"}},
+		{Target: "/c4", Rel: []string{"next", "chapter"}, Title: "nächstes Kapitel", TitleLang: "de"},
+		{Target: "/x", Anchor: "#a", Type: "text/html", Title: `say "hi"`, Params: []mhttp.LinkParam{
+			{Name: "hreflang", Value: "en"},
+			{Name: "crossorigin"},
+			{Name: "media", Value: "screen, print"},
+		}},
+	}
+	got := mhttp.FormatLinks(links...)
+	const want = `</p?page=2>; rel="next", ` +
+		`</c4>; rel="next chapter"; title*=UTF-8'de'n%C3%A4chstes%20Kapitel, ` +
+		`</x>; anchor="#a"; type="text/html"; title="say \"hi\""; hreflang=en; crossorigin; media="screen, print"`
+	if got != want {
+		t.Errorf("FormatLinks:\ngot  %s\nwant %s", got, want)
+	}
+
+	// The formatted header round-trips.
+	back, err := mhttp.ParseLinkHeader(got)
+	if err != nil {
+		t.Fatalf("ParseLinkHeader: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(back, links); diff != "" {
+		t.Errorf("Round trip (-got, +want):\n%s", diff)
+	}
+
+	if !links[1].HasRel("Chapter") {
+		t.Error("HasRel(Chapter): got false, want true")
+	}
+	if links[1].HasRel("prev") {
+		t.Error("HasRel(prev): got true, want false")
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	u, err := url.Parse("https://api.example.com/items?sort=name&offset=7")
+	if err != nil {
+		t.Fatalf("Parse URL: %v", err)
+	}
+	const base = "https://api.example.com/items?"
+	tests := []struct {
+		offset, limit, total int
+		want                 string
+	}{
+		{0, 10, 25, `<` + base + `limit=10&offset=0&sort=name>; rel="first", ` +
+			`<` + base + `limit=10&offset=10&sort=name>; rel="next", ` +
+			`<` + base + `limit=10&offset=20&sort=name>; rel="last"`},
+		{15, 10, 25, `<` + base + `limit=10&offset=0&sort=name>; rel="first", ` +
+			`<` + base + `limit=10&offset=5&sort=name>; rel="prev", ` +
+			`<` + base + `limit=10&offset=20&sort=name>; rel="last"`},
+		{20, 10, 30, `<` + base + `limit=10&offset=0&sort=name>; rel="first", ` +
+			`<` + base + `limit=10&offset=10&sort=name>; rel="prev", ` +
+			`<` + base + `limit=10&offset=20&sort=name>; rel="last"`},
+		{0, 10, 0, `<` + base + `limit=10&offset=0&sort=name>; rel="first", ` +
+			`<` + base + `limit=10&offset=0&sort=name>; rel="last"`},
+		{5, 5, -1, `<` + base + `limit=5&offset=0&sort=name>; rel="first", ` +
+			`<` + base + `limit=5&offset=0&sort=name>; rel="prev", ` +
+			`<` + base + `limit=5&offset=10&sort=name>; rel="next"`},
+		{0, 0, 100, ""},
+	}
+	for _, tc := range tests {
+		got := mhttp.FormatLinks(mhttp.PageLinks(u, tc.offset, tc.limit, tc.total)...)
+		if got != tc.want {
+			t.Errorf("PageLinks(%d, %d, %d):\ngot  %s\nwant %s", tc.offset, tc.limit, tc.total, got, tc.want)
+		}
+	}
+	if got := u.String(); got != "https://api.example.com/items?sort=name&offset=7" {
+		t.Errorf("PageLinks modified its input: %s", got)
+	}
+}
+
+func TestPages(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e", "f", "g"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer x" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if limit <= 0 {
+			limit = 3
+		}
+		end := min(offset+limit, len(items))
+		var links []mhttp.Link
+		for _, l := range mhttp.PageLinks(r.URL, offset, limit, len(items)) {
+			// Send relative references, to check that they are resolved.
+			l.Target = strings.TrimPrefix(l.Target, "/items")
+			links = append(links, l)
+		}
+		w.Header().Set("Link", mhttp.FormatLinks(links...))
+		fmt.Fprint(w, strings.Join(items[offset:end], ""))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `<loop?n=1>; rel="next"`)
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `<missing>; rel="next"`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	collect := func(path string) ([]string, error) {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer x")
+		var pages []string
+		for rsp, err := range mhttp.Pages(srv.Client(), req) {
+			if err != nil {
+				return pages, err
+			}
+			body, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatalf("Read body: %v", err)
+			}
+			pages = append(pages, string(body))
+		}
+		return pages, nil
+	}
+
+	t.Run("Items", func(t *testing.T) {
+		got, err := collect("/items")
+		if err != nil {
+			t.Fatalf("Pages: unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(got, []string{"abc", "def", "g"}); diff != "" {
+			t.Errorf("Pages (-got, +want):\n%s", diff)
+		}
+	})
+	t.Run("Loop", func(t *testing.T) {
+		got, err := collect("/loop?n=1")
+		if err == nil || !strings.Contains(err.Error(), "loop") {
+			t.Errorf("Pages: got err=%v, want loop error", err)
+		}
+		if len(got) != 1 {
+			t.Errorf("Pages: got %d pages, want 1", len(got))
+		}
+	})
+	t.Run("Status", func(t *testing.T) {
+		got, err := collect("/fail")
+		if err == nil || !strings.Contains(err.Error(), "404") {
+			t.Errorf("Pages: got err=%v, want 404 error", err)
+		}
+		if len(got) != 1 {
+			t.Errorf("Pages: got %d pages, want 1", len(got))
+		}
+	})
+	t.Run("Break", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", srv.URL+"/items", nil)
+		req.Header.Set("Authorization", "Bearer x")
+		var n int
+		for _, err := range mhttp.Pages(srv.Client(), req) {
+			if err != nil {
+				t.Fatalf("Pages: unexpected error: %v", err)
+			}
+			n++
+			break
+		}
+		if n != 1 {
+			t.Errorf("Pages: got %d pages, want 1", n)
+		}
+	})
+}
@@ -26,6 +26,28 @@ func (r Range) ContentRange(totalSize int64) string {
 	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End-1, totalSize)
 }
 
+// A Mode selects how strictly header values are parsed.
+// The zero value is [Strict].
+type Mode int
+
+const (
+	// Strict accepts only values that a conforming sender would generate
+	// under RFC 9110, including optional whitespace around list delimiters.
+	Strict Mode = iota
+
+	// Lenient accepts everything Strict does, and in addition tolerates the
+	// following deviations, which are commonly sent by real clients:
+	//
+	//   - Range: a unit name in any case ("Bytes=0-5").
+	//   - Range: whitespace around "=" and "-" ("bytes = 0 - 5").
+	//   - Range and match: empty list elements ("bytes=0-5,,10-").
+	//   - Match: entity tags without quotation marks ("plum, cherry").
+	//   - Match: a lower-case weak prefix (`w/"plum"`).
+	//
+	// No other deviations are accepted.
+	Lenient
+)
+
 // ParseRangeHeader parses the contents of an HTTP [Range] header for a
 // resource of the specified total size in bytes. On success, the resulting
 // ranges are adjusted to absolute offsets within the resource.
@@ -35,14 +57,29 @@ func (r Range) ContentRange(totalSize int64) string {
 // If s == "", it returns empty without error, indicating the entire resource
 // is requested in a single range.
 //
+// ParseRangeHeader is equivalent to [Strict].ParseRangeHeader.
+//
 // [Range]: https://developer.mozilla.org/en-US/docs/Web/HTTP/Reference/Headers/Range
 func ParseRangeHeader(totalSize int64, s string) ([]Range, error) {
+	return Strict.ParseRangeHeader(totalSize, s)
+}
+
+// ParseRangeHeader parses the contents of an HTTP Range header for a resource
+// of the specified total size in bytes, according to the rules of m.
+// See [ParseRangeHeader] for a description of the result.
+func (m Mode) ParseRangeHeader(totalSize int64, s string) ([]Range, error) {
+	if m == Lenient {
+		s = strings.TrimSpace(s)
+	}
 	if s == "" {
 		return nil, nil // no ranges are requested
 	}
 
 	// Grammar: bytes=lo-hi bytes=lo- bytes=-hi bytes=lo1-hi1,lo2-hi2,...
 	kind, rest, ok := strings.Cut(s, "=")
+	if m == Lenient {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+	}
 	if !ok {
 		return nil, errors.New("invalid range syntax")
 	} else if kind != "bytes" {
@@ -51,17 +88,24 @@ func ParseRangeHeader(totalSize int64, s string) ([]Range, error) {
 
 	var out []Range
 	for rs := range strings.SplitSeq(rest, ",") {
-		lo, hi, ok := strings.Cut(strings.TrimSpace(rs), "-")
+		spec := strings.TrimSpace(rs)
+		if spec == "" && m == Lenient {
+			continue // tolerate empty list elements
+		}
+		lo, hi, ok := strings.Cut(spec, "-")
+		if m == Lenient {
+			lo, hi = strings.TrimSpace(lo), strings.TrimSpace(hi)
+		}
 		if !ok || lo == "" && hi == "" {
 			return nil, fmt.Errorf("invalid range format %q", rs)
 		}
 
-		vlo, err := strconv.ParseInt(lo, 10, 64)
-		if err != nil && lo != "" || vlo < 0 {
+		vlo, err := parsePos(lo)
+		if err != nil && lo != "" {
 			return nil, fmt.Errorf("invalid range start %q: %w", lo, err)
 		}
-		vhi, err := strconv.ParseInt(hi, 10, 64)
-		if err != nil && hi != "" || vhi < 0 {
+		vhi, err := parsePos(hi)
+		if err != nil && hi != "" {
 			return nil, fmt.Errorf("invalid range end %q: %w", hi, err)
 		}
 		// Reaching here, vlo and vhi are valid range endpoints if present, but
@@ -75,6 +119,8 @@ func ParseRangeHeader(totalSize int64, s string) ([]Range, error) {
 			out = append(out, Range{Start: totalSize - vhi, End: totalSize})
 		case hi == "": // lo- → lo..size
 			out = append(out, Range{Start: vlo, End: totalSize})
+		case vhi < vlo:
+			return nil, fmt.Errorf("invalid range %q: end before start", rs)
 		default:
 			out = append(out, Range{Start: vlo, End: min(vhi+1, totalSize)})
 			// +1 to make the range exclusive; min to cap at the actual size
@@ -83,9 +129,20 @@ func ParseRangeHeader(totalSize int64, s string) ([]Range, error) {
 			return nil, fmt.Errorf("range %d: start %d > size %d", len(out), st, totalSize)
 		}
 	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("invalid range format %q", rest)
+	}
 	return out, nil
 }
 
+// parsePos parses s as a non-negative decimal integer without a sign.
+func parsePos(s string) (int64, error) {
+	if strings.TrimLeft(s, "0123456789") != "" {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
 // Match is the parsed representation of an If-Match or If-None-Match header.
 type Match struct {
 	terms []term
@@ -181,8 +238,18 @@ func trimTag(s string) (_ string, isWeak bool) {
 // matches all resources. Use [Match.IsPresent] to check for this case.
 // Otherwise, see [Match.Matches] and [Match.MatchesWeak] for matching rules.
 // An error is only reported if the header is present but invalid.
-func ParseMatchHeader(s string) (Match, error) {
+//
+// ParseMatchHeader is equivalent to [Strict].ParseMatchHeader.
+func ParseMatchHeader(s string) (Match, error) { return Strict.ParseMatchHeader(s) }
+
+// ParseMatchHeader parses the contents of an HTTP If-Match or If-None-Match
+// header according to the rules of m.
+// See [ParseMatchHeader] for a description of the result.
+func (m Mode) ParseMatchHeader(s string) (Match, error) {
 	clean := strings.TrimSpace(s)
+	if m == Lenient {
+		clean = trimEmpty(clean)
+	}
 	if clean == "" {
 		return Match{}, nil // not present
 	} else if clean == "*" {
@@ -191,7 +258,13 @@ func ParseMatchHeader(s string) (Match, error) {
 	var terms []term
 	for clean != "" {
 		rest, isWeak := strings.CutPrefix(clean, "W/")
+		if !isWeak && m == Lenient {
+			rest, isWeak = strings.CutPrefix(clean, "w/")
+		}
 		q, rest, ok := cutQuoted(rest)
+		if !ok && m == Lenient {
+			q, rest, ok = cutUnquoted(rest)
+		}
 		if !ok {
 			return Match{}, fmt.Errorf("invalid match term in %q", rest)
 		}
@@ -199,7 +272,9 @@ func ParseMatchHeader(s string) (Match, error) {
 		clean, ok = strings.CutPrefix(strings.TrimSpace(rest), ",")
 		if !ok && clean != "" {
 			return Match{}, fmt.Errorf("extra text after term %q", clean)
-		} else if ok && clean == "" {
+		} else if m == Lenient {
+			clean = trimEmpty(clean)
+		} else if ok && strings.TrimSpace(clean) == "" {
 			return Match{}, fmt.Errorf("missing term after %q", q)
 		}
 		clean = strings.TrimSpace(clean)
@@ -207,6 +282,9 @@ func ParseMatchHeader(s string) (Match, error) {
 	return Match{terms: terms}, nil
 }
 
+// trimEmpty removes leading and trailing empty list elements from s.
+func trimEmpty(s string) string { return strings.Trim(s, ", \t") }
+
 func cutQuoted(s string) (quoted, rest string, _ bool) {
 	body, ok := strings.CutPrefix(s, `"`)
 	if !ok {
@@ -219,3 +297,123 @@ func cutQuoted(s string) (quoted, rest string, _ bool) {
 	}
 	return "", s, false
 }
+
+// cutUnquoted reports the longest prefix of s not containing a delimiter,
+// along with the remaining unconsumed suffix of s.
+func cutUnquoted(s string) (tag, rest string, _ bool) {
+	i := strings.IndexAny(s, ", \t\"")
+	if i < 0 {
+		i = len(s)
+	} else if s[i] == '"' {
+		return "", s, false
+	}
+	return s[:i], s[i:], i > 0
+}
+
+// splitList splits s into the elements of a comma-separated header list.
+// See [splitQuoted].
+func splitList(s string) []string { return splitQuoted(s, ',') }
+
+// splitQuoted splits s at each occurrence of sep that is not inside a quoted
+// string. Elements are trimmed of surrounding whitespace, and empty elements
+// are discarded.
+func splitQuoted(s string, sep byte) []string {
+	var out []string
+	var inQuote, escaped bool
+	push := func(e string) {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case inQuote && c == '\\':
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			push(s[start:i])
+			start = i + 1
+		}
+	}
+	push(s[start:])
+	return out
+}
+
+// parseParam parses s as a parameter of the form name[=value], where value
+// is a token or a quoted string. The name is normalized to lower case, and
+// the value is unquoted. It reports whether a value was present.
+func parseParam(s string) (name, value string, hasValue bool, err error) {
+	name, value, hasValue = strings.Cut(s, "=")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !isToken(name) {
+		return "", "", false, fmt.Errorf("invalid parameter name %q", name)
+	}
+	if !hasValue {
+		return name, "", false, nil
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) {
+		q, rest, ok := cutQuotedString(value)
+		if !ok || rest != "" {
+			return "", "", false, fmt.Errorf("invalid quoted value for %q", name)
+		}
+		return name, q, true, nil
+	} else if !isToken(value) {
+		return "", "", false, fmt.Errorf("invalid value for %q", name)
+	}
+	return name, value, true, nil
+}
+
+// cutQuotedString parses a quoted string with backslash escapes from the
+// front of s, and returns the unquoted contents along with the unconsumed
+// remainder of s.
+func cutQuotedString(s string) (quoted, rest string, _ bool) {
+	body, ok := strings.CutPrefix(s, `"`)
+	if !ok {
+		return "", s, false
+	}
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; c {
+		case '"':
+			return sb.String(), body[i+1:], true
+		case '\\':
+			if i+1 == len(body) {
+				return "", s, false
+			}
+			i++
+			sb.WriteByte(body[i])
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", s, false
+}
+
+// quoteString renders s as a quoted string, escaping quotation marks and
+// backslashes.
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// tokenOrQuoted renders s as a token if it is one, or otherwise as a quoted
+// string.
+func tokenOrQuoted(s string) string {
+	if isToken(s) {
+		return s
+	}
+	return quoteString(s)
+}
@@ -0,0 +1,322 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package objstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// A DirStore is a [Store] that keeps objects in files in a local directory.
+// The content of each object is stored in a file whose path below the "data"
+// subdirectory is its key, and its metadata in a file with the same path
+// below the "meta" subdirectory.
+//
+// Because keys map to file paths, a DirStore cannot hold both an object "a"
+// and an object "a/b" at the same time.
+type DirStore struct {
+	dir string
+
+	mu sync.Mutex // serializes changes to objects
+}
+
+// NewDirStore returns a [DirStore] that keeps objects in dir, creating the
+// directory if it does not exist.
+func NewDirStore(dir string) (*DirStore, error) {
+	for _, sub := range []string{"data", "meta", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// dirMeta is the encoded metadata of an object. The size and modification
+// time of an object are those of its data file, so they are not recorded.
+type dirMeta struct {
+	ETag        string `json:"etag"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+func (s *DirStore) dataPath(key string) string {
+	return filepath.Join(s.dir, "data", filepath.FromSlash(key))
+}
+
+func (s *DirStore) metaPath(key string) string {
+	return filepath.Join(s.dir, "meta", filepath.FromSlash(key))
+}
+
+// stat returns the metadata for key, or ErrNotFound. The caller must hold s.mu.
+func (s *DirStore) stat(key string) (Object, error) {
+	fi, err := os.Stat(s.dataPath(key))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) || err == nil && fi.IsDir() {
+		return Object{}, ErrNotFound
+	} else if err != nil {
+		return Object{}, err
+	}
+	bits, err := os.ReadFile(s.metaPath(key))
+	if err != nil {
+		return Object{}, err
+	}
+	var meta dirMeta
+	if err := json.Unmarshal(bits, &meta); err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:         key,
+		Size:        fi.Size(),
+		ETag:        meta.ETag,
+		ContentType: meta.ContentType,
+		ModTime:     fi.ModTime().UTC(),
+	}, nil
+}
+
+// Stat implements part of the [Store] interface.
+func (s *DirStore) Stat(ctx context.Context, key string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stat(key)
+}
+
+// Open implements part of the [Store] interface.
+func (s *DirStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	if err := checkKey(key); err != nil {
+		return nil, Object{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, err := s.stat(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	// Objects are replaced by renaming, so the open file is not affected by
+	// later changes.
+	f, err := os.Open(s.dataPath(key))
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return f, obj, nil
+}
+
+// Put implements part of the [Store] interface.
+func (s *DirStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+
+	// Stage the new content before taking the lock.
+	staged, err := s.tempFile()
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+	h := newHash()
+	var w io.Writer = staged
+	if !opts.Partial {
+		w = io.MultiWriter(staged, h)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return Object{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var curObj *Object
+	cur, err := s.stat(key)
+	if err == nil {
+		curObj = &cur
+	} else if !errors.Is(err, ErrNotFound) {
+		return Object{}, err
+	}
+	if err := opts.Check.check(curObj); err != nil {
+		return Object{}, err
+	}
+
+	ctype := opts.ContentType
+	if opts.Partial {
+		if opts.Offset < 0 || opts.Offset > cur.Size {
+			return Object{}, ErrInvalidOffset
+		}
+		if ctype == "" {
+			ctype = cur.ContentType
+		}
+		merged, err := s.merge(key, curObj != nil, staged, opts.Offset)
+		if err != nil {
+			return Object{}, err
+		}
+		defer os.Remove(merged.Name())
+		defer merged.Close()
+		if _, err := merged.Seek(0, io.SeekStart); err != nil {
+			return Object{}, err
+		}
+		if _, err := io.Copy(h, merged); err != nil {
+			return Object{}, err
+		}
+		staged = merged
+	}
+	if err := staged.Sync(); err != nil {
+		return Object{}, err
+	}
+
+	meta, err := json.Marshal(dirMeta{ETag: etagOf(h), ContentType: ctype})
+	if err != nil {
+		return Object{}, err
+	}
+	if err := s.commit(key, staged.Name(), meta); err != nil {
+		return Object{}, err
+	}
+	return s.stat(key)
+}
+
+// tempFile creates a new temporary file in the store.
+func (s *DirStore) tempFile() (*os.File, error) {
+	return os.CreateTemp(filepath.Join(s.dir, "tmp"), "put-*")
+}
+
+// merge returns a temporary file containing the current content of key, if
+// exists is true, overwritten at offset by the content of staged. The caller
+// must hold s.mu.
+func (s *DirStore) merge(key string, exists bool, staged *os.File, offset int64) (*os.File, error) {
+	out, err := s.tempFile()
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*os.File, error) {
+		out.Close()
+		os.Remove(out.Name())
+		return nil, err
+	}
+	if exists {
+		f, err := os.Open(s.dataPath(key))
+		if err != nil {
+			return fail(err)
+		}
+		_, err = io.Copy(out, f)
+		f.Close()
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	if _, err := io.Copy(out, staged); err != nil {
+		return fail(err)
+	}
+	return out, nil
+}
+
+// commit moves the file at tmp into place as the content of key, and
+// records its metadata. The caller must hold s.mu.
+func (s *DirStore) commit(key, tmp string, meta []byte) error {
+	dataPath, metaPath := s.dataPath(key), s.metaPath(key)
+	for _, p := range []string{dataPath, metaPath} {
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			return err
+		}
+	}
+	mf, err := s.tempFile()
+	if err != nil {
+		return err
+	}
+	metaTmp := mf.Name()
+	_, err = mf.Write(meta)
+	if err := errors.Join(err, mf.Close()); err != nil {
+		os.Remove(metaTmp)
+		return err
+	}
+	if err := os.Rename(tmp, dataPath); err != nil {
+		os.Remove(metaTmp)
+		return err
+	}
+	return os.Rename(metaTmp, metaPath)
+}
+
+// Delete implements part of the [Store] interface.
+func (s *DirStore) Delete(ctx context.Context, key string, check Check) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, err := s.stat(key)
+	if err != nil {
+		return err
+	}
+	if err := check.check(&cur); err != nil {
+		return err
+	}
+	if err := os.Remove(s.dataPath(key)); err != nil {
+		return err
+	}
+	if err := os.Remove(s.metaPath(key)); err != nil {
+		return err
+	}
+
+	// Remove directories left empty, so that their names can be reused as
+	// object keys.
+	for dir := path.Dir(key); dir != "."; dir = path.Dir(dir) {
+		if os.Remove(s.dataPath(dir)) != nil {
+			break
+		}
+		os.Remove(s.metaPath(dir))
+	}
+	return nil
+}
+
+// List implements part of the [Store] interface.
+func (s *DirStore) List(ctx context.Context, prefix string) iter.Seq2[Object, error] {
+	return func(yield func(Object, error) bool) {
+		s.mu.Lock()
+		var objs []Object
+		root := filepath.Join(s.dir, "data")
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(rel)
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+			obj, err := s.stat(key)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, obj)
+			return ctx.Err()
+		})
+		s.mu.Unlock()
+		if err != nil {
+			yield(Object{}, err)
+			return
+		}
+		slices.SortFunc(objs, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+		for _, obj := range objs {
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,480 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package objstore
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creachadair/mhttp"
+)
+
+// DefaultListLimit is the number of objects in a page of a listing, if the
+// request does not specify a limit.
+const DefaultListLimit = 1000
+
+// Handler is an [http.Handler] that serves the objects in a [Store].
+//
+// The key of an object is the path of the request without its leading slash;
+// use [http.StripPrefix] to serve the store below some other path. A GET or
+// HEAD request for a path that is empty or ends in "/" lists the objects
+// whose keys begin with that path, as a JSON object with the following form:
+//
+//	{"objects": [{"key": "a/b", "size": 5, "etag": "\"…\"", …}, …], "total": 12}
+//
+// The listing is paginated using the "offset" and "limit" query parameters,
+// and the response carries a Link header with links to the other pages.
+type Handler struct {
+	// Store holds the objects. It must not be nil.
+	Store Store
+
+	// MaxSize, if positive, is the maximum size of an object in bytes.
+	MaxSize int64
+}
+
+// listing is the encoded form of a listing response.
+type listing struct {
+	Objects []Object `json:"objects"`
+	Total   int      `json:"total"`
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if isPrefix(key) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			mhttp.NewProblem(http.StatusMethodNotAllowed, "").ServeHTTP(w, r)
+			return
+		}
+		h.list(w, r, key)
+		return
+	}
+	if checkKey(key) != nil {
+		mhttp.NewProblem(http.StatusBadRequest, "invalid object key").ServeHTTP(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, key)
+	case http.MethodPut:
+		h.put(w, r, key)
+	case http.MethodDelete:
+		h.delete(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		mhttp.NewProblem(http.StatusMethodNotAllowed, "").ServeHTTP(w, r)
+	}
+}
+
+// get serves a GET or HEAD request for the object with the given key.
+func (h Handler) get(w http.ResponseWriter, r *http.Request, key string) {
+	pre, err := parsePreconditions(r)
+	if err != nil {
+		mhttp.NewProblem(http.StatusBadRequest, err.Error()).ServeHTTP(w, r)
+		return
+	}
+	rc, obj, err := h.Store.Open(r.Context(), key)
+	if err != nil {
+		storeError(err).ServeHTTP(w, r)
+		return
+	}
+	defer rc.Close()
+
+	setHeaders(w.Header(), obj)
+	w.Header().Set("Accept-Ranges", "bytes")
+	switch pre.evaluate(r.Method, &obj) {
+	case http.StatusNotModified:
+		w.WriteHeader(http.StatusNotModified)
+		return
+	case http.StatusPreconditionFailed:
+		mhttp.NewProblem(http.StatusPreconditionFailed, "").ServeHTTP(w, r)
+		return
+	}
+
+	var ranges []mhttp.Range
+	if s := r.Header.Get("Range"); s != "" && ifRange(r.Header.Get("If-Range"), obj) {
+		// An invalid Range header is ignored (RFC 9110 Section 14.2).
+		if rs, ok := satisfiableRanges(obj.Size, s); ok {
+			if ranges = rs; len(ranges) == 0 {
+				mhttp.RangeNotSatisfiable(obj.Size, "no range overlaps the content").ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+	ctype := cmp.Or(obj.ContentType, "application/octet-stream")
+
+	switch len(ranges) {
+	case 0:
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			io.Copy(w, rc)
+		}
+
+	case 1:
+		rng := ranges[0]
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Range", rng.ContentRange(obj.Size))
+		w.Header().Set("Content-Length", strconv.FormatInt(rng.Size(), 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method != http.MethodHead {
+			copyRange(w, rc, rng)
+		}
+
+	default:
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method == http.MethodHead {
+			return
+		}
+		for _, rng := range ranges {
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {ctype},
+				"Content-Range": {rng.ContentRange(obj.Size)},
+			})
+			if err != nil || copyRange(part, rc, rng) != nil {
+				return
+			}
+		}
+		mw.Close()
+	}
+}
+
+// put serves a PUT request for the object with the given key.
+func (h Handler) put(w http.ResponseWriter, r *http.Request, key string) {
+	pre, err := parsePreconditions(r)
+	if err != nil {
+		mhttp.NewProblem(http.StatusBadRequest, err.Error()).ServeHTTP(w, r)
+		return
+	}
+	opts := PutOptions{ContentType: r.Header.Get("Content-Type")}
+	body := io.Reader(r.Body)
+	end := r.ContentLength
+	if s := r.Header.Get("Content-Range"); s != "" {
+		rng, err := parseContentRange(s)
+		if err != nil {
+			mhttp.NewProblem(http.StatusBadRequest, err.Error()).ServeHTTP(w, r)
+			return
+		} else if r.ContentLength >= 0 && r.ContentLength != rng.Size() {
+			mhttp.NewProblem(http.StatusBadRequest, fmt.Sprintf(
+				"content length %d does not match range size %d", r.ContentLength, rng.Size())).ServeHTTP(w, r)
+			return
+		}
+		opts.Partial, opts.Offset = true, rng.Start
+		body = &sizedReader{r: body, n: rng.Size()}
+		end = rng.End
+	}
+	if h.MaxSize > 0 {
+		if end > h.MaxSize {
+			mhttp.NewProblem(http.StatusRequestEntityTooLarge, "object is too large").ServeHTTP(w, r)
+			return
+		}
+		body = http.MaxBytesReader(w, io.NopCloser(body), h.MaxSize-opts.Offset)
+	}
+
+	var created bool
+	opts.Check = func(cur *Object) error {
+		created = cur == nil
+		if pre.evaluate(r.Method, cur) != 0 {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+	obj, err := h.Store.Put(r.Context(), key, body, opts)
+	if mbe := (*http.MaxBytesError)(nil); errors.As(err, &mbe) {
+		mhttp.NewProblem(http.StatusRequestEntityTooLarge, "object is too large").ServeHTTP(w, r)
+		return
+	} else if errors.Is(err, errRangeSize) {
+		mhttp.NewProblem(http.StatusBadRequest, err.Error()).ServeHTTP(w, r)
+		return
+	} else if err != nil {
+		storeError(err).ServeHTTP(w, r)
+		return
+	}
+	setHeaders(w.Header(), obj)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// errRangeSize is reported by a sizedReader whose input has the wrong size.
+var errRangeSize = errors.New("content size does not match the Content-Range")
+
+// sizedReader reads exactly n bytes from r. It reports errRangeSize instead
+// of io.EOF if r has fewer or more than n bytes, so that a store does not
+// commit a partial write of the wrong size.
+type sizedReader struct {
+	r io.Reader
+	n int64 // bytes remaining
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if s.n <= 0 {
+		var b [1]byte
+		if k, _ := io.ReadFull(s.r, b[:]); k != 0 {
+			return 0, errRangeSize
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.n {
+		p = p[:s.n]
+	}
+	k, err := s.r.Read(p)
+	s.n -= int64(k)
+	if err == io.EOF {
+		if s.n > 0 {
+			return k, errRangeSize
+		}
+		err = nil
+	}
+	return k, err
+}
+
+// delete serves a DELETE request for the object with the given key.
+func (h Handler) delete(w http.ResponseWriter, r *http.Request, key string) {
+	pre, err := parsePreconditions(r)
+	if err != nil {
+		mhttp.NewProblem(http.StatusBadRequest, err.Error()).ServeHTTP(w, r)
+		return
+	}
+	if err := h.Store.Delete(r.Context(), key, func(cur *Object) error {
+		if pre.evaluate(r.Method, cur) != 0 {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}); err != nil {
+		storeError(err).ServeHTTP(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list serves a listing of the objects whose keys begin with prefix.
+func (h Handler) list(w http.ResponseWriter, r *http.Request, prefix string) {
+	q := r.URL.Query()
+	offset, limit := 0, DefaultListLimit
+	if s := q.Get("offset"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			mhttp.NewProblem(http.StatusBadRequest, "invalid offset").ServeHTTP(w, r)
+			return
+		}
+		offset = v
+	}
+	if s := q.Get("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			mhttp.NewProblem(http.StatusBadRequest, "invalid limit").ServeHTTP(w, r)
+			return
+		}
+		limit = v
+	}
+
+	out := listing{Objects: []Object{}}
+	for obj, err := range h.Store.List(r.Context(), prefix) {
+		if err != nil {
+			storeError(err).ServeHTTP(w, r)
+			return
+		}
+		if out.Total >= offset && len(out.Objects) < limit {
+			out.Objects = append(out.Objects, obj)
+		}
+		out.Total++
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		mhttp.NewProblem(http.StatusInternalServerError, err.Error()).ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Link", mhttp.FormatLinks(mhttp.PageLinks(r.URL, offset, limit, out.Total)...))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// preconditions are the conditional request headers of a request.
+type preconditions struct {
+	ifMatch, ifNoneMatch               mhttp.Match
+	ifUnmodifiedSince, ifModifiedSince mhttp.Since
+}
+
+func parsePreconditions(r *http.Request) (preconditions, error) {
+	var p preconditions
+	var err error
+	if p.ifMatch, err = mhttp.ParseMatchHeader(r.Header.Get("If-Match")); err != nil {
+		return p, fmt.Errorf("invalid If-Match: %w", err)
+	}
+	if p.ifNoneMatch, err = mhttp.ParseMatchHeader(r.Header.Get("If-None-Match")); err != nil {
+		return p, fmt.Errorf("invalid If-None-Match: %w", err)
+	}
+	// Invalid dates are ignored, per RFC 9110 Section 13.1.3 and 13.1.4.
+	p.ifUnmodifiedSince, _ = mhttp.ParseSinceHeader(r.Header.Get("If-Unmodified-Since"))
+	p.ifModifiedSince, _ = mhttp.ParseSinceHeader(r.Header.Get("If-Modified-Since"))
+	return p, nil
+}
+
+// evaluate evaluates the preconditions p for a request with the given method
+// on the object cur, which is nil if the object does not exist, following
+// RFC 9110 Section 13.2.2. It returns 0 if the request should proceed, or
+// the status with which it should fail.
+func (p preconditions) evaluate(method string, cur *Object) int {
+	etag := ""
+	if cur != nil {
+		etag = cur.ETag
+	}
+	if p.ifMatch.IsPresent() {
+		if !p.ifMatch.Matches(etag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if p.ifUnmodifiedSince.IsPresent() && cur != nil {
+		if !p.ifUnmodifiedSince.UnmodifiedSince(cur.ModTime) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	isRead := method == http.MethodGet || method == http.MethodHead
+	if p.ifNoneMatch.IsPresent() {
+		if p.ifNoneMatch.MatchesWeak(etag) {
+			if isRead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if isRead && p.ifModifiedSince.IsPresent() && cur != nil {
+		if !p.ifModifiedSince.ModifiedSince(cur.ModTime) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// ifRange reports whether a range request with the given If-Range header
+// should be honored for obj.
+func ifRange(s string, obj Object) bool {
+	if s == "" {
+		return true
+	}
+	if t, err := mhttp.ParseHTTPDate(s); err == nil {
+		// A date is only usable if the modification time is a strong
+		// validator, which we approximate by the current time.
+		return t.Equal(obj.ModTime.Truncate(time.Second)) && mhttp.IsStrongLastModified(obj.ModTime, time.Now())
+	}
+	m, err := mhttp.ParseMatchHeader(s)
+	return err == nil && !m.IsGlob() && m.Matches(obj.ETag)
+}
+
+// satisfiableRanges returns the ranges of a Range header s that overlap
+// content of the given size, and reports whether s is valid. Ranges that do
+// not overlap the content are dropped, and a suffix range longer than the
+// content covers all of it (RFC 9110 Section 14.1.2).
+func satisfiableRanges(size int64, s string) ([]mhttp.Range, bool) {
+	if _, err := mhttp.ParseRangeHeader(math.MaxInt64, s); err != nil {
+		return nil, false // no range can be out of bounds, so s is invalid
+	}
+	_, specs, _ := strings.Cut(s, "=")
+	var out []mhttp.Range
+	for spec := range strings.SplitSeq(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		rs, err := mhttp.ParseRangeHeader(size, "bytes="+spec)
+		if err != nil && strings.HasPrefix(spec, "-") {
+			rs = []mhttp.Range{{Start: 0, End: size}}
+		}
+		out = append(out, nonEmpty(rs)...)
+	}
+	return out, true
+}
+
+// nonEmpty returns the non-empty ranges of rs.
+func nonEmpty(rs []mhttp.Range) []mhttp.Range {
+	var out []mhttp.Range
+	for _, r := range rs {
+		if r.Size() > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// copyRange copies the content of rng from r to w.
+func copyRange(w io.Writer, r io.ReadSeeker, rng mhttp.Range) error {
+	if _, err := r.Seek(rng.Start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, r, rng.Size())
+	return err
+}
+
+// parseContentRange parses the value of a Content-Range header in a request,
+// of the form "bytes first-last/complete" or "bytes first-last/*". The
+// complete length, if given, must be consistent with the range but is
+// otherwise ignored.
+func parseContentRange(s string) (mhttp.Range, error) {
+	spec, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return mhttp.Range{}, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	span, complete, ok := strings.Cut(spec, "/")
+	first, last, ok2 := strings.Cut(span, "-")
+	if !ok || !ok2 {
+		return mhttp.Range{}, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	lo, err1 := parseUint(first)
+	hi, err2 := parseUint(last)
+	if err1 != nil || err2 != nil || hi < lo {
+		return mhttp.Range{}, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	if complete != "*" {
+		n, err := parseUint(complete)
+		if err != nil || n <= hi {
+			return mhttp.Range{}, fmt.Errorf("invalid Content-Range %q", s)
+		}
+	}
+	return mhttp.Range{Start: lo, End: hi + 1}, nil
+}
+
+// parseUint parses s as a non-negative decimal integer without a sign.
+func parseUint(s string) (int64, error) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// setHeaders sets the validator headers for obj in h.
+func setHeaders(h http.Header, obj Object) {
+	h.Set("ETag", obj.ETag)
+	h.Set("Last-Modified", mhttp.FormatHTTPDate(obj.ModTime))
+}
+
+// storeError returns a problem describing an error reported by a Store.
+func storeError(err error) *mhttp.Problem {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return mhttp.NewProblem(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidKey):
+		return mhttp.NewProblem(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrPreconditionFailed):
+		return mhttp.NewProblem(http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, ErrInvalidOffset):
+		return mhttp.NewProblem(http.StatusRequestedRangeNotSatisfiable, err.Error())
+	default:
+		return mhttp.NewProblem(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A MemStore is a [Store] that keeps objects in memory.
+type MemStore struct {
+	mu   sync.Mutex
+	objs map[string]*memObject
+}
+
+// memObject is a stored object. Its data are never modified in place, so a
+// reader may retain them after the object is replaced.
+type memObject struct {
+	obj  Object
+	data []byte
+}
+
+// NewMemStore returns a new empty [MemStore].
+func NewMemStore() *MemStore { return &MemStore{objs: make(map[string]*memObject)} }
+
+// Stat implements part of the [Store] interface.
+func (s *MemStore) Stat(ctx context.Context, key string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.objs[key]; ok {
+		return m.obj, nil
+	}
+	return Object{}, ErrNotFound
+}
+
+// Open implements part of the [Store] interface.
+func (s *MemStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	if err := checkKey(key); err != nil {
+		return nil, Object{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.objs[key]
+	if !ok {
+		return nil, Object{}, ErrNotFound
+	}
+	return nopCloser{bytes.NewReader(m.data)}, m.obj, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+// Put implements part of the [Store] interface.
+func (s *MemStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Object{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.objs[key]
+	var curObj *Object
+	if cur != nil {
+		obj := cur.obj
+		curObj = &obj
+	}
+	if err := opts.Check.check(curObj); err != nil {
+		return Object{}, err
+	}
+	ctype := opts.ContentType
+	if opts.Partial {
+		var old []byte
+		if cur != nil {
+			old = cur.data
+			if ctype == "" {
+				ctype = cur.obj.ContentType
+			}
+		}
+		if opts.Offset < 0 || opts.Offset > int64(len(old)) {
+			return Object{}, ErrInvalidOffset
+		}
+		// Copy, so that readers of the old content are not disturbed.
+		buf := make([]byte, max(int64(len(old)), opts.Offset+int64(len(data))))
+		copy(buf, old)
+		copy(buf[opts.Offset:], data)
+		data = buf
+	}
+
+	h := newHash()
+	h.Write(data)
+	m := &memObject{
+		obj: Object{
+			Key:         key,
+			Size:        int64(len(data)),
+			ETag:        etagOf(h),
+			ContentType: ctype,
+			ModTime:     time.Now().UTC(),
+		},
+		data: data,
+	}
+	s.objs[key] = m
+	return m.obj, nil
+}
+
+// Delete implements part of the [Store] interface.
+func (s *MemStore) Delete(ctx context.Context, key string, check Check) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.objs[key]
+	if !ok {
+		return ErrNotFound
+	}
+	obj := m.obj
+	if err := check.check(&obj); err != nil {
+		return err
+	}
+	delete(s.objs, key)
+	return nil
+}
+
+// List implements part of the [Store] interface.
+func (s *MemStore) List(ctx context.Context, prefix string) iter.Seq2[Object, error] {
+	return func(yield func(Object, error) bool) {
+		s.mu.Lock()
+		var objs []Object
+		for key, m := range s.objs {
+			if strings.HasPrefix(key, prefix) {
+				objs = append(objs, m.obj)
+			}
+		}
+		s.mu.Unlock()
+		slices.SortFunc(objs, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+		for _, obj := range objs {
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+// Package objstore implements a simple writable object store over HTTP,
+// suitable as a local stand-in for a blob storage service in tests.
+//
+// A [Handler] serves the objects in a [Store], named by the paths of
+// requests. It supports GET and HEAD with byte ranges, PUT to create or
+// replace an object, PUT with a Content-Range header to write part of an
+// object, and DELETE. Writes and deletions honor If-Match and If-None-Match
+// preconditions, so that a client can create an object only if it does not
+// already exist (If-None-Match: *) or replace it only if it has not changed
+// since it was read (If-Match). A GET for a path ending in "/" lists the
+// objects whose names begin with that path.
+//
+// Each object has a strong entity tag derived from a hash of its content.
+// [NewMemStore] returns a Store that keeps objects in memory, and
+// [NewDirStore] returns a Store that keeps them in files in a local
+// directory.
+package objstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"iter"
+	"strings"
+	"time"
+)
+
+// An Object describes a stored object.
+type Object struct {
+	Key         string    `json:"key"`                   // the name of the object
+	Size        int64     `json:"size"`                  // the size of the content in bytes
+	ETag        string    `json:"etag"`                  // the quoted strong entity tag
+	ContentType string    `json:"contentType,omitempty"` // the media type of the content
+	ModTime     time.Time `json:"modTime"`               // when the content was last written
+}
+
+// Errors reported by a [Store].
+var (
+	// ErrNotFound indicates that the requested object does not exist.
+	ErrNotFound = errors.New("object not found")
+
+	// ErrInvalidKey indicates that a key is not a valid object name.
+	ErrInvalidKey = errors.New("invalid object key")
+
+	// ErrInvalidOffset indicates a partial write that does not start
+	// within or at the end of the existing content.
+	ErrInvalidOffset = errors.New("write offset is beyond the end of the object")
+
+	// ErrPreconditionFailed is reported by a [Check] whose precondition
+	// does not hold.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// A Check is a precondition for a change to an object. A [Store] calls it
+// with the current state of the object, or nil if the object does not exist,
+// atomically with the change, and does not make the change if it reports an
+// error.
+type Check func(cur *Object) error
+
+// PutOptions are options for [Store.Put].
+type PutOptions struct {
+	// ContentType is the media type of the content. For a partial write to
+	// an existing object, if it is empty, the existing type is kept.
+	ContentType string
+
+	// Partial, if true, writes the content at Offset in the existing
+	// content of the object, rather than replacing it. The object grows if
+	// the content extends beyond its end. Offset must not exceed the size of
+	// the object, or 0 if the object does not exist.
+	Partial bool
+	Offset  int64
+
+	// Check, if non-nil, is the precondition for the write.
+	Check Check
+}
+
+// A Store stores objects. Implementations must be safe for concurrent use.
+//
+// A key is a slash-separated path satisfying [fs.ValidPath], other than ".".
+// A store reports ErrInvalidKey for other keys.
+type Store interface {
+	// Stat returns the metadata for the specified object, or ErrNotFound.
+	Stat(ctx context.Context, key string) (Object, error)
+
+	// Open returns a reader for the content of the specified object, along
+	// with its metadata, or ErrNotFound. The reader sees the content as of
+	// the call to Open, even if the object is later changed.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error)
+
+	// Put writes the content of r to the specified object, as described by
+	// opts, and returns the new metadata of the object. If opts.Check
+	// reports an error, Put returns that error. If reading r fails, Put
+	// reports the error and the object is not changed.
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (Object, error)
+
+	// Delete deletes the specified object, or reports ErrNotFound. If check
+	// is non-nil and reports an error, Delete returns that error.
+	Delete(ctx context.Context, key string, check Check) error
+
+	// List returns an iterator over the objects whose keys begin with
+	// prefix, in lexicographic order of key.
+	List(ctx context.Context, prefix string) iter.Seq2[Object, error]
+}
+
+// checkKey reports ErrInvalidKey if key is not a valid object key.
+func checkKey(key string) error {
+	if key == "." || !fs.ValidPath(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// isPrefix reports whether key is a listing prefix rather than an object key.
+func isPrefix(key string) bool { return key == "" || strings.HasSuffix(key, "/") }
+
+// newHash returns a hash for computing the entity tag of content.
+func newHash() hash.Hash { return sha256.New() }
+
+// etagOf returns the entity tag for content with the hash state h.
+func etagOf(h hash.Hash) string {
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// check calls c with cur, if c is non-nil.
+func (c Check) check(cur *Object) error {
+	if c == nil {
+		return nil
+	}
+	return c(cur)
+}
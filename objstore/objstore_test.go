@@ -0,0 +1,355 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package objstore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/creachadair/mhttp"
+	"github.com/creachadair/mhttp/objstore"
+	"github.com/google/go-cmp/cmp"
+)
+
+// forEachStore runs f as a subtest with each Store implementation.
+func forEachStore(t *testing.T, f func(t *testing.T, s objstore.Store)) {
+	t.Run("Mem", func(t *testing.T) { f(t, objstore.NewMemStore()) })
+	t.Run("Dir", func(t *testing.T) {
+		s, err := objstore.NewDirStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewDirStore: unexpected error: %v", err)
+		}
+		f(t, s)
+	})
+}
+
+type client struct {
+	t   *testing.T
+	url string
+}
+
+// do sends a request and returns the response with its body.
+func (c client) do(method, path, body string, hdr ...string) (*http.Response, string) {
+	c.t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.url+path, r)
+	if err != nil {
+		c.t.Fatalf("NewRequest: %v", err)
+	}
+	for i := 0; i+1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: unexpected error: %v", method, path, err)
+	}
+	defer rsp.Body.Close()
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: read body: %v", method, path, err)
+	}
+	return rsp, string(data)
+}
+
+// want sends a request and checks that it has the given status.
+func (c client) want(status int, method, path, body string, hdr ...string) (*http.Response, string) {
+	c.t.Helper()
+	rsp, data := c.do(method, path, body, hdr...)
+	if rsp.StatusCode != status {
+		c.t.Fatalf("%s %s: got status %d, want %d\n%s", method, path, rsp.StatusCode, status, data)
+	}
+	return rsp, data
+}
+
+func newClient(t *testing.T, h objstore.Handler) client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return client{t: t, url: srv.URL}
+}
+
+func TestHandler(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s objstore.Store) {
+		c := newClient(t, objstore.Handler{Store: s})
+
+		c.want(http.StatusNotFound, "GET", "/a/b", "")
+
+		// Create an object, only if it does not already exist.
+		rsp, _ := c.want(http.StatusCreated, "PUT", "/a/b", "hello, world",
+			"Content-Type", "text/plain", "If-None-Match", "*")
+		etag := rsp.Header.Get("ETag")
+		if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 3 {
+			t.Fatalf("PUT: got ETag %q, want a strong tag", etag)
+		}
+		c.want(http.StatusPreconditionFailed, "PUT", "/a/b", "other", "If-None-Match", "*")
+
+		rsp, body := c.want(http.StatusOK, "GET", "/a/b", "")
+		if body != "hello, world" {
+			t.Errorf("GET: got %q, want %q", body, "hello, world")
+		}
+		if got := rsp.Header.Get("ETag"); got != etag {
+			t.Errorf("GET: got ETag %q, want %q", got, etag)
+		}
+		if got := rsp.Header.Get("Content-Type"); got != "text/plain" {
+			t.Errorf("GET: got Content-Type %q, want text/plain", got)
+		}
+		c.want(http.StatusNotModified, "GET", "/a/b", "", "If-None-Match", etag)
+		c.want(http.StatusPreconditionFailed, "GET", "/a/b", "", "If-Match", `"other"`)
+
+		// The same content has the same tag.
+		rsp, _ = c.want(http.StatusCreated, "PUT", "/c", "hello, world")
+		if got := rsp.Header.Get("ETag"); got != etag {
+			t.Errorf("PUT same content: got ETag %q, want %q", got, etag)
+		}
+
+		// Replace an object only if it has not changed.
+		c.want(http.StatusPreconditionFailed, "PUT", "/a/b", "goodbye", "If-Match", `"other"`)
+		rsp, _ = c.want(http.StatusNoContent, "PUT", "/a/b", "goodbye, world", "If-Match", etag)
+		newTag := rsp.Header.Get("ETag")
+		if newTag == etag {
+			t.Errorf("PUT: ETag %q did not change", newTag)
+		}
+		c.want(http.StatusPreconditionFailed, "PUT", "/nonesuch", "x", "If-Match", "*")
+
+		// Partial writes overwrite and extend the content.
+		c.want(http.StatusNoContent, "PUT", "/a/b", "GOOD", "Content-Range", "bytes 0-3/*")
+		c.want(http.StatusNoContent, "PUT", "/a/b", "!!", "Content-Range", "bytes 14-15/16")
+		_, body = c.want(http.StatusOK, "GET", "/a/b", "")
+		if want := "GOODbye, world!!"; body != want {
+			t.Errorf("GET after partial writes: got %q, want %q", body, want)
+		}
+		c.want(http.StatusRequestedRangeNotSatisfiable, "PUT", "/a/b", "x", "Content-Range", "bytes 20-20/*")
+		c.want(http.StatusBadRequest, "PUT", "/a/b", "xyz", "Content-Range", "bytes 0-1/*")
+		c.want(http.StatusBadRequest, "PUT", "/a/b", "xy", "Content-Range", "bytes 0-1/1")
+		c.want(http.StatusCreated, "PUT", "/d", "new", "Content-Range", "bytes 0-2/*")
+
+		// A chunked body must match the size of its range.
+		for _, body := range []string{"ab", "abcdef"} {
+			req, _ := http.NewRequest("PUT", c.url+"/a/b", io.NopCloser(strings.NewReader(body)))
+			req.Header.Set("Content-Range", "bytes 0-3/*")
+			rsp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("PUT chunked: unexpected error: %v", err)
+			}
+			rsp.Body.Close()
+			if rsp.StatusCode != http.StatusBadRequest {
+				t.Errorf("PUT chunked %q: got status %d, want %d", body, rsp.StatusCode, http.StatusBadRequest)
+			}
+		}
+		if _, body = c.want(http.StatusOK, "GET", "/a/b", ""); body != "GOODbye, world!!" {
+			t.Errorf("GET after bad partial writes: got %q, want it unchanged", body)
+		}
+
+		// Delete with preconditions.
+		c.want(http.StatusPreconditionFailed, "DELETE", "/c", "", "If-Match", newTag)
+		c.want(http.StatusNoContent, "DELETE", "/c", "", "If-Match", etag)
+		c.want(http.StatusNotFound, "DELETE", "/c", "")
+		c.want(http.StatusNotFound, "HEAD", "/c", "")
+
+		c.want(http.StatusMethodNotAllowed, "POST", "/a/b", "x")
+		c.want(http.StatusMethodNotAllowed, "PUT", "/a/", "x")
+		c.want(http.StatusBadRequest, "PUT", "/a//b", "x")
+	})
+}
+
+func TestRanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s objstore.Store) {
+		c := newClient(t, objstore.Handler{Store: s})
+		rsp, _ := c.want(http.StatusCreated, "PUT", "/obj", "0123456789", "Content-Type", "text/plain")
+		etag := rsp.Header.Get("ETag")
+
+		rsp, body := c.want(http.StatusPartialContent, "GET", "/obj", "", "Range", "bytes=2-4")
+		if body != "234" {
+			t.Errorf("Range: got %q, want %q", body, "234")
+		}
+		if got, want := rsp.Header.Get("Content-Range"), "bytes 2-4/10"; got != want {
+			t.Errorf("Content-Range: got %q, want %q", got, want)
+		}
+		_, body = c.want(http.StatusPartialContent, "GET", "/obj", "", "Range", "bytes=-3", "If-Range", etag)
+		if body != "789" {
+			t.Errorf("Suffix range: got %q, want %q", body, "789")
+		}
+		_, body = c.want(http.StatusOK, "GET", "/obj", "", "Range", "bytes=-3", "If-Range", `"stale"`)
+		if body != "0123456789" {
+			t.Errorf("Stale If-Range: got %q, want the whole content", body)
+		}
+
+		rsp, _ = c.want(http.StatusRequestedRangeNotSatisfiable, "GET", "/obj", "", "Range", "bytes=20-")
+		if got, want := rsp.Header.Get("Content-Range"), "bytes */10"; got != want {
+			t.Errorf("Unsatisfiable Content-Range: got %q, want %q", got, want)
+		}
+
+		// An invalid Range header is ignored.
+		for _, rng := range []string{"bytes=abc", "items=0-1", "bytes=5-2", "bytes=0-1,"} {
+			if _, body := c.want(http.StatusOK, "GET", "/obj", "", "Range", rng); body != "0123456789" {
+				t.Errorf("Range %q: got %q, want the whole content", rng, body)
+			}
+		}
+
+		// Unsatisfiable ranges are dropped, and a long suffix covers the
+		// whole content.
+		if _, body = c.want(http.StatusPartialContent, "GET", "/obj", "", "Range", "bytes=20-,0-1"); body != "01" {
+			t.Errorf("Range with unsatisfiable part: got %q, want %q", body, "01")
+		}
+		rsp, body = c.want(http.StatusPartialContent, "GET", "/obj", "", "Range", "bytes=-20")
+		if got, want := rsp.Header.Get("Content-Range"), "bytes 0-9/10"; got != want || body != "0123456789" {
+			t.Errorf("Long suffix: got %q %q, want %q and the whole content", got, body, want)
+		}
+
+		rsp, body = c.want(http.StatusPartialContent, "GET", "/obj", "", "Range", "bytes=0-1,8-")
+		mt, params, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+		if err != nil || mt != "multipart/byteranges" {
+			t.Fatalf("Multiple ranges: got type %q, %v", mt, err)
+		}
+		type part struct{ Range, Body string }
+		var got []part
+		mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("NextPart: %v", err)
+			}
+			data, _ := io.ReadAll(p)
+			got = append(got, part{p.Header.Get("Content-Range"), string(data)})
+		}
+		if diff := cmp.Diff(got, []part{{"bytes 0-1/10", "01"}, {"bytes 8-9/10", "89"}}); diff != "" {
+			t.Errorf("Parts (-got, +want):\n%s", diff)
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s objstore.Store) {
+		c := newClient(t, objstore.Handler{Store: s})
+		for _, key := range []string{"x/2", "x/1", "x/3/a", "x-y", "z"} {
+			c.want(http.StatusCreated, "PUT", "/"+key, key)
+		}
+
+		list := func(path string) ([]string, int, []mhttp.Link) {
+			t.Helper()
+			rsp, body := c.want(http.StatusOK, "GET", path, "")
+			var out struct {
+				Objects []objstore.Object `json:"objects"`
+				Total   int               `json:"total"`
+			}
+			if err := json.Unmarshal([]byte(body), &out); err != nil {
+				t.Fatalf("Decode listing: %v", err)
+			}
+			var keys []string
+			for _, obj := range out.Objects {
+				keys = append(keys, obj.Key)
+				if obj.Size != int64(len(obj.Key)) {
+					t.Errorf("Object %q: got size %d, want %d", obj.Key, obj.Size, len(obj.Key))
+				}
+			}
+			links, err := mhttp.ParseLinkHeader(rsp.Header.Get("Link"))
+			if err != nil {
+				t.Fatalf("Parse Link: %v", err)
+			}
+			return keys, out.Total, links
+		}
+
+		keys, total, _ := list("/")
+		if diff := cmp.Diff(keys, []string{"x-y", "x/1", "x/2", "x/3/a", "z"}); diff != "" || total != 5 {
+			t.Errorf("List all (-got, +want):\n%s\ntotal=%d", diff, total)
+		}
+		keys, total, links := list("/x/?limit=2")
+		if diff := cmp.Diff(keys, []string{"x/1", "x/2"}); diff != "" || total != 3 {
+			t.Errorf("List x/ (-got, +want):\n%s\ntotal=%d", diff, total)
+		}
+		var next string
+		for _, l := range links {
+			if l.HasRel("next") {
+				next = l.Target
+			}
+		}
+		if next == "" {
+			t.Fatalf("List x/: no next link in %v", links)
+		}
+		keys, _, _ = list(next)
+		if diff := cmp.Diff(keys, []string{"x/3/a"}); diff != "" {
+			t.Errorf("List next (-got, +want):\n%s", diff)
+		}
+
+		// Deleting the last object under a directory frees its name.
+		c.want(http.StatusNoContent, "DELETE", "/x/3/a", "")
+		c.want(http.StatusCreated, "PUT", "/x/3", "now a file")
+		c.want(http.StatusBadRequest, "GET", "/?limit=0", "")
+	})
+}
+
+func TestMaxSize(t *testing.T) {
+	c := newClient(t, objstore.Handler{Store: objstore.NewMemStore(), MaxSize: 5})
+	c.want(http.StatusCreated, "PUT", "/a", "12345")
+	c.want(http.StatusRequestEntityTooLarge, "PUT", "/a", "123456")
+	c.want(http.StatusRequestEntityTooLarge, "PUT", "/a", "x", "Content-Range", "bytes 5-5/*")
+	_, body := c.want(http.StatusOK, "GET", "/a", "")
+	if body != "12345" {
+		t.Errorf("GET: got %q, want %q", body, "12345")
+	}
+}
+
+func TestStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s objstore.Store) {
+		ctx := t.Context()
+		obj, err := s.Put(ctx, "k", strings.NewReader("old"), objstore.PutOptions{ContentType: "text/plain"})
+		if err != nil {
+			t.Fatalf("Put: unexpected error: %v", err)
+		}
+
+		// A reader sees the content as of when it was opened.
+		rc, got, err := s.Open(ctx, "k")
+		if err != nil {
+			t.Fatalf("Open: unexpected error: %v", err)
+		}
+		defer rc.Close()
+		if diff := cmp.Diff(got, obj); diff != "" {
+			t.Errorf("Open (-got, +want):\n%s", diff)
+		}
+		if _, err := s.Put(ctx, "k", strings.NewReader("new content"), objstore.PutOptions{}); err != nil {
+			t.Fatalf("Put: unexpected error: %v", err)
+		}
+		if data, _ := io.ReadAll(rc); string(data) != "old" {
+			t.Errorf("Read: got %q, want %q", data, "old")
+		}
+
+		// A failed read leaves the object unchanged.
+		before, _ := s.Stat(ctx, "k")
+		if _, err := s.Put(ctx, "k", iotest.ErrReader(errors.New("bad")), objstore.PutOptions{}); err == nil {
+			t.Error("Put with failing reader: got nil, want error")
+		}
+		if after, _ := s.Stat(ctx, "k"); after != before {
+			t.Errorf("Stat after failed Put: got %+v, want %+v", after, before)
+		}
+
+		// A failed check prevents the change.
+		fail := func(*objstore.Object) error { return objstore.ErrPreconditionFailed }
+		if _, err := s.Put(ctx, "k", strings.NewReader("x"), objstore.PutOptions{Check: fail}); !errors.Is(err, objstore.ErrPreconditionFailed) {
+			t.Errorf("Put with failing check: got %v, want %v", err, objstore.ErrPreconditionFailed)
+		}
+		if err := s.Delete(ctx, "k", fail); !errors.Is(err, objstore.ErrPreconditionFailed) {
+			t.Errorf("Delete with failing check: got %v, want %v", err, objstore.ErrPreconditionFailed)
+		}
+		if _, err := s.Put(ctx, "new", strings.NewReader("x"), objstore.PutOptions{Partial: true, Offset: 1}); !errors.Is(err, objstore.ErrInvalidOffset) {
+			t.Errorf("Put at offset 1 of new object: got %v, want %v", err, objstore.ErrInvalidOffset)
+		}
+
+		for _, key := range []string{"", ".", "/a", "a/../b", "a/"} {
+			if _, err := s.Stat(ctx, key); !errors.Is(err, objstore.ErrInvalidKey) {
+				t.Errorf("Stat %q: got %v, want %v", key, err, objstore.ErrInvalidKey)
+			}
+		}
+	})
+}
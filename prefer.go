@@ -0,0 +1,488 @@
+package mhttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefer is the parsed representation of an HTTP [Prefer] header.
+//
+// [Prefer]: https://www.rfc-editor.org/rfc/rfc7240
+type Prefer struct {
+	prefs []Preference // nil if not present
+}
+
+// A Preference is a single preference from a Prefer header.
+type Preference struct {
+	// Name is the name of the preference, normalized to lower case.
+	Name string
+
+	// Value is the value of the preference, or "" if it has none.
+	Value string
+
+	// Params are the parameters of the preference, keyed by lower-case name.
+	Params map[string]string
+}
+
+// ParsePreferHeader parses the contents of an HTTP Prefer header. If a request
+// has multiple Prefer header lines, the caller should join them with commas
+// before parsing. If the header is empty it returns a Prefer with no
+// preferences; use [Prefer.IsPresent] to check for this case.
+//
+// Per RFC 7240, if a preference is given more than once, only the first
+// instance is used, and an empty value is equivalent to no value.
+func ParsePreferHeader(s string) (Prefer, error) {
+	var out Prefer
+	seen := make(map[string]bool)
+	for i, elt := range splitList(s) {
+		parts := splitQuoted(elt, ';')
+		name, value, _, err := parseParam(parts[0])
+		if err != nil {
+			return Prefer{}, fmt.Errorf("preference %d: %w", i+1, err)
+		}
+		p := Preference{Name: name, Value: value}
+		for _, pp := range parts[1:] {
+			pn, pv, _, err := parseParam(pp)
+			if err != nil {
+				return Prefer{}, fmt.Errorf("preference %q: %w", name, err)
+			}
+			if p.Params == nil {
+				p.Params = make(map[string]string)
+			}
+			if _, ok := p.Params[pn]; !ok {
+				p.Params[pn] = pv
+			}
+		}
+		if !seen[name] {
+			seen[name] = true
+			out.prefs = append(out.prefs, p)
+		}
+	}
+	return out, nil
+}
+
+// IsPresent reports whether p has any preferences.
+func (p Prefer) IsPresent() bool { return len(p.prefs) != 0 }
+
+// Preferences returns the preferences of p in the order given.
+func (p Prefer) Preferences() []Preference { return p.prefs }
+
+// Get returns the preference with the given name, if present.
+// Names are compared without regard to case.
+func (p Prefer) Get(name string) (Preference, bool) {
+	for _, pref := range p.prefs {
+		if strings.EqualFold(pref.Name, name) {
+			return pref, true
+		}
+	}
+	return Preference{}, false
+}
+
+// Return reports the value of the return preference, normalized to lower
+// case: "minimal", "representation", or "" if the preference is absent or
+// has another value.
+func (p Prefer) Return() string {
+	pref, _ := p.Get("return")
+	switch v := strings.ToLower(pref.Value); v {
+	case "minimal", "representation":
+		return v
+	}
+	return ""
+}
+
+// RespondAsync reports whether p has the respond-async preference.
+func (p Prefer) RespondAsync() bool {
+	_, ok := p.Get("respond-async")
+	return ok
+}
+
+// Wait reports the duration of the wait preference, if it is present and
+// valid.
+func (p Prefer) Wait() (time.Duration, bool) {
+	pref, ok := p.Get("wait")
+	if !ok {
+		return 0, false
+	}
+	secs, err := strconv.ParseUint(pref.Value, 10, 31)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// Handling reports the value of the handling preference, normalized to lower
+// case: "strict", "lenient", or "" if the preference is absent or has another
+// value.
+func (p Prefer) Handling() string {
+	pref, _ := p.Get("handling")
+	switch v := strings.ToLower(pref.Value); v {
+	case "strict", "lenient":
+		return v
+	}
+	return ""
+}
+
+// preferState records the preferences of a request handled by a
+// [PreferHandler], and those the handler has applied.
+type preferState struct {
+	prefer Prefer
+
+	mu      sync.Mutex
+	applied []Preference
+}
+
+type preferKey struct{}
+
+func preferStateOf(r *http.Request) *preferState {
+	st, _ := r.Context().Value(preferKey{}).(*preferState)
+	return st
+}
+
+// header returns the contents of a Preference-Applied header for the applied
+// preferences, or "" if there are none.
+func (st *preferState) header() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ss := make([]string, len(st.applied))
+	for i, p := range st.applied {
+		ss[i] = p.Name
+		if p.Value != "" {
+			ss[i] += "=" + tokenOrQuoted(p.Value)
+		}
+	}
+	return strings.Join(ss, ", ")
+}
+
+// RequestPrefer returns the preferences of r. If r is being handled by a
+// [PreferHandler], it returns the preferences parsed by the handler;
+// otherwise it parses the Prefer header of r. An invalid header is treated
+// as absent, as RFC 7240 permits.
+func RequestPrefer(r *http.Request) Prefer {
+	if st := preferStateOf(r); st != nil {
+		return st.prefer
+	}
+	p, _ := ParsePreferHeader(strings.Join(r.Header.Values("Prefer"), ","))
+	return p
+}
+
+// ApplyPreference records that the handler of r has honored the specified
+// preference, so that a [PreferHandler] will report it in the
+// Preference-Applied header of the response. Applying a preference again
+// replaces its value. It has no effect if r is not being handled by a
+// PreferHandler, or if the response header has already been written.
+func ApplyPreference(r *http.Request, name, value string) {
+	st := preferStateOf(r)
+	if st == nil {
+		return
+	}
+	name = strings.ToLower(name)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, p := range st.applied {
+		if p.Name == name {
+			st.applied[i].Value = value
+			return
+		}
+	}
+	st.applied = append(st.applied, Preference{Name: name, Value: value})
+}
+
+// A PreferHandler is an [http.Handler] that parses the Prefer header of each
+// request for an underlying handler, which can read the preferences with
+// [RequestPrefer] and record those it honors with [ApplyPreference].
+//
+// The applied preferences are reported in the Preference-Applied header of
+// the response. Since the response may depend on the preferences, all
+// responses get "Prefer" in their Vary header.
+type PreferHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (p PreferHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefer, _ := ParsePreferHeader(strings.Join(r.Header.Values("Prefer"), ","))
+	st := &preferState{prefer: prefer}
+	r = r.WithContext(context.WithValue(r.Context(), preferKey{}, st))
+	pw := &preferWriter{ResponseWriter: w, st: st}
+	p.Handler.ServeHTTP(pw, r)
+	if !pw.wrote {
+		pw.WriteHeader(http.StatusOK)
+	}
+}
+
+// preferWriter is an [http.ResponseWriter] that adds the Preference-Applied
+// and Vary headers to a response when its header is written.
+type preferWriter struct {
+	http.ResponseWriter
+	st    *preferState
+	wrote bool
+}
+
+// Unwrap supports [http.ResponseController].
+func (pw *preferWriter) Unwrap() http.ResponseWriter { return pw.ResponseWriter }
+
+// WriteHeader implements part of [http.ResponseWriter].
+func (pw *preferWriter) WriteHeader(code int) {
+	if !pw.wrote && code >= 200 {
+		pw.wrote = true
+		h := pw.Header()
+		addVary(h, "Prefer")
+		if applied := pw.st.header(); applied != "" {
+			h.Set("Preference-Applied", applied)
+		}
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements part of [http.ResponseWriter].
+func (pw *preferWriter) Write(data []byte) (int, error) {
+	if !pw.wrote {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(data)
+}
+
+// Flush implements the [http.Flusher] interface.
+func (pw *preferWriter) Flush() { pw.FlushError() }
+
+// FlushError flushes buffered data to the client, and supports
+// [http.ResponseController].
+func (pw *preferWriter) FlushError() error {
+	if !pw.wrote {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return http.NewResponseController(pw.ResponseWriter).Flush()
+}
+
+// DefaultAsyncWait is the default time an [AsyncHandler] waits for a request
+// to complete before responding asynchronously.
+const DefaultAsyncWait = time.Second
+
+// An AsyncHandler is an [http.Handler] that supports the respond-async
+// preference (RFC 7240 Section 4.1).
+//
+// When a request has the respond-async preference, the AsyncHandler runs the
+// underlying handler and waits for it to complete, for the time given by the
+// wait preference or, if there is none, for the Wait duration. If the handler
+// completes in time, its response is sent as usual. Otherwise, the
+// AsyncHandler calls Begin and responds with 202 Accepted, with a Location
+// header giving the status monitor URL returned by Begin, and the
+// respond-async preference applied. The underlying handler keeps running,
+// with a context that is not canceled when the client goes away, and its
+// response is delivered to the done function returned by Begin when it
+// finishes.
+//
+// Because the underlying handler may outlive the request, it is given a copy
+// of the request whose body has been read into memory in advance. If the
+// underlying handler panics, its response is replaced by a 500 Problem, and
+// the panic is logged unless its value is [http.ErrAbortHandler].
+//
+// A request without the respond-async preference is passed directly to the
+// underlying handler. If an AsyncHandler is not already wrapped by a
+// [PreferHandler], it wraps itself in one.
+type AsyncHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+
+	// Begin is called when an operation does not complete within the wait.
+	// It returns the URL of a resource that reports the status of the
+	// operation, and a function to which its eventual response will be
+	// delivered. If Begin is nil, requests are always handled synchronously.
+	Begin func(r *http.Request) (location string, done func(*http.Response))
+
+	// Wait is the time to wait for a request that does not have a wait
+	// preference. If zero, DefaultAsyncWait is used. A wait preference
+	// longer than Wait is reduced to Wait.
+	Wait time.Duration
+
+	// MaxBodySize, if positive, is the maximum size of the body of a request
+	// with the respond-async preference. A request with a larger body gets
+	// status 413 (Content Too Large).
+	MaxBodySize int64
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (a AsyncHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if preferStateOf(r) == nil {
+		PreferHandler{Handler: a}.ServeHTTP(w, r)
+		return
+	}
+	prefer := RequestPrefer(r)
+	if !prefer.RespondAsync() || a.Begin == nil {
+		a.Handler.ServeHTTP(w, r)
+		return
+	}
+	wait := a.Wait
+	if wait <= 0 {
+		wait = DefaultAsyncWait
+	}
+	if d, ok := prefer.Wait(); ok {
+		wait = min(wait, d)
+	}
+
+	// The server closes the request body when ServeHTTP returns, so read it
+	// now in case the handler outlives the request.
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		rc := r.Body
+		if a.MaxBodySize > 0 {
+			rc = http.MaxBytesReader(w, rc, a.MaxBodySize)
+		}
+		var err error
+		body, err = io.ReadAll(rc)
+		if mbe := (*http.MaxBytesError)(nil); errors.As(err, &mbe) {
+			NewProblem(http.StatusRequestEntityTooLarge, "request body is too large").ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			NewProblem(http.StatusBadRequest, "reading request body: "+err.Error()).ServeHTTP(w, r)
+			return
+		}
+	}
+
+	// Run the handler with its own preference state, so that the preferences
+	// it applies are recorded in its own response.
+	st := &preferState{prefer: prefer}
+	ctx := context.WithValue(context.WithoutCancel(r.Context()), preferKey{}, st)
+	hr := r.Clone(ctx)
+	if body != nil {
+		hr.Body = io.NopCloser(bytes.NewReader(body))
+		hr.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+	ar := &asyncRecorder{header: make(http.Header), finished: make(chan struct{})}
+	go func() {
+		pw := &preferWriter{ResponseWriter: ar, st: st}
+		defer func() {
+			// The handler does not run under the server's recovery, so a panic
+			// here would end the program rather than the request.
+			if v := recover(); v != nil {
+				if v != http.ErrAbortHandler {
+					logf(hr, "mhttp: panic serving %s: %v\n%s", hr.URL, v, debug.Stack())
+				}
+				ar.reset()
+				NewProblem(http.StatusInternalServerError, "").ServeHTTP(ar, hr)
+			} else if !pw.wrote {
+				pw.WriteHeader(http.StatusOK)
+			}
+			ar.finish()
+		}()
+		a.Handler.ServeHTTP(pw, hr)
+	}()
+
+	tm := time.NewTimer(wait)
+	defer tm.Stop()
+	select {
+	case <-ar.finished:
+	case <-tm.C:
+	}
+	ar.mu.Lock()
+	if ar.done {
+		ar.mu.Unlock()
+		ar.copyTo(w)
+		return
+	}
+	loc, done := a.Begin(r)
+	ar.detached = done
+	ar.mu.Unlock()
+
+	ApplyPreference(r, "respond-async", "")
+	w.Header().Set("Location", loc)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// asyncRecorder is an [http.ResponseWriter] that records a response in
+// memory, for an AsyncHandler.
+type asyncRecorder struct {
+	header   http.Header
+	finished chan struct{}
+
+	mu       sync.Mutex
+	code     int
+	body     bytes.Buffer
+	done     bool                 // the handler has returned
+	detached func(*http.Response) // if set, deliver the response here
+}
+
+func (ar *asyncRecorder) Header() http.Header { return ar.header }
+
+func (ar *asyncRecorder) WriteHeader(code int) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.code == 0 && code >= 200 {
+		ar.code = code
+	}
+}
+
+func (ar *asyncRecorder) Write(data []byte) (int, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.code == 0 {
+		ar.code = http.StatusOK
+	}
+	return ar.body.Write(data)
+}
+
+// reset discards the response recorded so far.
+func (ar *asyncRecorder) reset() {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	clear(ar.header)
+	ar.code = 0
+	ar.body.Reset()
+}
+
+// finish marks the recorded response as complete, and delivers it if the
+// request was answered asynchronously.
+func (ar *asyncRecorder) finish() {
+	ar.mu.Lock()
+	ar.done = true
+	if ar.code == 0 {
+		ar.code = http.StatusOK
+	}
+	deliver := ar.detached
+	ar.mu.Unlock()
+	close(ar.finished)
+
+	if deliver != nil {
+		deliver(&http.Response{
+			Status:        strconv.Itoa(ar.code) + " " + http.StatusText(ar.code),
+			StatusCode:    ar.code,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        ar.header,
+			Body:          io.NopCloser(&ar.body),
+			ContentLength: int64(ar.body.Len()),
+		})
+	}
+}
+
+// copyTo writes the recorded response to w.
+func (ar *asyncRecorder) copyTo(w http.ResponseWriter) {
+	h := w.Header()
+	for name, vs := range ar.header {
+		h[name] = vs
+	}
+	w.WriteHeader(ar.code)
+	w.Write(ar.body.Bytes())
+}
+
+// logf logs a message to the error log of the server handling r, or to the
+// standard logger if the server does not have one.
+func logf(r *http.Request, format string, args ...any) {
+	if s, ok := r.Context().Value(http.ServerContextKey).(*http.Server); ok && s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
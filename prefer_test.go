@@ -0,0 +1,311 @@
+package mhttp_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePreferHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []mhttp.Preference
+	}{
+		{"", nil},
+		{"respond-async, wait=100", []mhttp.Preference{
+			{Name: "respond-async"}, {Name: "wait", Value: "100"},
+		}},
+		{`return=minimal; foo="some parameter"`, []mhttp.Preference{
+			{Name: "return", Value: "minimal", Params: map[string]string{"foo": "some parameter"}},
+		}},
+		{`Handling=Lenient, handling=strict, return="", priority=5;; a; A=b`, []mhttp.Preference{
+			{Name: "handling", Value: "Lenient"},
+			{Name: "return"},
+			{Name: "priority", Value: "5", Params: map[string]string{"a": ""}},
+		}},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParsePreferHeader(tc.input)
+		if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got.Preferences(), tc.want); diff != "" {
+			t.Errorf("Parse %q (-got, +want):\n%s", tc.input, diff)
+		}
+		if got.IsPresent() != (len(tc.want) != 0) {
+			t.Errorf("Parse %q: IsPresent is %v", tc.input, got.IsPresent())
+		}
+	}
+	for _, bad := range []string{"wait=1 2", `return="x`, "a=b; c d", "=x"} {
+		if got, err := mhttp.ParsePreferHeader(bad); err == nil {
+			t.Errorf("Parse %q: got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestPreferAccessors(t *testing.T) {
+	tests := []struct {
+		input    string
+		ret      string
+		async    bool
+		wait     time.Duration
+		hasWait  bool
+		handling string
+	}{
+		{"", "", false, 0, false, ""},
+		{"return=MINIMAL, handling=strict", "minimal", false, 0, false, "strict"},
+		{"return=representation, respond-async, wait=10", "representation", true, 10 * time.Second, true, ""},
+		{"return=other, wait=-1, handling=sloppy", "", false, 0, false, ""},
+	}
+	for _, tc := range tests {
+		p, err := mhttp.ParsePreferHeader(tc.input)
+		if err != nil {
+			t.Fatalf("Parse %q: %v", tc.input, err)
+		}
+		wait, hasWait := p.Wait()
+		if p.Return() != tc.ret || p.RespondAsync() != tc.async ||
+			wait != tc.wait || hasWait != tc.hasWait || p.Handling() != tc.handling {
+			t.Errorf("Parse %q: got (%q, %v, %v, %v, %q), want (%q, %v, %v, %v, %q)", tc.input,
+				p.Return(), p.RespondAsync(), wait, hasWait, p.Handling(),
+				tc.ret, tc.async, tc.wait, tc.hasWait, tc.handling)
+		}
+	}
+}
+
+func TestPreferHandler(t *testing.T) {
+	h := mhttp.PreferHandler{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := mhttp.RequestPrefer(r)
+		if p.Return() == "minimal" {
+			mhttp.ApplyPreference(r, "Return", "minimal")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if p.Handling() == "lenient" {
+			mhttp.ApplyPreference(r, "handling", "strict")
+			mhttp.ApplyPreference(r, "handling", "lenient")
+		}
+		w.Header().Set("Vary", "Accept")
+		io.WriteString(w, "full representation")
+	})}
+
+	tests := []struct {
+		prefer  string
+		code    int
+		applied string
+		vary    []string
+	}{
+		{"", 200, "", []string{"Accept", "Prefer"}},
+		{"return=minimal", 204, "return=minimal", []string{"Prefer"}},
+		{"handling=lenient, return=representation", 200, "handling=lenient", []string{"Accept", "Prefer"}},
+		{"bogus=a b", 200, "", []string{"Accept", "Prefer"}},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.prefer != "" {
+			req.Header.Set("Prefer", tc.prefer)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("Prefer %q: got status %d, want %d", tc.prefer, rec.Code, tc.code)
+		}
+		if got := rec.Header().Get("Preference-Applied"); got != tc.applied {
+			t.Errorf("Prefer %q: got Preference-Applied %q, want %q", tc.prefer, got, tc.applied)
+		}
+		if diff := cmp.Diff(rec.Header().Values("Vary"), tc.vary); diff != "" {
+			t.Errorf("Prefer %q: Vary (-got, +want):\n%s", tc.prefer, diff)
+		}
+	}
+
+	// Without the middleware, RequestPrefer parses the header directly and
+	// ApplyPreference does nothing.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Prefer", "return=minimal")
+	if got := mhttp.RequestPrefer(req).Return(); got != "minimal" {
+		t.Errorf("RequestPrefer: got %q, want minimal", got)
+	}
+	mhttp.ApplyPreference(req, "return", "minimal")
+}
+
+func TestAsyncHandler(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan *http.Response, 1)
+	h := mhttp.AsyncHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				<-release
+				if r.Context().Err() != nil {
+					t.Error("Handler context was canceled")
+				}
+			}
+			mhttp.ApplyPreference(r, "return", "representation")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, "done "+r.URL.Path)
+		}),
+		Begin: func(r *http.Request) (string, func(*http.Response)) {
+			return "/status/1", func(rsp *http.Response) { delivered <- rsp }
+		},
+		Wait: 5 * time.Second,
+	}
+
+	t.Run("Sync", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/fast", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated || rec.Body.String() != "done /fast" {
+			t.Errorf("Got %d %q, want 201 %q", rec.Code, rec.Body, "done /fast")
+		}
+		if got := rec.Header().Get("Preference-Applied"); got != "return=representation" {
+			t.Errorf("Got Preference-Applied %q, want return=representation", got)
+		}
+	})
+
+	t.Run("FastAsync", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/fast", nil)
+		req.Header.Set("Prefer", "respond-async, wait=5")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated || rec.Body.String() != "done /fast" {
+			t.Errorf("Got %d %q, want 201 %q", rec.Code, rec.Body, "done /fast")
+		}
+		if got := rec.Header().Get("Preference-Applied"); got != "return=representation" {
+			t.Errorf("Got Preference-Applied %q, want return=representation", got)
+		}
+	})
+
+	t.Run("SlowAsync", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/slow", nil)
+		req.Header.Set("Prefer", "respond-async, wait=0")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Got status %d, want 202", rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != "/status/1" {
+			t.Errorf("Got Location %q, want /status/1", got)
+		}
+		if got := rec.Header().Get("Preference-Applied"); got != "respond-async" {
+			t.Errorf("Got Preference-Applied %q, want respond-async", got)
+		}
+		if got := rec.Header().Get("Vary"); got != "Prefer" {
+			t.Errorf("Got Vary %q, want Prefer", got)
+		}
+
+		close(release)
+		rsp := <-delivered
+		body, _ := io.ReadAll(rsp.Body)
+		if rsp.StatusCode != http.StatusCreated || string(body) != "done /slow" {
+			t.Errorf("Delivered %d %q, want 201 %q", rsp.StatusCode, body, "done /slow")
+		}
+		if got := rsp.Header.Get("Preference-Applied"); got != "return=representation" {
+			t.Errorf("Delivered Preference-Applied %q, want return=representation", got)
+		}
+	})
+}
+
+func TestAsyncHandlerBody(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan *http.Response, 1)
+	srv := httptest.NewServer(mhttp.AsyncHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release // read the body only after the 202 has been sent
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(body)
+		}),
+		Begin: func(r *http.Request) (string, func(*http.Response)) {
+			return "/status/1", func(rsp *http.Response) { delivered <- rsp }
+		},
+		MaxBodySize: 16,
+	})
+	defer srv.Close()
+
+	post := func(body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", srv.URL+"/", strings.NewReader(body))
+		req.Header.Set("Prefer", "respond-async, wait=0")
+		rsp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		rsp.Body.Close()
+		return rsp
+	}
+
+	if rsp := post("too large for the limit"); rsp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Large body: got status %d, want 413", rsp.StatusCode)
+	}
+	if rsp := post("payload"); rsp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Got status %d, want 202", rsp.StatusCode)
+	}
+	close(release)
+	rsp := <-delivered
+	body, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("Delivered %d %q, want 200 %q", rsp.StatusCode, body, "payload")
+	}
+}
+
+func TestAsyncHandlerPanic(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan *http.Response, 1)
+	h := mhttp.AsyncHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Partial", "yes")
+			if r.URL.Path == "/slow" {
+				<-release
+				panic(http.ErrAbortHandler)
+			}
+			panic("boom")
+		}),
+		Begin: func(r *http.Request) (string, func(*http.Response)) {
+			return "/status/1", func(rsp *http.Response) { delivered <- rsp }
+		},
+		Wait: 5 * time.Second,
+	}
+
+	var logBuf bytes.Buffer
+	srv := &http.Server{ErrorLog: log.New(&logBuf, "", 0)}
+	req := httptest.NewRequest("POST", "/fast", nil)
+	req = req.WithContext(context.WithValue(req.Context(), http.ServerContextKey, srv))
+	req.Header.Set("Prefer", "respond-async")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("X-Partial") != "" {
+		t.Errorf("Got %d %v, want 500 without the partial header", rec.Code, rec.Header())
+	}
+	if !strings.Contains(logBuf.String(), "panic serving /fast: boom") {
+		t.Errorf("Log: got %q, want the panic", logBuf.String())
+	}
+
+	logBuf.Reset()
+	req = httptest.NewRequest("POST", "/slow", nil)
+	req = req.WithContext(context.WithValue(req.Context(), http.ServerContextKey, srv))
+	req.Header.Set("Prefer", "respond-async, wait=0")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Got status %d, want 202", rec.Code)
+	}
+	close(release)
+	rsp := <-delivered
+	if rsp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Delivered status %d, want 500", rsp.StatusCode)
+	}
+	if logBuf.Len() != 0 {
+		t.Errorf("Log: got %q, want empty for ErrAbortHandler", logBuf.String())
+	}
+}
@@ -0,0 +1,333 @@
+package mhttp
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Media types for problem details documents (RFC 9457).
+const (
+	ProblemJSON = "application/problem+json"
+	ProblemXML  = "application/problem+xml"
+)
+
+// problemXMLNS is the XML namespace of a problem details document.
+const problemXMLNS = "urn:ietf:rfc:7807"
+
+// A Problem is a problem details object as defined by [RFC 9457], which
+// describes an error in an HTTP response. A *Problem is an [http.Handler]
+// that writes it as a response, and an error, so that clients can recover it
+// with [errors.As] from the result of [ResponseError].
+//
+// A Problem is encoded as JSON with the standard members first, followed by
+// the extensions. When encoded as XML, extension values that are slices are
+// written as lists of <i> elements, and maps as nested elements, following
+// RFC 9457 Appendix B.
+//
+// [RFC 9457]: https://www.rfc-editor.org/rfc/rfc9457
+type Problem struct {
+	// Type is a URI reference identifying the problem type. If empty, the
+	// problem type is "about:blank", meaning the problem has no semantics
+	// beyond those of its status code.
+	Type string
+
+	// Title is a short human-readable summary of the problem type.
+	Title string
+
+	// Status is the HTTP status code of the response. When serving a problem
+	// with status 0, status 500 is used.
+	Status int
+
+	// Detail is a human-readable explanation of this occurrence of the problem.
+	Detail string
+
+	// Instance is a URI reference identifying this occurrence of the problem.
+	Instance string
+
+	// Extensions are additional members of the problem object. Keys that
+	// conflict with the standard members are ignored when encoding.
+	Extensions map[string]any
+
+	// Header, if non-nil, are additional header fields to send when serving
+	// the problem, for example Retry-After. They are not part of the problem
+	// object, and are not encoded.
+	Header http.Header
+}
+
+// NewProblem returns a problem of type "about:blank" with the specified status
+// code and detail, and a title taken from the status code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// RangeNotSatisfiable returns a problem with status 416 (Range Not
+// Satisfiable) for a resource with the given total size, as may be reported
+// when [ParseRangeHeader] fails. It includes a Content-Range header giving
+// the size, as required by RFC 9110 Section 15.5.17.
+func RangeNotSatisfiable(totalSize int64, detail string) *Problem {
+	p := NewProblem(http.StatusRequestedRangeNotSatisfiable, detail)
+	p.Header = http.Header{"Content-Range": {"bytes */" + strconv.FormatInt(totalSize, 10)}}
+	return p
+}
+
+// Error implements the error interface. The result is the title of p, or the
+// text of its status code if it has no title, followed by the detail.
+func (p *Problem) Error() string {
+	msg := p.Title
+	if msg == "" {
+		msg = http.StatusText(p.Status)
+	}
+	if msg == "" {
+		msg = "status " + strconv.Itoa(p.Status)
+	}
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	return msg
+}
+
+// ServeHTTP implements the [http.Handler] interface. It writes p as the
+// response, encoded as JSON or XML according to the Accept header of r. If
+// the client accepts neither, JSON is used, since an error response should
+// not itself fail with status 406 (Not Acceptable).
+func (p *Problem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctype := ProblemJSON
+	if acc, err := ParseAcceptHeader(strings.Join(r.Header.Values("Accept"), ",")); err == nil {
+		if pick, ok := acc.Negotiate(ProblemJSON, ProblemXML, "application/json", "application/xml"); ok {
+			if strings.HasSuffix(pick, "xml") {
+				ctype = ProblemXML
+			}
+		}
+	}
+	var data []byte
+	var err error
+	if ctype == ProblemXML {
+		data, err = xml.Marshal(p)
+		data = append([]byte(xml.Header), data...)
+	} else {
+		data, err = json.Marshal(p)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	for name, vals := range p.Header {
+		h[name] = vals
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Type", ctype)
+	h.Set("X-Content-Type-Options", "nosniff")
+	addVary(h, "Accept")
+	w.WriteHeader(cmp.Or(p.Status, http.StatusInternalServerError))
+	w.Write(data)
+}
+
+// isProblemMember reports whether name is a standard member of a problem.
+func isProblemMember(name string) bool {
+	switch name {
+	case "type", "title", "status", "detail", "instance":
+		return true
+	}
+	return false
+}
+
+// problemMember is a standard member of a problem object.
+type problemMember struct {
+	name  string
+	value any
+}
+
+// members returns the non-empty standard members of p, in order.
+func (p *Problem) members() []problemMember {
+	var out []problemMember
+	for _, m := range []problemMember{
+		{"type", p.Type},
+		{"title", p.Title},
+		{"status", p.Status},
+		{"detail", p.Detail},
+		{"instance", p.Instance},
+	} {
+		if m.value != "" && m.value != 0 {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// MarshalJSON implements the [json.Marshaler] interface.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	add := func(name string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("member %q: %w", name, err)
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(data)
+		return nil
+	}
+	for _, m := range p.members() {
+		add(m.name, m.value)
+	}
+	for _, name := range slices.Sorted(maps.Keys(p.Extensions)) {
+		if isProblemMember(name) {
+			continue
+		}
+		if err := add(name, p.Extensions[name]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface. As required by
+// RFC 9457, a standard member whose value has the wrong type is ignored.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for name, raw := range obj {
+		switch name {
+		case "type":
+			json.Unmarshal(raw, &p.Type)
+		case "title":
+			json.Unmarshal(raw, &p.Title)
+		case "status":
+			json.Unmarshal(raw, &p.Status)
+		case "detail":
+			json.Unmarshal(raw, &p.Detail)
+		case "instance":
+			json.Unmarshal(raw, &p.Instance)
+		default:
+			var v any
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return fmt.Errorf("member %q: %w", name, err)
+			}
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]any)
+			}
+			p.Extensions[name] = v
+		}
+	}
+	return nil
+}
+
+// MarshalXML implements the [xml.Marshaler] interface.
+func (p *Problem) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	root := xml.StartElement{Name: xml.Name{Local: "problem"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: problemXMLNS},
+	}}
+	if err := e.EncodeToken(root); err != nil {
+		return err
+	}
+	for _, m := range p.members() {
+		if err := e.EncodeElement(m.value, xml.StartElement{Name: xml.Name{Local: m.name}}); err != nil {
+			return err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(p.Extensions)) {
+		if isProblemMember(name) {
+			continue
+		}
+		if err := encodeXMLValue(e, name, p.Extensions[name]); err != nil {
+			return fmt.Errorf("member %q: %w", name, err)
+		}
+	}
+	if err := e.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+// encodeXMLValue writes v as an element with the given name. Slices are
+// written as <i> elements, and maps as nested elements in key order.
+func encodeXMLValue(e *xml.Encoder, name string, v any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch t := v.(type) {
+	case []any:
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, elt := range t {
+			if err := encodeXMLValue(e, "i", elt); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case []string:
+		return e.EncodeElement(struct {
+			I []string `xml:"i"`
+		}{t}, start)
+	case map[string]any:
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, key := range slices.Sorted(maps.Keys(t)) {
+			if err := encodeXMLValue(e, key, t[key]); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case nil:
+		return e.EncodeElement("", start)
+	default:
+		return e.EncodeElement(v, start)
+	}
+}
+
+// maxProblemSize is the maximum size of a response body read by ResponseError.
+const maxProblemSize = 1 << 16
+
+// ResponseError returns nil if rsp has a status code less than 400.
+// Otherwise, it returns an error of concrete type *[Problem] describing the
+// response, which the caller may recover using [errors.As].
+//
+// If the response has content type application/problem+json, the problem is
+// decoded from the body. If the problem has no status, the status code of
+// rsp is used. Otherwise, the problem has the status code of rsp, a title
+// taken from the status code, and if the body is plain text, the text of the
+// body as its detail. ResponseError reads the body, but does not close it.
+func ResponseError(rsp *http.Response) error {
+	if rsp.StatusCode < 400 {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, maxProblemSize))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	mtype, _, _ := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+	switch mtype {
+	case ProblemJSON:
+		var p Problem
+		if err := json.Unmarshal(body, &p); err == nil {
+			if p.Status == 0 {
+				p.Status = rsp.StatusCode
+			}
+			return &p
+		}
+	case "text/plain":
+		return NewProblem(rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return NewProblem(rsp.StatusCode, "")
+}
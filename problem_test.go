@@ -0,0 +1,181 @@
+package mhttp_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+// The out-of-credit example from RFC 9457 Section 3.
+var testProblem = &mhttp.Problem{
+	Type:     "https://example.com/probs/out-of-credit",
+	Title:    "You do not have enough credit.",
+	Status:   http.StatusForbidden,
+	Detail:   "Your current balance is 30, but that costs 50.",
+	Instance: "/account/12345/msgs/abc",
+	Extensions: map[string]any{
+		"balance":  30,
+		"accounts": []string{"/account/12345", "/account/67890"},
+		"status":   "ignored",
+	},
+}
+
+func TestProblemJSON(t *testing.T) {
+	data, err := json.Marshal(testProblem)
+	if err != nil {
+		t.Fatalf("Marshal: unexpected error: %v", err)
+	}
+	const want = `{"type":"https://example.com/probs/out-of-credit",` +
+		`"title":"You do not have enough credit.","status":403,` +
+		`"detail":"Your current balance is 30, but that costs 50.",` +
+		`"instance":"/account/12345/msgs/abc",` +
+		`"accounts":["/account/12345","/account/67890"],"balance":30}`
+	if got := string(data); got != want {
+		t.Errorf("Marshal:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	var p mhttp.Problem
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("Unmarshal: unexpected error: %v", err)
+	}
+	wantP := *testProblem
+	wantP.Extensions = map[string]any{
+		"balance":  30.0,
+		"accounts": []any{"/account/12345", "/account/67890"},
+	}
+	if diff := cmp.Diff(p, wantP); diff != "" {
+		t.Errorf("Unmarshal (-got, +want):\n%s", diff)
+	}
+
+	// Standard members with the wrong type are ignored.
+	if err := json.Unmarshal([]byte(`{"status":"404","title":["x"],"detail":"ok"}`), &p); err != nil {
+		t.Fatalf("Unmarshal: unexpected error: %v", err)
+	} else if diff := cmp.Diff(p, mhttp.Problem{Detail: "ok"}); diff != "" {
+		t.Errorf("Unmarshal (-got, +want):\n%s", diff)
+	}
+}
+
+func TestProblemServeHTTP(t *testing.T) {
+	tests := []struct {
+		accept, ctype string
+		wantBody      string
+	}{
+		{"", mhttp.ProblemJSON, `"status":403`},
+		{"application/json", mhttp.ProblemJSON, `"status":403`},
+		{"text/html", mhttp.ProblemJSON, `"status":403`},
+		{"application/problem+xml", mhttp.ProblemXML, `<?xml version="1.0" encoding="UTF-8"?>
+<problem xmlns="urn:ietf:rfc:7807">` +
+			`<type>https://example.com/probs/out-of-credit</type>` +
+			`<title>You do not have enough credit.</title>` +
+			`<status>403</status>` +
+			`<detail>Your current balance is 30, but that costs 50.</detail>` +
+			`<instance>/account/12345/msgs/abc</instance>` +
+			`<accounts><i>/account/12345</i><i>/account/67890</i></accounts>` +
+			`<balance>30</balance></problem>`},
+		{"application/xml, application/json;q=0.5", mhttp.ProblemXML, `<status>403</status>`},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Length", "100")
+		testProblem.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Accept %q: got status %d, want %d", tc.accept, rec.Code, http.StatusForbidden)
+		}
+		h := rec.Result().Header
+		if got := h.Get("Content-Type"); got != tc.ctype {
+			t.Errorf("Accept %q: got Content-Type %q, want %q", tc.accept, got, tc.ctype)
+		}
+		if got := h.Get("Vary"); got != "Accept" {
+			t.Errorf("Accept %q: got Vary %q, want Accept", tc.accept, got)
+		}
+		if got := h.Get("Content-Length"); got != "" {
+			t.Errorf("Accept %q: got Content-Length %q, want none", tc.accept, got)
+		}
+		if got := rec.Body.String(); !strings.Contains(got, tc.wantBody) {
+			t.Errorf("Accept %q: got body %q, want %q", tc.accept, got, tc.wantBody)
+		}
+	}
+
+	t.Run("RangeNotSatisfiable", func(t *testing.T) {
+		_, err := mhttp.ParseRangeHeader(100, "bytes=200-300")
+		if err == nil {
+			t.Fatal("ParseRangeHeader: got nil, want error")
+		}
+		rec := httptest.NewRecorder()
+		mhttp.RangeNotSatisfiable(100, err.Error()).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("Status: got %d, want %d", rec.Code, http.StatusRequestedRangeNotSatisfiable)
+		}
+		if got, want := rec.Header().Get("Content-Range"), "bytes */100"; got != want {
+			t.Errorf("Content-Range: got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestResponseError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/problem", testProblem)
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such thing", http.StatusNotFound)
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want *mhttp.Problem
+	}{
+		{"/ok", nil},
+		{"/problem", &mhttp.Problem{
+			Type:     testProblem.Type,
+			Title:    testProblem.Title,
+			Status:   testProblem.Status,
+			Detail:   testProblem.Detail,
+			Instance: testProblem.Instance,
+			Extensions: map[string]any{
+				"balance":  30.0,
+				"accounts": []any{"/account/12345", "/account/67890"},
+			},
+		}},
+		{"/plain", mhttp.NewProblem(http.StatusNotFound, "no such thing")},
+	}
+	for _, tc := range tests {
+		rsp, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatalf("Get %q: %v", tc.path, err)
+		}
+		err = mhttp.ResponseError(rsp)
+		rsp.Body.Close()
+		if tc.want == nil {
+			if err != nil {
+				t.Errorf("ResponseError %q: got %v, want nil", tc.path, err)
+			}
+			continue
+		}
+		wrapped := fmt.Errorf("call failed: %w", err)
+		var p *mhttp.Problem
+		if !errors.As(wrapped, &p) {
+			t.Errorf("ResponseError %q: got %v (%T), want *Problem", tc.path, err, err)
+			continue
+		}
+		if diff := cmp.Diff(p, tc.want); diff != "" {
+			t.Errorf("ResponseError %q (-got, +want):\n%s", tc.path, diff)
+		}
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+
+	"github.com/creachadair/mhttp"
 )
 
 // A Bridge is an [http.Handler] that forwards requests to a reverse proxy.
@@ -132,7 +134,7 @@ func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// The CONNECT URL has a restricted form: host:port only.
 	if r.URL.RawQuery != "" || r.URL.Fragment != "" || r.URL.Path != "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		mhttp.NewProblem(http.StatusBadRequest, "invalid CONNECT target").ServeHTTP(w, r)
 		return
 	}
 
@@ -145,7 +147,7 @@ func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	conn, bw, err := http.NewResponseController(w).Hijack()
 	if err != nil {
 		b.proxyConnError.Add(1)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		mhttp.NewProblem(http.StatusInternalServerError, err.Error()).ServeHTTP(w, r)
 		return
 	}
 	bw.Flush()
@@ -160,6 +162,7 @@ func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	b.proxyConnAccept.Add(1)
+	b.logf("accept CONNECT for target %q trace=%s", r.URL.Host, traceID(r))
 
 	// Report success to the caller, then no more.
 	fmt.Fprintf(conn, "%s 200 OK\r\n\r\n", r.Proto)
@@ -183,11 +186,12 @@ func (b *Bridge) push(ctx context.Context, conn net.Conn) error {
 func (b *Bridge) delegateHTTP(w http.ResponseWriter, r *http.Request) {
 	if b.Handler == nil {
 		b.httpProxyReject.Add(1)
-		b.logf("reject proxy request %v", r.URL)
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		b.logf("reject proxy request %v trace=%s", r.URL, traceID(r))
+		mhttp.NewProblem(http.StatusNotFound, "").ServeHTTP(w, r)
 		return
 	}
 	b.httpProxyDelegate.Add(1)
+	b.logf("delegate %s %v trace=%s", r.Method, r.URL, traceID(r))
 	b.Handler.ServeHTTP(w, r)
 }
 
@@ -196,8 +200,8 @@ func (b *Bridge) delegateHTTP(w http.ResponseWriter, r *http.Request) {
 func (b *Bridge) forwardConnect(w http.ResponseWriter, r *http.Request) {
 	if !b.ForwardConnect {
 		b.fwdConnReject.Add(1)
-		b.logf("reject CONNECT for target %q", r.URL.Host)
-		http.Error(w, fmt.Sprintf("target address %q not recognized", r.URL.Host), http.StatusForbidden)
+		b.logf("reject CONNECT for target %q trace=%s", r.URL.Host, traceID(r))
+		mhttp.NewProblem(http.StatusForbidden, fmt.Sprintf("target address %q not recognized", r.URL.Host)).ServeHTTP(w, r)
 		return
 	}
 
@@ -205,7 +209,7 @@ func (b *Bridge) forwardConnect(w http.ResponseWriter, r *http.Request) {
 	rconn, err := net.Dial("tcp", r.URL.Host)
 	if err != nil {
 		b.fwdConnError.Add(1)
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		mhttp.NewProblem(http.StatusBadGateway, err.Error()).ServeHTTP(w, r)
 		return
 	}
 
@@ -213,7 +217,7 @@ func (b *Bridge) forwardConnect(w http.ResponseWriter, r *http.Request) {
 	cconn, bw, err := http.NewResponseController(w).Hijack()
 	if err != nil {
 		b.fwdConnError.Add(1)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		mhttp.NewProblem(http.StatusInternalServerError, err.Error()).ServeHTTP(w, r)
 		return
 	}
 	bw.Flush()
@@ -225,6 +229,7 @@ func (b *Bridge) forwardConnect(w http.ResponseWriter, r *http.Request) {
 
 	// Splice the connections together.
 	b.fwdConnSplice.Add(1)
+	b.logf("forward CONNECT for target %q trace=%s", r.URL.Host, traceID(r))
 	go func() {
 		io.Copy(cconn, rconn)
 		cconn.(*net.TCPConn).CloseWrite()
@@ -254,6 +259,15 @@ func (b *Bridge) logf(msg string, args ...any) {
 	}
 }
 
+// traceID returns the trace ID of r for logging, or "-" if r has no trace
+// context.
+func traceID(r *http.Request) string {
+	if tc, ok := mhttp.RequestTrace(r); ok {
+		return tc.TraceID.String()
+	}
+	return "-"
+}
+
 // addrStub implements the [net.Addr] interface for a fake address.
 type addrStub string
 
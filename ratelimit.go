@@ -0,0 +1,593 @@
+package mhttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/mhttp/sfv"
+)
+
+// A RateLimitPolicy is a quota policy advertised by a server in the
+// RateLimit-Policy header, as defined by the IETF [RateLimit header fields]
+// draft.
+//
+// [RateLimit header fields]: https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+type RateLimitPolicy struct {
+	Name         string        // the name of the policy
+	Quota        int64         // the number of quota units allowed per window (q)
+	Unit         string        // the quota unit (qu); empty means "requests"
+	Window       time.Duration // the time window of the quota (w); 0 if unspecified
+	PartitionKey []byte        // the partition key (pk); nil if unspecified
+}
+
+// A RateLimit is the state of a quota policy reported by a server in the
+// RateLimit header.
+type RateLimit struct {
+	Name         string        // the name of the policy
+	Remaining    int64         // the remaining quota units (r)
+	Reset        time.Duration // the time until the quota resets (t); 0 if unspecified
+	PartitionKey []byte        // the partition key (pk); nil if unspecified
+}
+
+// FormatRateLimitPolicyHeader renders the contents of a RateLimit-Policy
+// header for the given policies.
+func FormatRateLimitPolicyHeader(ps ...RateLimitPolicy) (string, error) {
+	var out sfv.List
+	for _, p := range ps {
+		it := sfv.Item{Value: p.Name}
+		it.Params.Set("q", p.Quota)
+		if p.Unit != "" {
+			it.Params.Set("qu", p.Unit)
+		}
+		if p.Window > 0 {
+			it.Params.Set("w", ceilSeconds(p.Window))
+		}
+		if p.PartitionKey != nil {
+			it.Params.Set("pk", p.PartitionKey)
+		}
+		out = append(out, it)
+	}
+	return sfv.FormatList(out)
+}
+
+// FormatRateLimitHeader renders the contents of a RateLimit header for the
+// given limits.
+func FormatRateLimitHeader(ls ...RateLimit) (string, error) {
+	var out sfv.List
+	for _, l := range ls {
+		it := sfv.Item{Value: l.Name}
+		it.Params.Set("r", l.Remaining)
+		if l.Reset > 0 {
+			it.Params.Set("t", ceilSeconds(l.Reset))
+		}
+		if l.PartitionKey != nil {
+			it.Params.Set("pk", l.PartitionKey)
+		}
+		out = append(out, it)
+	}
+	return sfv.FormatList(out)
+}
+
+// ParseRateLimitPolicyHeader parses the contents of a RateLimit-Policy
+// header. Unknown parameters are ignored. A policy without a quota is an
+// error.
+func ParseRateLimitPolicyHeader(s string) ([]RateLimitPolicy, error) {
+	items, err := rateLimitItems(s)
+	if err != nil {
+		return nil, err
+	}
+	var out []RateLimitPolicy
+	for _, it := range items {
+		p := RateLimitPolicy{Name: it.Value.(string)}
+		q, ok := it.Params.Get("q")
+		if p.Quota, ok = q.(int64); !ok || p.Quota < 0 {
+			return nil, fmt.Errorf("policy %q: missing or invalid quota", p.Name)
+		}
+		if v, ok := it.Params.Get("qu"); ok {
+			if p.Unit, ok = v.(string); !ok {
+				return nil, fmt.Errorf("policy %q: invalid quota unit", p.Name)
+			}
+		}
+		if v, ok := it.Params.Get("w"); ok {
+			secs, ok := v.(int64)
+			if !ok || secs < 0 {
+				return nil, fmt.Errorf("policy %q: invalid window", p.Name)
+			}
+			p.Window = time.Duration(secs) * time.Second
+		}
+		if v, ok := it.Params.Get("pk"); ok {
+			if p.PartitionKey, ok = v.([]byte); !ok {
+				return nil, fmt.Errorf("policy %q: invalid partition key", p.Name)
+			}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// ParseRateLimitHeader parses the contents of a RateLimit header. Unknown
+// parameters are ignored. A limit without a remaining quota is an error.
+func ParseRateLimitHeader(s string) ([]RateLimit, error) {
+	items, err := rateLimitItems(s)
+	if err != nil {
+		return nil, err
+	}
+	var out []RateLimit
+	for _, it := range items {
+		l := RateLimit{Name: it.Value.(string)}
+		r, ok := it.Params.Get("r")
+		if l.Remaining, ok = r.(int64); !ok || l.Remaining < 0 {
+			return nil, fmt.Errorf("limit %q: missing or invalid remaining quota", l.Name)
+		}
+		if v, ok := it.Params.Get("t"); ok {
+			secs, ok := v.(int64)
+			if !ok || secs < 0 {
+				return nil, fmt.Errorf("limit %q: invalid reset", l.Name)
+			}
+			l.Reset = time.Duration(secs) * time.Second
+		}
+		if v, ok := it.Params.Get("pk"); ok {
+			if l.PartitionKey, ok = v.([]byte); !ok {
+				return nil, fmt.Errorf("limit %q: invalid partition key", l.Name)
+			}
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// rateLimitItems parses s as a structured list whose members are items with
+// string values.
+func rateLimitItems(s string) ([]sfv.Item, error) {
+	list, err := sfv.ParseList(s)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sfv.Item, len(list))
+	for i, m := range list {
+		it, ok := m.(sfv.Item)
+		if !ok {
+			return nil, fmt.Errorf("member %d is not an item", i+1)
+		} else if _, ok := it.Value.(string); !ok {
+			return nil, fmt.Errorf("member %d is not a policy name", i+1)
+		}
+		out[i] = it
+	}
+	return out, nil
+}
+
+// ceilSeconds returns d in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// A Limiter enforces a quota policy on requests partitioned by key.
+// Implementations must be safe for concurrent use.
+type Limiter interface {
+	// Policy returns the quota policy enforced by the limiter.
+	Policy() RateLimitPolicy
+
+	// Take attempts to consume one unit of the quota for key at time now.
+	Take(key string, now time.Time) LimitResult
+}
+
+// A LimitResult is the outcome of a [Limiter.Take] call.
+type LimitResult struct {
+	Allowed    bool          // whether the request is within the quota
+	Remaining  int64         // the quota units remaining after the request
+	Reset      time.Duration // the time until the quota is fully restored
+	RetryAfter time.Duration // if not allowed, the time until a unit is available
+}
+
+// A TokenBucket is a [Limiter] that gives each key a bucket holding up to
+// quota tokens, which refills continuously at the rate of quota tokens per
+// window. Each request consumes one token, so a key may make a burst of up to
+// quota requests, and quota requests per window on average.
+type TokenBucket struct {
+	name   string
+	quota  int64
+	window time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*bucketState
+	sweep   int // sweep idle buckets when the map reaches this size
+}
+
+type bucketState struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket constructs a [TokenBucket] with the given policy name, quota,
+// and window. It panics if quota or window is not positive.
+func NewTokenBucket(name string, quota int64, window time.Duration) *TokenBucket {
+	if quota <= 0 || window <= 0 {
+		panic("quota and window must be positive")
+	}
+	return &TokenBucket{name: name, quota: quota, window: window, buckets: make(map[string]*bucketState)}
+}
+
+// Policy implements part of the [Limiter] interface.
+func (b *TokenBucket) Policy() RateLimitPolicy {
+	return RateLimitPolicy{Name: b.name, Quota: b.quota, Window: b.window}
+}
+
+// Take implements part of the [Limiter] interface.
+func (b *TokenBucket) Take(key string, now time.Time) LimitResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rate := float64(b.quota) / float64(b.window) // tokens per nanosecond
+	st, ok := b.buckets[key]
+	if !ok {
+		b.sweepIdle(now)
+		st = &bucketState{tokens: float64(b.quota), last: now}
+		b.buckets[key] = st
+	} else if now.After(st.last) {
+		st.tokens = min(float64(b.quota), st.tokens+float64(now.Sub(st.last))*rate)
+		st.last = now
+	}
+
+	var res LimitResult
+	if st.tokens >= 1 {
+		st.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1 - st.tokens) / rate))
+	}
+	res.Remaining = int64(st.tokens)
+	res.Reset = time.Duration(math.Ceil((float64(b.quota) - st.tokens) / rate))
+	return res
+}
+
+// sweepIdle discards buckets that have been idle long enough to refill, so
+// that the map does not grow without bound. The caller must hold b.mu.
+func (b *TokenBucket) sweepIdle(now time.Time) {
+	if len(b.buckets) < b.sweep {
+		return
+	}
+	for key, st := range b.buckets {
+		if now.Sub(st.last) >= b.window {
+			delete(b.buckets, key)
+		}
+	}
+	b.sweep = max(2*len(b.buckets), 64)
+}
+
+// A SlidingWindow is a [Limiter] that allows each key quota requests in any
+// period of length window. It approximates the request count over the
+// sliding window by weighting the count of the previous fixed window by its
+// overlap with the sliding window.
+type SlidingWindow struct {
+	name   string
+	quota  int64
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*windowState
+	sweep   int // sweep idle windows when the map reaches this size
+}
+
+type windowState struct {
+	start     time.Time // start of the current fixed window
+	cur, prev int64     // counts in the current and previous fixed windows
+}
+
+// NewSlidingWindow constructs a [SlidingWindow] with the given policy name,
+// quota, and window. It panics if quota or window is not positive.
+func NewSlidingWindow(name string, quota int64, window time.Duration) *SlidingWindow {
+	if quota <= 0 || window <= 0 {
+		panic("quota and window must be positive")
+	}
+	return &SlidingWindow{name: name, quota: quota, window: window, windows: make(map[string]*windowState)}
+}
+
+// Policy implements part of the [Limiter] interface.
+func (s *SlidingWindow) Policy() RateLimitPolicy {
+	return RateLimitPolicy{Name: s.name, Quota: s.quota, Window: s.window}
+}
+
+// Take implements part of the [Limiter] interface.
+func (s *SlidingWindow) Take(key string, now time.Time) LimitResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := now.Truncate(s.window)
+	st, ok := s.windows[key]
+	if !ok {
+		s.sweepIdle(now)
+		st = &windowState{start: start}
+		s.windows[key] = st
+	} else if start.After(st.start) {
+		if start.Sub(st.start) == s.window {
+			st.prev = st.cur
+		} else {
+			st.prev = 0 // the previous window had no requests
+		}
+		st.cur, st.start = 0, start
+	}
+
+	elapsed := float64(now.Sub(st.start)) / float64(s.window)
+	weight := 1 - elapsed // the overlap of the previous window
+	count := func() float64 { return float64(st.prev)*weight + float64(st.cur) }
+
+	res := LimitResult{Reset: st.start.Add(s.window).Sub(now)}
+	if count()+1 <= float64(s.quota) {
+		st.cur++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = s.retryAfter(st, elapsed)
+	}
+	res.Remaining = max(s.quota-int64(math.Ceil(count())), 0)
+	if st.cur > 0 {
+		// The current window's requests leave the sliding window at the end
+		// of the next fixed window.
+		res.Reset += s.window
+	}
+	return res
+}
+
+// retryAfter returns the time until the estimated count for st drops enough
+// to admit another request, given the elapsed fraction of the current window.
+func (s *SlidingWindow) retryAfter(st *windowState, elapsed float64) time.Duration {
+	room := float64(s.quota - 1) // the count must drop to this
+	w := float64(s.window)
+	if float64(st.cur) <= room && st.prev > 0 {
+		// Within the current window: prev*(1-x) + cur <= room.
+		x := 1 - (room-float64(st.cur))/float64(st.prev)
+		return time.Duration(math.Ceil((x - elapsed) * w))
+	}
+	// In the next window, the current count becomes the previous count:
+	// cur*(1-x) <= room.
+	x := 1 - room/float64(st.cur)
+	return time.Duration(math.Ceil((1 - elapsed + x) * w))
+}
+
+// sweepIdle discards windows with no requests in the sliding window. The
+// caller must hold s.mu.
+func (s *SlidingWindow) sweepIdle(now time.Time) {
+	if len(s.windows) < s.sweep {
+		return
+	}
+	for key, st := range s.windows {
+		if now.Sub(st.start) >= 2*s.window {
+			delete(s.windows, key)
+		}
+	}
+	s.sweep = max(2*len(s.windows), 64)
+}
+
+// RateLimitHandler is an [http.Handler] that enforces a quota on requests
+// before delegating them to an underlying handler. Requests are partitioned
+// by the key returned by the Key function, and each partition has its own
+// quota, enforced by the Limiter.
+//
+// The handler reports the quota policy in the RateLimit-Policy header and
+// the state of the partition in the RateLimit header of every response. If
+// the quota is exhausted, it responds with status 429 (Too Many Requests)
+// and a Retry-After header, without calling the underlying handler.
+type RateLimitHandler struct {
+	// Handler is the underlying handler for requests within the quota.
+	Handler http.Handler
+
+	// Limiter enforces the quota. It must not be nil.
+	Limiter Limiter
+
+	// Key returns the partition key for a request. If it returns "", the
+	// request is not limited. If nil, [RateLimitByClientIP] is used.
+	Key func(*http.Request) string
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h RateLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	keyFunc := h.Key
+	if keyFunc == nil {
+		keyFunc = RateLimitByClientIP
+	}
+	key := keyFunc(r)
+	if key == "" {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	policy := h.Limiter.Policy()
+	res := h.Limiter.Take(key, time.Now())
+	hdr := w.Header()
+	if s, err := FormatRateLimitPolicyHeader(policy); err == nil {
+		hdr.Set("RateLimit-Policy", s)
+	}
+	if s, err := FormatRateLimitHeader(RateLimit{
+		Name:      policy.Name,
+		Remaining: res.Remaining,
+		Reset:     res.Reset,
+	}); err == nil {
+		hdr.Set("RateLimit", s)
+	}
+	if !res.Allowed {
+		p := NewProblem(http.StatusTooManyRequests, "quota exceeded")
+		p.Header = http.Header{"Retry-After": {strconv.FormatInt(ceilSeconds(res.RetryAfter), 10)}}
+		p.ServeHTTP(w, r)
+		return
+	}
+	h.Handler.ServeHTTP(w, r)
+}
+
+// RateLimitByClientIP is a key function for a [RateLimitHandler] that
+// partitions requests by the IP address of the client, taken from the
+// RemoteAddr of the request. To use the address of the original client
+// behind trusted proxies, wrap the handler in a [ForwardedHandler].
+func RateLimitByClientIP(r *http.Request) string {
+	if n := peerNode(r.RemoteAddr); n.Addr.IsValid() {
+		return n.Addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// RateLimitByHeader returns a key function for a [RateLimitHandler] that
+// partitions requests by the value of the named header. Requests without
+// the header are not limited.
+func RateLimitByHeader(name string) func(*http.Request) string {
+	return func(r *http.Request) string { return r.Header.Get(name) }
+}
+
+// RateLimitByAuth is a key function for a [RateLimitHandler] that partitions
+// requests by the identity in their Authorization header: the user name of
+// Basic credentials, or a hash of the token of Bearer credentials. Requests
+// with other or no credentials are partitioned by client IP address, as for
+// [RateLimitByClientIP]. The credentials are not verified, so the handler
+// should be placed after authentication.
+func RateLimitByAuth(r *http.Request) string {
+	c, err := ParseAuthorizationHeader(r.Header.Get("Authorization"))
+	if err == nil {
+		if user, _, ok := c.Basic(); ok {
+			return "user:" + user
+		} else if tok, ok := c.Bearer(); ok {
+			sum := sha256.Sum256([]byte(tok))
+			return "token:" + hex.EncodeToString(sum[:16])
+		}
+	}
+	return "ip:" + RateLimitByClientIP(r)
+}
+
+// A PacingTransport is an [http.RoundTripper] that paces requests to stay
+// within the quotas that servers advertise in RateLimit headers.
+//
+// The transport tracks the most restrictive limit reported by each host.
+// When the remaining quota for a host is exhausted, requests to the host wait
+// until the quota resets. When the remaining quota is at or below Reserve,
+// requests are spaced evenly over the time until the reset. After a response
+// with status 429 (Too Many Requests) or 503 (Service Unavailable) and a
+// Retry-After header, requests to the host wait for the specified delay.
+//
+// A request whose context ends while it is waiting fails with the context's
+// error. If the wait would extend past the deadline of the request context,
+// the request fails immediately with [context.DeadlineExceeded].
+type PacingTransport struct {
+	// Base is the underlying transport. If nil, [http.DefaultTransport] is used.
+	Base http.RoundTripper
+
+	// Reserve is the remaining quota at or below which requests are spaced
+	// out, rather than sent as soon as possible.
+	Reserve int64
+
+	mu    sync.Mutex
+	hosts map[string]*paceState
+}
+
+type paceState struct {
+	remaining int64     // the remaining quota, or -1 if unknown
+	reset     time.Time // when the quota resets
+	next      time.Time // the earliest time to send the next request
+}
+
+// RoundTrip implements the [http.RoundTripper] interface.
+func (t *PacingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	host := req.URL.Host
+	if delay := t.reserve(host, time.Now()); delay > 0 {
+		if dl, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(dl) {
+			return nil, context.DeadlineExceeded
+		}
+		tm := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			tm.Stop()
+			return nil, ctx.Err()
+		case <-tm.C:
+		}
+	}
+	rsp, err := base.RoundTrip(req)
+	if err == nil {
+		t.update(host, rsp)
+	}
+	return rsp, err
+}
+
+// reserve claims a unit of the quota for host, and returns how long the
+// caller must wait before sending its request.
+func (t *PacingTransport) reserve(host string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.hosts[host]
+	if st == nil {
+		return 0
+	}
+	if !now.Before(st.reset) && st.remaining >= 0 {
+		st.remaining = -1 // the quota has reset; its state is unknown
+	}
+	at := st.next
+	switch {
+	case st.remaining == 0:
+		if st.reset.After(at) {
+			at = st.reset
+		}
+	case st.remaining > 0:
+		if st.remaining <= t.Reserve {
+			// Space the remaining requests evenly until the reset.
+			gap := st.reset.Sub(now) / time.Duration(st.remaining)
+			st.next = laterOf(at, now).Add(gap)
+		}
+		st.remaining--
+	}
+	return max(at.Sub(now), 0)
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// update records the rate limit state reported by rsp for host.
+func (t *PacingTransport) update(host string, rsp *http.Response) {
+	now := responseDate(rsp)
+	var next time.Time
+	if sc := rsp.StatusCode; sc == http.StatusTooManyRequests || sc == http.StatusServiceUnavailable {
+		if d, err := ParseRetryAfter(rsp.Header.Get("Retry-After"), now); err == nil {
+			next = time.Now().Add(d)
+		}
+	}
+	limits, err := ParseRateLimitHeader(strings.Join(rsp.Header.Values("RateLimit"), ","))
+	if err != nil || (len(limits) == 0 && next.IsZero()) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hosts == nil {
+		t.hosts = make(map[string]*paceState)
+	}
+	st := t.hosts[host]
+	if st == nil {
+		st = &paceState{remaining: -1}
+		t.hosts[host] = st
+	}
+	if next.After(st.next) {
+		st.next = next
+	}
+	if len(limits) == 0 {
+		return
+	}
+	// Use the limit with the least remaining quota.
+	low := limits[0]
+	for _, l := range limits[1:] {
+		if l.Remaining < low.Remaining {
+			low = l
+		}
+	}
+	st.remaining = low.Remaining
+	st.reset = time.Now().Add(low.Reset)
+}
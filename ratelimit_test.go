@@ -0,0 +1,278 @@
+package mhttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	policies := []mhttp.RateLimitPolicy{
+		{Name: "burst", Quota: 100, Window: time.Minute},
+		{Name: "daily", Quota: 1000, Unit: "content-bytes", Window: 24 * time.Hour, PartitionKey: []byte("u1")},
+	}
+	ps, err := mhttp.FormatRateLimitPolicyHeader(policies...)
+	if err != nil {
+		t.Fatalf("FormatRateLimitPolicyHeader: unexpected error: %v", err)
+	}
+	const wantPolicy = `"burst";q=100;w=60, "daily";q=1000;qu="content-bytes";w=86400;pk=:dTE=:`
+	if ps != wantPolicy {
+		t.Errorf("FormatRateLimitPolicyHeader: got %q, want %q", ps, wantPolicy)
+	}
+	gotPolicies, err := mhttp.ParseRateLimitPolicyHeader(ps)
+	if err != nil {
+		t.Fatalf("ParseRateLimitPolicyHeader: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(gotPolicies, policies); diff != "" {
+		t.Errorf("ParseRateLimitPolicyHeader (-got, +want):\n%s", diff)
+	}
+
+	limits := []mhttp.RateLimit{
+		{Name: "burst", Remaining: 5, Reset: 1500 * time.Millisecond},
+		{Name: "daily", Remaining: 0},
+	}
+	ls, err := mhttp.FormatRateLimitHeader(limits...)
+	if err != nil {
+		t.Fatalf("FormatRateLimitHeader: unexpected error: %v", err)
+	}
+	if want := `"burst";r=5;t=2, "daily";r=0`; ls != want {
+		t.Errorf("FormatRateLimitHeader: got %q, want %q", ls, want)
+	}
+	gotLimits, err := mhttp.ParseRateLimitHeader(`"burst";r=5;t=2;x=y, "daily";r=0`)
+	if err != nil {
+		t.Fatalf("ParseRateLimitHeader: unexpected error: %v", err)
+	}
+	limits[0].Reset = 2 * time.Second
+	if diff := cmp.Diff(gotLimits, limits); diff != "" {
+		t.Errorf("ParseRateLimitHeader (-got, +want):\n%s", diff)
+	}
+
+	for _, bad := range []string{`"a";w=1`, `"a";q=-1`, `"a";q=1;w="x"`, `a;q=1`, `("a");q=1`} {
+		if got, err := mhttp.ParseRateLimitPolicyHeader(bad); err == nil {
+			t.Errorf("ParseRateLimitPolicyHeader(%q): got %+v, want error", bad, got)
+		}
+	}
+	for _, bad := range []string{`"a";t=1`, `"a";r=1.5`, `"a";r=1;t=-3`, `"a";r=1;pk="x"`} {
+		if got, err := mhttp.ParseRateLimitHeader(bad); err == nil {
+			t.Errorf("ParseRateLimitHeader(%q): got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := mhttp.NewTokenBucket("tb", 3, 3*time.Second) // one token per second
+	now := time.Unix(1000, 0)
+	type step struct {
+		at   time.Duration // offset from now
+		key  string
+		want mhttp.LimitResult
+	}
+	steps := []step{
+		{0, "a", mhttp.LimitResult{Allowed: true, Remaining: 2, Reset: time.Second}},
+		{0, "a", mhttp.LimitResult{Allowed: true, Remaining: 1, Reset: 2 * time.Second}},
+		{0, "a", mhttp.LimitResult{Allowed: true, Remaining: 0, Reset: 3 * time.Second}},
+		{0, "a", mhttp.LimitResult{Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		{0, "b", mhttp.LimitResult{Allowed: true, Remaining: 2, Reset: time.Second}},
+		{500 * time.Millisecond, "a", mhttp.LimitResult{Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{time.Second, "a", mhttp.LimitResult{Allowed: true, Remaining: 0, Reset: 3 * time.Second}},
+		{10 * time.Second, "a", mhttp.LimitResult{Allowed: true, Remaining: 2, Reset: time.Second}},
+	}
+	for i, s := range steps {
+		got := b.Take(s.key, now.Add(s.at))
+		if diff := cmp.Diff(got, s.want); diff != "" {
+			t.Errorf("Step %d: Take(%q) (-got, +want):\n%s", i+1, s.key, diff)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := mhttp.NewSlidingWindow("sw", 4, 10*time.Second)
+	start := time.Unix(1000, 0) // a multiple of the window
+	for i := range 4 {
+		if got := w.Take("a", start.Add(time.Duration(i)*time.Second)); !got.Allowed {
+			t.Fatalf("Take %d: got %+v, want allowed", i+1, got)
+		}
+	}
+	got := w.Take("a", start.Add(5*time.Second))
+	if diff := cmp.Diff(got, mhttp.LimitResult{
+		Reset:      15 * time.Second,
+		RetryAfter: 7500 * time.Millisecond, // until 1/4 of the next window has elapsed
+	}); diff != "" {
+		t.Errorf("Take over quota (-got, +want):\n%s", diff)
+	}
+
+	// In the next window, the previous requests are weighted by overlap.
+	got = w.Take("a", start.Add(12500*time.Millisecond)) // weight 3/4 => 3
+	if !got.Allowed || got.Remaining != 0 {
+		t.Errorf("Take at 12.5s: got %+v, want allowed with 0 remaining", got)
+	}
+	got = w.Take("a", start.Add(13*time.Second)) // 4*0.7 + 1 = 3.8
+	if got.Allowed {
+		t.Errorf("Take at 13s: got %+v, want denied", got)
+	}
+	if got := w.Take("b", start.Add(13*time.Second)); !got.Allowed || got.Remaining != 3 {
+		t.Errorf("Take b: got %+v, want allowed with 3 remaining", got)
+	}
+
+	// After two idle windows, the quota is fully restored.
+	if got := w.Take("a", start.Add(40*time.Second)); !got.Allowed || got.Remaining != 3 {
+		t.Errorf("Take after idle: got %+v, want allowed with 3 remaining", got)
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	h := mhttp.RateLimitHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+		Limiter: mhttp.NewTokenBucket("api", 2, time.Hour),
+		Key:     mhttp.RateLimitByAuth,
+	}
+	call := func(remoteAddr, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range 2 {
+		rec := call("192.0.2.1:1234", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Call %d: got status %d, want 200", i+1, rec.Code)
+		}
+		if got, want := rec.Header().Get("RateLimit-Policy"), `"api";q=2;w=3600`; got != want {
+			t.Errorf("Call %d: got RateLimit-Policy %q, want %q", i+1, got, want)
+		}
+	}
+	// The same client on another port shares the quota.
+	rec := call("192.0.2.1:5678", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Call 3: got status %d, want 429", rec.Code)
+	}
+	if got, want := rec.Header().Get("Retry-After"), "1800"; got != want {
+		t.Errorf("Retry-After: got %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("RateLimit"), `"api";r=0;t=3600`; got != want {
+		t.Errorf("RateLimit: got %q, want %q", got, want)
+	}
+	if got := rec.Header().Get("Content-Type"); got != mhttp.ProblemJSON {
+		t.Errorf("Content-Type: got %q, want %q", got, mhttp.ProblemJSON)
+	}
+
+	// Authenticated users have their own quotas.
+	if rec := call("192.0.2.1:1234", "Bearer abc"); rec.Code != http.StatusOK {
+		t.Errorf("Bearer: got status %d, want 200", rec.Code)
+	}
+	if rec := call("192.0.2.1:1234", "Basic dXNlcjpwYXNz"); rec.Code != http.StatusOK {
+		t.Errorf("Basic: got status %d, want 200", rec.Code)
+	}
+	if got, want := call("192.0.2.1:1234", "Bearer abc").Header().Get("RateLimit"), `"api";r=0;t=3600`; got != want {
+		t.Errorf("Bearer RateLimit: got %q, want %q", got, want)
+	}
+
+	// Requests without a key are not limited.
+	h.Key = mhttp.RateLimitByHeader("X-Api-Key")
+	for range 3 {
+		if rec := call("192.0.2.1:1234", ""); rec.Code != http.StatusOK || rec.Header().Get("RateLimit") != "" {
+			t.Errorf("No key: got status %d, RateLimit %q; want 200 and none", rec.Code, rec.Header().Get("RateLimit"))
+		}
+	}
+}
+
+func TestPacingTransport(t *testing.T) {
+	var sent []time.Time
+	var remaining int64 = 1
+	pt := &mhttp.PacingTransport{
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent = append(sent, time.Now())
+			rsp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Request: req}
+			rsp.Header.Set("RateLimit", `"x";r=`+strconv.FormatInt(remaining, 10)+`;t=1`)
+			remaining = max(remaining-1, 0)
+			return rsp, nil
+		}),
+	}
+	cli := &http.Client{Transport: pt}
+	for i := range 3 {
+		rsp, err := cli.Get("http://example.com/")
+		if err != nil {
+			t.Fatalf("Get %d: unexpected error: %v", i+1, err)
+		}
+		rsp.Body.Close()
+	}
+	// The first two requests go immediately. The third waits for the reset,
+	// since the second response reported no remaining quota.
+	if d := sent[1].Sub(sent[0]); d > 500*time.Millisecond {
+		t.Errorf("Second request waited %v, want no wait", d)
+	}
+	if d := sent[2].Sub(sent[1]); d < 900*time.Millisecond {
+		t.Errorf("Third request waited %v, want about 1s", d)
+	}
+
+	t.Run("Deadline", func(t *testing.T) {
+		pt := &mhttp.PacingTransport{
+			Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				rsp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: make(http.Header), Request: req}
+				rsp.Header.Set("Retry-After", "60")
+				return rsp, nil
+			}),
+		}
+		cli := &http.Client{Transport: pt}
+		rsp, err := cli.Get("http://example.com/")
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/", nil)
+		if _, err := cli.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Get after 429: got %v, want %v", err, context.DeadlineExceeded)
+		}
+		// Other hosts are not affected.
+		req, _ = http.NewRequestWithContext(ctx, "GET", "http://example.org/", nil)
+		if rsp, err := cli.Do(req); err != nil {
+			t.Errorf("Get other host: unexpected error: %v", err)
+		} else {
+			rsp.Body.Close()
+		}
+	})
+
+	t.Run("Reserve", func(t *testing.T) {
+		var sent []time.Time
+		pt := &mhttp.PacingTransport{
+			Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				sent = append(sent, time.Now())
+				rsp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Request: req}
+				if len(sent) == 1 {
+					rsp.Header.Set("RateLimit", `"x";r=4;t=1`)
+				}
+				return rsp, nil
+			}),
+			Reserve: 10,
+		}
+		cli := &http.Client{Transport: pt}
+		for range 3 {
+			rsp, err := cli.Get("http://example.com/")
+			if err != nil {
+				t.Fatalf("Get: unexpected error: %v", err)
+			}
+			rsp.Body.Close()
+		}
+		// With 4 requests remaining in 1s, they are spaced about 250ms apart.
+		if d := sent[2].Sub(sent[1]); d < 200*time.Millisecond || d > 600*time.Millisecond {
+			t.Errorf("Spacing: got %v, want about 250ms", d)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package resumable
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults for the fields of a [Client].
+const (
+	DefaultMaxRetries = 5
+	DefaultRetryDelay = time.Second
+)
+
+// A Client uploads content using the resumable upload protocol. If an upload
+// is interrupted after the server has reported the location of the upload
+// resource, the client retrieves the offset the server has received and
+// resumes the upload from there.
+type Client struct {
+	// HTTP is the client used to send requests. If nil, [http.DefaultClient]
+	// is used.
+	HTTP *http.Client
+
+	// MaxRetries is the maximum number of consecutive attempts to resume the
+	// upload that make no progress. If zero, DefaultMaxRetries is used.
+	MaxRetries int
+
+	// RetryDelay is the time to wait before each attempt to resume.
+	// If zero, DefaultRetryDelay is used.
+	RetryDelay time.Duration
+}
+
+// Upload sends the content of body, which is size bytes long, with the method,
+// URL, and headers of req, and returns the final response. The body of req is
+// ignored. The context of req governs the whole upload, including retries.
+//
+// If the server does not support resumable uploads, the response is returned
+// as for an ordinary request. If the upload fails before the server reports
+// the location of the upload resource, Upload reports an error, since there
+// is nothing to resume.
+func (c *Client) Upload(req *http.Request, body io.ReadSeeker, size int64) (*http.Response, error) {
+	ctx := req.Context()
+	cli := c.HTTP
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+
+	// The location is reported in an interim response, which may arrive
+	// before the request fails.
+	var mu sync.Mutex
+	var location *url.URL
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, h textproto.MIMEHeader) error {
+			if code != StatusUploadResumptionSupported {
+				return nil
+			}
+			if loc, err := req.URL.Parse(h.Get("Location")); err == nil {
+				mu.Lock()
+				location = loc
+				mu.Unlock()
+			}
+			return nil
+		},
+	}
+	first := req.Clone(httptrace.WithClientTrace(ctx, trace))
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	first.Body = io.NopCloser(body)
+	first.ContentLength = size
+	first.GetBody = nil
+	first.Header.Set("Upload-Complete", "?1")
+	first.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+
+	rsp, err := cli.Do(first)
+	mu.Lock()
+	loc := location
+	mu.Unlock()
+	if err == nil {
+		// A 201 (Created) response without Upload-Complete means the server
+		// did not receive all the content.
+		if rsp.StatusCode != http.StatusCreated || isComplete(rsp) || rsp.Header.Get("Upload-Complete") == "" {
+			return rsp, nil
+		}
+		if s := rsp.Header.Get("Location"); s != "" {
+			if l, perr := req.URL.Parse(s); perr == nil {
+				loc = l
+			}
+		}
+		if loc == nil {
+			return rsp, nil
+		}
+		drain(rsp)
+	} else if loc == nil || ctx.Err() != nil {
+		return nil, err
+	}
+	return c.resume(ctx, cli, loc, body, size)
+}
+
+// resume completes the upload at loc, beginning by retrieving its offset.
+func (c *Client) resume(ctx context.Context, cli *http.Client, loc *url.URL, body io.ReadSeeker, size int64) (*http.Response, error) {
+	maxRetries := c.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	delay := c.RetryDelay
+	if delay == 0 {
+		delay = DefaultRetryDelay
+	}
+
+	var lastErr error
+	lastOffset := int64(-1)
+	for failures := 0; failures < maxRetries; {
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+
+		offset, done, err := c.offset(ctx, cli, loc)
+		if err != nil {
+			lastErr = err
+			failures++
+			continue
+		} else if done {
+			return nil, fmt.Errorf("upload %s is already complete, but its response was lost", loc)
+		} else if offset > size {
+			return nil, fmt.Errorf("upload %s has offset %d beyond its size %d", loc, offset, size)
+		}
+		if offset > lastOffset {
+			failures = 0
+		} else {
+			failures++
+		}
+		lastOffset = offset
+
+		rsp, err := c.append(ctx, cli, loc, body, offset, size)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch {
+		case rsp.StatusCode == http.StatusConflict, rsp.StatusCode >= 500:
+			lastErr = fmt.Errorf("append to %s: %s", loc, rsp.Status)
+			drain(rsp)
+		case rsp.StatusCode == http.StatusNoContent && !isComplete(rsp):
+			lastErr = fmt.Errorf("append to %s: upload is incomplete", loc)
+			drain(rsp)
+		default:
+			return rsp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("upload %s: giving up after %d attempts: %w", loc, maxRetries, lastErr)
+}
+
+// offset retrieves the offset of the upload at loc.
+func (c *Client) offset(ctx context.Context, cli *http.Client, loc *url.URL) (int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, loc.String(), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	rsp, err := cli.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	drain(rsp)
+	if rsp.StatusCode/100 != 2 {
+		return 0, false, fmt.Errorf("get offset of %s: %s", loc, rsp.Status)
+	}
+	offset, err := parseInt(rsp.Header.Get("Upload-Offset"))
+	if err != nil {
+		return 0, false, fmt.Errorf("get offset of %s: invalid Upload-Offset: %w", loc, err)
+	}
+	return offset, isComplete(rsp), nil
+}
+
+// append sends the content of body from offset to the upload at loc.
+func (c *Client) append(ctx context.Context, cli *http.Client, loc *url.URL, body io.ReadSeeker, offset, size int64) (*http.Response, error) {
+	if _, err := body.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, loc.String(),
+		io.NopCloser(io.LimitReader(body, size-offset)))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size - offset
+	req.Header.Set("Content-Type", PartialUploadType)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Upload-Complete", "?1")
+	return cli.Do(req)
+}
+
+// Cancel cancels the upload at the specified location.
+func (c *Client) Cancel(ctx context.Context, location string) error {
+	cli := c.HTTP
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, location, nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	drain(rsp)
+	if rsp.StatusCode/100 != 2 {
+		return fmt.Errorf("cancel %s: %s", location, rsp.Status)
+	}
+	return nil
+}
+
+func isComplete(rsp *http.Response) bool {
+	ok, err := parseBool(rsp.Header.Get("Upload-Complete"))
+	return err == nil && ok
+}
+
+// drain discards and closes the body of rsp.
+func drain(rsp *http.Response) {
+	io.CopyN(io.Discard, rsp.Body, 4<<10)
+	rsp.Body.Close()
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package resumable
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A DirStore is a [Store] that keeps uploads in files in a local directory.
+// The content of each upload is stored in a file named for its ID with the
+// suffix ".data", and its state in a file with the suffix ".json".
+type DirStore struct {
+	dir string
+
+	mu sync.Mutex // serializes updates to state files
+}
+
+// NewDirStore returns a [DirStore] that keeps uploads in dir, creating the
+// directory if it does not exist.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// dirState is the encoded state of an upload. The offset of an upload is
+// the size of its data file, so it is not recorded.
+type dirState struct {
+	Length      int64  `json:"length"`
+	Complete    bool   `json:"complete,omitempty"`
+	Target      string `json:"target,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+func (s *DirStore) path(id, suffix string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, id+suffix), nil
+}
+
+// Create implements part of the [Store] interface.
+func (s *DirStore) Create(ctx context.Context, u Upload) (Upload, error) {
+	u.ID = rand.Text()
+	u.Offset, u.Complete = 0, false
+	data, _ := s.path(u.ID, ".data")
+	f, err := os.OpenFile(data, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return Upload{}, err
+	}
+	f.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writeState(u); err != nil {
+		os.Remove(data)
+		return Upload{}, err
+	}
+	return u, nil
+}
+
+// Get implements part of the [Store] interface.
+func (s *DirStore) Get(ctx context.Context, id string) (Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(id)
+}
+
+func (s *DirStore) get(id string) (Upload, error) {
+	path, err := s.path(id, ".json")
+	if err != nil {
+		return Upload{}, err
+	}
+	bits, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Upload{}, ErrNotFound
+	} else if err != nil {
+		return Upload{}, err
+	}
+	var st dirState
+	if err := json.Unmarshal(bits, &st); err != nil {
+		return Upload{}, fmt.Errorf("invalid state for upload %q: %w", id, err)
+	}
+	data, _ := s.path(id, ".data")
+	fi, err := os.Stat(data)
+	if err != nil {
+		return Upload{}, err
+	}
+	return Upload{
+		ID:          id,
+		Offset:      fi.Size(),
+		Length:      st.Length,
+		Complete:    st.Complete,
+		Target:      st.Target,
+		ContentType: st.ContentType,
+	}, nil
+}
+
+// writeState atomically replaces the state file for u. The caller must hold
+// s.mu.
+func (s *DirStore) writeState(u Upload) error {
+	bits, err := json.Marshal(dirState{
+		Length:      u.Length,
+		Complete:    u.Complete,
+		Target:      u.Target,
+		ContentType: u.ContentType,
+	})
+	if err != nil {
+		return err
+	}
+	path, _ := s.path(u.ID, ".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bits, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Append implements part of the [Store] interface.
+func (s *DirStore) Append(ctx context.Context, id string, offset int64, r io.Reader, complete bool) (Upload, error) {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return Upload{}, err
+	} else if u.Complete {
+		return u, ErrCompleted
+	} else if offset != u.Offset {
+		return u, fmt.Errorf("%w: offset is %d, not %d", ErrOffsetMismatch, u.Offset, offset)
+	}
+
+	data, _ := s.path(id, ".data")
+	f, err := os.OpenFile(data, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return u, err
+	}
+	n, cerr := io.Copy(f, r)
+	serr := f.Sync()
+	if err := errors.Join(serr, f.Close()); err != nil {
+		return u, err
+	}
+	u.Offset += n
+	if cerr != nil {
+		return u, cerr
+	}
+	if complete {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		u.Complete, u.Length = true, u.Offset
+		if err := s.writeState(u); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// Open implements part of the [Store] interface.
+func (s *DirStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	path, err := s.path(id, ".data")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete implements part of the [Store] interface.
+func (s *DirStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.path(id, ".json")
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	data, _ := s.path(id, ".data")
+	return os.Remove(data)
+}
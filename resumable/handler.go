@@ -0,0 +1,385 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package resumable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/mhttp"
+)
+
+// Handler is an [http.Handler] that implements resumable uploads.
+//
+// A request with an Upload-Complete header creates an upload, whatever its
+// method and path, except for a request to an upload resource. Upload
+// resources have paths beginning with Prefix followed by the upload ID, and
+// support HEAD, PATCH, and DELETE requests. Other requests are delegated to
+// the underlying handler.
+//
+// When an upload is complete, the handler calls Done to produce the response
+// to the request that completed it. The upload remains in the Store after it
+// is complete, so that a client that did not receive the response can learn
+// that the upload is complete; the application should delete it from the
+// Store when it is no longer needed.
+//
+// If a client appends to an upload while a previous append to the same
+// upload is still in progress, for example because the client lost its
+// connection and the server has not yet noticed, the handler interrupts the
+// previous append before starting the new one.
+type Handler struct {
+	// Handler is the underlying handler for requests that do not use the
+	// resumable upload protocol. If nil, such requests are rejected with
+	// status 404 (Not Found).
+	Handler http.Handler
+
+	// Store holds the content of uploads. It must not be nil.
+	Store Store
+
+	// Prefix is the URL path prefix of upload resources, for example
+	// "/uploads/". It must not be empty.
+	Prefix string
+
+	// MaxSize, if positive, is the maximum length of an upload in bytes.
+	MaxSize int64
+
+	// Done, if set, is called when an upload is complete to write the
+	// response to the request that completed it, with a reader for the
+	// content of the upload. If Done is nil, the handler responds with status
+	// 201 (Created) if the upload was completed by the request that created
+	// it, or 204 (No Content) otherwise.
+	Done func(w http.ResponseWriter, r *http.Request, u Upload, content io.Reader)
+
+	mu     sync.Mutex
+	active map[string]*activeAppend
+}
+
+// activeAppend records an append in progress, so that it can be interrupted.
+type activeAppend struct {
+	stop func()        // interrupts the append
+	done chan struct{} // closed when the append has finished
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rest, ok := strings.CutPrefix(r.URL.Path, h.Prefix); ok && h.Prefix != "" {
+		if rest == "" || strings.Contains(rest, "/") {
+			mhttp.NewProblem(http.StatusNotFound, "").ServeHTTP(w, r)
+			return
+		}
+		h.serveUpload(w, r, rest)
+		return
+	}
+	if r.Header.Get("Upload-Complete") != "" {
+		h.create(w, r)
+		return
+	}
+	if h.Handler == nil {
+		mhttp.NewProblem(http.StatusNotFound, "").ServeHTTP(w, r)
+		return
+	}
+	h.Handler.ServeHTTP(w, r)
+}
+
+func (h *Handler) serveUpload(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodHead:
+		u, err := h.Store.Get(r.Context(), id)
+		if err != nil {
+			storeError(err).ServeHTTP(w, r)
+			return
+		}
+		setState(w.Header(), u)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPatch:
+		h.append(w, r, id)
+
+	case http.MethodDelete:
+		// Interrupt an append in progress, if any.
+		h.acquire(id, nil)()
+		if err := h.Store.Delete(r.Context(), id); err != nil {
+			storeError(err).ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "HEAD, PATCH, DELETE")
+		mhttp.NewProblem(http.StatusMethodNotAllowed, "").ServeHTTP(w, r)
+	}
+}
+
+// create handles a request that creates an upload.
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	complete, err := parseBool(r.Header.Get("Upload-Complete"))
+	if err != nil {
+		mhttp.NewProblem(http.StatusBadRequest, "invalid Upload-Complete: "+err.Error()).ServeHTTP(w, r)
+		return
+	}
+	length, err := h.uploadLength(r, 0, complete)
+	if err != nil {
+		problem(http.StatusBadRequest, ProblemInconsistentUploadLength, err.Error()).ServeHTTP(w, r)
+		return
+	} else if h.MaxSize > 0 && length > h.MaxSize {
+		mhttp.NewProblem(http.StatusRequestEntityTooLarge, "upload is too large").ServeHTTP(w, r)
+		return
+	}
+
+	u, err := h.Store.Create(r.Context(), Upload{
+		Length:      length,
+		Target:      r.URL.Path,
+		ContentType: r.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		storeError(err).ServeHTTP(w, r)
+		return
+	}
+	location := h.Prefix + u.ID
+	defer h.acquire(u.ID, interrupter(w))()
+
+	// Report the location of the upload before reading the content, so that
+	// the client can resume if the transfer fails.
+	w.Header().Set("Location", location)
+	w.WriteHeader(StatusUploadResumptionSupported)
+
+	u, ok := h.appendBody(w, r, u, complete, length)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", location)
+	if u.Complete {
+		h.done(w, r, u, http.StatusCreated)
+		return
+	}
+	setState(w.Header(), u)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// append handles a PATCH request to append to upload id.
+func (h *Handler) append(w http.ResponseWriter, r *http.Request, id string) {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != PartialUploadType {
+		mhttp.NewProblem(http.StatusUnsupportedMediaType, "content type must be "+PartialUploadType).ServeHTTP(w, r)
+		return
+	}
+	offset, err := parseInt(r.Header.Get("Upload-Offset"))
+	if err != nil {
+		mhttp.NewProblem(http.StatusBadRequest, "invalid Upload-Offset: "+err.Error()).ServeHTTP(w, r)
+		return
+	}
+	complete, err := parseBool(r.Header.Get("Upload-Complete"))
+	if err != nil {
+		mhttp.NewProblem(http.StatusBadRequest, "invalid Upload-Complete: "+err.Error()).ServeHTTP(w, r)
+		return
+	}
+
+	defer h.acquire(id, interrupter(w))()
+	u, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		storeError(err).ServeHTTP(w, r)
+		return
+	} else if u.Complete {
+		problem(http.StatusBadRequest, ProblemCompletedUpload, "upload is already complete").ServeHTTP(w, r)
+		return
+	} else if offset != u.Offset {
+		p := problem(http.StatusConflict, ProblemMismatchingOffset,
+			fmt.Sprintf("upload offset is %d, not %d", u.Offset, offset))
+		p.Extensions = map[string]any{"expected-offset": u.Offset, "provided-offset": offset}
+		p.Header = http.Header{"Upload-Offset": {fmt.Sprint(u.Offset)}}
+		p.ServeHTTP(w, r)
+		return
+	}
+
+	length, err := h.uploadLength(r, offset, complete)
+	if err != nil {
+		problem(http.StatusBadRequest, ProblemInconsistentUploadLength, err.Error()).ServeHTTP(w, r)
+		return
+	} else if u.Length >= 0 && length >= 0 && length != u.Length {
+		problem(http.StatusBadRequest, ProblemInconsistentUploadLength,
+			fmt.Sprintf("upload length is %d, not %d", u.Length, length)).ServeHTTP(w, r)
+		return
+	} else if h.MaxSize > 0 && length > h.MaxSize {
+		mhttp.NewProblem(http.StatusRequestEntityTooLarge, "upload is too large").ServeHTTP(w, r)
+		return
+	}
+	length = max(length, u.Length)
+
+	u, ok := h.appendBody(w, r, u, complete, length)
+	if !ok {
+		return
+	}
+	if u.Complete {
+		h.done(w, r, u, http.StatusNoContent)
+		return
+	}
+	setState(w.Header(), u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// appendBody appends the body of r to u, enforcing the length of the upload
+// if known and the maximum size. If it fails, it writes an error response
+// and reports false.
+func (h *Handler) appendBody(w http.ResponseWriter, r *http.Request, u Upload, complete bool, length int64) (Upload, bool) {
+	limit := int64(-1)
+	if length >= 0 && h.MaxSize > 0 {
+		limit = min(length, h.MaxSize) - u.Offset
+	} else if length >= 0 {
+		limit = length - u.Offset
+	} else if h.MaxSize > 0 {
+		limit = h.MaxSize - u.Offset
+	}
+	body := io.Reader(r.Body)
+	if limit >= 0 {
+		body = http.MaxBytesReader(w, r.Body, limit)
+		if complete && length >= 0 {
+			body = &exactReader{r: body, n: limit}
+		}
+	}
+	u, err := h.Store.Append(r.Context(), u.ID, u.Offset, body, complete)
+	if err != nil {
+		if errors.Is(err, errShortContent) {
+			problem(http.StatusBadRequest, ProblemInconsistentUploadLength,
+				fmt.Sprintf("content ends at %d, upload length is %d", u.Offset, length)).ServeHTTP(w, r)
+			return u, false
+		}
+		if mbe := (*http.MaxBytesError)(nil); errors.As(err, &mbe) {
+			if length >= 0 {
+				problem(http.StatusBadRequest, ProblemInconsistentUploadLength,
+					"content exceeds the upload length").ServeHTTP(w, r)
+			} else {
+				mhttp.NewProblem(http.StatusRequestEntityTooLarge, "upload is too large").ServeHTTP(w, r)
+			}
+			return u, false
+		}
+		storeError(err).ServeHTTP(w, r)
+		return u, false
+	}
+	return u, true
+}
+
+// errShortContent is reported by an exactReader whose input ends early.
+var errShortContent = errors.New("content is shorter than the upload length")
+
+// exactReader reports errShortContent if its input ends before n bytes have
+// been read, so that a Store does not mark such an upload complete.
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	nr, err := e.r.Read(p)
+	e.n -= int64(nr)
+	if err == io.EOF && e.n > 0 {
+		err = errShortContent
+	}
+	return nr, err
+}
+
+// uploadLength returns the total length of the upload declared by r, whose
+// content begins at offset, or -1 if r does not declare it. The length is
+// given by the Upload-Length header, or implied by the Content-Length of a
+// request that completes the upload.
+func (h *Handler) uploadLength(r *http.Request, offset int64, complete bool) (int64, error) {
+	length := int64(-1)
+	if s := r.Header.Get("Upload-Length"); s != "" {
+		n, err := parseInt(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Upload-Length: %w", err)
+		}
+		length = n
+	}
+	if complete && r.ContentLength >= 0 {
+		n := offset + r.ContentLength
+		if length >= 0 && n != length {
+			return 0, fmt.Errorf("content ends at %d, upload length is %d", n, length)
+		}
+		length = n
+	}
+	return length, nil
+}
+
+// done writes the response for a complete upload.
+func (h *Handler) done(w http.ResponseWriter, r *http.Request, u Upload, status int) {
+	if h.Done == nil {
+		setState(w.Header(), u)
+		w.WriteHeader(status)
+		return
+	}
+	rc, err := h.Store.Open(r.Context(), u.ID)
+	if err != nil {
+		storeError(err).ServeHTTP(w, r)
+		return
+	}
+	defer rc.Close()
+	h.Done(w, r, u, rc)
+}
+
+// acquire waits until there is no append in progress to upload id, after
+// interrupting the one in progress if any, and registers a new append that
+// can be interrupted by calling stop. It returns a function that releases
+// the registration. If stop is nil, the registration cannot be interrupted.
+func (h *Handler) acquire(id string, stop func()) (release func()) {
+	cur := &activeAppend{stop: stop, done: make(chan struct{})}
+	h.mu.Lock()
+	if h.active == nil {
+		h.active = make(map[string]*activeAppend)
+	}
+	for {
+		prev := h.active[id]
+		if prev == nil {
+			break
+		}
+		h.mu.Unlock()
+		if prev.stop != nil {
+			prev.stop()
+		}
+		<-prev.done
+		h.mu.Lock()
+	}
+	h.active[id] = cur
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.active[id] == cur {
+			delete(h.active, id)
+		}
+		close(cur.done)
+	}
+}
+
+// interrupter returns a function that interrupts reading the body of the
+// request whose response is written by w.
+func interrupter(w http.ResponseWriter) func() {
+	rc := http.NewResponseController(w)
+	return func() { rc.SetReadDeadline(time.Now()) }
+}
+
+// problem returns a problem with the given status and type.
+func problem(status int, ptype, detail string) *mhttp.Problem {
+	p := mhttp.NewProblem(status, detail)
+	p.Type = ptype
+	return p
+}
+
+// storeError returns a problem describing an error reported by a Store.
+func storeError(err error) *mhttp.Problem {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return mhttp.NewProblem(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrCompleted):
+		return problem(http.StatusBadRequest, ProblemCompletedUpload, err.Error())
+	case errors.Is(err, ErrOffsetMismatch):
+		return problem(http.StatusConflict, ProblemMismatchingOffset, err.Error())
+	default:
+		return mhttp.NewProblem(http.StatusInternalServerError, err.Error())
+	}
+}
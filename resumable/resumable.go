@@ -0,0 +1,139 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+// Package resumable implements resumable uploads over HTTP, following the
+// IETF [Resumable Uploads for HTTP] draft.
+//
+// A client begins an upload by sending a request with an Upload-Complete
+// header. The server creates an upload resource and reports its location in
+// an interim 104 (Upload Resumption Supported) response, before it reads the
+// content. If the transfer is interrupted, the client retrieves the offset
+// the server has received with a HEAD request to the upload resource, and
+// sends the remaining content in a PATCH request. The client can cancel an
+// upload with a DELETE request.
+//
+// A [Handler] implements the server side of the protocol, storing uploads in
+// a [Store]. [NewDirStore] returns a Store that keeps uploads in files in a
+// local directory. A [Client] uploads content, resuming automatically after
+// failures.
+//
+// [Resumable Uploads for HTTP]: https://datatracker.ietf.org/doc/draft-ietf-httpbis-resumable-upload/
+package resumable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/creachadair/mhttp/sfv"
+)
+
+// PartialUploadType is the media type of the content of a PATCH request
+// that appends to an upload.
+const PartialUploadType = "application/partial-upload"
+
+// StatusUploadResumptionSupported is the status code of the interim response
+// by which a server reports the location of a new upload resource.
+const StatusUploadResumptionSupported = 104
+
+// Problem types defined by the draft.
+const (
+	ProblemMismatchingOffset        = "https://iana.org/assignments/http-problem-types#mismatching-upload-offset"
+	ProblemCompletedUpload          = "https://iana.org/assignments/http-problem-types#completed-upload"
+	ProblemInconsistentUploadLength = "https://iana.org/assignments/http-problem-types#inconsistent-upload-length"
+)
+
+// Upload describes the state of an upload.
+type Upload struct {
+	ID          string // the unique ID of the upload
+	Offset      int64  // the number of bytes received
+	Length      int64  // the total length of the content, or -1 if unknown
+	Complete    bool   // whether all the content has been received
+	Target      string // the path of the request that created the upload
+	ContentType string // the content type of the request that created the upload
+}
+
+// Errors reported by a [Store].
+var (
+	// ErrNotFound indicates that the requested upload does not exist.
+	ErrNotFound = errors.New("upload not found")
+
+	// ErrOffsetMismatch indicates that an append did not start at the
+	// current offset of the upload.
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+	// ErrCompleted indicates an attempt to append to a complete upload.
+	ErrCompleted = errors.New("upload is complete")
+)
+
+// A Store stores the content of uploads. Implementations must be safe for
+// concurrent use, but a [Handler] does not append to the same upload
+// concurrently.
+type Store interface {
+	// Create creates a new empty upload with the given properties, and
+	// returns its state. The ID and Offset of u are ignored.
+	Create(ctx context.Context, u Upload) (Upload, error)
+
+	// Get returns the state of the specified upload, or ErrNotFound.
+	Get(ctx context.Context, id string) (Upload, error)
+
+	// Append appends the content of r to the specified upload, starting at
+	// offset, which must equal the current offset of the upload. If complete
+	// is true, the upload is marked complete after the content is stored,
+	// and its length is set to its final offset.
+	//
+	// Append returns the updated state of the upload. If reading r fails,
+	// the content read so far is retained, and Append returns the updated
+	// state along with the error; the upload is not marked complete.
+	Append(ctx context.Context, id string, offset int64, r io.Reader, complete bool) (Upload, error)
+
+	// Open returns a reader for the content of the specified upload.
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+
+	// Delete discards the specified upload, or reports ErrNotFound.
+	Delete(ctx context.Context, id string) error
+}
+
+// parseBool parses a structured boolean header value.
+func parseBool(s string) (bool, error) {
+	it, err := sfv.ParseItem(s)
+	if err != nil {
+		return false, err
+	}
+	b, ok := it.Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("value %q is not a boolean", s)
+	}
+	return b, nil
+}
+
+// parseInt parses a structured non-negative integer header value.
+func parseInt(s string) (int64, error) {
+	it, err := sfv.ParseItem(s)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := it.Value.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("value %q is not a non-negative integer", s)
+	}
+	return n, nil
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "?1"
+	}
+	return "?0"
+}
+
+// setState sets the Upload-Offset, Upload-Complete, and, if known,
+// Upload-Length headers of h from u.
+func setState(h http.Header, u Upload) {
+	h.Set("Upload-Offset", fmt.Sprint(u.Offset))
+	h.Set("Upload-Complete", formatBool(u.Complete))
+	if u.Length >= 0 {
+		h.Set("Upload-Length", fmt.Sprint(u.Length))
+	}
+}
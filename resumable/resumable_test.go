@@ -0,0 +1,454 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package resumable_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/creachadair/mhttp/resumable"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testServer starts a server for h with a DirStore in a temporary directory.
+// If h.Done is nil, it is set to a function that echoes the content.
+func testServer(t *testing.T, h *resumable.Handler) *httptest.Server {
+	t.Helper()
+	setup(t, h)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// setup populates the Store, Prefix, and Done fields of h for testing.
+func setup(t *testing.T, h *resumable.Handler) {
+	t.Helper()
+	s, err := resumable.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirStore: unexpected error: %v", err)
+	}
+	h.Store = s
+	if h.Prefix == "" {
+		h.Prefix = "/uploads/"
+	}
+	if h.Done == nil {
+		h.Done = func(w http.ResponseWriter, r *http.Request, u resumable.Upload, content io.Reader) {
+			w.Header().Set("Target", u.Target)
+			io.Copy(w, content)
+		}
+	}
+}
+
+func mustDo(t *testing.T, method, url string, body io.Reader, hdr ...string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	for i := 0; i+1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: unexpected error: %v", method, url, err)
+	}
+	t.Cleanup(func() { rsp.Body.Close() })
+	return rsp
+}
+
+func checkStatus(t *testing.T, rsp *http.Response, want int) {
+	t.Helper()
+	if rsp.StatusCode != want {
+		body, _ := io.ReadAll(rsp.Body)
+		t.Fatalf("%s %s: got status %d, want %d\n%s",
+			rsp.Request.Method, rsp.Request.URL, rsp.StatusCode, want, body)
+	}
+}
+
+func checkHeaders(t *testing.T, rsp *http.Response, want map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	for k := range want {
+		got[k] = rsp.Header.Get(k)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Headers (-got, +want):\n%s", diff)
+	}
+}
+
+func problemType(t *testing.T, rsp *http.Response) string {
+	t.Helper()
+	var p struct {
+		Type string `json:"type"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&p); err != nil {
+		t.Fatalf("Decode problem: %v", err)
+	}
+	return p.Type
+}
+
+func TestCreateComplete(t *testing.T) {
+	srv := testServer(t, &resumable.Handler{})
+
+	const content = "hello, world"
+	rsp := mustDo(t, "POST", srv.URL+"/files/greeting", strings.NewReader(content), "Upload-Complete", "?1")
+	checkStatus(t, rsp, http.StatusOK)
+	if got, err := io.ReadAll(rsp.Body); err != nil || string(got) != content {
+		t.Errorf("Body: got %q, %v; want %q", got, err, content)
+	}
+	checkHeaders(t, rsp, map[string]string{"Target": "/files/greeting"})
+}
+
+func TestNotResumable(t *testing.T) {
+	srv := testServer(t, &resumable.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	})
+
+	checkStatus(t, mustDo(t, "POST", srv.URL+"/other", strings.NewReader("x")), http.StatusTeapot)
+	checkStatus(t, mustDo(t, "HEAD", srv.URL+"/uploads/nonesuch", nil), http.StatusNotFound)
+	checkStatus(t, mustDo(t, "GET", srv.URL+"/uploads/", nil), http.StatusNotFound)
+}
+
+func TestIncremental(t *testing.T) {
+	srv := testServer(t, &resumable.Handler{})
+
+	// Create an upload with some of its content.
+	rsp := mustDo(t, "POST", srv.URL+"/target", strings.NewReader("abc"),
+		"Upload-Complete", "?0", "Upload-Length", "9")
+	checkStatus(t, rsp, http.StatusCreated)
+	checkHeaders(t, rsp, map[string]string{
+		"Upload-Offset": "3", "Upload-Complete": "?0", "Upload-Length": "9",
+	})
+	loc := rsp.Header.Get("Location")
+	if !strings.HasPrefix(loc, "/uploads/") {
+		t.Fatalf("Location: got %q, want /uploads/...", loc)
+	}
+	url := srv.URL + loc
+
+	rsp = mustDo(t, "HEAD", url, nil)
+	checkStatus(t, rsp, http.StatusNoContent)
+	checkHeaders(t, rsp, map[string]string{
+		"Upload-Offset": "3", "Upload-Complete": "?0", "Upload-Length": "9",
+		"Cache-Control": "no-store",
+	})
+
+	t.Run("WrongType", func(t *testing.T) {
+		rsp := mustDo(t, "PATCH", url, strings.NewReader("def"),
+			"Upload-Offset", "3", "Upload-Complete", "?0")
+		checkStatus(t, rsp, http.StatusUnsupportedMediaType)
+	})
+	t.Run("WrongOffset", func(t *testing.T) {
+		rsp := mustDo(t, "PATCH", url, strings.NewReader("def"),
+			"Content-Type", resumable.PartialUploadType,
+			"Upload-Offset", "5", "Upload-Complete", "?0")
+		checkStatus(t, rsp, http.StatusConflict)
+		checkHeaders(t, rsp, map[string]string{"Upload-Offset": "3"})
+		if got := problemType(t, rsp); got != resumable.ProblemMismatchingOffset {
+			t.Errorf("Problem type: got %q, want %q", got, resumable.ProblemMismatchingOffset)
+		}
+	})
+	t.Run("WrongLength", func(t *testing.T) {
+		rsp := mustDo(t, "PATCH", url, strings.NewReader("def"),
+			"Content-Type", resumable.PartialUploadType,
+			"Upload-Offset", "3", "Upload-Complete", "?1")
+		checkStatus(t, rsp, http.StatusBadRequest)
+		if got := problemType(t, rsp); got != resumable.ProblemInconsistentUploadLength {
+			t.Errorf("Problem type: got %q, want %q", got, resumable.ProblemInconsistentUploadLength)
+		}
+	})
+	t.Run("Method", func(t *testing.T) {
+		rsp := mustDo(t, "PUT", url, strings.NewReader("def"))
+		checkStatus(t, rsp, http.StatusMethodNotAllowed)
+		checkHeaders(t, rsp, map[string]string{"Allow": "HEAD, PATCH, DELETE"})
+	})
+
+	rsp = mustDo(t, "PATCH", url, strings.NewReader("def"),
+		"Content-Type", resumable.PartialUploadType,
+		"Upload-Offset", "3", "Upload-Complete", "?0")
+	checkStatus(t, rsp, http.StatusNoContent)
+	checkHeaders(t, rsp, map[string]string{"Upload-Offset": "6", "Upload-Complete": "?0"})
+
+	rsp = mustDo(t, "PATCH", url, strings.NewReader("ghi"),
+		"Content-Type", resumable.PartialUploadType,
+		"Upload-Offset", "6", "Upload-Complete", "?1")
+	checkStatus(t, rsp, http.StatusOK)
+	if got, _ := io.ReadAll(rsp.Body); string(got) != "abcdefghi" {
+		t.Errorf("Body: got %q, want %q", got, "abcdefghi")
+	}
+
+	// The completed upload remains until it is deleted.
+	rsp = mustDo(t, "HEAD", url, nil)
+	checkStatus(t, rsp, http.StatusNoContent)
+	checkHeaders(t, rsp, map[string]string{"Upload-Offset": "9", "Upload-Complete": "?1"})
+
+	rsp = mustDo(t, "PATCH", url, strings.NewReader("jkl"),
+		"Content-Type", resumable.PartialUploadType,
+		"Upload-Offset", "9", "Upload-Complete", "?1")
+	checkStatus(t, rsp, http.StatusBadRequest)
+	if got := problemType(t, rsp); got != resumable.ProblemCompletedUpload {
+		t.Errorf("Problem type: got %q, want %q", got, resumable.ProblemCompletedUpload)
+	}
+
+	var c resumable.Client
+	if err := c.Cancel(t.Context(), url); err != nil {
+		t.Errorf("Cancel: unexpected error: %v", err)
+	}
+	checkStatus(t, mustDo(t, "HEAD", url, nil), http.StatusNotFound)
+	if err := c.Cancel(t.Context(), url); err == nil {
+		t.Error("Cancel of deleted upload: got nil, want error")
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	srv := testServer(t, &resumable.Handler{MaxSize: 5})
+
+	t.Run("Declared", func(t *testing.T) {
+		rsp := mustDo(t, "POST", srv.URL+"/x", strings.NewReader("abcdef"), "Upload-Complete", "?1")
+		checkStatus(t, rsp, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("Undeclared", func(t *testing.T) {
+		// Hide the length of the content so the server must count it.
+		body := io.MultiReader(strings.NewReader("abcdef"))
+		rsp := mustDo(t, "POST", srv.URL+"/x", body, "Upload-Complete", "?0")
+		checkStatus(t, rsp, http.StatusRequestEntityTooLarge)
+	})
+
+	// An upload created without a length cannot declare a larger one later.
+	rsp := mustDo(t, "POST", srv.URL+"/x", strings.NewReader("abc"), "Upload-Complete", "?0")
+	checkStatus(t, rsp, http.StatusCreated)
+	url := srv.URL + rsp.Header.Get("Location")
+
+	t.Run("PatchLength", func(t *testing.T) {
+		rsp := mustDo(t, "PATCH", url, strings.NewReader("def"),
+			"Content-Type", resumable.PartialUploadType,
+			"Upload-Offset", "3", "Upload-Complete", "?0", "Upload-Length", "9")
+		checkStatus(t, rsp, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("PatchComplete", func(t *testing.T) {
+		rsp := mustDo(t, "PATCH", url, strings.NewReader("defghi"),
+			"Content-Type", resumable.PartialUploadType,
+			"Upload-Offset", "3", "Upload-Complete", "?1")
+		checkStatus(t, rsp, http.StatusRequestEntityTooLarge)
+	})
+	checkHeaders(t, mustDo(t, "HEAD", url, nil), map[string]string{"Upload-Offset": "3"})
+}
+
+// failReader reads from a ReadSeeker, but fails once when it reaches offset
+// failAt, after waiting for ready to be closed.
+type failReader struct {
+	io.ReadSeeker
+	pos    int64
+	failAt int64
+	ready  <-chan struct{}
+}
+
+var errInterrupted = errors.New("interrupted")
+
+func (f *failReader) Read(p []byte) (int, error) {
+	if f.failAt >= 0 {
+		if f.pos == f.failAt {
+			<-f.ready
+			f.failAt = -1
+			return 0, errInterrupted
+		}
+		p = p[:min(int64(len(p)), f.failAt-f.pos)]
+	}
+	n, err := f.ReadSeeker.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *failReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.ReadSeeker.Seek(offset, whence)
+	f.pos = pos
+	return pos, err
+}
+
+func TestClientResume(t *testing.T) {
+	h := &resumable.Handler{}
+	setup(t, h)
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method]++
+		mu.Unlock()
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 8192) // 128KiB
+
+	// Wait until the client has received the location of the upload before
+	// interrupting the transfer, so that it has something to resume.
+	ready := make(chan struct{})
+	var once sync.Once
+	ctx := httptrace.WithClientTrace(t.Context(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+			if code == resumable.StatusUploadResumptionSupported {
+				once.Do(func() { close(ready) })
+			}
+			return nil
+		},
+	})
+	body := &failReader{
+		ReadSeeker: bytes.NewReader(content),
+		failAt:     int64(len(content) / 2),
+		ready:      ready,
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", srv.URL+"/files/big", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	c := &resumable.Client{RetryDelay: time.Millisecond}
+	rsp, err := c.Upload(req, body, int64(len(content)))
+	if err != nil {
+		t.Fatalf("Upload: unexpected error: %v", err)
+	}
+	defer rsp.Body.Close()
+	checkStatus(t, rsp, http.StatusOK)
+	got, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("Read body: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Body: got %d bytes, want %d bytes matching the content", len(got), len(content))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if diff := cmp.Diff(requests, map[string]int{"PUT": 1, "HEAD": 1, "PATCH": 1}); diff != "" {
+		t.Errorf("Requests (-got, +want):\n%s", diff)
+	}
+}
+
+func TestClientGiveUp(t *testing.T) {
+	// A server that accepts no content and fails every append.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Upload-Offset", "0")
+		w.Header().Set("Upload-Complete", "?0")
+		switch r.Method {
+		case "HEAD":
+			w.WriteHeader(http.StatusNoContent)
+		case "POST":
+			w.Header().Set("Location", "/uploads/x")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "broken", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(t.Context(), "POST", srv.URL+"/x", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	c := &resumable.Client{MaxRetries: 3, RetryDelay: time.Millisecond}
+	rsp, err := c.Upload(req, strings.NewReader("data"), 4)
+	if err == nil {
+		rsp.Body.Close()
+		t.Fatalf("Upload: got %s, want error", rsp.Status)
+	} else if !strings.Contains(err.Error(), "giving up") {
+		t.Errorf("Upload: got %v, want giving up", err)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/uploads/x")
+		if r.Method == "POST" {
+			w.WriteHeader(resumable.StatusUploadResumptionSupported)
+		}
+		w.Header().Set("Upload-Offset", "0")
+		w.Header().Set("Upload-Complete", "?0")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", srv.URL+"/x", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	c := &resumable.Client{RetryDelay: time.Hour}
+	rsp, err := c.Upload(req, strings.NewReader("data"), 4)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Upload: got (%v, %v), want %v", rsp, err, context.DeadlineExceeded)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	ctx := t.Context()
+	s, err := resumable.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirStore: unexpected error: %v", err)
+	}
+	u, err := s.Create(ctx, resumable.Upload{Length: -1, Target: "/t", ContentType: "text/plain"})
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+
+	// A failed read retains the content read before the failure.
+	r := io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errInterrupted))
+	u, err = s.Append(ctx, u.ID, 0, r, true)
+	if !errors.Is(err, errInterrupted) {
+		t.Errorf("Append: got %v, want %v", err, errInterrupted)
+	}
+	if u.Offset != 3 || u.Complete {
+		t.Errorf("Append: got offset %d complete %v, want 3, false", u.Offset, u.Complete)
+	}
+	if _, err := s.Append(ctx, u.ID, 1, strings.NewReader("x"), false); !errors.Is(err, resumable.ErrOffsetMismatch) {
+		t.Errorf("Append at 1: got %v, want %v", err, resumable.ErrOffsetMismatch)
+	}
+	if _, err := s.Append(ctx, u.ID, 3, strings.NewReader("def"), true); err != nil {
+		t.Errorf("Append at 3: unexpected error: %v", err)
+	}
+
+	got, err := s.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	want := resumable.Upload{
+		ID: u.ID, Offset: 6, Length: 6, Complete: true, Target: "/t", ContentType: "text/plain",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Get (-got, +want):\n%s", diff)
+	}
+	if _, err := s.Append(ctx, u.ID, 6, strings.NewReader("x"), true); !errors.Is(err, resumable.ErrCompleted) {
+		t.Errorf("Append after complete: got %v, want %v", err, resumable.ErrCompleted)
+	}
+
+	rc, err := s.Open(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "abcdef" {
+		t.Errorf("Content: got %q, want %q", data, "abcdef")
+	}
+
+	if err := s.Delete(ctx, u.ID); err != nil {
+		t.Errorf("Delete: unexpected error: %v", err)
+	}
+	for _, id := range []string{u.ID, "../escape", ""} {
+		if _, err := s.Get(ctx, id); !errors.Is(err, resumable.ErrNotFound) {
+			t.Errorf("Get %q: got %v, want %v", id, err, resumable.ErrNotFound)
+		}
+	}
+}
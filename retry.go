@@ -0,0 +1,245 @@
+package mhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryCountHeader is the name of the response header in which a
+// [RetryTransport] reports the number of times it retried a request.
+const RetryCountHeader = "X-Retry-Count"
+
+// Defaults for the fields of a [RetryTransport].
+const (
+	DefaultMaxRetries = 3
+	DefaultBaseDelay  = 100 * time.Millisecond
+	DefaultMaxDelay   = 30 * time.Second
+)
+
+// A RetryTransport is an [http.RoundTripper] that retries requests that fail
+// with a connection error or with a status of 429 (Too Many Requests) or 503
+// (Service Unavailable).
+//
+// Only requests that are safe to repeat are retried: those with an
+// idempotent method (GET, HEAD, OPTIONS, TRACE, PUT, and DELETE), and those
+// with any other method that carry an Idempotency-Key header. A request with
+// a body is retried only if its GetBody field is set, so that the body can be
+// rewound; [http.NewRequest] does this for common body types. Only errors
+// from the network connection, such as a refused or reset connection, a
+// timeout, or a connection closed before the response was complete, are
+// retried; those caused by cancellation of the request context or by failure
+// to verify a server certificate are not, and neither are errors that would
+// recur, such as an unsupported URL scheme.
+//
+// If a 429 or 503 response has a Retry-After header, the transport waits for
+// the duration it specifies before retrying. Otherwise, it waits for an
+// exponentially increasing delay with random jitter. If the delay exceeds
+// MaxDelay, or would extend past the deadline of the request context, the
+// transport stops and returns the last response or error. The context
+// deadline thus serves as a budget for the request including all retries.
+//
+// When the transport has retried a request, it reports the number of retries
+// in the [RetryCountHeader] of the response it returns.
+type RetryTransport struct {
+	// Base is the underlying transport. If nil, [http.DefaultTransport] is used.
+	Base http.RoundTripper
+
+	// MaxRetries is the maximum number of times a request is retried.
+	// If zero, DefaultMaxRetries is used. If negative, requests are not retried.
+	MaxRetries int
+
+	// BaseDelay is the initial backoff delay, which doubles after each retry.
+	// If zero, DefaultBaseDelay is used.
+	BaseDelay time.Duration
+
+	// MaxDelay is the longest the transport will wait before a retry. It caps
+	// the backoff delay; a Retry-After longer than MaxDelay ends retries.
+	// If zero, DefaultMaxDelay is used.
+	MaxDelay time.Duration
+}
+
+// RoundTrip implements the [http.RoundTripper] interface.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	maxRetries := t.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	if !isRetryable(req) {
+		maxRetries = 0
+	}
+
+	ctx := req.Context()
+	for n := 0; ; n++ {
+		areq := req
+		if n > 0 {
+			areq = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("rewind body: %w", err)
+				}
+				areq.Body = body
+			}
+		}
+		rsp, err := base.RoundTrip(areq)
+
+		var delay time.Duration
+		if err != nil {
+			if n >= maxRetries || !isRetryableError(ctx, err) {
+				return nil, retryError(err, n)
+			}
+			delay = t.backoff(n)
+		} else {
+			if n >= maxRetries || (rsp.StatusCode != http.StatusTooManyRequests &&
+				rsp.StatusCode != http.StatusServiceUnavailable) {
+				return withRetryCount(rsp, n), nil
+			}
+			if ra := rsp.Header.Get("Retry-After"); ra != "" {
+				d, err := ParseRetryAfter(ra, responseDate(rsp))
+				if err != nil || d > t.maxDelay() {
+					return withRetryCount(rsp, n), nil
+				}
+				delay = d
+			} else {
+				delay = t.backoff(n)
+			}
+		}
+
+		if dl, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(dl) {
+			// The budget does not permit waiting for another attempt.
+			if err != nil {
+				return nil, retryError(err, n)
+			}
+			return withRetryCount(rsp, n), nil
+		}
+		if rsp != nil {
+			// Drain a little of the body so the connection may be reused.
+			io.CopyN(io.Discard, rsp.Body, 4<<10)
+			rsp.Body.Close()
+		}
+		tm := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			tm.Stop()
+			return nil, ctx.Err()
+		case <-tm.C:
+		}
+	}
+}
+
+func (t *RetryTransport) maxDelay() time.Duration {
+	if t.MaxDelay > 0 {
+		return t.MaxDelay
+	}
+	return DefaultMaxDelay
+}
+
+// backoff returns a jittered delay before retry number n+1: a random value
+// between half and all of BaseDelay·2ⁿ, capped at MaxDelay.
+func (t *RetryTransport) backoff(n int) time.Duration {
+	d := t.BaseDelay
+	if d <= 0 {
+		d = DefaultBaseDelay
+	}
+	for i := 0; i < n && d < t.maxDelay(); i++ {
+		d *= 2
+	}
+	d = min(d, t.maxDelay())
+	return d/2 + rand.N(d/2+1)
+}
+
+// withRetryCount records the retry count n in rsp, if n > 0.
+func withRetryCount(rsp *http.Response, n int) *http.Response {
+	if n > 0 {
+		rsp.Header.Set(RetryCountHeader, strconv.Itoa(n))
+	}
+	return rsp
+}
+
+// retryError annotates err with the retry count n, if n > 0.
+func retryError(err error, n int) error {
+	if n > 0 {
+		return fmt.Errorf("after %d retries: %w", n, err)
+	}
+	return err
+}
+
+// isRetryable reports whether req may be safely retried.
+func isRetryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// isRetryableError reports whether a transport error may be retried, which
+// it may if it is a failure of the network connection.
+func isRetryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var cerr *tls.CertificateVerificationError
+	if errors.As(err, &cerr) {
+		return false
+	}
+	var operr *net.OpError
+	var nerr net.Error
+	switch {
+	case errors.As(err, &operr):
+		return true
+	case errors.As(err, &nerr) && nerr.Timeout():
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true // the connection closed before the response arrived
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE)
+}
+
+// responseDate returns the time from the Date header of rsp, or the current
+// time if it has none.
+func responseDate(rsp *http.Response) time.Time {
+	if t, err := ParseHTTPDate(rsp.Header.Get("Date")); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// ParseRetryAfter parses the contents of a Retry-After header and returns the
+// delay it specifies. The header may be a number of seconds or an HTTP-date;
+// a date is taken relative to now, which should be the time from the Date
+// header of the response if it has one. A date in the past is a zero delay.
+func ParseRetryAfter(s string, now time.Time) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s != "" && strings.Trim(s, "0123456789") == "" {
+		secs, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || secs > maxDelta {
+			secs = maxDelta // clamp, as for Cache-Control deltas
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	t, err := ParseHTTPDate(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Retry-After %q", s)
+	}
+	return max(t.Sub(now), 0), nil
+}
@@ -0,0 +1,273 @@
+package mhttp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"0", 0},
+		{"120", 2 * time.Minute},
+		{" 5 ", 5 * time.Second},
+		{"99999999999999999999", (1 << 31) * time.Second},
+		{"Sun, 18 Oct 2026 12:00:30 GMT", 30 * time.Second},
+		{"Sunday, 18-Oct-26 12:01:00 GMT", time.Minute},
+		{"Sun, 18 Oct 2026 11:00:00 GMT", 0},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseRetryAfter(tc.input, now)
+		if err != nil {
+			t.Errorf("ParseRetryAfter(%q): unexpected error: %v", tc.input, err)
+		} else if got != tc.want {
+			t.Errorf("ParseRetryAfter(%q): got %v, want %v", tc.input, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "-1", "1.5", "soon", "Sun, 18 Oct 2026"} {
+		if got, err := mhttp.ParseRetryAfter(bad, now); err == nil {
+			t.Errorf("ParseRetryAfter(%q): got %v, want error", bad, got)
+		}
+	}
+}
+
+// flakyServer returns a server that responds with the given statuses in
+// order, then with 200 OK, and that counts the requests it receives. Each
+// response body echoes the request body.
+func flakyServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(n.Add(1)) - 1
+		body, _ := io.ReadAll(r.Body)
+		if i < len(statuses) {
+			for k, vs := range header {
+				w.Header()[k] = vs
+			}
+			w.WriteHeader(statuses[i])
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func TestRetryTransport(t *testing.T) {
+	fast := &mhttp.RetryTransport{BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	cli := &http.Client{Transport: fast}
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		srv, n := flakyServer(t, http.Header{"Retry-After": {"0"}}, 503, 429)
+		rsp, err := cli.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			t.Errorf("Status: got %d, want 200", rsp.StatusCode)
+		}
+		if got := rsp.Header.Get(mhttp.RetryCountHeader); got != "2" {
+			t.Errorf("Retry count: got %q, want 2", got)
+		}
+		if got := n.Load(); got != 3 {
+			t.Errorf("Server saw %d requests, want 3", got)
+		}
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		srv, n := flakyServer(t, nil, 503, 503)
+		rsp, err := cli.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK || n.Load() != 3 {
+			t.Errorf("Got status %d after %d requests, want 200 after 3", rsp.StatusCode, n.Load())
+		}
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		srv, n := flakyServer(t, nil, 503, 503, 503, 503, 503)
+		rsp, err := cli.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Status: got %d, want 503", rsp.StatusCode)
+		}
+		if got := rsp.Header.Get(mhttp.RetryCountHeader); got != "3" {
+			t.Errorf("Retry count: got %q, want 3", got)
+		}
+		if got := n.Load(); got != 4 {
+			t.Errorf("Server saw %d requests, want 4", got)
+		}
+	})
+
+	t.Run("NoRetryStatus", func(t *testing.T) {
+		srv, n := flakyServer(t, nil, 500)
+		rsp, err := cli.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != 500 || n.Load() != 1 || rsp.Header.Get(mhttp.RetryCountHeader) != "" {
+			t.Errorf("Got status %d after %d requests, want 500 after 1", rsp.StatusCode, n.Load())
+		}
+	})
+
+	t.Run("LongRetryAfter", func(t *testing.T) {
+		srv, n := flakyServer(t, http.Header{"Retry-After": {"3600"}}, 429)
+		rsp, err := cli.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != 429 || n.Load() != 1 {
+			t.Errorf("Got status %d after %d requests, want 429 after 1", rsp.StatusCode, n.Load())
+		}
+	})
+
+	t.Run("Budget", func(t *testing.T) {
+		srv, n := flakyServer(t, http.Header{"Retry-After": {"1"}}, 503)
+		slow := &http.Client{Transport: &mhttp.RetryTransport{MaxDelay: time.Minute}}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		start := time.Now()
+		rsp, err := slow.Do(req)
+		if err != nil {
+			t.Fatalf("Do: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != 503 || n.Load() != 1 {
+			t.Errorf("Got status %d after %d requests, want 503 after 1", rsp.StatusCode, n.Load())
+		}
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Errorf("Request took %v, should not have waited", elapsed)
+		}
+	})
+
+	t.Run("PostWithoutKey", func(t *testing.T) {
+		srv, n := flakyServer(t, nil, 503)
+		rsp, err := cli.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("Post: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != 503 || n.Load() != 1 {
+			t.Errorf("Got status %d after %d requests, want 503 after 1", rsp.StatusCode, n.Load())
+		}
+	})
+
+	t.Run("PostWithKey", func(t *testing.T) {
+		srv, n := flakyServer(t, nil, 503, 503)
+		req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("hello"))
+		req.Header.Set("Idempotency-Key", `"abc"`)
+		rsp, err := cli.Do(req)
+		if err != nil {
+			t.Fatalf("Do: unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != 200 || n.Load() != 3 {
+			t.Errorf("Got status %d after %d requests, want 200 after 3", rsp.StatusCode, n.Load())
+		}
+		if string(body) != "hello" {
+			t.Errorf("Body: got %q, want hello (not rewound?)", body)
+		}
+	})
+
+	t.Run("NoGetBody", func(t *testing.T) {
+		srv, n := flakyServer(t, nil, 503)
+		req, _ := http.NewRequest("PUT", srv.URL, io.NopCloser(strings.NewReader("data")))
+		rsp, err := cli.Do(req)
+		if err != nil {
+			t.Fatalf("Do: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != 503 || n.Load() != 1 {
+			t.Errorf("Got status %d after %d requests, want 503 after 1", rsp.StatusCode, n.Load())
+		}
+	})
+
+	t.Run("TransportError", func(t *testing.T) {
+		srv, _ := flakyServer(t, nil)
+		var calls int
+		errConn := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+		rt := &mhttp.RetryTransport{
+			BaseDelay: time.Millisecond,
+			Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				if calls < 3 {
+					return nil, errConn
+				}
+				return http.DefaultTransport.RoundTrip(req)
+			}),
+		}
+		rsp, err := (&http.Client{Transport: rt}).Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		rsp.Body.Close()
+		if got := rsp.Header.Get(mhttp.RetryCountHeader); got != "2" {
+			t.Errorf("Retry count: got %q, want 2", got)
+		}
+
+		calls = -10
+		_, err = (&http.Client{Transport: rt}).Get(srv.URL)
+		if !errors.Is(err, errConn) {
+			t.Errorf("Get: got error %v, want %v", err, errConn)
+		} else if !strings.Contains(err.Error(), "after 3 retries") {
+			t.Errorf("Get: error %q does not report retries", err)
+		}
+	})
+
+	t.Run("NotConnectionError", func(t *testing.T) {
+		var calls int
+		rt := &mhttp.RetryTransport{
+			BaseDelay: time.Millisecond,
+			Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				return http.DefaultTransport.RoundTrip(req)
+			}),
+		}
+		_, err := (&http.Client{Transport: rt}).Get("gopher://example.com/")
+		if err == nil || !strings.Contains(err.Error(), "unsupported protocol scheme") {
+			t.Errorf("Get: got error %v, want unsupported protocol scheme", err)
+		}
+		if calls != 1 {
+			t.Errorf("Got %d attempts, want 1", calls)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		srv, _ := flakyServer(t, http.Header{"Retry-After": {"10"}}, 503)
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := &http.Client{Transport: &mhttp.RetryTransport{MaxDelay: time.Minute}}
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		time.AfterFunc(50*time.Millisecond, cancel)
+		if rsp, err := slow.Do(req); !errors.Is(err, context.Canceled) {
+			t.Errorf("Do: got %v, %v; want %v", rsp, err, context.Canceled)
+		}
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,320 @@
+package mhttp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A ServerTimingMetric is a single metric from a [Server-Timing] header.
+//
+// [Server-Timing]: https://www.w3.org/TR/server-timing/
+type ServerTimingMetric struct {
+	Name        string        // the name of the metric; a token
+	Duration    time.Duration // the duration of the metric, or 0 if not given
+	Description string        // a human-readable description, if given
+}
+
+// String renders m as a metric for a Server-Timing header. The duration is
+// given in milliseconds, to microsecond precision, and omitted if it is 0.
+func (m ServerTimingMetric) String() string {
+	var sb strings.Builder
+	sb.WriteString(m.Name)
+	if m.Duration != 0 {
+		ms := float64(m.Duration.Round(time.Microsecond)) / float64(time.Millisecond)
+		sb.WriteString(";dur=" + strconv.FormatFloat(ms, 'f', -1, 64))
+	}
+	if m.Description != "" {
+		sb.WriteString(";desc=" + tokenOrQuoted(m.Description))
+	}
+	return sb.String()
+}
+
+// FormatServerTiming renders the contents of a Server-Timing header for the
+// given metrics.
+func FormatServerTiming(metrics ...ServerTimingMetric) string {
+	ss := make([]string, len(metrics))
+	for i, m := range metrics {
+		ss[i] = m.String()
+	}
+	return strings.Join(ss, ", ")
+}
+
+// ParseServerTiming parses the contents of a Server-Timing header. If a
+// response has multiple Server-Timing header lines, the caller should join
+// them with commas. As the specification requires, parameters other than
+// dur and desc are ignored, only the first occurrence of each is used, and a
+// duration that is not a number is treated as 0. A duration too large to
+// represent as a [time.Duration] is also treated as 0.
+func ParseServerTiming(s string) ([]ServerTimingMetric, error) {
+	var out []ServerTimingMetric
+	for _, elt := range splitList(s) {
+		parts := splitQuoted(elt, ';')
+		m := ServerTimingMetric{Name: parts[0]}
+		if !isToken(m.Name) {
+			return nil, fmt.Errorf("invalid metric name %q", m.Name)
+		}
+		var seen []string
+		for _, p := range parts[1:] {
+			name, value, _, err := parseParam(p)
+			if err != nil {
+				return nil, fmt.Errorf("metric %q: %w", m.Name, err)
+			} else if slices.Contains(seen, name) {
+				continue
+			}
+			seen = append(seen, name)
+			switch name {
+			case "dur":
+				m.Duration = parseTimingDuration(value)
+			case "desc":
+				m.Description = value
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// parseTimingDuration parses a dur parameter, a number of milliseconds. It
+// returns 0 if s is not a number, or is out of range for a time.Duration.
+func parseTimingDuration(s string) time.Duration {
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(ms) {
+		return 0
+	}
+	ns := ms * float64(time.Millisecond)
+	if ns >= math.MaxInt64 || ns <= math.MinInt64 {
+		return 0
+	}
+	return time.Duration(ns)
+}
+
+// ResponseServerTiming parses the Server-Timing metrics of rsp, from both its
+// header and its trailer. Because the trailer is not available until the
+// body of the response has been read to the end, the caller should read and
+// close the body before calling ResponseServerTiming.
+func ResponseServerTiming(rsp *http.Response) ([]ServerTimingMetric, error) {
+	vs := slices.Concat(rsp.Header.Values("Server-Timing"), rsp.Trailer.Values("Server-Timing"))
+	return ParseServerTiming(strings.Join(vs, ", "))
+}
+
+// A ServerTiming records the metrics reported by a [ServerTimingHandler] for
+// a request. Use [ServerTimingFromContext] to obtain the recorder for a
+// request. A ServerTiming is safe for concurrent use.
+//
+// The methods of a nil *ServerTiming do nothing, so that handlers may record
+// metrics without checking whether timings are reported for the request.
+type ServerTiming struct {
+	mu      sync.Mutex
+	metrics []*timingEntry
+}
+
+type timingEntry struct {
+	ServerTimingMetric
+	start    time.Time // zero if the metric is not running
+	reported bool
+}
+
+// Start starts a metric with the given name and description, and returns a
+// function that stops it. The duration of the metric is the time from the
+// call of Start to the first call of the stop function, or to the end of the
+// request if the stop function is not called. Start panics if name is not a
+// valid token.
+func (t *ServerTiming) Start(name, desc string) (stop func()) {
+	if t == nil {
+		return func() {}
+	}
+	e := t.add(name, 0, desc, time.Now())
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		e.stop(time.Now())
+	}
+}
+
+// Record records a metric with the given name, duration, and description,
+// measured by the caller. Record panics if name is not a valid token.
+func (t *ServerTiming) Record(name string, d time.Duration, desc string) {
+	if t != nil {
+		t.add(name, d, desc, time.Time{})
+	}
+}
+
+// add adds a metric to t, running from start if start is not zero.
+func (t *ServerTiming) add(name string, d time.Duration, desc string, start time.Time) *timingEntry {
+	if !isToken(name) {
+		panic(fmt.Sprintf("invalid metric name %q", name))
+	}
+	e := &timingEntry{
+		ServerTimingMetric: ServerTimingMetric{Name: name, Duration: d, Description: desc},
+		start:              start,
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = append(t.metrics, e)
+	return e
+}
+
+// stop stops e at now, if it is running. The caller must hold the lock.
+func (e *timingEntry) stop(now time.Time) {
+	if !e.start.IsZero() {
+		e.Duration = now.Sub(e.start)
+		e.start = time.Time{}
+	}
+}
+
+// take returns the stopped metrics of t that have not already been taken, in
+// the order they were started, and reports whether any metrics are still
+// running. If final is true, running metrics are stopped first.
+func (t *ServerTiming) take(final bool) (_ []ServerTimingMetric, running bool) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []ServerTimingMetric
+	for _, e := range t.metrics {
+		if final {
+			e.stop(now)
+		}
+		if !e.start.IsZero() {
+			running = true
+		} else if !e.reported {
+			e.reported = true
+			out = append(out, e.ServerTimingMetric)
+		}
+	}
+	return out, running
+}
+
+type serverTimingKey struct{}
+
+// ServerTimingFromContext returns the [ServerTiming] recorder attached to ctx
+// by a [ServerTimingHandler], or nil if there is none.
+func ServerTimingFromContext(ctx context.Context) *ServerTiming {
+	t, _ := ctx.Value(serverTimingKey{}).(*ServerTiming)
+	return t
+}
+
+// A ServerTimingHandler is an [http.Handler] that attaches a [ServerTiming]
+// recorder to the context of each request it reports timings for, and
+// reports the metrics recorded by the underlying handler in a
+// [Server-Timing] header.
+//
+// Metrics that are stopped before the underlying handler writes the response
+// header are reported in the header. If metrics are still running when the
+// header is written, as when streaming a response, the response declares a
+// Server-Timing trailer, and the remaining metrics are reported in it when
+// the handler returns. A trailer cannot be sent over HTTP/1.1 if the handler
+// sets a Content-Length, nor over HTTP/1.0, so the remaining metrics are then
+// lost.
+//
+// Timings may reveal information about the implementation of a service to
+// its clients, so consider using Allow to report them only to trusted
+// clients, for example with [ClientInPrefixes].
+//
+// [Server-Timing]: https://www.w3.org/TR/server-timing/
+type ServerTimingHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+
+	// Allow, if non-nil, reports whether to report timings for a request.
+	// If nil, timings are reported for all requests.
+	Allow func(*http.Request) bool
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h ServerTimingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Allow != nil && !h.Allow(r) {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+	t := new(ServerTiming)
+	tw := &timingWriter{ResponseWriter: w, t: t}
+	h.Handler.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, t)))
+
+	rest, _ := t.take(true)
+	if len(rest) == 0 {
+		return
+	} else if !tw.wrote {
+		// The handler did not write a response, so the header is still
+		// pending and can carry all the metrics.
+		w.Header().Set("Server-Timing", FormatServerTiming(rest...))
+	} else if tw.trailer {
+		// The server sends the value of a declared trailer from the header
+		// map, replacing the metrics already sent in the header.
+		w.Header().Set("Server-Timing", FormatServerTiming(rest...))
+	} else {
+		w.Header().Set(http.TrailerPrefix+"Server-Timing", FormatServerTiming(rest...))
+	}
+}
+
+// timingWriter is an [http.ResponseWriter] that adds the stopped metrics of
+// a ServerTiming to the response header when it is written.
+type timingWriter struct {
+	http.ResponseWriter
+
+	t       *ServerTiming
+	wrote   bool // the response header was written
+	trailer bool // the response header declared a Server-Timing trailer
+}
+
+// Unwrap supports [http.ResponseController].
+func (tw *timingWriter) Unwrap() http.ResponseWriter { return tw.ResponseWriter }
+
+// WriteHeader implements part of [http.ResponseWriter].
+func (tw *timingWriter) WriteHeader(code int) {
+	if !tw.wrote && code >= 200 {
+		tw.wrote = true
+		ms, running := tw.t.take(false)
+		if len(ms) != 0 {
+			tw.Header().Set("Server-Timing", FormatServerTiming(ms...))
+		}
+		if running {
+			// Declare the trailer, so that the server does not send a
+			// Content-Length that would prevent it.
+			tw.Header().Add("Trailer", "Server-Timing")
+			tw.trailer = true
+		}
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements part of [http.ResponseWriter].
+func (tw *timingWriter) Write(data []byte) (int, error) {
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(data)
+}
+
+// Flush implements the [http.Flusher] interface.
+func (tw *timingWriter) Flush() { tw.FlushError() }
+
+// FlushError flushes buffered data to the client, and supports
+// [http.ResponseController].
+func (tw *timingWriter) FlushError() error {
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+// ClientInPrefixes returns a function that reports whether the IP address of
+// the client of a request, taken from its RemoteAddr, is in any of the given
+// prefixes. It is suitable for the Allow field of a [ServerTimingHandler].
+// To use the address of the original client behind trusted proxies, wrap
+// the handler in a [ForwardedHandler].
+func ClientInPrefixes(prefixes ...netip.Prefix) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		addr := peerNode(r.RemoteAddr).Addr.Unmap()
+		return addr.IsValid() && slices.ContainsFunc(prefixes, func(p netip.Prefix) bool {
+			return p.Contains(addr)
+		})
+	}
+}
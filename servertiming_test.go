@@ -0,0 +1,186 @@
+package mhttp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []mhttp.ServerTimingMetric
+		ok    bool
+	}{
+		{"", nil, true},
+		{"miss", []mhttp.ServerTimingMetric{{Name: "miss"}}, true},
+		{`db;dur=53, app;dur=47.2;desc="App \"render\"", cache;desc=Cache;dur=0.5`, []mhttp.ServerTimingMetric{
+			{Name: "db", Duration: 53 * time.Millisecond},
+			{Name: "app", Duration: 47200 * time.Microsecond, Description: `App "render"`},
+			{Name: "cache", Duration: 500 * time.Microsecond, Description: "Cache"},
+		}, true},
+		{"db ; dur = 1 ; dur=2 ; other=x", []mhttp.ServerTimingMetric{
+			{Name: "db", Duration: time.Millisecond},
+		}, true},
+
+		// An unusable duration is treated as 0, and the metric is kept.
+		{"db;dur=x;desc=a, NaN;dur=NaN, inf;dur=Inf, big;dur=1e300, ok;dur=2", []mhttp.ServerTimingMetric{
+			{Name: "db", Description: "a"},
+			{Name: "NaN"},
+			{Name: "inf"},
+			{Name: "big"},
+			{Name: "ok", Duration: 2 * time.Millisecond},
+		}, true},
+
+		{"d b;dur=1", nil, false},
+		{`db;desc="unterminated`, nil, false},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseServerTiming(tc.input)
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("Parse %q: got %+v, want error", tc.input, got)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("Parse %q (-got, +want):\n%s", tc.input, diff)
+		}
+	}
+}
+
+func TestFormatServerTiming(t *testing.T) {
+	ms := []mhttp.ServerTimingMetric{
+		{Name: "db", Duration: 12345678 * time.Nanosecond, Description: "Database query"},
+		{Name: "hit", Description: "cache"},
+	}
+	got := mhttp.FormatServerTiming(ms...)
+	const want = `db;dur=12.346;desc="Database query", hit;desc=cache`
+	if got != want {
+		t.Errorf("FormatServerTiming:\ngot  %s\nwant %s", got, want)
+	}
+	back, err := mhttp.ParseServerTiming(got)
+	if err != nil {
+		t.Fatalf("ParseServerTiming: unexpected error: %v", err)
+	}
+	ms[0].Duration = 12346 * time.Microsecond
+	if diff := cmp.Diff(back, ms); diff != "" {
+		t.Errorf("Round trip (-got, +want):\n%s", diff)
+	}
+}
+
+func TestServerTimingHandler(t *testing.T) {
+	names := func(ms []mhttp.ServerTimingMetric) []string {
+		var out []string
+		for _, m := range ms {
+			out = append(out, m.Name)
+		}
+		return out
+	}
+	srv := httptest.NewServer(mhttp.ServerTimingHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			st := mhttp.ServerTimingFromContext(r.Context())
+			st.Record("auth", time.Millisecond, "")
+			stop := st.Start("db", "query")
+			time.Sleep(time.Millisecond)
+			stop()
+			stop() // no effect
+			rest := st.Start("render", "")
+			if r.URL.Query().Get("stream") != "" {
+				w.Write([]byte("partial "))
+				http.NewResponseController(w).Flush()
+			}
+			w.Write([]byte("done"))
+			_ = rest // never stopped; ends with the request
+		}),
+		Allow: mhttp.ClientInPrefixes(netip.MustParsePrefix("127.0.0.0/8")),
+	})
+	defer srv.Close()
+
+	tests := []struct {
+		path        string
+		wantHeader  []string
+		wantTrailer []string
+	}{
+		{"/", []string{"auth", "db"}, []string{"render"}},
+		{"/?stream=1", []string{"auth", "db"}, []string{"render"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			rsp, err := srv.Client().Get(srv.URL + tc.path)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+
+			hdr, err := mhttp.ParseServerTiming(rsp.Header.Get("Server-Timing"))
+			if err != nil {
+				t.Fatalf("Parse header: %v", err)
+			}
+			if diff := cmp.Diff(names(hdr), tc.wantHeader); diff != "" {
+				t.Errorf("Header metrics (-got, +want):\n%s", diff)
+			}
+			if hdr[1].Duration < time.Millisecond || hdr[1].Description != "query" {
+				t.Errorf("Metric db: got %+v, want ≥ 1ms with description", hdr[1])
+			}
+			tr, err := mhttp.ParseServerTiming(rsp.Trailer.Get("Server-Timing"))
+			if err != nil {
+				t.Fatalf("Parse trailer: %v", err)
+			}
+			if diff := cmp.Diff(names(tr), tc.wantTrailer); diff != "" {
+				t.Errorf("Trailer metrics (-got, +want):\n%s", diff)
+			}
+			all, err := mhttp.ResponseServerTiming(rsp)
+			if err != nil {
+				t.Fatalf("ResponseServerTiming: %v", err)
+			}
+			if diff := cmp.Diff(names(all), append(tc.wantHeader, tc.wantTrailer...)); diff != "" {
+				t.Errorf("All metrics (-got, +want):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("NoWrite", func(t *testing.T) {
+		h := mhttp.ServerTimingHandler{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mhttp.ServerTimingFromContext(r.Context()).Start("idle", "")
+			}),
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if ms, err := mhttp.ParseServerTiming(rec.Header().Get("Server-Timing")); err != nil || len(ms) != 1 || ms[0].Name != "idle" {
+			t.Errorf("Server-Timing: got %+v, %v; want idle", ms, err)
+		}
+	})
+
+	t.Run("NotAllowed", func(t *testing.T) {
+		h := mhttp.ServerTimingHandler{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				st := mhttp.ServerTimingFromContext(r.Context())
+				if st != nil {
+					t.Error("Recorder attached for a request that is not allowed")
+				}
+				st.Start("x", "")() // a nil recorder does nothing
+				st.Record("y", time.Second, "")
+			}),
+			Allow: mhttp.ClientInPrefixes(netip.MustParsePrefix("10.0.0.0/8")),
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "[::ffff:192.0.2.1]:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Server-Timing"); got != "" {
+			t.Errorf("Server-Timing: got %q, want empty", got)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FormatItem serializes an [Item] as a structured field value.
+func FormatItem(it Item) (string, error) {
+	var sb strings.Builder
+	if err := writeItem(&sb, it); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// FormatList serializes a [List] as a structured field value.
+// An empty list is serialized as "".
+func FormatList(l List) (string, error) {
+	var sb strings.Builder
+	for i, m := range l {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if err := writeMember(&sb, m); err != nil {
+			return "", fmt.Errorf("member %d: %w", i, err)
+		}
+	}
+	return sb.String(), nil
+}
+
+// FormatDictionary serializes a [Dictionary] as a structured field value.
+// An empty dictionary is serialized as "".
+func FormatDictionary(d Dictionary) (string, error) {
+	var sb strings.Builder
+	for i, e := range d {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if err := writeKey(&sb, e.Key); err != nil {
+			return "", err
+		}
+		// An item whose value is true is written as its key alone.
+		if it, ok := e.Value.(Item); ok && it.Value == true {
+			if err := writeParams(&sb, it.Params); err != nil {
+				return "", fmt.Errorf("key %q: %w", e.Key, err)
+			}
+			continue
+		}
+		sb.WriteByte('=')
+		if err := writeMember(&sb, e.Value); err != nil {
+			return "", fmt.Errorf("key %q: %w", e.Key, err)
+		}
+	}
+	return sb.String(), nil
+}
+
+func writeMember(sb *strings.Builder, m Member) error {
+	switch t := m.(type) {
+	case Item:
+		return writeItem(sb, t)
+	case InnerList:
+		return writeInnerList(sb, t)
+	default:
+		return fmt.Errorf("invalid member type %T", m)
+	}
+}
+
+func writeInnerList(sb *strings.Builder, il InnerList) error {
+	sb.WriteByte('(')
+	for i, it := range il.Items {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		if err := writeItem(sb, it); err != nil {
+			return err
+		}
+	}
+	sb.WriteByte(')')
+	return writeParams(sb, il.Params)
+}
+
+func writeItem(sb *strings.Builder, it Item) error {
+	if err := writeBareItem(sb, it.Value); err != nil {
+		return err
+	}
+	return writeParams(sb, it.Params)
+}
+
+func writeParams(sb *strings.Builder, ps Params) error {
+	for _, p := range ps {
+		sb.WriteByte(';')
+		if err := writeKey(sb, p.Key); err != nil {
+			return err
+		}
+		if p.Value == true {
+			continue
+		}
+		sb.WriteByte('=')
+		if err := writeBareItem(sb, p.Value); err != nil {
+			return fmt.Errorf("parameter %q: %w", p.Key, err)
+		}
+	}
+	return nil
+}
+
+func writeKey(sb *strings.Builder, key string) error {
+	if key == "" || (!isLCAlpha(key[0]) && key[0] != '*') {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	for i := 1; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	sb.WriteString(key)
+	return nil
+}
+
+func writeBareItem(sb *strings.Builder, v any) error {
+	switch t := v.(type) {
+	case int:
+		return writeInteger(sb, int64(t))
+	case int64:
+		return writeInteger(sb, t)
+	case float64:
+		return writeDecimal(sb, t)
+	case string:
+		return writeString(sb, t)
+	case Token:
+		return writeToken(sb, t)
+	case []byte:
+		sb.WriteByte(':')
+		sb.WriteString(base64.StdEncoding.EncodeToString(t))
+		sb.WriteByte(':')
+	case bool:
+		if t {
+			sb.WriteString("?1")
+		} else {
+			sb.WriteString("?0")
+		}
+	case time.Time:
+		sb.WriteByte('@')
+		return writeInteger(sb, t.Unix())
+	case DisplayString:
+		return writeDisplayString(sb, t)
+	default:
+		return fmt.Errorf("invalid value type %T", v)
+	}
+	return nil
+}
+
+func writeInteger(sb *strings.Builder, v int64) error {
+	if v < -maxInteger || v > maxInteger {
+		return fmt.Errorf("integer %d out of range", v)
+	}
+	sb.WriteString(strconv.FormatInt(v, 10))
+	return nil
+}
+
+func writeDecimal(sb *strings.Builder, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("invalid decimal %v", v)
+	}
+	r := math.RoundToEven(v*1000) / 1000
+	if math.Abs(math.Trunc(r)) > maxDecimalInt {
+		return fmt.Errorf("decimal %v out of range", v)
+	}
+	s := strconv.FormatFloat(r, 'f', 3, 64)
+	s = strings.TrimRight(s, "0")
+	if strings.HasSuffix(s, ".") {
+		s += "0"
+	}
+	if s == "-0.0" {
+		s = "0.0"
+	}
+	sb.WriteString(s)
+	return nil
+}
+
+func writeString(sb *strings.Builder, s string) error {
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return fmt.Errorf("invalid string character %q", c)
+		} else if c == '"' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteByte('"')
+	return nil
+}
+
+func writeToken(sb *strings.Builder, t Token) error {
+	if t == "" || (!isAlpha(t[0]) && t[0] != '*') {
+		return fmt.Errorf("invalid token %q", t)
+	}
+	for i := 1; i < len(t); i++ {
+		if !isTokenChar(t[i]) {
+			return fmt.Errorf("invalid token %q", t)
+		}
+	}
+	sb.WriteString(string(t))
+	return nil
+}
+
+func writeDisplayString(sb *strings.Builder, s DisplayString) error {
+	if !utf8.ValidString(string(s)) {
+		return fmt.Errorf("display string is not valid UTF-8")
+	}
+	const hex = "0123456789abcdef"
+	sb.WriteString(`%"`)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' || c == '"' || c < 0x20 || c > 0x7e {
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&0xf])
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return nil
+}
@@ -0,0 +1,432 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package sfv
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseItem parses s as a structured field whose value is an [Item].
+func ParseItem(s string) (Item, error) {
+	p := &parser{input: s}
+	p.skipSP()
+	it, err := p.parseItem()
+	if err != nil {
+		return Item{}, err
+	}
+	return it, p.finish()
+}
+
+// ParseList parses s as a structured field whose value is a [List].
+// An empty field value is an empty list.
+func ParseList(s string) (List, error) {
+	p := &parser{input: s}
+	p.skipSP()
+	var out List
+	for !p.eof() {
+		m, err := p.parseMember()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// ParseDictionary parses s as a structured field whose value is a
+// [Dictionary]. An empty field value is an empty dictionary. If a key occurs
+// more than once, the last value given for it is kept, in the position of
+// the first occurrence.
+func ParseDictionary(s string) (Dictionary, error) {
+	p := &parser{input: s}
+	p.skipSP()
+	var out Dictionary
+	for !p.eof() {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var m Member
+		if p.consume('=') {
+			m, err = p.parseMember()
+		} else {
+			var params Params
+			params, err = p.parseParams()
+			m = Item{Value: true, Params: params}
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.Set(key, m)
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// parser is a parser for structured field values.
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.input) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.peek() == c && !p.eof() {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSP() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) skipOWS() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.pos++
+	}
+}
+
+func (p *parser) fail(msg string, args ...any) error {
+	return fmt.Errorf("offset %d: %s", p.pos, fmt.Sprintf(msg, args...))
+}
+
+// finish checks that only trailing spaces remain in the input.
+func (p *parser) finish() error {
+	p.skipSP()
+	if !p.eof() {
+		return p.fail("unexpected %q after value", p.peek())
+	}
+	return nil
+}
+
+// nextMember advances past the separator after a list or dictionary member.
+func (p *parser) nextMember() error {
+	p.skipOWS()
+	if p.eof() {
+		return nil
+	} else if !p.consume(',') {
+		return p.fail("expected ',' after member, got %q", p.peek())
+	}
+	p.skipOWS()
+	if p.eof() {
+		return p.fail("trailing comma")
+	}
+	return nil
+}
+
+func (p *parser) parseMember() (Member, error) {
+	if p.peek() == '(' {
+		return p.parseInnerList()
+	}
+	return p.parseItem()
+}
+
+func (p *parser) parseInnerList() (InnerList, error) {
+	if !p.consume('(') {
+		return InnerList{}, p.fail("expected '('")
+	}
+	items := []Item{}
+	for !p.eof() {
+		p.skipSP()
+		if p.consume(')') {
+			params, err := p.parseParams()
+			if err != nil {
+				return InnerList{}, err
+			}
+			return InnerList{Items: items, Params: params}, nil
+		}
+		it, err := p.parseItem()
+		if err != nil {
+			return InnerList{}, err
+		}
+		items = append(items, it)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return InnerList{}, p.fail("expected ' ' or ')' in inner list, got %q", c)
+		}
+	}
+	return InnerList{}, p.fail("unterminated inner list")
+}
+
+func (p *parser) parseItem() (Item, error) {
+	v, err := p.parseBareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := p.parseParams()
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{Value: v, Params: params}, nil
+}
+
+func (p *parser) parseParams() (Params, error) {
+	var out Params
+	for p.consume(';') {
+		p.skipSP()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var v any = true
+		if p.consume('=') {
+			v, err = p.parseBareItem()
+			if err != nil {
+				return nil, err
+			}
+		}
+		out.Set(key, v)
+	}
+	return out, nil
+}
+
+func (p *parser) parseKey() (string, error) {
+	if c := p.peek(); !isLCAlpha(c) && c != '*' {
+		return "", p.fail("invalid key start %q", c)
+	}
+	start := p.pos
+	for !p.eof() && isKeyChar(p.peek()) {
+		p.pos++
+	}
+	return p.input[start:p.pos], nil
+}
+
+func (p *parser) parseBareItem() (any, error) {
+	switch c := p.peek(); {
+	case c == '-' || isDigit(c):
+		return p.parseNumber()
+	case c == '"':
+		return p.parseString()
+	case c == '*' || isAlpha(c):
+		return p.parseToken(), nil
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	case c == '@':
+		return p.parseDate()
+	case c == '%':
+		return p.parseDisplayString()
+	case p.eof():
+		return nil, p.fail("missing value")
+	default:
+		return nil, p.fail("invalid value start %q", c)
+	}
+}
+
+func (p *parser) parseNumber() (any, error) {
+	start := p.pos
+	p.consume('-')
+	if !isDigit(p.peek()) {
+		return nil, p.fail("missing digits in number")
+	}
+	digits, dot := 0, -1
+	for !p.eof() {
+		c := p.peek()
+		if c == '.' && dot < 0 {
+			if digits > 12 {
+				return nil, p.fail("integer part of decimal too long")
+			}
+			dot = digits
+		} else if !isDigit(c) {
+			break
+		} else {
+			digits++
+		}
+		p.pos++
+		if dot < 0 && digits > 15 {
+			return nil, p.fail("integer too long")
+		} else if dot >= 0 && digits > 15 {
+			return nil, p.fail("decimal too long")
+		}
+	}
+	text := p.input[start:p.pos]
+	if dot < 0 {
+		return strconv.ParseInt(text, 10, 64)
+	} else if frac := digits - dot; frac == 0 {
+		return nil, p.fail("decimal ends with '.'")
+	} else if frac > 3 {
+		return nil, p.fail("decimal has too many fractional digits")
+	}
+	return strconv.ParseFloat(text, 64)
+}
+
+func (p *parser) parseString() (string, error) {
+	if !p.consume('"') {
+		return "", p.fail("expected '\"'")
+	}
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == '\\':
+			if p.eof() {
+				return "", p.fail("unterminated escape")
+			}
+			next := p.peek()
+			if next != '"' && next != '\\' {
+				return "", p.fail("invalid escape %q", next)
+			}
+			p.pos++
+			sb.WriteByte(next)
+		case c == '"':
+			return sb.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.fail("invalid string character %q", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.fail("unterminated string")
+}
+
+func (p *parser) parseToken() Token {
+	start := p.pos
+	p.pos++ // the first character was checked by the caller
+	for !p.eof() && isTokenChar(p.peek()) {
+		p.pos++
+	}
+	return Token(p.input[start:p.pos])
+}
+
+func (p *parser) parseByteSequence() ([]byte, error) {
+	if !p.consume(':') {
+		return nil, p.fail("expected ':'")
+	}
+	end := strings.IndexByte(p.input[p.pos:], ':')
+	if end < 0 {
+		return nil, p.fail("unterminated byte sequence")
+	}
+	text := p.input[p.pos : p.pos+end]
+	for i := 0; i < len(text); i++ {
+		if !isBase64Char(text[i]) {
+			return nil, p.fail("invalid byte sequence character %q", text[i])
+		}
+	}
+	// Per RFC 9651 Section 4.2.7, do not insist on padding, but padding must
+	// not appear in the middle of the sequence.
+	body := strings.TrimRight(text, "=")
+	if strings.Contains(body, "=") {
+		return nil, p.fail("invalid padding in byte sequence")
+	}
+	data, err := base64.RawStdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, p.fail("invalid byte sequence: %v", err)
+	}
+	p.pos += end + 1
+	return data, nil
+}
+
+func (p *parser) parseBoolean() (bool, error) {
+	if !p.consume('?') {
+		return false, p.fail("expected '?'")
+	}
+	switch {
+	case p.consume('1'):
+		return true, nil
+	case p.consume('0'):
+		return false, nil
+	default:
+		return false, p.fail("invalid boolean")
+	}
+}
+
+func (p *parser) parseDate() (any, error) {
+	if !p.consume('@') {
+		return nil, p.fail("expected '@'")
+	}
+	v, err := p.parseNumber()
+	if err != nil {
+		return nil, err
+	}
+	sec, ok := v.(int64)
+	if !ok {
+		return nil, p.fail("date must be an integer")
+	}
+	return Date(sec), nil
+}
+
+func (p *parser) parseDisplayString() (DisplayString, error) {
+	if !p.consume('%') || !p.consume('"') {
+		return "", p.fail(`expected '%%"'`)
+	}
+	var buf []byte
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c < 0x20 || c > 0x7e:
+			return "", p.fail("invalid display string character %q", c)
+		case c == '%':
+			if p.pos+2 > len(p.input) {
+				return "", p.fail("truncated percent escape")
+			}
+			hi, lo := unhex(p.input[p.pos]), unhex(p.input[p.pos+1])
+			if hi < 0 || lo < 0 {
+				return "", p.fail("invalid percent escape %q", p.input[p.pos:p.pos+2])
+			}
+			p.pos += 2
+			buf = append(buf, byte(hi<<4|lo))
+		case c == '"':
+			if !utf8.Valid(buf) {
+				return "", errors.New("display string is not valid UTF-8")
+			}
+			return DisplayString(buf), nil
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return "", p.fail("unterminated display string")
+}
+
+// unhex returns the value of a lower-case hexadecimal digit, or -1.
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	default:
+		return -1
+	}
+}
+
+func isDigit(c byte) bool   { return c >= '0' && c <= '9' }
+func isLCAlpha(c byte) bool { return c >= 'a' && c <= 'z' }
+func isAlpha(c byte) bool   { return isLCAlpha(c) || c >= 'A' && c <= 'Z' }
+
+func isKeyChar(c byte) bool {
+	return isLCAlpha(c) || isDigit(c) || strings.IndexByte("_-.*", c) >= 0
+}
+
+// isTokenChar reports whether c may appear after the first character of a
+// token: a tchar, ':', or '/'.
+func isTokenChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || strings.IndexByte("!#$%&'*+-.^_`|~:/", c) >= 0
+}
+
+func isBase64Char(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '+' || c == '/' || c == '='
+}
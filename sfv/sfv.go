@@ -0,0 +1,126 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+// Package sfv implements parsing and serialization of Structured Field
+// Values for HTTP, as defined by [RFC 9651] (which obsoletes RFC 8941).
+//
+// A structured field is an [Item], a [List], or a [Dictionary]. The bare
+// values of items and parameters have the following Go types:
+//
+//	Integer         int64
+//	Decimal         float64
+//	String          string
+//	Token           Token
+//	Byte Sequence   []byte
+//	Boolean         bool
+//	Date            time.Time
+//	Display String  DisplayString
+//
+// When formatting, a value of type int is also accepted as an Integer.
+//
+// [RFC 9651]: https://www.rfc-editor.org/rfc/rfc9651
+package sfv
+
+import "time"
+
+// A Token is a bare item value of token type, as distinct from a String.
+type Token string
+
+// A DisplayString is a bare item value of display string type, which may
+// contain arbitrary Unicode text, as distinct from a String.
+type DisplayString string
+
+// An Item is a bare value with parameters.
+type Item struct {
+	Value  any // see the package documentation for types
+	Params Params
+}
+
+// An InnerList is a list of items with parameters.
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+// A Member is an element of a [List] or the value of a [Dictionary] entry.
+// Its concrete type is either [Item] or [InnerList].
+type Member interface{ isMember() }
+
+func (Item) isMember()      {}
+func (InnerList) isMember() {}
+
+// A List is a structured field consisting of a sequence of members.
+type List []Member
+
+// A Dictionary is a structured field consisting of an ordered sequence of
+// key-value entries, with unique keys.
+type Dictionary []DictEntry
+
+// A DictEntry is a single entry in a [Dictionary].
+type DictEntry struct {
+	Key   string
+	Value Member
+}
+
+// Get returns the value of the entry in d with the given key, and reports
+// whether such an entry was found.
+func (d Dictionary) Get(key string) (Member, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set sets the value of the entry in d with the given key, adding a new
+// entry at the end if there is not one already.
+func (d *Dictionary) Set(key string, value Member) {
+	for i, e := range *d {
+		if e.Key == key {
+			(*d)[i].Value = value
+			return
+		}
+	}
+	*d = append(*d, DictEntry{Key: key, Value: value})
+}
+
+// Params are an ordered sequence of key-value parameters, with unique keys.
+type Params []Param
+
+// A Param is a single parameter.
+type Param struct {
+	Key   string
+	Value any // see the package documentation for types
+}
+
+// Get returns the value of the parameter with the given key, and reports
+// whether such a parameter was found.
+func (p Params) Get(key string) (any, bool) {
+	for _, e := range p {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set sets the value of the parameter with the given key, adding a new
+// parameter at the end if there is not one already.
+func (p *Params) Set(key string, value any) {
+	for i, e := range *p {
+		if e.Key == key {
+			(*p)[i].Value = value
+			return
+		}
+	}
+	*p = append(*p, Param{Key: key, Value: value})
+}
+
+// Range limits defined by RFC 9651.
+const (
+	maxInteger    = 999_999_999_999_999
+	maxDecimalInt = 999_999_999_999
+)
+
+// Date returns a Date bare value for the given Unix time in seconds.
+func Date(sec int64) time.Time { return time.Unix(sec, 0).UTC() }
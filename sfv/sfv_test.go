@@ -0,0 +1,317 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package sfv_test
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp/sfv"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testCase is a single case in the JSON format of the HTTP WG
+// structured-field-tests suite.
+type testCase struct {
+	Name       string   `json:"name"`
+	Raw        []string `json:"raw"`
+	HeaderType string   `json:"header_type"`
+	Expected   any      `json:"expected"`
+	MustFail   bool     `json:"must_fail"`
+	CanFail    bool     `json:"can_fail"`
+	Canonical  []string `json:"canonical"`
+}
+
+func TestVectors(t *testing.T) {
+	// The upstream suite keeps tests that only check serialisation in a
+	// subdirectory of their own.
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	} else if len(files) == 0 {
+		t.Fatal("No test vectors found")
+	}
+	ser, err := filepath.Glob("testdata/serialisation-tests/*.json")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	for _, path := range append(files, ser...) {
+		name, _ := filepath.Rel("testdata", path)
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Read vectors: %v", err)
+			}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			var cases []testCase
+			if err := dec.Decode(&cases); err != nil {
+				t.Fatalf("Decode vectors: %v", err)
+			}
+			for _, tc := range cases {
+				t.Run(tc.Name, func(t *testing.T) { runVector(t, tc) })
+			}
+		})
+	}
+}
+
+func runVector(t *testing.T, tc testCase) {
+	if tc.Raw == nil {
+		runSerialisation(t, tc)
+		return
+	}
+	input := strings.Join(tc.Raw, ", ")
+
+	var got any
+	var format func() (string, error)
+	var err error
+	switch tc.HeaderType {
+	case "item":
+		var v sfv.Item
+		v, err = sfv.ParseItem(input)
+		got, format = v, func() (string, error) { return sfv.FormatItem(v) }
+	case "list":
+		var v sfv.List
+		v, err = sfv.ParseList(input)
+		got, format = v, func() (string, error) { return sfv.FormatList(v) }
+	case "dictionary":
+		var v sfv.Dictionary
+		v, err = sfv.ParseDictionary(input)
+		got, format = v, func() (string, error) { return sfv.FormatDictionary(v) }
+	default:
+		t.Fatalf("Unknown header type %q", tc.HeaderType)
+	}
+
+	if tc.MustFail {
+		if err == nil {
+			t.Errorf("Parse %q: got %+v, want error", input, got)
+		}
+		return
+	} else if err != nil {
+		if !tc.CanFail {
+			t.Errorf("Parse %q: unexpected error: %v", input, err)
+		}
+		return
+	}
+
+	want := fromJSON(t, tc.HeaderType, tc.Expected)
+	if diff := cmp.Diff(got, want, cmpDecimal); diff != "" {
+		t.Errorf("Parse %q (-got, +want):\n%s", input, diff)
+	}
+
+	canon := input
+	if len(tc.Canonical) != 0 {
+		canon = strings.Join(tc.Canonical, ", ")
+	}
+	if out, err := format(); err != nil {
+		t.Errorf("Format: unexpected error: %v", err)
+	} else if out != canon {
+		t.Errorf("Format: got %q, want %q", out, canon)
+	}
+}
+
+// runSerialisation checks a case that has no input, and gives only the value
+// to format.
+func runSerialisation(t *testing.T, tc testCase) {
+	var out string
+	var err error
+	switch v := fromJSON(t, tc.HeaderType, tc.Expected).(type) {
+	case sfv.Item:
+		out, err = sfv.FormatItem(v)
+	case sfv.List:
+		out, err = sfv.FormatList(v)
+	case sfv.Dictionary:
+		out, err = sfv.FormatDictionary(v)
+	}
+	if tc.MustFail {
+		if err == nil {
+			t.Errorf("Format: got %q, want error", out)
+		}
+	} else if err != nil {
+		if !tc.CanFail {
+			t.Errorf("Format: unexpected error: %v", err)
+		}
+	} else if want := strings.Join(tc.Canonical, ", "); out != want {
+		t.Errorf("Format: got %q, want %q", out, want)
+	}
+}
+
+// cmpDecimal compares decimals approximately, since the expected values in
+// the JSON vectors are subject to float formatting.
+var cmpDecimal = cmp.Comparer(func(a, b float64) bool { return math.Abs(a-b) < 1e-9 })
+
+// fromJSON converts an expected value in the test vector format to the
+// corresponding sfv value.
+func fromJSON(t *testing.T, kind string, v any) any {
+	t.Helper()
+	switch kind {
+	case "item":
+		return jsonItem(t, v)
+	case "list":
+		var out sfv.List
+		for _, m := range v.([]any) {
+			out = append(out, jsonMember(t, m))
+		}
+		return out
+	case "dictionary":
+		var out sfv.Dictionary
+		for _, e := range v.([]any) {
+			pair := e.([]any)
+			out = append(out, sfv.DictEntry{Key: pair[0].(string), Value: jsonMember(t, pair[1])})
+		}
+		return out
+	}
+	panic("unknown kind " + kind)
+}
+
+func jsonMember(t *testing.T, v any) sfv.Member {
+	pair := v.([]any)
+	items, ok := pair[0].([]any)
+	if !ok {
+		return jsonItem(t, v)
+	}
+	out := sfv.InnerList{Items: []sfv.Item{}, Params: jsonParams(t, pair[1])}
+	for _, it := range items {
+		out.Items = append(out.Items, jsonItem(t, it))
+	}
+	return out
+}
+
+func jsonItem(t *testing.T, v any) sfv.Item {
+	pair := v.([]any)
+	return sfv.Item{Value: jsonBare(t, pair[0]), Params: jsonParams(t, pair[1])}
+}
+
+func jsonParams(t *testing.T, v any) sfv.Params {
+	var out sfv.Params
+	for _, p := range v.([]any) {
+		pair := p.([]any)
+		out = append(out, sfv.Param{Key: pair[0].(string), Value: jsonBare(t, pair[1])})
+	}
+	return out
+}
+
+func jsonBare(t *testing.T, v any) any {
+	t.Helper()
+	switch x := v.(type) {
+	case json.Number:
+		if strings.ContainsAny(x.String(), ".eE") {
+			f, err := x.Float64()
+			if err != nil {
+				t.Fatalf("Invalid decimal %q: %v", x, err)
+			}
+			return f
+		}
+		n, err := x.Int64()
+		if err != nil {
+			t.Fatalf("Invalid integer %q: %v", x, err)
+		}
+		return n
+	case string, bool:
+		return x
+	case map[string]any:
+		switch x["__type"] {
+		case "token":
+			return sfv.Token(x["value"].(string))
+		case "binary":
+			data, err := base32.StdEncoding.DecodeString(x["value"].(string))
+			if err != nil {
+				t.Fatalf("Invalid base32 %q: %v", x["value"], err)
+			}
+			return data
+		case "date":
+			n, err := x["value"].(json.Number).Int64()
+			if err != nil {
+				t.Fatalf("Invalid date %q: %v", x["value"], err)
+			}
+			return sfv.Date(n)
+		case "displaystring":
+			return sfv.DisplayString(x["value"].(string))
+		}
+	}
+	t.Fatalf("Unknown value %#v", v)
+	return nil
+}
+
+func TestFormat(t *testing.T) {
+	d := sfv.Dictionary{}
+	d.Set("a", sfv.Item{Value: 1})
+	d.Set("b", sfv.Item{Value: true, Params: sfv.Params{{Key: "x", Value: sfv.Token("y")}}})
+	d.Set("c", sfv.InnerList{
+		Items:  []sfv.Item{{Value: "s"}, {Value: []byte("hi")}},
+		Params: sfv.Params{{Key: "when", Value: time.Unix(1700000000, 0)}},
+	})
+	d.Set("a", sfv.Item{Value: 2.5})
+	d.Set("e", sfv.Item{Value: sfv.DisplayString(`100% "ü"`)})
+	got, err := sfv.FormatDictionary(d)
+	if err != nil {
+		t.Fatalf("FormatDictionary: unexpected error: %v", err)
+	}
+	const want = `a=2.5, b;x=y, c=("s" :aGk=:);when=@1700000000, e=%"100%25 %22%c3%bc%22"`
+	if got != want {
+		t.Errorf("FormatDictionary: got %q, want %q", got, want)
+	}
+
+	if v, ok := d.Get("c"); !ok {
+		t.Error("Get(c): not found")
+	} else if _, ok := v.(sfv.InnerList); !ok {
+		t.Errorf("Get(c): got %T, want InnerList", v)
+	}
+
+	t.Run("Decimal", func(t *testing.T) {
+		tests := []struct {
+			input float64
+			want  string
+		}{
+			{0, "0.0"},
+			{1, "1.0"},
+			{-1.5, "-1.5"},
+			{1.2345, "1.234"}, // the binary value is just below 1.2345
+			{1.0005, "1.0"},
+			{-0.0001, "0.0"},
+			{123456789012.5, "123456789012.5"},
+		}
+		for _, tc := range tests {
+			got, err := sfv.FormatItem(sfv.Item{Value: tc.input})
+			if err != nil {
+				t.Errorf("FormatItem(%v): unexpected error: %v", tc.input, err)
+			} else if got != tc.want {
+				t.Errorf("FormatItem(%v): got %q, want %q", tc.input, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			input sfv.Item
+		}{
+			{"BigInteger", sfv.Item{Value: int64(1e15)}},
+			{"BigDecimal", sfv.Item{Value: 1e12}},
+			{"NaN", sfv.Item{Value: math.NaN()}},
+			{"NonASCIIString", sfv.Item{Value: "ü"}},
+			{"ControlString", sfv.Item{Value: "a\nb"}},
+			{"BadToken", sfv.Item{Value: sfv.Token("1abc")}},
+			{"EmptyToken", sfv.Item{Value: sfv.Token("")}},
+			{"BadDisplayString", sfv.Item{Value: sfv.DisplayString("\xff")}},
+			{"BadType", sfv.Item{Value: 1 + 2i}},
+			{"BadParamKey", sfv.Item{Value: 1, Params: sfv.Params{{Key: "A", Value: 1}}}},
+			{"BadParamValue", sfv.Item{Value: 1, Params: sfv.Params{{Key: "a", Value: []int{1}}}}},
+		}
+		for _, tc := range tests {
+			if got, err := sfv.FormatItem(tc.input); err == nil {
+				t.Errorf("FormatItem %s: got %q, want error", tc.name, got)
+			}
+		}
+		if got, err := sfv.FormatDictionary(sfv.Dictionary{{Key: "", Value: sfv.Item{Value: 1}}}); err == nil {
+			t.Errorf("FormatDictionary: got %q, want error", got)
+		}
+	})
+}
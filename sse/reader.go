@@ -0,0 +1,212 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLineSize is the maximum length of a line in an event stream.
+const maxLineSize = 1 << 20
+
+// A Reader parses events from an event stream.
+type Reader struct {
+	sc      *bufio.Scanner
+	started bool // whether the first line has been read
+	lastID  string
+	retry   time.Duration
+}
+
+// NewReader returns a reader that parses events from r.
+func NewReader(r io.Reader) *Reader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxLineSize)
+	sc.Split(scanLines)
+	return &Reader{sc: sc}
+}
+
+// LastEventID returns the last event ID seen by r, or "" if none.
+func (r *Reader) LastEventID() string { return r.lastID }
+
+// Retry returns the last reconnection delay specified in the stream, or 0 if
+// none has been specified.
+func (r *Reader) Retry() time.Duration { return r.retry }
+
+// Next returns the next event in the stream. At the end of the stream, it
+// returns io.EOF; an incomplete event at the end of the stream is discarded,
+// as the standard requires.
+func (r *Reader) Next() (Event, error) {
+	var data strings.Builder
+	var hasData bool
+	var ev Event
+	for r.sc.Scan() {
+		line := r.sc.Text()
+		if !r.started {
+			line = strings.TrimPrefix(line, "\ufeff") // a leading byte order mark
+			r.started = true
+		}
+		if line == "" {
+			if !hasData {
+				ev = Event{} // nothing to dispatch
+				continue
+			}
+			ev.ID = r.lastID
+			ev.Data = strings.TrimSuffix(data.String(), "\n")
+			if ev.Type == "" {
+				ev.Type = "message"
+			}
+			return ev, nil
+		} else if line[0] == ':' {
+			continue // comment
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Type = value
+		case "data":
+			data.WriteString(value + "\n")
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				r.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+				r.retry = ev.Retry
+			}
+		}
+	}
+	if err := r.sc.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// scanLines is a [bufio.SplitFunc] for lines ending in CRLF, CR, or LF.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		} else if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		} else if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil // a CR at the end of data may be followed by LF
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Stream returns an iterator over the events sent by the server in response
+// to req, which should be a GET request. If cli == nil, [http.DefaultClient]
+// is used.
+//
+// When the connection fails or the server closes it, Stream yields an error
+// describing the failure, then waits for the reconnection delay and reissues
+// req, with a Last-Event-ID header if the server has sent an event ID. The
+// caller can stop reconnecting by breaking out of the loop. The delay is the
+// last retry interval sent by the server, or [DefaultRetry].
+//
+// If the server responds with status 204 (No Content), Stream stops. If it
+// responds with another status than 200 or a content type other than
+// text/event-stream, Stream yields an error and stops, since reconnecting
+// will not help. If the context of req ends, Stream yields its error and
+// stops.
+func Stream(cli *http.Client, req *http.Request) iter.Seq2[Event, error] {
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	return func(yield func(Event, error) bool) {
+		ctx := req.Context()
+		var lastID string
+		retry := DefaultRetry
+		for {
+			cur := req.Clone(ctx)
+			cur.Header.Set("Accept", ContentType)
+			cur.Header.Set("Cache-Control", "no-store")
+			if lastID != "" {
+				cur.Header.Set("Last-Event-ID", lastID)
+			}
+			err := streamOnce(cli, cur, &lastID, &retry, yield)
+			if errors.Is(err, errStop) {
+				return
+			} else if ctx.Err() != nil {
+				yield(Event{}, ctx.Err())
+				return
+			} else if fe := (fatalError{}); errors.As(err, &fe) {
+				yield(Event{}, fe.error)
+				return
+			} else if !yield(Event{}, err) {
+				return
+			}
+
+			t := time.NewTimer(retry)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				yield(Event{}, ctx.Err())
+				return
+			case <-t.C:
+			}
+		}
+	}
+}
+
+// errStop is reported by streamOnce when the stream should end without error.
+var errStop = errors.New("stop")
+
+// fatalError wraps an error after which Stream should not reconnect.
+type fatalError struct{ error }
+
+// streamOnce issues req and yields the events of the response, updating
+// lastID and retry as events are received. It reports why the stream ended.
+func streamOnce(cli *http.Client, req *http.Request, lastID *string, retry *time.Duration, yield func(Event, error) bool) error {
+	rsp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusNoContent {
+		return errStop
+	} else if rsp.StatusCode != http.StatusOK {
+		return fatalError{fmt.Errorf("get %s: %s", req.URL, rsp.Status)}
+	}
+	if mt, _, _ := mime.ParseMediaType(rsp.Header.Get("Content-Type")); mt != ContentType {
+		return fatalError{fmt.Errorf("get %s: unexpected content type %q", req.URL, mt)}
+	}
+
+	r := NewReader(rsp.Body)
+	r.lastID = *lastID
+	for {
+		ev, err := r.Next()
+		*lastID = r.lastID
+		if r.retry > 0 {
+			*retry = r.retry
+		}
+		if err == io.EOF {
+			return fmt.Errorf("get %s: stream closed by server", req.URL)
+		} else if err != nil {
+			return err
+		} else if !yield(ev, nil) {
+			return errStop
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+// Package sse implements the server-sent events protocol, as defined by the
+// [HTML Living Standard].
+//
+// On the server, use [NewWriter] to begin an event stream on an HTTP
+// response, and [Writer.Send] to send events. On the client, use [Stream] to
+// receive events from a server, reconnecting as needed, or use a [Reader]
+// directly to parse an event stream.
+//
+// [HTML Living Standard]: https://html.spec.whatwg.org/multipage/server-sent-events.html
+package sse
+
+import "time"
+
+// ContentType is the media type of an event stream.
+const ContentType = "text/event-stream"
+
+// DefaultRetry is the reconnection delay used by [Stream] if the server has
+// not specified one.
+const DefaultRetry = 3 * time.Second
+
+// An Event is a single server-sent event.
+type Event struct {
+	// ID is the event ID. When reading, it is the last event ID seen in the
+	// stream, which persists from one event to the next.
+	ID string
+
+	// Type is the event type. When writing, an empty type is omitted, which
+	// the client treats as "message". When reading, an event that does not
+	// specify a type has type "message".
+	Type string
+
+	// Data is the event data. It may contain line breaks.
+	Data string
+
+	// Retry, if positive, is the reconnection delay the client should use.
+	// When reading, it is set only for the event that specified it.
+	Retry time.Duration
+}
@@ -0,0 +1,249 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package sse_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creachadair/mhttp/sse"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w, err := sse.NewWriter(rec)
+	if err != nil {
+		t.Fatalf("NewWriter: unexpected error: %v", err)
+	}
+	if !rec.Flushed {
+		t.Error("NewWriter did not flush the header")
+	}
+	for _, e := range []sse.Event{
+		{Data: "hello"},
+		{ID: "1", Type: "update", Data: "line one\nline two\r\nline three"},
+		{Data: "", Retry: 2500 * time.Millisecond},
+	} {
+		if err := w.Send(e); err != nil {
+			t.Errorf("Send %+v: unexpected error: %v", e, err)
+		}
+	}
+	if err := w.Comment("ping"); err != nil {
+		t.Errorf("Comment: unexpected error: %v", err)
+	}
+	for _, e := range []sse.Event{
+		{ID: "a\nb", Data: "x"},
+		{ID: "a\x00b", Data: "x"},
+		{Type: "a\rb", Data: "x"},
+	} {
+		if err := w.Send(e); err == nil {
+			t.Errorf("Send %+v: got nil, want error", e)
+		}
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != sse.ContentType {
+		t.Errorf("Content-Type: got %q, want %q", got, sse.ContentType)
+	}
+	const want = "data: hello\n\n" +
+		"event: update\ndata: line one\ndata: line two\ndata: line three\nid: 1\n\n" +
+		"data: \nretry: 2500\n\n" +
+		":ping\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Body:\ngot:  %q\nwant: %q", got, want)
+	}
+
+	// The output of the writer can be read back.
+	r := sse.NewReader(strings.NewReader(want))
+	var got []sse.Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next: unexpected error: %v", err)
+		}
+		got = append(got, e)
+	}
+	if diff := cmp.Diff(got, []sse.Event{
+		{Type: "message", Data: "hello"},
+		{ID: "1", Type: "update", Data: "line one\nline two\nline three"},
+		{ID: "1", Type: "message", Data: "", Retry: 2500 * time.Millisecond},
+	}); diff != "" {
+		t.Errorf("Read back (-got, +want):\n%s", diff)
+	}
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []sse.Event
+	}{
+		{"Empty", "", nil},
+		{"BOM", "\ufeffdata: x\n\n", []sse.Event{{Type: "message", Data: "x"}}},
+		{"LineEndings", "data: a\rdata: b\r\ndata:c\n\r\n", []sse.Event{{Type: "message", Data: "a\nb\nc"}}},
+		{"Comments", ": hi\n:\ndata: x\n\n", []sse.Event{{Type: "message", Data: "x"}}},
+		{"NoColon", "data\ndata\ndata\n\ndata:\n\n", []sse.Event{
+			{Type: "message", Data: "\n\n"},
+			{Type: "message", Data: ""},
+		}},
+		{"SpaceOnce", "data:  two spaces\n\n", []sse.Event{{Type: "message", Data: " two spaces"}}},
+		{"NoData", "event: x\nid: 5\n\ndata: y\n\n", []sse.Event{{ID: "5", Type: "message", Data: "y"}}},
+		{"NULInID", "id: 1\ndata: a\n\nid: 2\x003\ndata: b\n\nid\ndata: c\n\n", []sse.Event{
+			{ID: "1", Type: "message", Data: "a"},
+			{ID: "1", Type: "message", Data: "b"},
+			{ID: "", Type: "message", Data: "c"},
+		}},
+		{"Retry", "retry: 1x\ndata: a\n\nretry: 250\ndata: b\n\n", []sse.Event{
+			{Type: "message", Data: "a"},
+			{Type: "message", Data: "b", Retry: 250 * time.Millisecond},
+		}},
+		{"Unknown", "foo: bar\ndata: x\n\n", []sse.Event{{Type: "message", Data: "x"}}},
+		{"Incomplete", "data: x\n\ndata: y\n", []sse.Event{{Type: "message", Data: "x"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := sse.NewReader(strings.NewReader(tc.input))
+			var got []sse.Event
+			for {
+				e, err := r.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Next: unexpected error: %v", err)
+				}
+				got = append(got, e)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("Events (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	var mu sync.Mutex
+	var lastIDs []string
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		lastIDs = append(lastIDs, sse.LastEventID(r))
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			sw, err := sse.NewWriter(w)
+			if err != nil {
+				t.Errorf("NewWriter: %v", err)
+				return
+			}
+			sw.Send(sse.Event{ID: "1", Data: "one", Retry: time.Millisecond})
+			sw.Send(sse.Event{ID: "2", Data: "two"})
+		case 2:
+			sw, err := sse.NewWriter(w)
+			if err != nil {
+				t.Errorf("NewWriter: %v", err)
+				return
+			}
+			sw.Send(sse.Event{ID: "3", Type: "last", Data: "three"})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	var got []sse.Event
+	var nerr int
+	for e, err := range sse.Stream(srv.Client(), req) {
+		if err != nil {
+			nerr++
+			continue
+		}
+		got = append(got, e)
+	}
+	if diff := cmp.Diff(got, []sse.Event{
+		{ID: "1", Type: "message", Data: "one", Retry: time.Millisecond},
+		{ID: "2", Type: "message", Data: "two"},
+		{ID: "3", Type: "last", Data: "three"},
+	}); diff != "" {
+		t.Errorf("Events (-got, +want):\n%s", diff)
+	}
+	if nerr != 2 {
+		t.Errorf("Got %d errors, want 2", nerr)
+	}
+	if diff := cmp.Diff(lastIDs, []string{"", "2", "3"}); diff != "" {
+		t.Errorf("Last-Event-ID (-got, +want):\n%s", diff)
+	}
+}
+
+func TestStreamFatal(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/text" {
+			io.WriteString(w, "data: not an event stream\n\n")
+			return
+		}
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/text", "/gone"} {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		var errs []error
+		for _, err := range sse.Stream(srv.Client(), req) {
+			errs = append(errs, err)
+		}
+		if len(errs) != 1 || errs[0] == nil {
+			t.Errorf("Stream %s: got %v, want one error", path, errs)
+		}
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw, err := sse.NewWriter(w)
+		if err != nil {
+			t.Errorf("NewWriter: %v", err)
+			return
+		}
+		sw.Send(sse.Event{Data: "hello"})
+		sw.Heartbeat(r.Context(), time.Millisecond)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	var last error
+	for e, err := range sse.Stream(srv.Client(), req) {
+		if err != nil {
+			last = err
+			continue
+		}
+		if e.Data != "hello" {
+			t.Errorf("Event: got %+v, want data hello", e)
+		}
+		cancel()
+	}
+	if !errors.Is(last, context.Canceled) {
+		t.Errorf("Stream: got error %v, want %v", last, context.Canceled)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package sse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Writer writes an event stream to an HTTP response. It is safe for
+// concurrent use by multiple goroutines.
+type Writer struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewWriter begins an event stream on w, and returns a writer for its events.
+// It sets the Content-Type and Cache-Control headers, writes the response
+// header with status 200, and flushes it to the client. The caller may set
+// other headers on w before calling NewWriter, but must not write to w
+// directly afterward.
+func NewWriter(w http.ResponseWriter) (*Writer, error) {
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set("Cache-Control", "no-cache")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, rc: rc}, nil
+}
+
+// LastEventID returns the value of the Last-Event-ID header of r, which a
+// reconnecting client sends to identify the last event it received.
+func LastEventID(r *http.Request) string { return r.Header.Get("Last-Event-ID") }
+
+// Send writes e to the stream and flushes it to the client. Data containing
+// line breaks is sent as multiple data lines. Send reports an error without
+// writing anything if the ID or type of e contains a line break, or if the ID
+// contains a NUL character, since these cannot be represented.
+func (w *Writer) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return errors.New("invalid event ID")
+	} else if strings.ContainsAny(e.Type, "\r\n") {
+		return errors.New("invalid event type")
+	}
+
+	var sb strings.Builder
+	if e.Type != "" {
+		sb.WriteString("event: " + e.Type + "\n")
+	}
+	for _, line := range splitLines(e.Data) {
+		sb.WriteString("data: " + line + "\n")
+	}
+	if e.ID != "" {
+		sb.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Retry > 0 {
+		sb.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	sb.WriteByte('\n')
+	return w.write(sb.String())
+}
+
+// Comment writes a comment to the stream and flushes it to the client.
+// Clients ignore comments, but they keep the connection active. A comment
+// containing line breaks is sent as multiple comment lines.
+func (w *Writer) Comment(text string) error {
+	var sb strings.Builder
+	for _, line := range splitLines(text) {
+		sb.WriteString(":" + line + "\n")
+	}
+	return w.write(sb.String())
+}
+
+// Heartbeat writes an empty comment to the stream at the given interval until
+// ctx ends or a write fails, and reports the error that stopped it. This keeps
+// idle connections from being closed by intermediaries. Typically it is run
+// in its own goroutine, with the context of the request.
+func (w *Writer) Heartbeat(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if err := w.Comment(""); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *Writer) write(s string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.w.Write([]byte(s)); err != nil {
+		return err
+	}
+	return w.rc.Flush()
+}
+
+// splitLines splits s into lines at CRLF, CR, or LF. An empty string is a
+// single empty line.
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
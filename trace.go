@@ -0,0 +1,403 @@
+package mhttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// A TraceID identifies a distributed trace, as defined by [W3C Trace Context].
+// The zero value is invalid.
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
+type TraceID [16]byte
+
+// IsValid reports whether id is valid, that is, not all zeroes.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// String returns the lower-case hexadecimal encoding of id.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// A SpanID identifies a span of work within a trace. The zero value is
+// invalid.
+type SpanID [8]byte
+
+// IsValid reports whether id is valid, that is, not all zeroes.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// String returns the lower-case hexadecimal encoding of id.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// TraceFlags are the flags of a trace context.
+type TraceFlags byte
+
+// TraceSampled is the flag indicating that the caller may have recorded
+// trace data for the request.
+const TraceSampled TraceFlags = 0x01
+
+// Sampled reports whether f has the [TraceSampled] flag set.
+func (f TraceFlags) Sampled() bool { return f&TraceSampled != 0 }
+
+// A TraceContext is the context of a distributed trace carried by the
+// traceparent and tracestate headers of a request, as defined by
+// [W3C Trace Context].
+//
+// [W3C Trace Context]: https://www.w3.org/TR/trace-context/
+type TraceContext struct {
+	TraceID TraceID    // the ID of the whole trace
+	SpanID  SpanID     // the ID of the span that sent the request (parent-id)
+	Flags   TraceFlags // trace flags
+	State   TraceState // vendor-specific trace state
+}
+
+// NewTraceContext returns a trace context for a new trace, with randomly
+// generated trace and span IDs.
+func NewTraceContext(sampled bool) TraceContext {
+	var tc TraceContext
+	for !tc.TraceID.IsValid() {
+		rand.Read(tc.TraceID[:])
+	}
+	if sampled {
+		tc.Flags = TraceSampled
+	}
+	return tc.NewSpan()
+}
+
+// NewSpan returns a copy of tc for a new span of the same trace, with a
+// randomly generated span ID.
+func (tc TraceContext) NewSpan() TraceContext {
+	tc.SpanID = SpanID{}
+	for !tc.SpanID.IsValid() {
+		rand.Read(tc.SpanID[:])
+	}
+	return tc
+}
+
+// IsValid reports whether tc has valid trace and span IDs.
+func (tc TraceContext) IsValid() bool { return tc.TraceID.IsValid() && tc.SpanID.IsValid() }
+
+// TraceParent returns the contents of a traceparent header for tc.
+// The result always has version 00.
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.SpanID, byte(tc.Flags))
+}
+
+// SetHeaders sets the traceparent and tracestate headers of h from tc.
+// If tc has no trace state, any tracestate header in h is removed.
+func (tc TraceContext) SetHeaders(h http.Header) {
+	h.Set("Traceparent", tc.TraceParent())
+	if s := tc.State.String(); s != "" {
+		h.Set("Tracestate", s)
+	} else {
+		h.Del("Tracestate")
+	}
+}
+
+// ParseTraceParent parses the contents of a traceparent header. The result
+// has no trace state.
+//
+// A version 00 header must have exactly the format defined for that version.
+// A header with a later version is accepted if it begins with the fields
+// defined for version 00, as the specification requires. Version ff, and
+// trace or parent IDs that are all zeroes, are invalid.
+func ParseTraceParent(s string) (TraceContext, error) {
+	s = strings.Trim(s, " \t")
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return TraceContext{}, errors.New("invalid traceparent format")
+	}
+	var version [1]byte
+	if err := decodeLowerHex(version[:], s[:2]); err != nil {
+		return TraceContext{}, fmt.Errorf("invalid traceparent version: %w", err)
+	} else if version[0] == 0xff {
+		return TraceContext{}, errors.New("invalid traceparent version ff")
+	} else if len(s) > 55 && (version[0] == 0 || s[55] != '-') {
+		return TraceContext{}, errors.New("invalid traceparent format")
+	}
+
+	var tc TraceContext
+	var flags [1]byte
+	if err := decodeLowerHex(tc.TraceID[:], s[3:35]); err != nil {
+		return TraceContext{}, fmt.Errorf("invalid trace ID: %w", err)
+	} else if !tc.TraceID.IsValid() {
+		return TraceContext{}, errors.New("invalid trace ID: all zeroes")
+	}
+	if err := decodeLowerHex(tc.SpanID[:], s[36:52]); err != nil {
+		return TraceContext{}, fmt.Errorf("invalid parent ID: %w", err)
+	} else if !tc.SpanID.IsValid() {
+		return TraceContext{}, errors.New("invalid parent ID: all zeroes")
+	}
+	if err := decodeLowerHex(flags[:], s[53:55]); err != nil {
+		return TraceContext{}, fmt.Errorf("invalid trace flags: %w", err)
+	}
+	tc.Flags = TraceFlags(flags[0])
+	return tc, nil
+}
+
+// decodeLowerHex decodes the lower-case hexadecimal string s into dst, which
+// must have exactly the length encoded by s.
+func decodeLowerHex(dst []byte, s string) error {
+	if strings.ToLower(s) != s {
+		return errors.New("not lower-case hexadecimal")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// ParseTraceHeaders parses the traceparent and tracestate headers of h.
+// It reports an error if the traceparent header is missing, repeated, or
+// invalid. An invalid tracestate header is discarded without error, as the
+// specification requires.
+func ParseTraceHeaders(h http.Header) (TraceContext, error) {
+	tps := h.Values("Traceparent")
+	if len(tps) == 0 {
+		return TraceContext{}, errors.New("no traceparent header")
+	} else if len(tps) > 1 {
+		return TraceContext{}, errors.New("multiple traceparent headers")
+	}
+	tc, err := ParseTraceParent(tps[0])
+	if err != nil {
+		return TraceContext{}, err
+	}
+	tc.State, _ = ParseTraceState(strings.Join(h.Values("Tracestate"), ","))
+	return tc, nil
+}
+
+// MaxTraceStateMembers is the maximum number of members in a [TraceState].
+const MaxTraceStateMembers = 32
+
+// maxTraceStateLen is the length of a tracestate header beyond which members
+// are discarded when it is formatted.
+const maxTraceStateLen = 512
+
+// A TraceState is the vendor-specific state of a trace, carried by the
+// tracestate header. It is an ordered list of key-value members, most
+// recently updated first. The zero value is empty and ready for use.
+// A TraceState is immutable; its methods return updated copies.
+type TraceState struct {
+	members []traceMember
+}
+
+type traceMember struct{ key, value string }
+
+// ParseTraceState parses the contents of a tracestate header. It reports an
+// error if any member is invalid, if a key is repeated, or if there are more
+// than [MaxTraceStateMembers] members.
+func ParseTraceState(s string) (TraceState, error) {
+	var ts TraceState
+	for m := range strings.SplitSeq(s, ",") {
+		m = strings.Trim(m, " \t")
+		if m == "" {
+			continue // empty members are permitted
+		}
+		key, value, ok := strings.Cut(m, "=")
+		if !ok {
+			return TraceState{}, fmt.Errorf("invalid tracestate member %q", m)
+		} else if err := checkTraceMember(key, value); err != nil {
+			return TraceState{}, err
+		} else if _, dup := ts.Get(key); dup {
+			return TraceState{}, fmt.Errorf("duplicate tracestate key %q", key)
+		}
+		ts.members = append(ts.members, traceMember{key, value})
+	}
+	if len(ts.members) > MaxTraceStateMembers {
+		return TraceState{}, fmt.Errorf("tracestate has %d members, maximum is %d", len(ts.members), MaxTraceStateMembers)
+	}
+	return ts, nil
+}
+
+// checkTraceMember reports whether key and value are a valid tracestate
+// member.
+func checkTraceMember(key, value string) error {
+	if !isTraceKey(key) {
+		return fmt.Errorf("invalid tracestate key %q", key)
+	}
+	if value == "" || len(value) > 256 || strings.HasSuffix(value, " ") {
+		return fmt.Errorf("invalid tracestate value %q", value)
+	}
+	for i := range len(value) {
+		if c := value[i]; c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return fmt.Errorf("invalid tracestate value %q", value)
+		}
+	}
+	return nil
+}
+
+// isTraceKey reports whether key is a valid tracestate key, either a simple
+// key or a multi-tenant key of the form tenant@system.
+func isTraceKey(key string) bool {
+	tenant, system, multi := strings.Cut(key, "@")
+	if !multi {
+		return len(key) <= 256 && isLCAlpha(key, 0) && isTraceKeyChars(key)
+	}
+	return len(tenant) >= 1 && len(tenant) <= 241 && isTraceKeyChars(tenant) &&
+		(isLCAlpha(tenant, 0) || tenant[0] >= '0' && tenant[0] <= '9') &&
+		len(system) >= 1 && len(system) <= 14 && isLCAlpha(system, 0) && isTraceKeyChars(system)
+}
+
+func isLCAlpha(s string, i int) bool { return i < len(s) && s[i] >= 'a' && s[i] <= 'z' }
+
+func isTraceKeyChars(s string) bool {
+	for i := range len(s) {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_', c == '-', c == '*', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Len reports the number of members in ts.
+func (ts TraceState) Len() int { return len(ts.members) }
+
+// Get returns the value of the member of ts with the given key, and reports
+// whether it exists.
+func (ts TraceState) Get(key string) (string, bool) {
+	for _, m := range ts.members {
+		if m.key == key {
+			return m.value, true
+		}
+	}
+	return "", false
+}
+
+// Set returns a copy of ts in which key has the given value, and is the
+// first member, as the specification requires of a member that has been
+// updated. If this would make the number of members exceed
+// [MaxTraceStateMembers], the last member is removed. It reports an error
+// if key or value is invalid.
+func (ts TraceState) Set(key, value string) (TraceState, error) {
+	if err := checkTraceMember(key, value); err != nil {
+		return ts, err
+	}
+	out := make([]traceMember, 0, len(ts.members)+1)
+	out = append(out, traceMember{key, value})
+	for _, m := range ts.members {
+		if m.key != key {
+			out = append(out, m)
+		}
+	}
+	if len(out) > MaxTraceStateMembers {
+		out = out[:MaxTraceStateMembers]
+	}
+	return TraceState{members: out}, nil
+}
+
+// Delete returns a copy of ts without the member with the given key.
+func (ts TraceState) Delete(key string) TraceState {
+	var out []traceMember
+	for _, m := range ts.members {
+		if m.key != key {
+			out = append(out, m)
+		}
+	}
+	return TraceState{members: out}
+}
+
+// String returns the contents of a tracestate header for ts. If the result
+// would be longer than 512 bytes, members are removed from the end until it
+// fits, starting with those longer than 128 bytes, as the specification
+// recommends.
+func (ts TraceState) String() string {
+	ms := ts.members
+	size := func(ms []traceMember) int {
+		n := max(len(ms)-1, 0) // commas
+		for _, m := range ms {
+			n += len(m.key) + 1 + len(m.value)
+		}
+		return n
+	}
+	for i := len(ms) - 1; i >= 0 && size(ms) > maxTraceStateLen; i-- {
+		if len(ms[i].key)+1+len(ms[i].value) > 128 {
+			ms = append(ms[:i:i], ms[i+1:]...)
+		}
+	}
+	for size(ms) > maxTraceStateLen {
+		ms = ms[:len(ms)-1]
+	}
+	ss := make([]string, len(ms))
+	for i, m := range ms {
+		ss[i] = m.key + "=" + m.value
+	}
+	return strings.Join(ss, ",")
+}
+
+type traceKey struct{}
+
+// ContextWithTrace returns a copy of ctx that carries tc.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, tc)
+}
+
+// TraceFromContext returns the trace context carried by ctx, and reports
+// whether there is one.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceKey{}).(TraceContext)
+	return tc, ok
+}
+
+// RequestTrace returns the trace context of r. If r is being handled by a
+// [TraceHandler], it returns the context of the handler's span; otherwise it
+// parses the trace headers of r.
+func RequestTrace(r *http.Request) (TraceContext, bool) {
+	if tc, ok := TraceFromContext(r.Context()); ok {
+		return tc, true
+	}
+	tc, err := ParseTraceHeaders(r.Header)
+	return tc, err == nil
+}
+
+// A TraceHandler is an [http.Handler] that attaches a trace context to each
+// request for an underlying handler, which can read it with
+// [TraceFromContext] or [RequestTrace].
+//
+// If the request has a valid traceparent header, the handler continues that
+// trace in a new span, keeping its flags and trace state. Otherwise it starts
+// a new trace. A [TraceTransport] propagates the context to outgoing
+// requests made with the request context.
+type TraceHandler struct {
+	// Handler is the underlying handler.
+	Handler http.Handler
+
+	// Sample, if non-nil, reports whether a new trace started for a request
+	// should be sampled. If nil, new traces are not sampled.
+	Sample func(*http.Request) bool
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (t TraceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tc, err := ParseTraceHeaders(r.Header)
+	if err == nil {
+		tc = tc.NewSpan()
+	} else {
+		tc = NewTraceContext(t.Sample != nil && t.Sample(r))
+	}
+	t.Handler.ServeHTTP(w, r.WithContext(ContextWithTrace(r.Context(), tc)))
+}
+
+// A TraceTransport is an [http.RoundTripper] that propagates the trace
+// context of each request's context, if it has one, in the traceparent and
+// tracestate headers of the request. The span ID of the context is sent as
+// the parent ID. A request that already has a traceparent header is sent
+// unchanged.
+type TraceTransport struct {
+	// Base is the underlying transport. If nil, [http.DefaultTransport] is used.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements the [http.RoundTripper] interface.
+func (t TraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if tc, ok := TraceFromContext(req.Context()); ok && req.Header.Get("Traceparent") == "" {
+		req = req.Clone(req.Context())
+		tc.SetHeaders(req.Header)
+	}
+	return base.RoundTrip(req)
+}
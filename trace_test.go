@@ -0,0 +1,250 @@
+package mhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/mhttp"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const (
+		tid = "4bf92f3577b34da6a3ce929d0e0e4736"
+		pid = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		input   string
+		want    string // formatted result, or "" for error
+		sampled bool
+	}{
+		{"00-" + tid + "-" + pid + "-01", "00-" + tid + "-" + pid + "-01", true},
+		{" 00-" + tid + "-" + pid + "-00\t", "00-" + tid + "-" + pid + "-00", false},
+
+		// Later versions are parsed as version 00, ignoring extra fields.
+		{"01-" + tid + "-" + pid + "-01", "00-" + tid + "-" + pid + "-01", true},
+		{"cc-" + tid + "-" + pid + "-01-what-the-future-holds", "00-" + tid + "-" + pid + "-01", true},
+
+		// Errors.
+		{"", "", false},
+		{"00-" + tid + "-" + pid + "-01-extra", "", false},
+		{"01-" + tid + "-" + pid + "-01extra", "", false},
+		{"ff-" + tid + "-" + pid + "-01", "", false},
+		{"00-" + strings.ToUpper(tid) + "-" + pid + "-01", "", false},
+		{"00-00000000000000000000000000000000-" + pid + "-01", "", false},
+		{"00-" + tid + "-0000000000000000-01", "", false},
+		{"00-" + tid + "-" + pid + "-0x", "", false},
+		{"00_" + tid + "-" + pid + "-01", "", false},
+		{"0-" + tid + "-" + pid + "-01", "", false},
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseTraceParent(tc.input)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("Parse %q: got %q, want error", tc.input, got.TraceParent())
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if s := got.TraceParent(); s != tc.want {
+			t.Errorf("Parse %q: got %q, want %q", tc.input, s, tc.want)
+		}
+		if got.Flags.Sampled() != tc.sampled {
+			t.Errorf("Parse %q: got sampled %v, want %v", tc.input, got.Flags.Sampled(), tc.sampled)
+		}
+		if s := got.TraceID.String(); s != tid {
+			t.Errorf("Parse %q: got trace ID %q, want %q", tc.input, s, tid)
+		}
+	}
+}
+
+func TestParseTraceState(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // formatted result, or "!" for error
+	}{
+		{"", ""},
+		{"rojo=00f067aa0ba902b7", "rojo=00f067aa0ba902b7"},
+		{"rojo=00f067aa0ba902b7 , congo=t61rcWkgMzE", "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"},
+		{" , a=1,, \t,b=2 ,", "a=1,b=2"},
+		{"t3n@sys-1=x,1tenant@s=y", "t3n@sys-1=x,1tenant@s=y"},
+		{"k=va lue", "k=va lue"},
+
+		{"a=1,a=2", "!"}, // duplicate key
+		{"A=1", "!"},     // upper-case key
+		{"1a=1", "!"},    // simple key must start with a letter
+		{"a@1=1", "!"},   // system must start with a letter
+		{"a@systemnameistoolong=1", "!"},
+		{"a=", "!"},     // empty value
+		{"a", "!"},      // no value
+		{"a=b=c", "!"},  // = in value
+		{"a=\x7f", "!"}, // invalid character
+		{strings.Repeat("a=1,", 10) + "b=1", "!"}, // duplicate keys among many
+	}
+	for _, tc := range tests {
+		got, err := mhttp.ParseTraceState(tc.input)
+		if tc.want == "!" {
+			if err == nil {
+				t.Errorf("Parse %q: got %q, want error", tc.input, got)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if s := got.String(); s != tc.want {
+			t.Errorf("Parse %q: got %q, want %q", tc.input, s, tc.want)
+		}
+	}
+
+	t.Run("TooMany", func(t *testing.T) {
+		var ms []string
+		for i := range mhttp.MaxTraceStateMembers + 1 {
+			ms = append(ms, "k"+strings.Repeat("x", i)+"=v")
+		}
+		if _, err := mhttp.ParseTraceState(strings.Join(ms[:mhttp.MaxTraceStateMembers], ",")); err != nil {
+			t.Errorf("Parse %d members: unexpected error: %v", mhttp.MaxTraceStateMembers, err)
+		}
+		if got, err := mhttp.ParseTraceState(strings.Join(ms, ",")); err == nil {
+			t.Errorf("Parse %d members: got %q, want error", len(ms), got)
+		}
+	})
+}
+
+func TestTraceStateUpdate(t *testing.T) {
+	ts, err := mhttp.ParseTraceState("a=1,b=2,c=3")
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	ts2, err := ts.Set("b", "two")
+	if err != nil {
+		t.Fatalf("Set: unexpected error: %v", err)
+	}
+	if got, want := ts2.String(), "b=two,a=1,c=3"; got != want {
+		t.Errorf("Set existing: got %q, want %q", got, want)
+	}
+	if got, want := ts.String(), "a=1,b=2,c=3"; got != want {
+		t.Errorf("Original after Set: got %q, want %q", got, want)
+	}
+	if v, ok := ts2.Get("b"); !ok || v != "two" {
+		t.Errorf("Get b: got %q, %v; want two, true", v, ok)
+	}
+	if got, want := ts2.Delete("a").String(), "b=two,c=3"; got != want {
+		t.Errorf("Delete: got %q, want %q", got, want)
+	}
+	if _, err := ts.Set("Bad", "x"); err == nil {
+		t.Error("Set invalid key: got nil, want error")
+	}
+
+	// Adding beyond the limit drops the last member.
+	var full mhttp.TraceState
+	for i := range mhttp.MaxTraceStateMembers + 1 {
+		full, err = full.Set("k"+strings.Repeat("x", i), "v")
+		if err != nil {
+			t.Fatalf("Set: unexpected error: %v", err)
+		}
+	}
+	if full.Len() != mhttp.MaxTraceStateMembers {
+		t.Errorf("Len: got %d, want %d", full.Len(), mhttp.MaxTraceStateMembers)
+	}
+	if _, ok := full.Get("k"); ok {
+		t.Error("Oldest member was not dropped")
+	}
+
+	// Formatting drops long members first, then others from the end.
+	long := strings.Repeat("x", 200)
+	ts, err = mhttp.ParseTraceState("a=" + long + ",b=" + long + ",c=" + long + ",d=short")
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if got, want := ts.String(), "a="+long+",b="+long+",d=short"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+}
+
+func TestTraceHandler(t *testing.T) {
+	// The downstream server reports the trace headers it received.
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Got-Traceparent", r.Header.Get("Traceparent"))
+		w.Header().Set("Got-Tracestate", r.Header.Get("Tracestate"))
+	}))
+	defer down.Close()
+	cli := &http.Client{Transport: mhttp.TraceTransport{}}
+
+	var span mhttp.TraceContext
+	h := mhttp.TraceHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tc, ok := mhttp.TraceFromContext(r.Context())
+			if !ok {
+				t.Error("No trace context in request")
+			}
+			span = tc
+			req, _ := http.NewRequestWithContext(r.Context(), "GET", down.URL, nil)
+			rsp, err := cli.Do(req)
+			if err != nil {
+				t.Errorf("Downstream request: %v", err)
+				return
+			}
+			rsp.Body.Close()
+			w.Header().Set("Got-Traceparent", rsp.Header.Get("Got-Traceparent"))
+			w.Header().Set("Got-Tracestate", rsp.Header.Get("Got-Tracestate"))
+		}),
+		Sample: func(*http.Request) bool { return true },
+	}
+
+	t.Run("Continue", func(t *testing.T) {
+		const in = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Traceparent", in)
+		req.Header.Set("Tracestate", "congo=t61rcWkgMzE")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := span.TraceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Trace ID: got %q, want the incoming ID", got)
+		}
+		if got := span.SpanID.String(); got == "00f067aa0ba902b7" {
+			t.Error("Span ID was not replaced")
+		}
+		if span.Flags.Sampled() {
+			t.Error("Incoming unsampled trace became sampled")
+		}
+		if got, want := rec.Header().Get("Got-Traceparent"), span.TraceParent(); got != want {
+			t.Errorf("Downstream traceparent: got %q, want %q", got, want)
+		}
+		if got, want := rec.Header().Get("Got-Tracestate"), "congo=t61rcWkgMzE"; got != want {
+			t.Errorf("Downstream tracestate: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Start", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Traceparent", "invalid")
+		req.Header.Set("Tracestate", "congo=t61rcWkgMzE")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if !span.IsValid() || !span.Flags.Sampled() {
+			t.Errorf("New trace: got %q, want a valid sampled trace", span.TraceParent())
+		}
+		if got, want := rec.Header().Get("Got-Traceparent"), span.TraceParent(); got != want {
+			t.Errorf("Downstream traceparent: got %q, want %q", got, want)
+		}
+		if got := rec.Header().Get("Got-Tracestate"); got != "" {
+			t.Errorf("Downstream tracestate: got %q, want empty", got)
+		}
+	})
+
+	t.Run("Multiple", func(t *testing.T) {
+		h := http.Header{"Traceparent": {
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}}
+		if tc, err := mhttp.ParseTraceHeaders(h); err == nil {
+			t.Errorf("ParseTraceHeaders: got %q, want error", tc.TraceParent())
+		}
+	})
+}